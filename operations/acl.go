@@ -0,0 +1,123 @@
+package operations
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/goamz/goamz/s3"
+	"github.com/mongodb/curator/sthree"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+	"golang.org/x/net/context"
+)
+
+// aclOptions determine the ACLs that the set-acl sub-command applies
+// to existing objects: the ACL of the last rule that matches each key,
+// or for keys that match no rule, the default ACL.
+type aclOptions struct {
+	acl   string
+	rules []string
+}
+
+func newACLOptions(c *cli.Context) aclOptions {
+	return aclOptions{
+		acl:   c.String("acl"),
+		rules: c.StringSlice("acl-rule"),
+	}
+}
+
+// parseRules returns the ACL rules of the options. Returns an error if
+// a rule is not in the "<pattern>=<acl>" form, or is not valid.
+func (opts aclOptions) parseRules() ([]sthree.ACLRule, error) {
+	rules := make([]sthree.ACLRule, 0, len(opts.rules))
+
+	for _, value := range opts.rules {
+		idx := strings.LastIndex(value, "=")
+		if idx <= 0 {
+			return nil, errors.Errorf("acl rule '%s' is not in the form <pattern>=<acl>", value)
+		}
+
+		rule := sthree.ACLRule{Pattern: value[:idx], ACL: s3.ACL(value[idx+1:])}
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, nil
+}
+
+func (opts aclOptions) configure(b *sthree.Bucket) error {
+	if opts.acl == "" && len(opts.rules) == 0 {
+		return errors.New("specify an acl, acl rules, or both")
+	}
+
+	if opts.acl != "" {
+		if err := sthree.ValidateACL(s3.ACL(opts.acl)); err != nil {
+			return err
+		}
+		b.NewFilePermission = s3.ACL(opts.acl)
+	}
+
+	rules, err := opts.parseRules()
+	if err != nil {
+		return err
+	}
+
+	return b.SetACLRules(rules)
+}
+
+func s3aclFlags(args ...cli.Flag) []cli.Flag {
+	flags := []cli.Flag{
+		cli.StringFlag{
+			Name:  "prefix",
+			Usage: "only change the objects with keys that start with this prefix",
+		},
+		cli.StringFlag{
+			Name: "acl",
+			Usage: fmt.Sprintln("the canned acl of the objects (e.g. 'public-read' or 'private'),",
+				"or with --acl-rule, of the objects that match no rule"),
+		},
+		cli.StringSliceFlag{
+			Name: "acl-rule",
+			Usage: fmt.Sprintln("an acl for objects that match a glob pattern, in the form <pattern>=<acl>",
+				"(e.g. '*.rpm=public-read'). may be specified multiple times; the last matching rule applies."),
+		},
+	}
+
+	flags = append(flags, args...)
+	return flags
+}
+
+func s3SetACL(ctx context.Context, opts bucketOptions, prefix string, acl aclOptions,
+	filter filterOptions) error {
+	b, err := resolveBucket(opts)
+	if err != nil {
+		return err
+	}
+
+	if err = acl.configure(b); err != nil {
+		return err
+	}
+
+	if err = filter.configure(b); err != nil {
+		return err
+	}
+
+	err = b.Open(ctx)
+	defer b.Close()
+	if err != nil {
+		return err
+	}
+
+	if opts.dryRun {
+		b, err = b.DryRunClone()
+		defer b.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return b.SetACL(ctx, prefix, "")
+}
@@ -0,0 +1,72 @@
+package operations
+
+import (
+	"io/ioutil"
+	"os"
+
+	"github.com/goamz/goamz/s3"
+	"github.com/mongodb/curator/sthree"
+	"github.com/urfave/cli"
+	"golang.org/x/net/context"
+)
+
+func (s *CommandsSuite) TestACLFlagsFactory() {
+	flags := s3aclFlags()
+	s.Len(flags, 3)
+
+	s.IsType(cli.StringFlag{}, flags[0])
+	s.Equal("prefix", flags[0].GetName())
+	s.IsType(cli.StringFlag{}, flags[1])
+	s.Equal("acl", flags[1].GetName())
+	s.IsType(cli.StringSliceFlag{}, flags[2])
+	s.Equal("acl-rule", flags[2].GetName())
+}
+
+func (s *CommandsSuite) TestACLOptionsParseRules() {
+	opts := aclOptions{rules: []string{"*.rpm=public-read", "a=b/=private"}}
+	rules, err := opts.parseRules()
+	s.NoError(err)
+	s.Equal([]sthree.ACLRule{
+		{Pattern: "*.rpm", ACL: s3.PublicRead},
+		{Pattern: "a=b/", ACL: s3.Private},
+	}, rules)
+
+	for _, rule := range []string{"public-read", "=private", "*.rpm=public", "[*.rpm=private"} {
+		opts.rules = []string{rule}
+		_, err = opts.parseRules()
+		s.Error(err, rule)
+	}
+}
+
+func (s *CommandsSuite) TestACLOptionsConfigureBuckets() {
+	b := sthree.GetBucket("acl-test")
+
+	s.Error(aclOptions{}.configure(b))
+	s.Error(aclOptions{acl: "public"}.configure(b))
+
+	s.NoError(aclOptions{acl: "private", rules: []string{"*.rpm=public-read"}}.configure(b))
+	s.Equal(s3.Private, b.NewFilePermission)
+	s.Len(b.ACLRules(), 1)
+}
+
+func (s *CommandsSuite) TestSetACLOperation() {
+	ctx := context.Background()
+	opts := bucketOptions{name: "acl-test"}
+
+	s.NoError(s3Put(ctx, opts, metadataOptions{}, "acl.go", "acl/acl.go"))
+	s.NoError(s3SetACL(ctx, opts, "acl", aclOptions{acl: "public-read"}, filterOptions{}))
+	s.NoError(s3SetACL(ctx, opts, "acl",
+		aclOptions{acl: "private", rules: []string{"*.go=public-read"}},
+		filterOptions{include: []string{"*.go"}}))
+
+	s.Error(s3SetACL(ctx, opts, "acl", aclOptions{}, filterOptions{}))
+	s.Error(s3SetACL(ctx, opts, "acl", aclOptions{acl: "private"},
+		filterOptions{include: []string{"[*.go"}}))
+
+	dir, err := ioutil.TempDir("", "acl-test")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	opts.localStorage = dir
+	s.Error(s3SetACL(ctx, opts, "acl", aclOptions{acl: "private"}, filterOptions{}))
+}
@@ -5,13 +5,11 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
-	"time"
 
 	"github.com/pkg/errors"
 	"github.com/tychoish/bond"
 	"github.com/tychoish/bond/recall"
 	"github.com/urfave/cli"
-	"golang.org/x/net/context"
 )
 
 // Artifacts returns a command object for the "archives" sub command
@@ -26,28 +24,13 @@ func Artifacts() cli.Command {
 				Name:    "download",
 				Usage:   "downloads builds of MongoDB",
 				Aliases: []string{"dl", "get"},
-				Flags: buildInfoFlags(baseDlFlags(true,
-					cli.StringFlag{
-						Name:  "timeout",
-						Value: "no-timeout",
-						Usage: "maximum duration for operation, defaults to no time out",
-					})...),
+				Flags:   buildInfoFlags(baseDlFlags(true, timeoutFlags()...)...),
 				Action: func(c *cli.Context) error {
-					var cancel context.CancelFunc
-					ctx := context.Background()
-
-					timeout := c.String("timeout")
-					if timeout != "no-timeout" {
-						ttl, err := time.ParseDuration(timeout)
-						if err != nil {
-							return errors.Wrapf(err, "%s is not a valid timeout", timeout)
-						}
-						ctx, cancel = context.WithTimeout(ctx, ttl)
-						defer cancel()
-					} else {
-						ctx, cancel = context.WithCancel(ctx)
-						defer cancel()
+					ctx, cancel, err := operationContext(c.String("timeout"))
+					if err != nil {
+						return err
 					}
+					defer cancel()
 
 					opts := bond.BuildOptions{
 						Target:  c.String("target"),
@@ -56,7 +39,7 @@ func Artifacts() cli.Command {
 						Debug:   c.Bool("debug"),
 					}
 
-					err := recall.FetchReleases(ctx, c.StringSlice("version"), c.String("path"), opts)
+					err = recall.FetchReleases(ctx, c.StringSlice("version"), c.String("path"), opts)
 					if err != nil {
 						return errors.Wrap(err, "problem fetching releases")
 					}
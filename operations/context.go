@@ -0,0 +1,63 @@
+package operations
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tychoish/grip"
+	"github.com/urfave/cli"
+	"golang.org/x/net/context"
+)
+
+// operationContext returns the context for a long-running command,
+// which is canceled when the timeout, if any, expires, or when the
+// process receives an interrupt or termination signal, so that
+// commands can stop in-progress work and report partial progress.
+// The timeout is a duration (e.g. "30m"), or "no-timeout". Callers
+// must call the cancel function when the command returns.
+func operationContext(timeout string) (context.Context, context.CancelFunc, error) {
+	var ctx context.Context
+	var cancel context.CancelFunc
+
+	if timeout != "no-timeout" && timeout != "" {
+		ttl, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "%s is not a valid timeout", timeout)
+		}
+		ctx, cancel = context.WithTimeout(context.Background(), ttl)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+
+	go func() {
+		defer signal.Stop(signals)
+
+		select {
+		case sig := <-signals:
+			grip.Warningf("received %s, canceling operation", sig)
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	return ctx, cancel, nil
+}
+
+func timeoutFlags(args ...cli.Flag) []cli.Flag {
+	flags := []cli.Flag{
+		cli.StringFlag{
+			Name:  "timeout",
+			Value: "no-timeout",
+			Usage: "maximum duration for operation, defaults to no time out",
+		},
+	}
+
+	flags = append(flags, args...)
+	return flags
+}
@@ -0,0 +1,35 @@
+package operations
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+func (s *CommandsSuite) TestTimeoutFlagsFactory() {
+	flags := timeoutFlags()
+	s.Len(flags, 1)
+	s.Equal("timeout", flags[0].GetName())
+}
+
+func (s *CommandsSuite) TestOperationContextTimeouts() {
+	_, _, err := operationContext("soon")
+	s.Error(err)
+
+	ctx, cancel, err := operationContext("no-timeout")
+	s.NoError(err)
+	_, ok := ctx.Deadline()
+	s.False(ok)
+	cancel()
+	s.Equal(context.Canceled, ctx.Err())
+
+	ctx, cancel, err = operationContext("10ms")
+	s.NoError(err)
+	defer cancel()
+	select {
+	case <-ctx.Done():
+		s.Equal(context.DeadlineExceeded, ctx.Err())
+	case <-time.After(time.Second):
+		s.Fail("timeout did not expire")
+	}
+}
@@ -10,6 +10,7 @@ import (
 	"github.com/satori/go.uuid"
 	"github.com/tychoish/grip"
 	"github.com/urfave/cli"
+	"golang.org/x/net/context"
 )
 
 // Index returns the index page rebuilder command line interface.
@@ -29,7 +30,7 @@ func Index() cli.Command {
 	return cli.Command{
 		Name:  "rebuild-index-pages",
 		Usage: "rebuild index.html pages for a bucket.",
-		Flags: []cli.Flag{
+		Flags: s3EndpointFlags(timeoutFlags(
 			cli.StringFlag{
 				Name:  "config",
 				Value: confPath,
@@ -45,6 +46,11 @@ func Index() cli.Command {
 				Usage: "aws profile",
 				Value: profile,
 			},
+			cli.StringFlag{
+				Name: "local-storage",
+				Usage: fmt.Sprintln("use a local directory, containing a directory for each",
+					"bucket, instead of s3"),
+			},
 			cli.BoolFlag{
 				Name: "dry-run",
 				Usage: fmt.Sprintln("task runs in a dry-run mode.",
@@ -65,20 +71,33 @@ func Index() cli.Command {
 				Name:  "edition",
 				Usage: "build edition",
 			},
-		},
+		)...),
 		Action: func(c *cli.Context) error {
+			if err := configureS3Endpoint(c); err != nil {
+				return err
+			}
+
+			ctx, cancel, err := operationContext(c.String("timeout"))
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
 			return rebuildIndexPages(
+				ctx,
 				c.String("config"),
 				c.String("dir"),
 				c.String("name"),
 				c.String("distro"),
 				c.String("edition"),
+				c.String("local-storage"),
 				c.Bool("dry-run"))
 		},
 	}
 }
 
-func rebuildIndexPages(configPath, dir, name, distro, edition string, dryRun bool) error {
+func rebuildIndexPages(ctx context.Context, configPath, dir, name, distro, edition,
+	localStorage string, dryRun bool) error {
 	// get configuration objects.
 	conf, err := repobuilder.GetConfig(configPath)
 	if err != nil {
@@ -93,8 +112,9 @@ func rebuildIndexPages(configPath, dir, name, distro, edition string, dryRun boo
 	}
 
 	j := repobuilder.NewIndexBuildJob(conf, dir, name, repo.Bucket, dryRun)
+	j.LocalStorage = localStorage
 
-	j.Run()
+	j.RunContext(ctx)
 
 	return j.Error()
 }
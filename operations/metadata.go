@@ -0,0 +1,110 @@
+package operations
+
+import (
+	"strings"
+
+	"github.com/mongodb/curator/sthree"
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+// metadataOptions set the headers and user metadata of the object
+// that the put sub-command uploads. The zero value uses the defaults
+// of the bucket.
+type metadataOptions struct {
+	contentType        string
+	cacheControl       string
+	contentEncoding    string
+	contentDisposition string
+	meta               []string
+	sse                bool
+}
+
+func newMetadataOptions(c *cli.Context) metadataOptions {
+	return metadataOptions{
+		contentType:        c.String("content-type"),
+		cacheControl:       c.String("cache-control"),
+		contentEncoding:    c.String("content-encoding"),
+		contentDisposition: c.String("content-disposition"),
+		meta:               c.StringSlice("meta"),
+		sse:                c.Bool("sse"),
+	}
+}
+
+// rule returns a metadata rule, which matches all keys, with the
+// options. Returns an error if a metadata field is not in the
+// "<key>=<value>" form.
+func (opts metadataOptions) rule() (sthree.MetadataRule, error) {
+	rule := sthree.MetadataRule{
+		Pattern:            "*",
+		ContentType:        opts.contentType,
+		CacheControl:       opts.cacheControl,
+		ContentEncoding:    opts.contentEncoding,
+		ContentDisposition: opts.contentDisposition,
+		SSE:                opts.sse,
+	}
+
+	for _, field := range opts.meta {
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 {
+			return rule, errors.Errorf("metadata field '%s' is not in the form <key>=<value>", field)
+		}
+
+		if rule.Meta == nil {
+			rule.Meta = make(map[string]string)
+		}
+		rule.Meta[parts[0]] = parts[1]
+	}
+
+	return rule, rule.Validate()
+}
+
+func (opts metadataOptions) isEmpty() bool {
+	return opts.contentType == "" && opts.cacheControl == "" && opts.contentEncoding == "" &&
+		opts.contentDisposition == "" && len(opts.meta) == 0 && !opts.sse
+}
+
+func (opts metadataOptions) configure(b *sthree.Bucket) error {
+	if opts.isEmpty() {
+		return nil
+	}
+
+	rule, err := opts.rule()
+	if err != nil {
+		return err
+	}
+
+	return b.SetMetadataRules([]sthree.MetadataRule{rule})
+}
+
+func s3metadataFlags(args ...cli.Flag) []cli.Flag {
+	flags := []cli.Flag{
+		cli.StringFlag{
+			Name:  "content-type",
+			Usage: "the content type of the object. defaults to the type for the file's extension.",
+		},
+		cli.StringFlag{
+			Name:  "cache-control",
+			Usage: "the Cache-Control header of the object (e.g. 'max-age=300')",
+		},
+		cli.StringFlag{
+			Name:  "content-encoding",
+			Usage: "the Content-Encoding header of the object (e.g. 'gzip')",
+		},
+		cli.StringFlag{
+			Name:  "content-disposition",
+			Usage: "the Content-Disposition header of the object (e.g. 'attachment')",
+		},
+		cli.StringSliceFlag{
+			Name:  "meta",
+			Usage: "a user metadata field, in the form <key>=<value>. may be specified multiple times.",
+		},
+		cli.BoolFlag{
+			Name:  "sse",
+			Usage: "encrypt the object with server-side encryption",
+		},
+	}
+
+	flags = append(flags, args...)
+	return flags
+}
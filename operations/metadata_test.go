@@ -0,0 +1,86 @@
+package operations
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/mongodb/curator/sthree"
+	"github.com/urfave/cli"
+	"golang.org/x/net/context"
+)
+
+func (s *CommandsSuite) TestMetadataFlagsFactory() {
+	flags := s3metadataFlags()
+	s.Len(flags, 6)
+
+	names := make(map[string]bool)
+	for _, flag := range flags {
+		names[flag.GetName()] = true
+	}
+
+	for _, name := range []string{
+		"content-type",
+		"cache-control",
+		"content-encoding",
+		"content-disposition",
+		"meta",
+		"sse",
+	} {
+		s.True(names[name], name)
+	}
+
+	s.IsType(cli.StringSliceFlag{}, flags[4])
+	s.IsType(cli.BoolFlag{}, flags[5])
+}
+
+func (s *CommandsSuite) TestMetadataOptionsProduceRule() {
+	opts := metadataOptions{
+		cacheControl:       "max-age=60",
+		contentDisposition: "attachment",
+		meta:               []string{"team=build", "note=a=b"},
+		sse:                true,
+	}
+
+	rule, err := opts.rule()
+	s.NoError(err)
+	s.Equal(sthree.MetadataRule{
+		Pattern:            "*",
+		CacheControl:       "max-age=60",
+		ContentDisposition: "attachment",
+		Meta:               map[string]string{"team": "build", "note": "a=b"},
+		SSE:                true,
+	}, rule)
+
+	opts.meta = []string{"no-value"}
+	_, err = opts.rule()
+	s.Error(err)
+
+	opts.meta = []string{"=value"}
+	_, err = opts.rule()
+	s.Error(err)
+}
+
+func (s *CommandsSuite) TestMetadataOptionsConfigureBuckets() {
+	dir, err := ioutil.TempDir("", "metadata-test")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	opts := bucketOptions{name: "metadata-test", localStorage: dir}
+	b, err := resolveBucket(opts)
+	s.Require().NoError(err)
+
+	s.NoError(metadataOptions{}.configure(b))
+	s.Len(b.MetadataRules(), 0)
+
+	s.NoError(metadataOptions{cacheControl: "no-cache"}.configure(b))
+	s.Len(b.MetadataRules(), 1)
+
+	s.NoError(s3Put(context.Background(), opts, metadataOptions{contentType: "text/html"},
+		"metadata.go", "metadata.go"))
+	_, err = os.Stat(filepath.Join(dir, "metadata-test", "metadata.go"))
+	s.NoError(err)
+
+	s.Error(s3Put(context.Background(), opts, metadataOptions{meta: []string{"invalid"}},
+		"metadata.go", "metadata.go"))
+}
@@ -0,0 +1,72 @@
+package operations
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+)
+
+func s3PresignCmd() cli.Command {
+	return cli.Command{
+		Name:  "presign",
+		Usage: "print a pre-signed url that grants access to download or upload an object",
+		Description: "Prints a URL that allows anyone holding it to download the object " +
+			"(\"--method GET\", the default) or to upload it (\"--method PUT\"), " +
+			"without credentials, until the \"--expires\" duration passes (one " +
+			"hour by default, and at most 7 days). URLs signed with temporary " +
+			"credentials, such as those of an assumed role, stop working when " +
+			"the credentials expire.",
+		Flags: baseS3Flags(s3presignFlags()...),
+		Action: func(c *cli.Context) error {
+			return s3Presign(newBucketOptions(c), c.String("name"), c.String("method"), c.String("expires"),
+				os.Stdout)
+		},
+	}
+}
+
+func s3presignFlags(args ...cli.Flag) []cli.Flag {
+	flags := []cli.Flag{
+		cli.StringFlag{
+			Name:  "name",
+			Usage: "the key of the object",
+		},
+		cli.StringFlag{
+			Name:  "method",
+			Usage: "the request that the url allows: GET to download the object, or PUT to upload it",
+			Value: "GET",
+		},
+		cli.StringFlag{
+			Name: "expires",
+			Usage: fmt.Sprintln("the duration after which the url stops working (e.g. '30m' or '72h'),",
+				"at most 7 days (168h)"),
+			Value: "1h",
+		},
+	}
+
+	flags = append(flags, args...)
+	return flags
+}
+
+func s3Presign(opts bucketOptions, key, method, expires string, out io.Writer) error {
+	ttl, err := time.ParseDuration(expires)
+	if err != nil {
+		return errors.Wrapf(err, "'%s' is not a valid expiration", expires)
+	}
+
+	b, err := resolveBucket(opts)
+	if err != nil {
+		return err
+	}
+
+	signed, err := b.SignedURL(key, method, ttl)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(out, signed)
+	return err
+}
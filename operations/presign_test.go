@@ -0,0 +1,65 @@
+package operations
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/urfave/cli"
+)
+
+func (s *CommandsSuite) TestPresignFlagsFactory() {
+	flags := s3presignFlags()
+	s.Len(flags, 3)
+
+	for idx, name := range []string{"name", "method", "expires"} {
+		s.IsType(cli.StringFlag{}, flags[idx])
+		s.Equal(name, flags[idx].GetName())
+	}
+
+	s.Equal("GET", flags[1].(cli.StringFlag).Value)
+	s.Equal("1h", flags[2].(cli.StringFlag).Value)
+}
+
+func (s *CommandsSuite) TestPresignOperation() {
+	opts := bucketOptions{name: "presign-test"}
+
+	out := &bytes.Buffer{}
+	s.Require().NoError(s3Presign(opts, "presign/file.txt", "put", "30m", out))
+	put := strings.TrimSpace(out.String())
+
+	u, err := url.Parse(put)
+	s.Require().NoError(err)
+	s.Equal("1800", u.Query().Get("X-Amz-Expires"))
+
+	req, err := http.NewRequest("PUT", put, strings.NewReader("presigned"))
+	s.Require().NoError(err)
+	resp, err := http.DefaultClient.Do(req)
+	s.Require().NoError(err)
+	s.NoError(resp.Body.Close())
+	s.Equal(http.StatusOK, resp.StatusCode)
+
+	out.Reset()
+	s.Require().NoError(s3Presign(opts, "presign/file.txt", "GET", "1h", out))
+	resp, err = http.Get(strings.TrimSpace(out.String()))
+	s.Require().NoError(err)
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	s.NoError(err)
+	s.Equal("presigned", string(data))
+
+	s.Error(s3Presign(opts, "presign/file.txt", "GET", "soon", out))
+	s.Error(s3Presign(opts, "presign/file.txt", "GET", "169h", out))
+	s.Error(s3Presign(opts, "presign/file.txt", "DELETE", "1h", out))
+	s.Error(s3Presign(opts, "", "GET", "1h", out))
+
+	dir, err := ioutil.TempDir("", "presign-test")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	opts.localStorage = dir
+	s.Error(s3Presign(opts, "presign/file.txt", "GET", "1h", out))
+}
@@ -0,0 +1,104 @@
+package operations
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mongodb/curator/sthree"
+	"github.com/tychoish/grip"
+	"github.com/urfave/cli"
+)
+
+// progressOptions determine whether and how often sync operations
+// display their progress: as a progress line on standard error, when
+// it is a terminal, and otherwise as log messages.
+type progressOptions struct {
+	enabled  bool
+	interval time.Duration
+}
+
+func newProgressOptions(c *cli.Context) progressOptions {
+	return progressOptions{
+		enabled:  c.Bool("progress"),
+		interval: c.Duration("progress-interval"),
+	}
+}
+
+func (opts progressOptions) configure(b *sthree.Bucket) {
+	if !opts.enabled {
+		b.SetProgressHandler(0, nil)
+		return
+	}
+
+	if isTerminal(os.Stderr) {
+		if opts.interval == 0 {
+			opts.interval = time.Second
+		}
+
+		b.SetProgressHandler(opts.interval, progressLine(os.Stderr))
+		return
+	}
+
+	if opts.interval == 0 {
+		opts.interval = 30 * time.Second
+	}
+
+	b.SetProgressHandler(opts.interval, logProgress)
+}
+
+// isTerminal returns true if the file is a character device, such as
+// a terminal, rather than a file or a pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// progressLine returns a progress handler that rewrites a single line
+// of the output with each update, and ends the line when the
+// operation completes.
+func progressLine(out io.Writer) sthree.ProgressHandler {
+	var width int
+
+	return func(p sthree.SyncProgress) {
+		line := p.String()
+
+		padding := width - len(line)
+		if padding < 0 {
+			padding = 0
+		}
+		width = len(line)
+
+		fmt.Fprintf(out, "\r%s%s", line, strings.Repeat(" ", padding))
+		if p.Done {
+			fmt.Fprintln(out)
+		}
+	}
+}
+
+func logProgress(p sthree.SyncProgress) {
+	grip.Info(p.String())
+}
+
+func s3progressFlags(args ...cli.Flag) []cli.Flag {
+	flags := []cli.Flag{
+		cli.BoolFlag{
+			Name:  "progress",
+			Usage: "display the progress of the operation",
+		},
+		cli.DurationFlag{
+			Name: "progress-interval",
+			Usage: fmt.Sprintln("how often to display progress. defaults to every second on",
+				"a terminal, and every 30 seconds in logs."),
+		},
+	}
+
+	flags = append(flags, args...)
+	return flags
+}
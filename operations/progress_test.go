@@ -0,0 +1,60 @@
+package operations
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mongodb/curator/sthree"
+	"github.com/urfave/cli"
+	"golang.org/x/net/context"
+)
+
+func (s *CommandsSuite) TestProgressFlagsFactory() {
+	flags := s3progressFlags()
+	s.Len(flags, 2)
+
+	s.IsType(cli.BoolFlag{}, flags[0])
+	s.Equal("progress", flags[0].GetName())
+	s.IsType(cli.DurationFlag{}, flags[1])
+	s.Equal("progress-interval", flags[1].GetName())
+}
+
+func (s *CommandsSuite) TestProgressLineRewritesLine() {
+	out := &bytes.Buffer{}
+	handler := progressLine(out)
+
+	p := sthree.SyncProgress{Operation: "push", Bucket: "bucket", Prefix: "a-long-prefix", Queued: 2}
+	handler(p)
+	s.Equal("\r"+p.String(), out.String())
+	s.False(strings.HasSuffix(out.String(), "\n"))
+
+	out.Reset()
+	p.Prefix = "p"
+	p.Completed = 2
+	p.Done = true
+	handler(p)
+	s.True(strings.HasPrefix(out.String(), "\r"+p.String()+"            "))
+	s.True(strings.HasSuffix(out.String(), "\n"))
+}
+
+func (s *CommandsSuite) TestSyncWithProgress() {
+	dir, err := ioutil.TempDir("", "progress-test")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, "local")
+	s.Require().NoError(os.MkdirAll(local, 0755))
+	s.Require().NoError(ioutil.WriteFile(filepath.Join(local, "a.deb"), []byte("deb"), 0644))
+
+	opts := bucketOptions{name: "progress-test", localStorage: dir}
+	sync := syncOptions{progress: progressOptions{enabled: true, interval: time.Millisecond}}
+	s.NoError(s3SyncTo(context.Background(), opts, local, "repo", sync, false))
+	s.NoError(s3SyncFrom(context.Background(), opts, filepath.Join(dir, "copy"), "repo", sync, false))
+
+	_, err = os.Stat(filepath.Join(dir, "copy", "a.deb"))
+	s.NoError(err)
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/satori/go.uuid"
 	"github.com/tychoish/grip"
 	"github.com/urfave/cli"
+	"golang.org/x/net/context"
 )
 
 // Repo returns a cli.Command object for the repo building and
@@ -21,7 +22,18 @@ func Repo() cli.Command {
 		Usage: "build repository",
 		Flags: repoFlags(),
 		Action: func(c *cli.Context) error {
+			if err := configureS3Endpoint(c); err != nil {
+				return err
+			}
+
+			ctx, cancel, err := operationContext(c.String("timeout"))
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
 			return buildRepo(
+				ctx,
 				c.String("packages"),
 				c.String("config"),
 				c.String("dir"),
@@ -30,8 +42,13 @@ func Repo() cli.Command {
 				c.String("version"),
 				c.String("arch"),
 				c.String("profile"),
+				c.String("local-storage"),
 				c.Bool("dry-run"),
-				c.Bool("rebuild"))
+				c.Bool("rebuild"),
+				c.Bool("resume"),
+				c.Bool("checksum-cache"),
+				newReportOptions(c),
+				newTransferOptions(c))
 		},
 	}
 }
@@ -49,7 +66,11 @@ func repoFlags() []cli.Flag {
 	grip.CatchEmergencyFatal(err)
 	workingDir := filepath.Join(pwd, uuid.NewV4().String())
 
-	return []cli.Flag{
+	flags := s3EndpointFlags()
+	flags = append(flags, s3transferFlags()...)
+	flags = append(flags, s3reportFlags()...)
+	flags = append(flags, timeoutFlags()...)
+	flags = append(flags,
 		cli.StringFlag{
 			Name:  "config",
 			Value: confPath,
@@ -85,6 +106,11 @@ func repoFlags() []cli.Flag {
 			Usage: "aws profile",
 			Value: profile,
 		},
+		cli.StringFlag{
+			Name: "local-storage",
+			Usage: fmt.Sprintln("publish to a local directory, containing a directory for each",
+				"bucket, instead of s3"),
+		},
 		cli.BoolFlag{
 			Name:  "dry-run",
 			Usage: "make task operate in a dry-run mode",
@@ -93,7 +119,18 @@ func repoFlags() []cli.Flag {
 			Name:  "rebuild",
 			Usage: "rebuild a repository without adding any new packages",
 		},
-	}
+		cli.BoolFlag{
+			Name: "resume",
+			Usage: fmt.Sprintln("resume the syncs of an interrupted build from their journals",
+				"in the workspace; requires the same --dir for each build"),
+		},
+		cli.BoolFlag{
+			Name: "checksum-cache",
+			Usage: fmt.Sprintln("store checksums of the repository files in the workspace,",
+				"and only hash files that changed since the last build"),
+		},
+	)
+	return flags
 }
 
 func getPackages(rootPath, suffix string) ([]string, error) {
@@ -122,12 +159,23 @@ func getPackages(rootPath, suffix string) ([]string, error) {
 	return output, err
 }
 
-func buildRepo(packages, configPath, workingDir, distro, edition, version, arch, profile string, dryRun, rebuild bool) error {
+func buildRepo(ctx context.Context, packages, configPath, workingDir, distro, edition, version,
+	arch, profile, localStorage string, dryRun, rebuild, resume, checksumCache bool,
+	report reportOptions, transfer transferOptions) error {
 	// validate inputs
 	if edition == "community" {
 		edition = "org"
 	}
 
+	if err := report.validate(); err != nil {
+		return err
+	}
+
+	bandwidthLimit, err := transfer.bytesPerSecond()
+	if err != nil {
+		return err
+	}
+
 	// get configuration objects.
 	conf, err := repobuilder.GetConfig(configPath)
 	if err != nil {
@@ -160,9 +208,16 @@ func buildRepo(packages, configPath, workingDir, distro, edition, version, arch,
 		return errors.Wrap(err, "problem constructing task for building repository")
 	}
 	job.WorkSpace = workingDir
+	job.LocalStorage = localStorage
 	job.DryRun = dryRun
+	job.BandwidthLimit = bandwidthLimit
+	job.MaxRequests = transfer.maxRequests
+	job.Resume = resume
+	job.ChecksumCache = checksumCache
+
+	job.RunContext(ctx)
+	grip.CatchError(report.writeAll(job.SyncReports))
 
-	job.Run()
 	err = job.Error()
 	if err != nil {
 		return errors.Wrap(err, "encountered error rebuilding repository")
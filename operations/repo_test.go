@@ -6,6 +6,7 @@ import (
 
 	"github.com/tychoish/grip"
 	"github.com/urfave/cli"
+	"golang.org/x/net/context"
 )
 
 func (s *CommandsSuite) TestRepoFlags() {
@@ -16,15 +17,18 @@ func (s *CommandsSuite) TestRepoFlags() {
 		names[flag.GetName()] = true
 
 		name := flag.GetName()
-		if name == "dry-run" || name == "rebuild" {
+		if name == "dry-run" || name == "rebuild" || name == "resume" ||
+			name == "checksum-cache" || name == "path-style" {
 			s.IsType(cli.BoolFlag{}, flag)
+		} else if name == "max-requests" {
+			s.IsType(cli.IntFlag{}, flag)
 		} else {
 			s.IsType(cli.StringFlag{}, flag)
 		}
 	}
 
-	s.Len(names, 10)
-	s.Len(flags, 10)
+	s.Len(names, 21)
+	s.Len(flags, 21)
 	s.True(names["config"])
 	s.True(names["distro"])
 	s.True(names["version"])
@@ -32,14 +36,22 @@ func (s *CommandsSuite) TestRepoFlags() {
 	s.True(names["arch"])
 	s.True(names["packages"])
 	s.True(names["profile"])
+	s.True(names["local-storage"])
 	s.True(names["dry-run"])
+	s.True(names["resume"])
+	s.True(names["checksum-cache"])
+	s.True(names["report"])
+	s.True(names["timeout"])
+	s.True(names["bwlimit"])
+	s.True(names["max-requests"])
 }
 
 func (s *CommandsSuite) TestRebuildOperationOnProcess() {
 	err := os.Setenv("NOTARY_TOKEN", "foo")
 	s.NoError(err)
 	err = buildRepo(
-		"./", // packages
+		context.Background(),              // context
+		"./",                              // packages
 		"../repobuilder/config_test.yaml", // repo config path
 		"../build/repo-build-test",        // workingdir
 		"rhel7",                           // distro
@@ -47,8 +59,13 @@ func (s *CommandsSuite) TestRebuildOperationOnProcess() {
 		"2.8.0",                           // mongodbe version
 		"x86_64",                          // arch
 		"default",                         // aws profile
+		"",                                // local storage
 		true,                              // dryrun
-		true)                              // rebuild
+		true,                              // rebuild
+		false,                             // resume
+		false,                             // checksum cache
+		reportOptions{},                   // report
+		transferOptions{})                 // transfer limits
 
 	// TODO: we should be able to get a dry run that passes on
 	// tests machines, but at the moment this depends on the
@@ -63,7 +80,8 @@ func (s *CommandsSuite) TestRebuildOperationOnProcess() {
 
 func (s *CommandsSuite) TestDryRunOperationOnProcess() {
 	err := buildRepo(
-		"./", // packages
+		context.Background(),              // context
+		"./",                              // packages
 		"../repobuilder/config_test.yaml", // repo config path
 		"../build/repo-build-test",        // workingdir
 		"rhel7",                           // distro
@@ -71,8 +89,13 @@ func (s *CommandsSuite) TestDryRunOperationOnProcess() {
 		"2.8.0",                           // mongodbe version
 		"x86_64",                          // arch
 		"default",                         // aws profile
+		"",                                // local storage
 		true,                              // dryrun
-		false)                             // rebuild
+		false,                             // rebuild
+		false,                             // resume
+		false,                             // checksum cache
+		reportOptions{},                   // report
+		transferOptions{})                 // transfer limits
 
 	if !s.Equal(err.Error(), "problem finding packages: no '.rpm' packages found in path './'") {
 		grip.Error(err)
@@ -0,0 +1,176 @@
+package operations
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mongodb/curator/sthree"
+	"github.com/pkg/errors"
+	"github.com/tychoish/grip"
+	"github.com/urfave/cli"
+	"golang.org/x/net/context"
+)
+
+// retentionOptions determine the retention policy of the expire
+// sub-command.
+type retentionOptions struct {
+	maxAge     string
+	keepNewest int
+	groupBy    string
+	maxSize    string
+}
+
+func newRetentionOptions(c *cli.Context) retentionOptions {
+	return retentionOptions{
+		maxAge:     c.String("max-age"),
+		keepNewest: c.Int("keep"),
+		groupBy:    c.String("group-by"),
+		maxSize:    c.String("max-size"),
+	}
+}
+
+// policy returns the retention policy of the options. Returns an error
+// if a value is not valid, or if the policy is not.
+func (opts retentionOptions) policy() (sthree.RetentionPolicy, error) {
+	policy := sthree.RetentionPolicy{
+		KeepNewest: opts.keepNewest,
+		GroupBy:    opts.groupBy,
+	}
+
+	var err error
+	if policy.MaxAge, err = parseAge(opts.maxAge); err != nil {
+		return policy, err
+	}
+
+	if policy.MaxSize, err = parseSize(opts.maxSize); err != nil {
+		return policy, err
+	}
+
+	return policy, policy.Validate()
+}
+
+// parseAge parses a duration, which may also be a number of days with
+// a "d" suffix (e.g. "90d".) An empty string is 0.
+func parseAge(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(value, "d"))
+		if err != nil || days < 0 {
+			return 0, errors.Errorf("'%s' is not a valid number of days", value)
+		}
+
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return 0, errors.Errorf("'%s' is not a valid age", value)
+	}
+
+	return age, nil
+}
+
+func s3ExpireCmd() cli.Command {
+	return cli.Command{
+		Name:  "expire",
+		Usage: "delete the objects with a prefix that a retention policy does not keep",
+		Description: "Deletes the objects with the prefix that are last modified longer " +
+			"ago than \"--max-age\" (e.g. \"36h\" or \"90d\"), that are not among the " +
+			"\"--keep <int>\" newest objects, or that are the oldest objects " +
+			"beyond a total size of \"--max-size\" (e.g. \"20G\"). An object is " +
+			"deleted if any rule selects it.\n\n" +
+			"With \"--group-by <regex>\", \"--keep\" applies to each group of " +
+			"objects with names, relative to the prefix, that have the same " +
+			"submatches of the expression, so \"--keep 14 --group-by " +
+			"'^([^/]+)/'\" keeps the 14 newest objects in each directory. " +
+			"Objects that do not match are not subject to \"--keep\". The report " +
+			"records the rule that selected each deleted object.",
+		Flags: baseS3Flags(s3retentionFlags(s3filterFlags(s3reportFlags()...)...)...),
+		Action: func(c *cli.Context) error {
+			ctx, cancel, err := operationContext(c.String("timeout"))
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
+			return s3Expire(ctx, newBucketOptions(c), c.String("prefix"), newRetentionOptions(c),
+				newFilterOptions(c), newReportOptions(c))
+		},
+	}
+}
+
+func s3retentionFlags(args ...cli.Flag) []cli.Flag {
+	flags := []cli.Flag{
+		cli.StringFlag{
+			Name:  "prefix",
+			Usage: "only consider the objects with keys that start with this prefix",
+		},
+		cli.StringFlag{
+			Name:  "max-age",
+			Usage: "delete objects last modified longer ago than this duration (e.g. '36h' or '90d')",
+		},
+		cli.IntFlag{
+			Name:  "keep",
+			Usage: "delete all but this number of the newest objects, in each group with --group-by",
+		},
+		cli.StringFlag{
+			Name: "group-by",
+			Usage: fmt.Sprintln("a regular expression that groups objects for --keep by its submatches",
+				"(e.g. '^([^/]+)/' to keep the newest objects in each directory)"),
+		},
+		cli.StringFlag{
+			Name:  "max-size",
+			Usage: "delete the oldest objects until the rest total at most this size (e.g. '500M' or '20G')",
+		},
+	}
+
+	flags = append(flags, args...)
+	return flags
+}
+
+func s3Expire(ctx context.Context, opts bucketOptions, prefix string, retention retentionOptions,
+	filter filterOptions, reportOpts reportOptions) error {
+	if err := reportOpts.validate(); err != nil {
+		return err
+	}
+
+	policy, err := retention.policy()
+	if err != nil {
+		return err
+	}
+
+	b, err := resolveBucket(opts)
+	if err != nil {
+		return err
+	}
+
+	if err = filter.configure(b); err != nil {
+		return err
+	}
+
+	err = b.Open(ctx)
+	defer b.Close()
+	if err != nil {
+		return err
+	}
+
+	if opts.dryRun {
+		b, err = b.DryRunClone()
+		defer b.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	report, err := b.Expire(ctx, prefix, policy)
+	if report != nil {
+		grip.CatchError(reportOpts.write(report))
+	}
+
+	return err
+}
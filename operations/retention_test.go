@@ -0,0 +1,104 @@
+package operations
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mongodb/curator/sthree"
+	"github.com/urfave/cli"
+	"golang.org/x/net/context"
+)
+
+func (s *CommandsSuite) TestRetentionFlagsFactory() {
+	flags := s3retentionFlags()
+	s.Len(flags, 5)
+
+	for idx, name := range []string{"prefix", "max-age", "keep", "group-by", "max-size"} {
+		s.Equal(name, flags[idx].GetName())
+	}
+	s.IsType(cli.IntFlag{}, flags[2])
+
+	names := make(map[string]bool)
+	for _, flag := range s3ExpireCmd().Flags {
+		names[flag.GetName()] = true
+	}
+	s.True(names["include"])
+	s.True(names["report"])
+	s.True(names["dry-run"])
+}
+
+func (s *CommandsSuite) TestRetentionOptions() {
+	opts := retentionOptions{maxAge: "90d", keepNewest: 14, groupBy: "^([^/]+)/", maxSize: "2G"}
+	policy, err := opts.policy()
+	s.NoError(err)
+	s.Equal(90*24*time.Hour, policy.MaxAge)
+	s.Equal(14, policy.KeepNewest)
+	s.Equal("^([^/]+)/", policy.GroupBy)
+	s.Equal(int64(2<<30), policy.MaxSize)
+
+	policy, err = retentionOptions{maxAge: "36h"}.policy()
+	s.NoError(err)
+	s.Equal(36*time.Hour, policy.MaxAge)
+
+	for _, opts := range []retentionOptions{
+		{},
+		{maxAge: "soon"},
+		{maxAge: "-3d"},
+		{maxSize: "big"},
+		{groupBy: "^([^/]+)/"},
+		{keepNewest: 3, groupBy: "[builds"},
+	} {
+		_, err = opts.policy()
+		s.Error(err, "%+v", opts)
+	}
+}
+
+func (s *CommandsSuite) TestExpireOperation() {
+	ctx := context.Background()
+	opts := bucketOptions{name: "expire-test"}
+
+	for _, name := range []string{"1", "2", "3"} {
+		s.Require().NoError(s3Put(ctx, opts, metadataOptions{}, "retention.go",
+			"expire/"+name+"/retention.go"))
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	dir, err := ioutil.TempDir("", "expire-test")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	// a dry run plans to delete the oldest object, and does not
+	// change the bucket.
+	fileName := filepath.Join(dir, "plan.json")
+	opts.dryRun = true
+	s.NoError(s3Expire(ctx, opts, "expire/", retentionOptions{keepNewest: 2}, filterOptions{},
+		reportOptions{format: "json", fileName: fileName}))
+
+	data, err := ioutil.ReadFile(fileName)
+	s.Require().NoError(err)
+	report := &sthree.SyncReport{}
+	s.Require().NoError(json.Unmarshal(data, report))
+	s.Equal("expire", report.Operation)
+	s.True(report.DryRun)
+	s.Require().Len(report.Items, 3)
+	s.Equal(sthree.SyncDelete, report.Items[0].Action)
+	s.Equal("count", report.Items[0].Reason)
+	s.Equal(sthree.SyncKeep, report.Items[2].Action)
+
+	opts.dryRun = false
+	s.NoError(s3Expire(ctx, opts, "expire/", retentionOptions{keepNewest: 1}, filterOptions{},
+		reportOptions{}))
+	listing, err := sthree.GetBucket("expire-test").List(ctx, "expire/", true)
+	s.Require().NoError(err)
+	s.Require().Len(listing.Objects, 1)
+	s.Equal("expire/3/retention.go", listing.Objects[0].Key)
+
+	s.Error(s3Expire(ctx, opts, "expire/", retentionOptions{}, filterOptions{}, reportOptions{}))
+	s.Error(s3Expire(ctx, opts, "expire/", retentionOptions{keepNewest: 1}, filterOptions{},
+		reportOptions{format: "yaml"}))
+	s.Error(s3Expire(ctx, opts, "expire/", retentionOptions{keepNewest: 1},
+		filterOptions{include: []string{"[*.go"}}, reportOptions{}))
+}
@@ -8,7 +8,7 @@ sub-command, for example:
 
    curator s3 sync-to --jobs <int> --bucket <bucket> --local <path> --prefix <remote>
    curator s3 sync-from --jobs <int> --bucket <bucket> --local <path> --prefix <remote>
-   curator s3 delete --bucket <bucket> --name <remote> <, --name <remote>...>
+   curator s3 delete --bucket <bucket> --name <remote> <, --name <remote>...> [--report json]
    curator s3 delete-prefix --bucket <bucket> --prefix <remote>
    curator s3 put --bucket <bucket> --file <local> --name <remote>
    curator s3 get --bucket <bucket> --file <local> --name <remote>
@@ -21,31 +21,41 @@ name) to the local file name within the bucket. The prefix need not
 end with a "/", though the prefix and filename will be combined with a
 "/" character.
 
-Sync operations first compare file names and then compare MD5
-checksums, and upload only differing content. Unlike rsync, file sizes
-and timestamps are *not* considered. Also there is no "delete" or
-"mirror" operation.
-
 Put and get operations perform simple copy operations. You can specify
 long path names, with prefix/directories in the remote name.
 
+Run "curator s3 <command> --help" for the details and options of each
+operation.
+
 By default curator attempts to read AWS credentials from the
 "AWS_ACCESS_KEY" and "AWS_SECRET_KEY" environment variables (if set),
 or the standard "$HOME/.aws/credentials" file or a file specified in
 the "AWS_CREDNETIAL_FILE" environment variable. By default curator
 reads the "default" profile from the credentials file, but you can
 specify a different profile using the "AWS_PROFILE" environment
-variable.
+variable, or the "--profile" option. Profiles may assume roles or run
+credential processes. Without credentials in the environment or the
+credentials file, curator uses the credentials of the ECS task or EC2
+instance.
 */
 
 package operations
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
 
 	"github.com/mongodb/curator/sthree"
+	"github.com/pkg/errors"
+	"github.com/tychoish/grip"
 	"github.com/urfave/cli"
+	"golang.org/x/net/context"
 )
 
 // S3 returns a cli.Command object for the S3 command group which has a
@@ -63,6 +73,16 @@ func S3() cli.Command {
 			s3DeleteMatchingCmd(),
 			s3SyncToCmd(),
 			s3SyncFromCmd(),
+			s3CopyCmd(),
+			s3SyncBucketCmd(),
+			s3ListCmd(),
+			s3DiskUsageCmd(),
+			s3SetACLCmd(),
+			s3VersionsCmd(),
+			s3RestoreCmd(),
+			s3UndeleteCmd(),
+			s3PresignCmd(),
+			s3ExpireCmd(),
 		},
 	}
 
@@ -78,9 +98,22 @@ func s3PutCmd() cli.Command {
 	return cli.Command{
 		Name:  "put",
 		Usage: "put a local file object into s3",
-		Flags: baseS3Flags(s3opFlags()...),
+		Description: "Uploads a single file. Uploads set the content type of the object " +
+			"from the extension of the file, unless you specify " +
+			"\"--content-type\". The \"--cache-control\", \"--content-encoding\", and " +
+			"\"--content-disposition\" options set the corresponding headers of " +
+			"the object, and \"--meta <key>=<value>\", which you can repeat, sets " +
+			"user metadata. Files larger than the \"--multipart-threshold\" " +
+			"upload in parts, in parallel.",
+		Flags: baseS3Flags(s3metadataFlags(s3opFlags()...)...),
 		Action: func(c *cli.Context) error {
-			return s3Put(c.String("bucket"), c.String("profile"), c.String("file"), c.String("name"))
+			ctx, cancel, err := operationContext(c.String("timeout"))
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
+			return s3Put(ctx, newBucketOptions(c), newMetadataOptions(c), c.String("file"), c.String("name"))
 		},
 	}
 }
@@ -89,9 +122,17 @@ func s3GetCmd() cli.Command {
 	return cli.Command{
 		Name:  "get",
 		Usage: "download a local file object from s3",
+		Description: "Downloads a single object to the local file, and sets the " +
+			"modification time of the file from the metadata of the object.",
 		Flags: baseS3Flags(s3opFlags()...),
 		Action: func(c *cli.Context) error {
-			return s3Get(c.String("bucket"), c.String("profile"), c.String("name"), c.String("file"))
+			ctx, cancel, err := operationContext(c.String("timeout"))
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
+			return s3Get(ctx, newBucketOptions(c), c.String("name"), c.String("file"))
 		},
 	}
 }
@@ -100,9 +141,21 @@ func s3DeleteCmd() cli.Command {
 	return cli.Command{
 		Name:    "delete",
 		Aliases: []string{"del", "rm"},
-		Flags:   baseS3Flags(s3deleteFlags()...),
+		Usage:   "delete objects by name",
+		Description: "Checks that each named object exists with a HEAD request, rather " +
+			"than listing the bucket, and deletes the objects in batches of up " +
+			"to 1000 keys per request. With \"--report json\", writes the result " +
+			"for each key (delete, skip-missing, or failed), including the " +
+			"errors that S3 reports for individual keys of a batch.",
+		Flags: baseS3Flags(s3deleteFlags(s3reportFlags()...)...),
 		Action: func(c *cli.Context) error {
-			return s3Delete(c.String("bucket"), c.String("profile"), c.Bool("dry-run"), c.StringSlice("name")...)
+			ctx, cancel, err := operationContext(c.String("timeout"))
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
+			return s3Delete(ctx, newBucketOptions(c), newReportOptions(c), c.StringSlice("name")...)
 		},
 	}
 }
@@ -111,13 +164,44 @@ func s3DeletePrefixCmd() cli.Command {
 	return cli.Command{
 		Name:    "delete-prefix",
 		Aliases: []string{"del-prefix", "rm-prefix"},
-		Flags:   s3deleteFlags(s3syncFlags()...),
+		Usage:   "delete the objects with a prefix",
+		Description: "Deletes all objects with the prefix, or with include and exclude " +
+			"filters, only the objects with names, relative to the prefix, that " +
+			"the filters select.",
+		Flags: baseS3Flags(s3deleteFlags(s3syncFlags(s3filterFlags()...)...)...),
 		Action: func(c *cli.Context) error {
-			return s3DeletePrefix(
-				c.String("bucket"),
-				c.String("profile"),
-				c.Bool("dry-run"),
-				c.String("prefix"))
+			ctx, cancel, err := operationContext(c.String("timeout"))
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
+			return s3DeletePrefix(ctx, newBucketOptions(c), c.String("prefix"), newFilterOptions(c))
+		},
+	}
+}
+
+func s3SetACLCmd() cli.Command {
+	return cli.Command{
+		Name:  "set-acl",
+		Usage: "change the acls of existing objects with a prefix",
+		Description: "Changes the canned ACL (e.g. \"public-read\" or \"private\") of the " +
+			"existing objects with the prefix: to the value of \"--acl\", or with " +
+			"\"--acl-rule <pattern>=<acl>\", which you can repeat, to the ACL of " +
+			"the last rule with a glob pattern that matches the key. Keys that " +
+			"match no rule get the value of \"--acl\". Use set-acl to correct the " +
+			"ACLs of files uploaded before a change to the ACL rules of a " +
+			"repository.",
+		Flags: baseS3Flags(s3aclFlags(s3filterFlags()...)...),
+		Action: func(c *cli.Context) error {
+			ctx, cancel, err := operationContext(c.String("timeout"))
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
+			return s3SetACL(ctx, newBucketOptions(c), c.String("prefix"), newACLOptions(c),
+				newFilterOptions(c))
 		},
 	}
 }
@@ -133,30 +217,79 @@ func s3DeleteMatchingCmd() cli.Command {
 					Usage: "a regular expression definition",
 				})...)...),
 		Action: func(c *cli.Context) error {
+			ctx, cancel, err := operationContext(c.String("timeout"))
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
 			return s3DeleteMatching(
-				c.String("bucket"),
-				c.String("profile"),
-				c.Bool("dry-run"),
+				ctx,
+				newBucketOptions(c),
 				c.String("prefix"),
 				c.String("match"))
 		},
 	}
 }
 
+// syncDescription describes the options that the sync-to and
+// sync-from commands share.
+const syncDescription = "The \"--compare\" option determines how sync operations compare " +
+	"files that exist on both sides: \"checksum\" compares MD5 checksums " +
+	"(the default), \"size-mtime\" compares sizes and modification times, " +
+	"like rsync, \"size\" compares sizes only, and \"always\" transfers all " +
+	"files. Uploads store the modification time of each file in the " +
+	"object's metadata, and downloads set the modification time of each " +
+	"file from this metadata, so that size-mtime comparisons work " +
+	"across machines.\n\n" +
+	"With \"--checksum-cache\", checksum comparisons store the checksums " +
+	"of local files in a \".curator-checksums.json\" file in the local " +
+	"directory, and only hash files that changed since the previous " +
+	"sync. With \"--resume\", sync operations record the files that they " +
+	"transfer in a \".curator-sync-journal-<push|pull>.jsonl\" file in " +
+	"the local directory, and running the same sync again after a " +
+	"failure skips the files that the interrupted sync transferred. " +
+	"Sync operations never upload these files.\n\n" +
+	"The include and exclude filters, which you can repeat, match names " +
+	"relative to the local directory or the prefix. Glob patterns " +
+	"without a \"/\", such as \"*.html\", match any element of the name, " +
+	"and patterns with a trailing \"/\", such as \"repodata/\", match " +
+	"everything in matching directories. When there are include " +
+	"filters, operations only consider names that match at least one of " +
+	"them, and names that match any exclude filter are always skipped.\n\n" +
+	"With \"--report json\", the operation writes the action for each " +
+	"file (upload, download, skip-identical, delete, or failed), with " +
+	"the bytes transferred and the duration, to standard output or to " +
+	"the \"--report-file\". With \"--dry-run\", the report is the plan of " +
+	"the operation. With \"--progress\", the operation displays the " +
+	"number of files processed, the bytes transferred, and an estimate " +
+	"of the remaining time."
+
 func s3SyncToCmd() cli.Command {
 	return cli.Command{
 		Name:    "sync-to",
 		Aliases: []string{"push"},
 		Usage:   "sync changes from the local system to s3",
-		Flags:   baseS3Flags(s3syncFlags()...),
+		Description: "Uploads the files in the local directory that do not exist in the " +
+			"bucket, or that differ from the objects, to keys that begin with " +
+			"the prefix. The prefix and file names are combined with a \"/\" " +
+			"character. With \"--delete\", also deletes the objects with the " +
+			"prefix that do not exist locally.\n\n" + syncDescription,
+		Flags: s3syncCommandFlags(),
 		Action: func(c *cli.Context) error {
+			ctx, cancel, err := operationContext(c.String("timeout"))
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
 			return s3SyncTo(
-				c.String("bucket"),
-				c.String("profile"),
+				ctx,
+				newBucketOptions(c),
 				c.String("local"),
 				c.String("prefix"),
-				c.Bool("delete"),
-				c.Bool("dry-run"))
+				newSyncOptions(c),
+				c.Bool("delete"))
 		},
 	}
 }
@@ -166,15 +299,162 @@ func s3SyncFromCmd() cli.Command {
 		Name:    "sync-from",
 		Aliases: []string{"pull"},
 		Usage:   "sync changes from s3 to the local system",
-		Flags:   baseS3Flags(s3syncFlags()...),
+		Description: "Downloads the objects with the prefix that do not exist in the " +
+			"local directory, or that differ from the local files. With " +
+			"\"--delete\", also deletes the local files that do not exist in the " +
+			"bucket.\n\n" + syncDescription,
+		Flags: s3syncCommandFlags(),
 		Action: func(c *cli.Context) error {
+			ctx, cancel, err := operationContext(c.String("timeout"))
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
 			return s3SyncFrom(
-				c.String("bucket"),
-				c.String("profile"),
+				ctx,
+				newBucketOptions(c),
 				c.String("local"),
 				c.String("prefix"),
-				c.Bool("delete"),
-				c.Bool("dry-run"))
+				newSyncOptions(c),
+				c.Bool("delete"))
+		},
+	}
+}
+
+func s3CopyCmd() cli.Command {
+	return cli.Command{
+		Name:    "copy",
+		Aliases: []string{"cp"},
+		Usage:   "copy an object to another key or bucket, without downloading it",
+		Description: "Copies the object to the \"--target-name\" in the \"--target-bucket\", " +
+			"either of which defaults to the source. S3 copies the object on " +
+			"the server, without downloading it.",
+		Flags: baseS3Flags(s3copyFlags(
+			cli.StringFlag{
+				Name:  "name",
+				Usage: "the name of the object to copy",
+			},
+			cli.StringFlag{
+				Name:  "target-name",
+				Usage: "the name of the copy",
+			})...),
+		Action: func(c *cli.Context) error {
+			ctx, cancel, err := operationContext(c.String("timeout"))
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
+			return s3Copy(
+				ctx,
+				newBucketOptions(c),
+				c.String("name"),
+				c.String("target-bucket"),
+				c.String("target-name"))
+		},
+	}
+}
+
+func s3SyncBucketCmd() cli.Command {
+	return cli.Command{
+		Name:  "sync-bucket",
+		Usage: "sync changes from one bucket or prefix to another, without downloading objects",
+		Description: "Copies the objects with the prefix that do not exist in the " +
+			"target, or have different ETags, from one bucket or prefix to " +
+			"another. S3 copies the objects on the server, without downloading " +
+			"them. With \"--delete\", also deletes the objects in the target that " +
+			"do not exist in the source. Promoting a staging repository to " +
+			"production, for example, is a sync-bucket operation. Accepts the " +
+			"filter, report, and progress options of the other sync operations.",
+		Flags: s3syncBucketFlags(),
+		Action: func(c *cli.Context) error {
+			ctx, cancel, err := operationContext(c.String("timeout"))
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
+			return s3SyncBucket(
+				ctx,
+				newBucketOptions(c),
+				c.String("prefix"),
+				c.String("target-bucket"),
+				c.String("target-prefix"),
+				newFilterOptions(c),
+				newReportOptions(c),
+				newProgressOptions(c),
+				c.Bool("delete"))
+		},
+	}
+}
+
+func s3ListCmd() cli.Command {
+	return cli.Command{
+		Name:  "ls",
+		Usage: "list the objects in a bucket with a prefix",
+		Description: "Lists the objects with the prefix, with their modification times, " +
+			"sizes, and ETags. Without \"--recursive\", groups keys at the next " +
+			"\"/\" after the prefix, like a directory listing. Use \"--json\" to " +
+			"produce machine-readable output.",
+		Flags: baseS3Flags(s3outputFlags(
+			cli.StringFlag{
+				Name:  "prefix",
+				Usage: "a prefix of s3 key names. use a trailing slash to list a directory.",
+			},
+			cli.BoolFlag{
+				Name:  "recursive",
+				Usage: "list all objects with the prefix, rather than grouping keys by directory",
+			})...),
+		Action: func(c *cli.Context) error {
+			ctx, cancel, err := operationContext(c.String("timeout"))
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
+			return s3List(
+				ctx,
+				newBucketOptions(c),
+				c.String("prefix"),
+				c.Bool("recursive"),
+				c.Bool("json"),
+				os.Stdout)
+		},
+	}
+}
+
+func s3DiskUsageCmd() cli.Command {
+	return cli.Command{
+		Name:  "du",
+		Usage: "report the total size of the objects in a bucket, by prefix",
+		Description: "Reports the number and total size of the objects under each " +
+			"\"directory\" of the prefix, to the \"--depth\" level. Use \"--json\" to " +
+			"produce machine-readable output.",
+		Flags: baseS3Flags(s3outputFlags(
+			cli.StringFlag{
+				Name:  "prefix",
+				Usage: "a prefix of s3 key names",
+			},
+			cli.IntFlag{
+				Name:  "depth",
+				Value: 1,
+				Usage: "the number of directory levels below the prefix to report",
+			})...),
+		Action: func(c *cli.Context) error {
+			ctx, cancel, err := operationContext(c.String("timeout"))
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
+			return s3DiskUsage(
+				ctx,
+				newBucketOptions(c),
+				c.String("prefix"),
+				c.Int("depth"),
+				c.Bool("json"),
+				os.Stdout)
 		},
 	}
 }
@@ -185,52 +465,390 @@ func s3SyncFromCmd() cli.Command {
 //
 /////////////////////////////////////////////
 
-func resolveBucket(name, profile string) *sthree.Bucket {
-	if profile == "" {
-		return sthree.GetBucket(name)
+// bucketOptions collects the options, common to all s3
+// sub-commands, that determine which bucket an operation uses and how
+// curator accesses it.
+type bucketOptions struct {
+	name         string
+	profile      string
+	localStorage string
+	region       string
+	endpoint     string
+	pathStyle    bool
+	dryRun       bool
+
+	// multipartThreshold is the file size, in megabytes, above
+	// which uploads use multipart uploads.
+	multipartThreshold int
+
+	retry      retryOptions
+	transfer   transferOptions
+	encryption encryptionOptions
+}
+
+func newBucketOptions(c *cli.Context) bucketOptions {
+	return bucketOptions{
+		name:         c.String("bucket"),
+		profile:      c.String("profile"),
+		localStorage: c.String("local-storage"),
+		region:       c.String("region"),
+		endpoint:     c.String("endpoint"),
+		pathStyle:    c.Bool("path-style"),
+		dryRun:       c.Bool("dry-run"),
+
+		multipartThreshold: c.Int("multipart-threshold"),
+
+		retry:      newRetryOptions(c),
+		transfer:   newTransferOptions(c),
+		encryption: newEncryptionOptions(c),
+	}
+}
+
+// transferOptions limit the bandwidth and the number of concurrent
+// requests of s3 operations. The zero value does not limit transfers.
+type transferOptions struct {
+	bandwidthLimit string
+	maxRequests    int
+}
+
+func newTransferOptions(c *cli.Context) transferOptions {
+	return transferOptions{
+		bandwidthLimit: c.String("bwlimit"),
+		maxRequests:    c.Int("max-requests"),
+	}
+}
+
+// bytesPerSecond returns the bandwidth limit, or 0 for no limit.
+func (opts transferOptions) bytesPerSecond() (int64, error) {
+	limit, err := parseSize(opts.bandwidthLimit)
+	return limit, errors.Wrap(err, "invalid bandwidth limit")
+}
+
+func (opts transferOptions) configure(b *sthree.Bucket) error {
+	limit, err := opts.bytesPerSecond()
+	if err != nil {
+		return err
+	}
+
+	if err = b.SetBandwidthLimit(limit); err != nil {
+		return err
+	}
+
+	return b.SetMaxRequests(opts.maxRequests)
+}
+
+// encryptionOptions set the server-side encryption of the objects
+// that s3 operations upload or copy. The zero value does not request
+// encryption.
+type encryptionOptions struct {
+	mode     string
+	kmsKeyID string
+}
+
+func newEncryptionOptions(c *cli.Context) encryptionOptions {
+	return encryptionOptions{
+		mode:     c.String("encryption"),
+		kmsKeyID: c.String("kms-key-id"),
+	}
+}
+
+func (opts encryptionOptions) configure(b *sthree.Bucket) error {
+	mode := sthree.EncryptionMode(opts.mode)
+	if mode == "none" {
+		mode = sthree.EncryptionNone
+	}
+
+	return b.SetEncryption(sthree.Encryption{Mode: mode, KMSKeyID: opts.kmsKeyID})
+}
+
+// retryOptions determine how operations retry failed requests. The
+// zero value keeps the bucket's current retry policy.
+type retryOptions struct {
+	attempts int
+	minDelay time.Duration
+	maxDelay time.Duration
+	noJitter bool
+}
+
+func newRetryOptions(c *cli.Context) retryOptions {
+	return retryOptions{
+		attempts: c.Int("retries"),
+		minDelay: c.Duration("retry-min-delay"),
+		maxDelay: c.Duration("retry-max-delay"),
+		noJitter: c.Bool("no-retry-jitter"),
+	}
+}
+
+func (opts retryOptions) configure(b *sthree.Bucket) error {
+	if opts == (retryOptions{}) {
+		return nil
+	}
+
+	return b.SetRetryPolicy(sthree.RetryPolicy{
+		MaxAttempts: opts.attempts,
+		MinDelay:    opts.minDelay,
+		MaxDelay:    opts.maxDelay,
+		Jitter:      !opts.noJitter,
+	})
+}
+
+// syncOptions collects the options that determine which files the
+// sync-to and sync-from sub-commands consider, and how they compare
+// files.
+type syncOptions struct {
+	compare       string
+	checksumCache bool
+	resume        bool
+	filter        filterOptions
+	report        reportOptions
+	progress      progressOptions
+}
+
+func newSyncOptions(c *cli.Context) syncOptions {
+	return syncOptions{
+		compare:       c.String("compare"),
+		checksumCache: c.Bool("checksum-cache"),
+		resume:        c.Bool("resume"),
+		filter:        newFilterOptions(c),
+		report:        newReportOptions(c),
+		progress:      newProgressOptions(c),
+	}
+}
+
+func (opts syncOptions) configure(b *sthree.Bucket) error {
+	if opts.compare != "" {
+		if err := b.SetCompareMode(sthree.CompareMode(opts.compare)); err != nil {
+			return err
+		}
+	}
+
+	b.SetChecksumCache(opts.checksumCache)
+	b.SetSyncJournal(opts.resume)
+	opts.progress.configure(b)
+	return opts.filter.configure(b)
+}
+
+// reportOptions determine whether and where sync operations write
+// their reports.
+type reportOptions struct {
+	format   string
+	fileName string
+}
+
+func newReportOptions(c *cli.Context) reportOptions {
+	return reportOptions{
+		format:   c.String("report"),
+		fileName: c.String("report-file"),
+	}
+}
+
+func (opts reportOptions) validate() error {
+	switch opts.format {
+	case "", "json":
+		return nil
+	default:
+		return errors.Errorf("'%s' is not a supported report format", opts.format)
+	}
+}
+
+// write writes the report of a sync operation to the report file or
+// standard output.
+func (opts reportOptions) write(report *sthree.SyncReport) error {
+	return opts.output(func(out io.Writer) error { return report.WriteJSON(out) })
+}
+
+// writeAll writes an array of the reports of several sync operations.
+func (opts reportOptions) writeAll(reports []*sthree.SyncReport) error {
+	if reports == nil {
+		reports = []*sthree.SyncReport{}
+	}
+
+	return opts.output(func(out io.Writer) error { return writeJSON(out, reports) })
+}
+
+func (opts reportOptions) output(write func(io.Writer) error) error {
+	if opts.format == "" {
+		return nil
+	}
+
+	if opts.fileName == "" {
+		return write(os.Stdout)
+	}
+
+	f, err := os.Create(opts.fileName)
+	if err != nil {
+		return errors.Wrapf(err, "problem creating report file '%s'", opts.fileName)
 	}
 
-	return sthree.GetBucketWithProfile(name, profile)
+	catcher := grip.NewCatcher()
+	catcher.Add(write(f))
+	catcher.Add(f.Close())
+	return catcher.Resolve()
+}
+
+// filterOptions collects the include and exclude rules for the sync
+// and delete-prefix sub-commands.
+type filterOptions struct {
+	include      []string
+	exclude      []string
+	includeRegex []string
+	excludeRegex []string
+}
+
+func newFilterOptions(c *cli.Context) filterOptions {
+	return filterOptions{
+		include:      c.StringSlice("include"),
+		exclude:      c.StringSlice("exclude"),
+		includeRegex: c.StringSlice("include-regex"),
+		excludeRegex: c.StringSlice("exclude-regex"),
+	}
+}
+
+func (opts filterOptions) configure(b *sthree.Bucket) error {
+	filter := sthree.NewFilter()
+	catcher := grip.NewCatcher()
+
+	for _, pattern := range opts.include {
+		catcher.Add(filter.Include(pattern))
+	}
+	for _, pattern := range opts.exclude {
+		catcher.Add(filter.Exclude(pattern))
+	}
+	for _, expression := range opts.includeRegex {
+		catcher.Add(filter.IncludeRegex(expression))
+	}
+	for _, expression := range opts.excludeRegex {
+		catcher.Add(filter.ExcludeRegex(expression))
+	}
+
+	if catcher.HasErrors() {
+		return catcher.Resolve()
+	}
+
+	// buckets from the registry may have the filter of an earlier
+	// operation, which an empty filter must replace.
+	b.SetFilter(filter)
+
+	return nil
+}
+
+func resolveBucket(opts bucketOptions) (*sthree.Bucket, error) {
+	if opts.localStorage != "" {
+		b := sthree.GetLocalBucket(opts.name, opts.localStorage)
+		if err := opts.retry.configure(b); err != nil {
+			return nil, err
+		}
+
+		if err := opts.transfer.configure(b); err != nil {
+			return nil, err
+		}
+
+		if err := opts.encryption.configure(b); err != nil {
+			return nil, err
+		}
+
+		return b, nil
+	}
+
+	if opts.region != "" || opts.endpoint != "" {
+		if err := sthree.SetEndpoint(opts.region, opts.endpoint, opts.pathStyle); err != nil {
+			return nil, err
+		}
+	}
+
+	var b *sthree.Bucket
+	if opts.profile == "" {
+		b = sthree.GetBucket(opts.name)
+	} else {
+		b = sthree.GetBucketWithProfile(opts.name, opts.profile)
+	}
+
+	if err := b.SetMultipartThreshold(int64(opts.multipartThreshold) * 1024 * 1024); err != nil {
+		return nil, err
+	}
+
+	if err := opts.retry.configure(b); err != nil {
+		return nil, err
+	}
+
+	if err := opts.transfer.configure(b); err != nil {
+		return nil, err
+	}
+
+	if err := opts.encryption.configure(b); err != nil {
+		return nil, err
+	}
+
+	return b, nil
+}
+
+// configureS3Endpoint applies the endpoint flags, if specified, for
+// commands that construct buckets indirectly.
+func configureS3Endpoint(c *cli.Context) error {
+	if c.String("region") == "" && c.String("endpoint") == "" {
+		return nil
+	}
+
+	return sthree.SetEndpoint(c.String("region"), c.String("endpoint"), c.Bool("path-style"))
 }
 
 // these helpers exist to facilitate easier unittesting
 
-func s3Put(bucket, profile, file, remoteFile string) error {
-	b := resolveBucket(bucket, profile)
+func s3Put(ctx context.Context, opts bucketOptions, metadata metadataOptions, file,
+	remoteFile string) error {
+	b, err := resolveBucket(opts)
+	if err != nil {
+		return err
+	}
+
+	if err = metadata.configure(b); err != nil {
+		return err
+	}
 
-	err := b.Open()
+	err = b.Open(ctx)
 	defer b.Close()
 
 	if err != nil {
 		return err
 	}
 
-	return b.Put(file, remoteFile)
+	return b.Put(ctx, file, remoteFile)
 }
 
-func s3Get(bucket, profile, remoteFile, file string) error {
-	b := resolveBucket(bucket, profile)
+func s3Get(ctx context.Context, opts bucketOptions, remoteFile, file string) error {
+	b, err := resolveBucket(opts)
+	if err != nil {
+		return err
+	}
 
-	err := b.Open()
+	err = b.Open(ctx)
 	defer b.Close()
 
 	if err != nil {
 		return err
 	}
 
-	return b.Get(remoteFile, file)
+	return b.Get(ctx, remoteFile, file)
 }
 
-func s3Delete(bucket, profile string, dryRun bool, file ...string) error {
-	b := resolveBucket(bucket, profile)
+func s3Delete(ctx context.Context, opts bucketOptions, reportOpts reportOptions,
+	file ...string) error {
+	if err := reportOpts.validate(); err != nil {
+		return err
+	}
 
-	err := b.Open()
+	b, err := resolveBucket(opts)
+	if err != nil {
+		return err
+	}
+
+	err = b.Open(ctx)
 	defer b.Close()
 	if err != nil {
 		return err
 	}
 
-	if dryRun {
+	if opts.dryRun {
 		b, err = b.DryRunClone()
 		defer b.Close()
 		if err != nil {
@@ -238,21 +856,30 @@ func s3Delete(bucket, profile string, dryRun bool, file ...string) error {
 		}
 	}
 
-	// DeleteMany handles the single-delete case gracefully, so
-	// there's no use in adding complexity here.
-	return b.DeleteMany(file...)
+	report, err := b.DeleteMany(ctx, file...)
+	grip.CatchError(reportOpts.write(report))
+
+	return err
 }
 
-func s3DeletePrefix(bucket, profile string, dryRun bool, prefix string) error {
-	b := resolveBucket(bucket, profile)
+func s3DeletePrefix(ctx context.Context, opts bucketOptions, prefix string,
+	filter filterOptions) error {
+	b, err := resolveBucket(opts)
+	if err != nil {
+		return err
+	}
 
-	err := b.Open()
+	if err = filter.configure(b); err != nil {
+		return err
+	}
+
+	err = b.Open(ctx)
 	defer b.Close()
 	if err != nil {
 		return err
 	}
 
-	if dryRun {
+	if opts.dryRun {
 		b, err = b.DryRunClone()
 		defer b.Close()
 		if err != nil {
@@ -260,19 +887,23 @@ func s3DeletePrefix(bucket, profile string, dryRun bool, prefix string) error {
 		}
 	}
 
-	return b.DeletePrefix(prefix)
+	return b.DeletePrefix(ctx, prefix)
 }
 
-func s3DeleteMatching(bucket, profile string, dryRun bool, prefix string, expression string) error {
-	b := resolveBucket(bucket, profile)
+func s3DeleteMatching(ctx context.Context, opts bucketOptions, prefix string,
+	expression string) error {
+	b, err := resolveBucket(opts)
+	if err != nil {
+		return err
+	}
 
-	err := b.Open()
+	err = b.Open(ctx)
 	defer b.Close()
 	if err != nil {
 		return err
 	}
 
-	if dryRun {
+	if opts.dryRun {
 		b, err = b.DryRunClone()
 		defer b.Close()
 		if err != nil {
@@ -280,19 +911,31 @@ func s3DeleteMatching(bucket, profile string, dryRun bool, prefix string, expres
 		}
 	}
 
-	return b.DeleteMatching(prefix, expression)
+	return b.DeleteMatching(ctx, prefix, expression)
 }
 
-func s3SyncTo(bucket, profile, local, prefix string, withDelete, dryRun bool) error {
-	b := resolveBucket(bucket, profile)
+func s3SyncTo(ctx context.Context, opts bucketOptions, local, prefix string, sync syncOptions,
+	withDelete bool) error {
+	if err := sync.report.validate(); err != nil {
+		return err
+	}
+
+	b, err := resolveBucket(opts)
+	if err != nil {
+		return err
+	}
 
-	err := b.Open()
+	if err = sync.configure(b); err != nil {
+		return err
+	}
+
+	err = b.Open(ctx)
 	defer b.Close()
 	if err != nil {
 		return err
 	}
 
-	if dryRun {
+	if opts.dryRun {
 		b, err = b.DryRunClone()
 		defer b.Close()
 		if err != nil {
@@ -300,19 +943,36 @@ func s3SyncTo(bucket, profile, local, prefix string, withDelete, dryRun bool) er
 		}
 	}
 
-	return b.SyncTo(local, prefix, withDelete)
+	report, err := b.SyncTo(ctx, local, prefix, withDelete)
+	if report != nil {
+		grip.CatchError(sync.report.write(report))
+	}
+
+	return err
 }
 
-func s3SyncFrom(bucket, profile, local, prefix string, withDelete, dryRun bool) error {
-	b := resolveBucket(bucket, profile)
+func s3SyncFrom(ctx context.Context, opts bucketOptions, local, prefix string, sync syncOptions,
+	withDelete bool) error {
+	if err := sync.report.validate(); err != nil {
+		return err
+	}
+
+	b, err := resolveBucket(opts)
+	if err != nil {
+		return err
+	}
+
+	if err = sync.configure(b); err != nil {
+		return err
+	}
 
-	err := b.Open()
+	err = b.Open(ctx)
 	defer b.Close()
 	if err != nil {
 		return err
 	}
 
-	if dryRun {
+	if opts.dryRun {
 		b, err = b.DryRunClone()
 		defer b.Close()
 		if err != nil {
@@ -320,7 +980,245 @@ func s3SyncFrom(bucket, profile, local, prefix string, withDelete, dryRun bool)
 		}
 	}
 
-	return b.SyncFrom(local, prefix, withDelete)
+	report, err := b.SyncFrom(ctx, local, prefix, withDelete)
+	if report != nil {
+		grip.CatchError(sync.report.write(report))
+	}
+
+	return err
+}
+
+// resolveTargetBucket returns the target bucket of a copy operation,
+// which uses the same options as the source bucket, and is the source
+// bucket if the name is empty. Callers must open and close the target.
+func resolveTargetBucket(opts bucketOptions, name string) (*sthree.Bucket, error) {
+	if name != "" {
+		opts.name = name
+	}
+
+	return resolveBucket(opts)
+}
+
+func s3Copy(ctx context.Context, opts bucketOptions, remoteFile, targetBucket,
+	targetFile string) error {
+	if targetFile == "" {
+		targetFile = remoteFile
+	}
+
+	if targetBucket == "" && targetFile == remoteFile {
+		return errors.New("copy requires a different target name or bucket")
+	}
+
+	b, err := resolveBucket(opts)
+	if err != nil {
+		return err
+	}
+
+	target, err := resolveTargetBucket(opts, targetBucket)
+	if err != nil {
+		return err
+	}
+
+	err = b.Open(ctx)
+	defer b.Close()
+	if err != nil {
+		return err
+	}
+
+	err = target.Open(ctx)
+	defer target.Close()
+	if err != nil {
+		return err
+	}
+
+	if opts.dryRun {
+		target, err = target.DryRunClone()
+		defer target.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return b.CopyTo(ctx, target, remoteFile, targetFile)
+}
+
+func s3SyncBucket(ctx context.Context, opts bucketOptions, prefix, targetBucket,
+	targetPrefix string, filter filterOptions, reportOpts reportOptions, progress progressOptions,
+	withDelete bool) error {
+	if targetBucket == "" && targetPrefix == prefix {
+		return errors.New("sync-bucket requires a different target prefix or bucket")
+	}
+
+	if err := reportOpts.validate(); err != nil {
+		return err
+	}
+
+	b, err := resolveBucket(opts)
+	if err != nil {
+		return err
+	}
+
+	if err = filter.configure(b); err != nil {
+		return err
+	}
+
+	progress.configure(b)
+
+	target, err := resolveTargetBucket(opts, targetBucket)
+	if err != nil {
+		return err
+	}
+
+	err = b.Open(ctx)
+	defer b.Close()
+	if err != nil {
+		return err
+	}
+
+	err = target.Open(ctx)
+	defer target.Close()
+	if err != nil {
+		return err
+	}
+
+	if opts.dryRun {
+		target, err = target.DryRunClone()
+		defer target.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	report, err := b.SyncToBucket(ctx, target, prefix, targetPrefix, withDelete)
+	if report != nil {
+		grip.CatchError(reportOpts.write(report))
+	}
+
+	return err
+}
+
+func s3List(ctx context.Context, opts bucketOptions, prefix string, recursive, asJSON bool,
+	out io.Writer) error {
+	b, err := resolveBucket(opts)
+	if err != nil {
+		return err
+	}
+
+	err = b.Open(ctx)
+	defer b.Close()
+	if err != nil {
+		return err
+	}
+
+	listing, err := b.List(ctx, prefix, recursive)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		return writeJSON(out, listing)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	for _, p := range listing.Prefixes {
+		fmt.Fprintf(w, "\t\tPRE\t%s\t\n", p)
+	}
+	for _, obj := range listing.Objects {
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t\n", obj.LastModified.Format("2006-01-02 15:04:05"),
+			obj.Size, strings.Trim(obj.ETag, "\""), obj.Key)
+	}
+
+	return w.Flush()
+}
+
+func s3DiskUsage(ctx context.Context, opts bucketOptions, prefix string, depth int, asJSON bool,
+	out io.Writer) error {
+	b, err := resolveBucket(opts)
+	if err != nil {
+		return err
+	}
+
+	err = b.Open(ctx)
+	defer b.Close()
+	if err != nil {
+		return err
+	}
+
+	usage, err := b.DiskUsage(ctx, prefix, depth)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		return writeJSON(out, usage)
+	}
+
+	var total sthree.PrefixUsage
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	for _, group := range usage {
+		fmt.Fprintf(w, "%s\t%d objects\t%s\t\n", humanSize(group.Size), group.Objects, group.Prefix)
+		total.Objects += group.Objects
+		total.Size += group.Size
+	}
+	fmt.Fprintf(w, "%s\t%d objects\ttotal\t\n", humanSize(total.Size), total.Objects)
+
+	return w.Flush()
+}
+
+func writeJSON(out io.Writer, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "problem encoding output")
+	}
+
+	_, err = fmt.Fprintln(out, string(data))
+	return err
+}
+
+// humanSize formats a size in bytes with a binary unit suffix.
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
+
+// parseSize parses a size in bytes, with an optional binary unit
+// suffix (e.g. "512K", "10M", or "1G".) An empty string is 0.
+func parseSize(value string) (int64, error) {
+	number := strings.TrimSpace(value)
+	if number == "" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	switch strings.ToUpper(number[len(number)-1:]) {
+	case "K":
+		multiplier = 1 << 10
+	case "M":
+		multiplier = 1 << 20
+	case "G":
+		multiplier = 1 << 30
+	}
+
+	if multiplier != 1 {
+		number = number[:len(number)-1]
+	}
+
+	size, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || size < 0 {
+		return 0, errors.Errorf("'%s' is not a valid size", value)
+	}
+
+	return size * multiplier, nil
 }
 
 /////////////////////////
@@ -344,6 +1242,141 @@ func baseS3Flags(args ...cli.Flag) []cli.Flag {
 			Name:  "dry-run",
 			Usage: "make task operate in a dry-run mode",
 		},
+		cli.StringFlag{
+			Name: "local-storage",
+			Usage: fmt.Sprintln("use a local directory, containing a directory for each",
+				"bucket, instead of s3"),
+		},
+		cli.IntFlag{
+			Name:  "multipart-threshold",
+			Value: 64,
+			Usage: fmt.Sprintln("size, in megabytes, above which files upload in parts.",
+				"0 disables multipart uploads."),
+		},
+	}
+
+	flags = append(flags, timeoutFlags()...)
+	flags = append(flags, s3retryFlags()...)
+	flags = append(flags, s3transferFlags()...)
+	flags = append(flags, s3encryptionFlags()...)
+	flags = append(flags, s3EndpointFlags()...)
+	flags = append(flags, args...)
+	return flags
+}
+
+// s3syncCommandFlags returns the flags of the sync-to and sync-from
+// commands.
+func s3syncCommandFlags() []cli.Flag {
+	flags := s3syncFlags()
+	flags = append(flags, s3compareFlags()...)
+	flags = append(flags, s3filterFlags()...)
+	flags = append(flags, s3reportFlags()...)
+	flags = append(flags, s3progressFlags()...)
+	return baseS3Flags(flags...)
+}
+
+// s3syncBucketFlags returns the flags of the sync-bucket command.
+func s3syncBucketFlags() []cli.Flag {
+	flags := s3copyFlags()
+	flags = append(flags, s3filterFlags()...)
+	flags = append(flags, s3reportFlags()...)
+	flags = append(flags, s3progressFlags()...)
+	flags = append(flags,
+		cli.StringFlag{
+			Name:  "prefix",
+			Usage: "the prefix of the source objects",
+		},
+		cli.StringFlag{
+			Name:  "target-prefix",
+			Usage: "the prefix of the copies, which replaces the source prefix",
+		},
+		cli.BoolFlag{
+			Name:  "delete",
+			Usage: "delete objects from the target that do not exist in the source",
+		})
+	return baseS3Flags(flags...)
+}
+
+func s3transferFlags(args ...cli.Flag) []cli.Flag {
+	flags := []cli.Flag{
+		cli.StringFlag{
+			Name: "bwlimit",
+			Usage: fmt.Sprintln("limit the bandwidth of all transfers to this many bytes per second,",
+				"with an optional K, M, or G suffix (e.g. '10M'). defaults to no limit."),
+		},
+		cli.IntFlag{
+			Name: "max-requests",
+			Usage: fmt.Sprintln("limit the number of concurrent s3 requests, independently of the",
+				"number of jobs. 0 is no limit."),
+		},
+	}
+
+	flags = append(flags, args...)
+	return flags
+}
+
+func s3encryptionFlags(args ...cli.Flag) []cli.Flag {
+	flags := []cli.Flag{
+		cli.StringFlag{
+			Name: "encryption",
+			Usage: fmt.Sprintln("the server-side encryption of uploaded and copied objects:",
+				"'none' (the default), 'sse-s3', or 'sse-kms'"),
+		},
+		cli.StringFlag{
+			Name:  "kms-key-id",
+			Usage: "the id or arn of the kms key for sse-kms encryption. defaults to the account's s3 key.",
+		},
+	}
+
+	flags = append(flags, args...)
+	return flags
+}
+
+func s3retryFlags(args ...cli.Flag) []cli.Flag {
+	flags := []cli.Flag{
+		cli.IntFlag{
+			Name:  "retries",
+			Value: 20,
+			Usage: "the maximum number of attempts for each s3 request",
+		},
+		cli.DurationFlag{
+			Name:  "retry-min-delay",
+			Value: 100 * time.Millisecond,
+			Usage: "the delay before the first retry of a failed request",
+		},
+		cli.DurationFlag{
+			Name:  "retry-max-delay",
+			Value: 5 * time.Second,
+			Usage: "the maximum delay between retries, which double after each attempt",
+		},
+		cli.BoolFlag{
+			Name:  "no-retry-jitter",
+			Usage: "disable the randomization of retry delays",
+		},
+	}
+
+	flags = append(flags, args...)
+	return flags
+}
+
+func s3EndpointFlags(args ...cli.Flag) []cli.Flag {
+	flags := []cli.Flag{
+		cli.StringFlag{
+			Name:   "region",
+			Usage:  "the name of the aws region, or a region name for a custom endpoint",
+			EnvVar: "CURATOR_S3_REGION",
+		},
+		cli.StringFlag{
+			Name: "endpoint",
+			Usage: fmt.Sprintln("the url of an s3-compatible service (e.g. minio or ceph)",
+				"to use instead of aws"),
+			EnvVar: "CURATOR_S3_ENDPOINT",
+		},
+		cli.BoolFlag{
+			Name:   "path-style",
+			Usage:  "address buckets using the url path rather than the host name",
+			EnvVar: "CURATOR_S3_PATH_STYLE",
+		},
 	}
 
 	flags = append(flags, args...)
@@ -373,6 +1406,98 @@ func s3syncFlags(args ...cli.Flag) []cli.Flag {
 	return flags
 }
 
+func s3compareFlags(args ...cli.Flag) []cli.Flag {
+	flags := []cli.Flag{
+		cli.StringFlag{
+			Name:  "compare",
+			Value: string(sthree.CompareChecksum),
+			Usage: fmt.Sprintln("how to determine whether files differ: 'checksum',",
+				"'size-mtime', 'size', or 'always'"),
+		},
+		cli.BoolFlag{
+			Name: "checksum-cache",
+			Usage: fmt.Sprintln("store checksums of local files in the local directory,",
+				"and only hash files that changed since the last sync"),
+		},
+		cli.BoolFlag{
+			Name: "resume",
+			Usage: fmt.Sprintln("keep a journal of the sync in the local directory,",
+				"and resume an interrupted sync from its journal"),
+		},
+	}
+
+	flags = append(flags, args...)
+	return flags
+}
+
+func s3reportFlags(args ...cli.Flag) []cli.Flag {
+	flags := []cli.Flag{
+		cli.StringFlag{
+			Name: "report",
+			Usage: fmt.Sprintln("write a report of each file's action, bytes, and duration in this",
+				"format ('json'). in dry-run mode the report is a plan."),
+		},
+		cli.StringFlag{
+			Name:  "report-file",
+			Usage: "write the report to this file rather than to standard output",
+		},
+	}
+
+	flags = append(flags, args...)
+	return flags
+}
+
+func s3outputFlags(args ...cli.Flag) []cli.Flag {
+	flags := []cli.Flag{
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "write output as json rather than as a table",
+		},
+	}
+
+	flags = append(flags, args...)
+	return flags
+}
+
+func s3copyFlags(args ...cli.Flag) []cli.Flag {
+	flags := []cli.Flag{
+		cli.StringFlag{
+			Name:  "target-bucket",
+			Usage: "the name of the bucket to copy to. defaults to the source bucket.",
+		},
+	}
+
+	flags = append(flags, args...)
+	return flags
+}
+
+func s3filterFlags(args ...cli.Flag) []cli.Flag {
+	flags := []cli.Flag{
+		cli.StringSliceFlag{
+			Name: "include",
+			Usage: fmt.Sprintln("only consider files that match this glob pattern (e.g. 'repodata/').",
+				"specify multiple times to include several patterns."),
+		},
+		cli.StringSliceFlag{
+			Name: "exclude",
+			Usage: fmt.Sprintln("skip files that match this glob pattern (e.g. '*.html').",
+				"may be specified multiple times."),
+		},
+		cli.StringSliceFlag{
+			Name: "include-regex",
+			Usage: fmt.Sprintln("only consider files that match this regular expression.",
+				"may be specified multiple times."),
+		},
+		cli.StringSliceFlag{
+			Name:  "exclude-regex",
+			Usage: "skip files that match this regular expression. may be specified multiple times.",
+		},
+	}
+
+	flags = append(flags, args...)
+	return flags
+}
+
 func s3opFlags() []cli.Flag {
 	return []cli.Flag{
 		cli.StringFlag{
@@ -1,10 +1,17 @@
 package operations
 
 import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
+	"time"
 
+	"github.com/mongodb/curator/sthree"
 	"github.com/urfave/cli"
+	"golang.org/x/net/context"
 )
 
 func (s *CommandsSuite) TestPutGetFlagFactory() {
@@ -56,14 +63,20 @@ func (s *CommandsSuite) TestS3ParentCommandHasExpectedProperties() {
 		s.IsType(cli.Command{}, sub)
 		names[sub.Name] = true
 
-		if sub.Name == "put" || sub.Name == "get" {
+		if sub.Name == "put" {
+			s.Equal(sub.Flags, baseS3Flags(s3metadataFlags(s3opFlags()...)...))
+		} else if sub.Name == "get" {
 			s.Equal(sub.Flags, baseS3Flags(s3opFlags()...))
-		} else if strings.HasPrefix(sub.Name, "sync") {
-			s.Equal(sub.Flags, baseS3Flags(s3syncFlags()...))
+		} else if sub.Name == "sync-to" || sub.Name == "sync-from" {
+			s.Equal(sub.Flags, s3syncCommandFlags())
+		} else if sub.Name == "delete" {
+			s.Equal(sub.Flags, baseS3Flags(s3deleteFlags(s3reportFlags()...)...))
+		} else if sub.Name == "set-acl" {
+			s.Equal(sub.Flags, baseS3Flags(s3aclFlags(s3filterFlags()...)...))
 		}
 	}
 
-	s.Len(cmd.Subcommands, 7)
+	s.Len(cmd.Subcommands, 17)
 	s.Equal(cmd.Name, "s3")
 	s.Len(cmd.Aliases, 1)
 
@@ -73,4 +86,449 @@ func (s *CommandsSuite) TestS3ParentCommandHasExpectedProperties() {
 	s.True(names["delete-prefix"])
 	s.True(names["sync-to"])
 	s.True(names["sync-from"])
+	s.True(names["copy"])
+	s.True(names["sync-bucket"])
+	s.True(names["ls"])
+	s.True(names["du"])
+	s.True(names["set-acl"])
+	s.True(names["versions"])
+	s.True(names["restore"])
+	s.True(names["undelete"])
+	s.True(names["presign"])
+	s.True(names["expire"])
+}
+
+func (s *CommandsSuite) TestCompareFlagsFactory() {
+	flags := s3compareFlags()
+	s.Len(flags, 3)
+
+	flag, ok := flags[0].(cli.StringFlag)
+	s.True(ok)
+	s.Equal("compare", flag.Name)
+	s.Equal("checksum", flag.Value)
+
+	s.IsType(cli.BoolFlag{}, flags[1])
+	s.Equal("checksum-cache", flags[1].GetName())
+
+	s.IsType(cli.BoolFlag{}, flags[2])
+	s.Equal("resume", flags[2].GetName())
+}
+
+func (s *CommandsSuite) TestInvalidCompareModesPreventSync() {
+	dir, err := ioutil.TempDir("", "compare-test")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	opts := bucketOptions{name: "compare-test", localStorage: dir}
+	s.Error(s3SyncTo(context.Background(), opts, dir, "prefix", syncOptions{compare: "mtime-only"},
+		false))
+	s.Error(s3SyncFrom(context.Background(), opts, dir, "prefix", syncOptions{compare: "fast"}, false))
+}
+
+func (s *CommandsSuite) TestFilterFlagsFactory() {
+	flags := s3filterFlags()
+	s.Len(flags, 4)
+
+	names := make(map[string]bool)
+	for _, flag := range flags {
+		s.IsType(cli.StringSliceFlag{}, flag)
+		names[flag.GetName()] = true
+	}
+
+	s.True(names["include"])
+	s.True(names["exclude"])
+	s.True(names["include-regex"])
+	s.True(names["exclude-regex"])
+}
+
+func (s *CommandsSuite) TestInvalidFiltersPreventOperations() {
+	dir, err := ioutil.TempDir("", "filter-test")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	opts := bucketOptions{name: "filter-test", localStorage: dir}
+	s.Error(s3SyncTo(context.Background(), opts, dir, "prefix",
+		syncOptions{filter: filterOptions{include: []string{"["}}}, false))
+	s.Error(s3SyncFrom(context.Background(), opts, dir, "prefix",
+		syncOptions{filter: filterOptions{excludeRegex: []string{"("}}}, false))
+	s.Error(s3DeletePrefix(context.Background(), opts, "prefix",
+		filterOptions{exclude: []string{"a[b"}}))
+}
+
+func (s *CommandsSuite) TestEmptyFiltersReplaceExistingFilters() {
+	dir, err := ioutil.TempDir("", "filter-test")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	b := sthree.GetLocalBucket("filter-test", dir)
+	s.Require().NoError(b.Open(ctx))
+	defer b.Close()
+
+	s.Require().NoError(os.MkdirAll(filepath.Join(dir, "filter-test", "prefix"), 0755))
+	for _, name := range []string{"prefix/a.txt", "prefix/b.log"} {
+		s.Require().NoError(ioutil.WriteFile(filepath.Join(dir, "filter-test", name), []byte(name), 0644))
+	}
+
+	s.NoError(filterOptions{include: []string{"*.txt"}}.configure(b))
+	s.NoError(filterOptions{}.configure(b))
+	s.NoError(b.DeletePrefix(ctx, "prefix"))
+
+	listing, err := b.List(ctx, "prefix", true)
+	s.NoError(err)
+	s.Len(listing.Objects, 0)
+}
+
+func (s *CommandsSuite) TestCopyFlagsFactory() {
+	flags := s3copyFlags(cli.StringFlag{Name: "target-prefix"})
+	s.Len(flags, 2)
+	s.Equal("target-bucket", flags[0].GetName())
+	s.Equal("target-prefix", flags[1].GetName())
+}
+
+func (s *CommandsSuite) TestCopyOperationsRequireDifferentTargets() {
+	dir, err := ioutil.TempDir("", "copy-test")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	opts := bucketOptions{name: "copy-test", localStorage: dir}
+	s.Error(s3Copy(context.Background(), opts, "a", "", ""))
+	s.Error(s3Copy(context.Background(), opts, "a", "", "a"))
+	s.Error(s3SyncBucket(context.Background(), opts, "prefix", "", "prefix", filterOptions{},
+		reportOptions{}, progressOptions{}, false))
+}
+
+func (s *CommandsSuite) TestSyncBucketWithLocalStorage() {
+	dir, err := ioutil.TempDir("", "copy-test")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "staging", "repo", "a.rpm")
+	s.Require().NoError(os.MkdirAll(filepath.Dir(source), 0755))
+	s.Require().NoError(ioutil.WriteFile(source, []byte("rpm"), 0644))
+
+	opts := bucketOptions{name: "staging", localStorage: dir}
+	s.NoError(s3SyncBucket(context.Background(), opts, "repo", "production", "repo", filterOptions{},
+		reportOptions{}, progressOptions{}, false))
+	s.NoError(s3Copy(context.Background(), opts, "repo/a.rpm", "production", "b.rpm"))
+
+	for _, name := range []string{"repo/a.rpm", "b.rpm"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, "production", name))
+		s.NoError(err)
+		s.Equal("rpm", string(data))
+	}
+}
+
+func (s *CommandsSuite) TestOperationsCloseTheirBuckets() {
+	dir, err := ioutil.TempDir("", "close-test")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	source := filepath.Join(dir, "staging", "repo", "a.rpm")
+	s.Require().NoError(os.MkdirAll(filepath.Dir(source), 0755))
+	s.Require().NoError(ioutil.WriteFile(source, []byte("rpm"), 0644))
+
+	ctx := context.Background()
+	opts := bucketOptions{name: "staging", localStorage: dir}
+	for _, op := range []struct {
+		bucket string
+		run    func() error
+	}{
+		{"staging", func() error { return s3List(ctx, opts, "repo/", true, false, &bytes.Buffer{}) }},
+		{"staging", func() error { return s3DiskUsage(ctx, opts, "repo/", 0, false, &bytes.Buffer{}) }},
+		{"production", func() error { return s3Copy(ctx, opts, "repo/a.rpm", "production", "b.rpm") }},
+		{"production", func() error {
+			return s3SyncBucket(ctx, opts, "repo", "production", "repo",
+				filterOptions{}, reportOptions{}, progressOptions{}, false)
+		}},
+	} {
+		b := sthree.GetLocalBucket(op.bucket, dir)
+		s.Require().NoError(b.Open(ctx))
+
+		s.NoError(op.run())
+		s.False(b.IsOpen())
+	}
+}
+
+func (s *CommandsSuite) TestListAndDiskUsageOutput() {
+	dir, err := ioutil.TempDir("", "ls-test")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	for name, size := range map[string]int{
+		"repo/a/one.rpm": 1024,
+		"repo/a/two.rpm": 2048,
+		"repo/b.html":    10,
+	} {
+		fileName := filepath.Join(dir, "ls-test", name)
+		s.Require().NoError(os.MkdirAll(filepath.Dir(fileName), 0755))
+		s.Require().NoError(ioutil.WriteFile(fileName, make([]byte, size), 0644))
+	}
+	opts := bucketOptions{name: "ls-test", localStorage: dir}
+
+	out := &bytes.Buffer{}
+	s.NoError(s3List(context.Background(), opts, "repo/", false, false, out))
+	s.Regexp(`PRE\s+repo/a/`, out.String())
+	s.Contains(out.String(), "repo/b.html")
+	s.NotContains(out.String(), "one.rpm")
+
+	out.Reset()
+	s.NoError(s3List(context.Background(), opts, "repo/", true, true, out))
+	listing := &sthree.Listing{}
+	s.NoError(json.Unmarshal(out.Bytes(), listing))
+	s.Len(listing.Objects, 3)
+	s.Equal("repo/a/one.rpm", listing.Objects[0].Key)
+	s.Equal(int64(1024), listing.Objects[0].Size)
+
+	out.Reset()
+	s.NoError(s3DiskUsage(context.Background(), opts, "repo/", 1, false, out))
+	s.Regexp(`3\.0 KiB\s+2 objects\s+repo/a/`, out.String())
+	s.Regexp(`3\.0 KiB\s+3 objects\s+total`, out.String())
+
+	out.Reset()
+	s.NoError(s3DiskUsage(context.Background(), opts, "repo/", 0, true, out))
+	var usage []sthree.PrefixUsage
+	s.NoError(json.Unmarshal(out.Bytes(), &usage))
+	s.Equal([]sthree.PrefixUsage{{Prefix: "repo/", Objects: 3, Size: 3082}}, usage)
+}
+
+func (s *CommandsSuite) TestHumanSize() {
+	s.Equal("0 B", humanSize(0))
+	s.Equal("1023 B", humanSize(1023))
+	s.Equal("1.0 KiB", humanSize(1024))
+	s.Equal("1.5 MiB", humanSize(1024*1024*3/2))
+	s.Equal("2.0 GiB", humanSize(2*1024*1024*1024))
+}
+
+func (s *CommandsSuite) TestEndpointFlagsFactory() {
+	flags := s3EndpointFlags()
+	names := make(map[string]bool)
+	for _, flag := range flags {
+		names[flag.GetName()] = true
+		if flag.GetName() == "path-style" {
+			s.IsType(cli.BoolFlag{}, flag)
+		} else {
+			s.IsType(cli.StringFlag{}, flag)
+		}
+	}
+
+	s.Len(flags, 3)
+	s.True(names["region"])
+	s.True(names["endpoint"])
+	s.True(names["path-style"])
+}
+
+func (s *CommandsSuite) TestInvalidEndpointsPreventOperations() {
+	opts := bucketOptions{name: "endpoint-test", endpoint: "not-a-url"}
+	s.Error(s3Put(context.Background(), opts, metadataOptions{}, "sthree.go", "sthree.go"))
+
+	opts = bucketOptions{name: "endpoint-test", region: "not-a-region"}
+	s.Error(s3Get(context.Background(), opts, "sthree.go", "sthree.go"))
+}
+
+func (s *CommandsSuite) TestRetryFlagsFactory() {
+	flags := s3retryFlags()
+	s.Len(flags, 4)
+
+	s.IsType(cli.IntFlag{}, flags[0])
+	s.Equal("retries", flags[0].GetName())
+	s.IsType(cli.DurationFlag{}, flags[1])
+	s.Equal("retry-min-delay", flags[1].GetName())
+	s.IsType(cli.DurationFlag{}, flags[2])
+	s.Equal("retry-max-delay", flags[2].GetName())
+	s.IsType(cli.BoolFlag{}, flags[3])
+	s.Equal("no-retry-jitter", flags[3].GetName())
+}
+
+func (s *CommandsSuite) TestRetryOptionsConfigureBuckets() {
+	dir, err := ioutil.TempDir("", "retry-test")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	opts := bucketOptions{name: "retry-test", localStorage: dir}
+	b, err := resolveBucket(opts)
+	s.Require().NoError(err)
+	s.Equal(sthree.DefaultRetryPolicy(), b.RetryPolicy())
+
+	opts.retry = retryOptions{
+		attempts: 3,
+		minDelay: time.Second,
+		maxDelay: time.Minute,
+		noJitter: true,
+	}
+	b, err = resolveBucket(opts)
+	s.Require().NoError(err)
+	s.Equal(sthree.RetryPolicy{MaxAttempts: 3, MinDelay: time.Second, MaxDelay: time.Minute},
+		b.RetryPolicy())
+
+	opts.retry = retryOptions{attempts: 0, minDelay: time.Second}
+	s.Error(s3Put(context.Background(), opts, metadataOptions{}, "sthree.go", "sthree.go"))
+
+	opts.retry = retryOptions{attempts: 3, minDelay: time.Minute, maxDelay: time.Second}
+	s.Error(s3Get(context.Background(), opts, "sthree.go", "sthree.go"))
+}
+
+func (s *CommandsSuite) TestTransferFlagsFactory() {
+	flags := s3transferFlags()
+	s.Len(flags, 2)
+
+	s.IsType(cli.StringFlag{}, flags[0])
+	s.Equal("bwlimit", flags[0].GetName())
+	s.IsType(cli.IntFlag{}, flags[1])
+	s.Equal("max-requests", flags[1].GetName())
+}
+
+func (s *CommandsSuite) TestEncryptionFlagsFactory() {
+	flags := s3encryptionFlags()
+	s.Len(flags, 2)
+
+	s.IsType(cli.StringFlag{}, flags[0])
+	s.Equal("encryption", flags[0].GetName())
+	s.IsType(cli.StringFlag{}, flags[1])
+	s.Equal("kms-key-id", flags[1].GetName())
+}
+
+func (s *CommandsSuite) TestEncryptionOptionsConfigureBuckets() {
+	dir, err := ioutil.TempDir("", "encryption-test")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	opts := bucketOptions{name: "encryption-test", localStorage: dir}
+	b, err := resolveBucket(opts)
+	s.Require().NoError(err)
+	s.Equal(sthree.Encryption{}, b.Encryption())
+
+	opts.encryption = encryptionOptions{mode: "sse-kms", kmsKeyID: "alias/curator"}
+	b, err = resolveBucket(opts)
+	s.Require().NoError(err)
+	s.Equal(sthree.Encryption{Mode: sthree.EncryptionKMS, KMSKeyID: "alias/curator"}, b.Encryption())
+
+	opts.encryption = encryptionOptions{mode: "none"}
+	b, err = resolveBucket(opts)
+	s.Require().NoError(err)
+	s.Equal(sthree.Encryption{}, b.Encryption())
+
+	opts.encryption = encryptionOptions{mode: "aes"}
+	s.Error(s3Put(context.Background(), opts, metadataOptions{}, "sthree.go", "sthree.go"))
+
+	opts.encryption = encryptionOptions{mode: "sse-s3", kmsKeyID: "alias/curator"}
+	s.Error(s3Get(context.Background(), opts, "sthree.go", "sthree.go"))
+}
+
+func (s *CommandsSuite) TestParseSize() {
+	for value, size := range map[string]int64{
+		"":     0,
+		"0":    0,
+		"512":  512,
+		"64K":  64 * 1024,
+		"10m":  10 * 1024 * 1024,
+		" 2G ": 2 * 1024 * 1024 * 1024,
+	} {
+		parsed, err := parseSize(value)
+		s.NoError(err, value)
+		s.Equal(size, parsed, value)
+	}
+
+	for _, value := range []string{"M", "ten", "-1K", "1.5M", "10T"} {
+		_, err := parseSize(value)
+		s.Error(err, value)
+	}
+}
+
+func (s *CommandsSuite) TestTransferOptionsConfigureBuckets() {
+	dir, err := ioutil.TempDir("", "transfer-test")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	opts := bucketOptions{name: "transfer-test", localStorage: dir}
+	opts.transfer = transferOptions{bandwidthLimit: "1M", maxRequests: 8}
+	b, err := resolveBucket(opts)
+	s.Require().NoError(err)
+	s.Equal(int64(1024*1024), b.BandwidthLimit())
+	s.Equal(8, b.MaxRequests())
+
+	opts.transfer = transferOptions{}
+	b, err = resolveBucket(opts)
+	s.Require().NoError(err)
+	s.Equal(int64(0), b.BandwidthLimit())
+	s.Equal(0, b.MaxRequests())
+
+	opts.transfer = transferOptions{bandwidthLimit: "fast"}
+	s.Error(s3Put(context.Background(), opts, metadataOptions{}, "sthree.go", "sthree.go"))
+
+	opts.transfer = transferOptions{maxRequests: -1}
+	s.Error(s3Get(context.Background(), opts, "sthree.go", "sthree.go"))
+}
+
+func (s *CommandsSuite) TestReportFlagsFactory() {
+	flags := s3reportFlags()
+	s.Len(flags, 2)
+	s.Equal("report", flags[0].GetName())
+	s.Equal("report-file", flags[1].GetName())
+}
+
+func (s *CommandsSuite) TestSyncWritesReportFile() {
+	dir, err := ioutil.TempDir("", "report-test")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	local := filepath.Join(dir, "local")
+	s.Require().NoError(os.MkdirAll(local, 0755))
+	s.Require().NoError(ioutil.WriteFile(filepath.Join(local, "a.rpm"), []byte("rpm"), 0644))
+
+	opts := bucketOptions{name: "report-test", localStorage: dir}
+	invalid := syncOptions{report: reportOptions{format: "yaml"}}
+	s.Error(s3SyncTo(context.Background(), opts, local, "repo", invalid, false))
+
+	fileName := filepath.Join(dir, "plan.json")
+	sync := syncOptions{report: reportOptions{format: "json", fileName: fileName}}
+	s.NoError(s3SyncTo(context.Background(), opts, local, "repo", sync, false))
+
+	data, err := ioutil.ReadFile(fileName)
+	s.Require().NoError(err)
+	report := &sthree.SyncReport{}
+	s.Require().NoError(json.Unmarshal(data, report))
+	s.Equal("push", report.Operation)
+	s.Require().Len(report.Items, 1)
+	s.Equal("repo/a.rpm", report.Items[0].Key)
+	s.Equal(sthree.SyncUpload, report.Items[0].Action)
+	s.Equal(int64(3), report.Items[0].Bytes)
+
+	s.NoError(reportOptions{format: "json", fileName: fileName}.writeAll(nil))
+	data, err = ioutil.ReadFile(fileName)
+	s.Require().NoError(err)
+	s.Equal("[]", strings.TrimSpace(string(data)))
+}
+
+func (s *CommandsSuite) TestDeleteWritesReportFile() {
+	dir, err := ioutil.TempDir("", "delete-test")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{"a.rpm", "b.rpm"} {
+		fileName := filepath.Join(dir, "delete-test", "repo", name)
+		s.Require().NoError(os.MkdirAll(filepath.Dir(fileName), 0755))
+		s.Require().NoError(ioutil.WriteFile(fileName, []byte("rpm"), 0644))
+	}
+
+	opts := bucketOptions{name: "delete-test", localStorage: dir}
+	s.Error(s3Delete(context.Background(), opts, reportOptions{format: "yaml"}, "repo/a.rpm"))
+
+	fileName := filepath.Join(dir, "report.json")
+	s.NoError(s3Delete(context.Background(), opts, reportOptions{format: "json", fileName: fileName},
+		"repo/a.rpm", "repo/missing.rpm"))
+
+	data, err := ioutil.ReadFile(fileName)
+	s.Require().NoError(err)
+	report := &sthree.SyncReport{}
+	s.Require().NoError(json.Unmarshal(data, report))
+	s.Equal("delete", report.Operation)
+	s.Require().Len(report.Items, 2)
+	s.Equal(sthree.SyncDelete, report.Items[0].Action)
+	s.Equal(sthree.SyncSkipMissing, report.Items[1].Action)
+
+	_, err = os.Stat(filepath.Join(dir, "delete-test", "repo", "a.rpm"))
+	s.True(os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(dir, "delete-test", "repo", "b.rpm"))
+	s.NoError(err)
 }
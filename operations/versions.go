@@ -0,0 +1,233 @@
+package operations
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mongodb/curator/sthree"
+	"github.com/pkg/errors"
+	"github.com/tychoish/grip"
+	"github.com/urfave/cli"
+	"golang.org/x/net/context"
+)
+
+func s3VersionsCmd() cli.Command {
+	return cli.Command{
+		Name:  "versions",
+		Usage: "list the versions and delete markers of the objects with a prefix",
+		Description: "Lists the versions and delete markers of the objects with the " +
+			"prefix, newest first, in buckets with S3 versioning enabled.",
+		Flags: baseS3Flags(s3outputFlags(s3versionFlags()...)...),
+		Action: func(c *cli.Context) error {
+			ctx, cancel, err := operationContext(c.String("timeout"))
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
+			return s3ListVersions(ctx, newBucketOptions(c), c.String("prefix"), c.Bool("json"), os.Stdout)
+		},
+	}
+}
+
+func s3RestoreCmd() cli.Command {
+	return cli.Command{
+		Name:  "restore",
+		Usage: "restore the objects with a prefix to their state at a point in time",
+		Description: "Rolls the objects with the prefix back to their state at the " +
+			"\"--time\", which is an RFC 3339 timestamp or a duration before now " +
+			"(e.g. \"36h\"): objects that changed since get a new copy of the " +
+			"version that was current at the time, and objects created since " +
+			"are deleted. Keeps all versions, so you can undo a restore with " +
+			"another restore.",
+		Flags: baseS3Flags(s3versionFlags(s3filterFlags(s3reportFlags(
+			cli.StringFlag{
+				Name: "time",
+				Usage: fmt.Sprintln("the point in time to restore to, as an RFC 3339 timestamp",
+					"(e.g. '2017-03-01T12:00:00Z'), or a duration before now (e.g. '36h')"),
+			})...)...)...),
+		Action: func(c *cli.Context) error {
+			ctx, cancel, err := operationContext(c.String("timeout"))
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
+			return s3Restore(ctx, newBucketOptions(c), c.String("prefix"), c.String("time"),
+				newFilterOptions(c), newReportOptions(c))
+		},
+	}
+}
+
+func s3UndeleteCmd() cli.Command {
+	return cli.Command{
+		Name:  "undelete",
+		Usage: "restore deleted objects with a prefix by removing their delete markers",
+		Description: "Restores deleted objects with the prefix, by removing the delete " +
+			"markers that are the latest versions of their keys.",
+		Flags: baseS3Flags(s3versionFlags(s3filterFlags(s3reportFlags()...)...)...),
+		Action: func(c *cli.Context) error {
+			ctx, cancel, err := operationContext(c.String("timeout"))
+			if err != nil {
+				return err
+			}
+			defer cancel()
+
+			return s3Undelete(ctx, newBucketOptions(c), c.String("prefix"), newFilterOptions(c),
+				newReportOptions(c))
+		},
+	}
+}
+
+func s3versionFlags(args ...cli.Flag) []cli.Flag {
+	flags := []cli.Flag{
+		cli.StringFlag{
+			Name:  "prefix",
+			Usage: "only consider the objects with keys that start with this prefix",
+		},
+	}
+
+	flags = append(flags, args...)
+	return flags
+}
+
+// parseRestoreTime returns the time of an RFC 3339 timestamp, or of a
+// duration before now.
+func parseRestoreTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, errors.New("specify a time to restore to")
+	}
+
+	if at, err := time.Parse(time.RFC3339, value); err == nil {
+		return at, nil
+	}
+
+	ago, err := time.ParseDuration(value)
+	if err != nil || ago < 0 {
+		return time.Time{}, errors.Errorf("'%s' is not an RFC 3339 timestamp or a positive duration",
+			value)
+	}
+
+	return now.Add(-ago), nil
+}
+
+func s3ListVersions(ctx context.Context, opts bucketOptions, prefix string, asJSON bool,
+	out io.Writer) error {
+	b, err := resolveBucket(opts)
+	if err != nil {
+		return err
+	}
+
+	versions, err := b.ListVersions(ctx, prefix)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		if versions == nil {
+			versions = []sthree.ObjectVersion{}
+		}
+		return writeJSON(out, versions)
+	}
+
+	w := tabwriter.NewWriter(out, 0, 8, 2, ' ', 0)
+	for _, version := range versions {
+		state := "    "
+		if version.IsLatest {
+			state = "LATEST"
+		}
+
+		details := fmt.Sprintf("%d\t%s", version.Size, strings.Trim(version.ETag, "\""))
+		if version.DeleteMarker {
+			details = "\tDELETED"
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t\n", version.LastModified.Format("2006-01-02 15:04:05"),
+			state, version.VersionID, details, version.Key)
+	}
+
+	return w.Flush()
+}
+
+func s3Restore(ctx context.Context, opts bucketOptions, prefix, at string, filter filterOptions,
+	reportOpts reportOptions) error {
+	if err := reportOpts.validate(); err != nil {
+		return err
+	}
+
+	restoreTime, err := parseRestoreTime(at, time.Now())
+	if err != nil {
+		return err
+	}
+
+	b, err := resolveBucket(opts)
+	if err != nil {
+		return err
+	}
+
+	if err = filter.configure(b); err != nil {
+		return err
+	}
+
+	err = b.Open(ctx)
+	defer b.Close()
+	if err != nil {
+		return err
+	}
+
+	if opts.dryRun {
+		b, err = b.DryRunClone()
+		defer b.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	report, err := b.RestoreTo(ctx, prefix, restoreTime)
+	if report != nil {
+		grip.CatchError(reportOpts.write(report))
+	}
+
+	return err
+}
+
+func s3Undelete(ctx context.Context, opts bucketOptions, prefix string, filter filterOptions,
+	reportOpts reportOptions) error {
+	if err := reportOpts.validate(); err != nil {
+		return err
+	}
+
+	b, err := resolveBucket(opts)
+	if err != nil {
+		return err
+	}
+
+	if err = filter.configure(b); err != nil {
+		return err
+	}
+
+	err = b.Open(ctx)
+	defer b.Close()
+	if err != nil {
+		return err
+	}
+
+	if opts.dryRun {
+		b, err = b.DryRunClone()
+		defer b.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	report, err := b.Undelete(ctx, prefix)
+	if report != nil {
+		grip.CatchError(reportOpts.write(report))
+	}
+
+	return err
+}
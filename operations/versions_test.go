@@ -0,0 +1,108 @@
+package operations
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/mongodb/curator/sthree"
+	"github.com/urfave/cli"
+	"golang.org/x/net/context"
+)
+
+func (s *CommandsSuite) TestVersionFlagsFactory() {
+	flags := s3versionFlags()
+	s.Len(flags, 1)
+	s.IsType(cli.StringFlag{}, flags[0])
+	s.Equal("prefix", flags[0].GetName())
+
+	for _, cmd := range []cli.Command{s3RestoreCmd(), s3UndeleteCmd()} {
+		names := make(map[string]bool)
+		for _, flag := range cmd.Flags {
+			names[flag.GetName()] = true
+		}
+
+		s.True(names["prefix"], cmd.Name)
+		s.True(names["include"], cmd.Name)
+		s.True(names["report"], cmd.Name)
+		s.True(names["dry-run"], cmd.Name)
+		s.Equal(cmd.Name == "restore", names["time"], cmd.Name)
+	}
+}
+
+func (s *CommandsSuite) TestParseRestoreTime() {
+	now := time.Date(2017, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	at, err := parseRestoreTime("2017-03-01T12:00:00Z", now)
+	s.NoError(err)
+	s.Equal(now.Add(-24*time.Hour), at)
+
+	at, err = parseRestoreTime("36h", now)
+	s.NoError(err)
+	s.Equal(now.Add(-36*time.Hour), at)
+
+	for _, value := range []string{"", "yesterday", "-1h", "2017-03-01"} {
+		_, err = parseRestoreTime(value, now)
+		s.Error(err, value)
+	}
+}
+
+func (s *CommandsSuite) TestVersionOperations() {
+	ctx := context.Background()
+	opts := bucketOptions{name: "versions-test"}
+
+	s.Require().NoError(s3Put(ctx, opts, metadataOptions{}, "versions.go", "versions/versions.go"))
+
+	out := &bytes.Buffer{}
+	s.NoError(s3ListVersions(ctx, opts, "versions/", true, out))
+	var versions []sthree.ObjectVersion
+	s.Require().NoError(json.Unmarshal(out.Bytes(), &versions))
+	s.Require().Len(versions, 1)
+	s.Equal("versions/versions.go", versions[0].Key)
+	s.True(versions[0].IsLatest)
+
+	out.Reset()
+	s.NoError(s3ListVersions(ctx, opts, "versions/", false, out))
+	s.Regexp(`LATEST\s+\S+\s+\d+\s+\w+\s+versions/versions.go`, out.String())
+
+	dir, err := ioutil.TempDir("", "versions-test")
+	s.Require().NoError(err)
+	defer os.RemoveAll(dir)
+
+	// a dry-run restore to before the upload plans to delete the
+	// object, and does not change the bucket.
+	fileName := filepath.Join(dir, "plan.json")
+	opts.dryRun = true
+	s.NoError(s3Restore(ctx, opts, "versions/", "1h", filterOptions{},
+		reportOptions{format: "json", fileName: fileName}))
+
+	data, err := ioutil.ReadFile(fileName)
+	s.Require().NoError(err)
+	report := &sthree.SyncReport{}
+	s.Require().NoError(json.Unmarshal(data, report))
+	s.Equal("restore", report.Operation)
+	s.True(report.DryRun)
+	s.Require().Len(report.Items, 1)
+	s.Equal(sthree.SyncDelete, report.Items[0].Action)
+
+	s.NoError(s3Undelete(ctx, opts, "versions/", filterOptions{}, reportOptions{}))
+
+	opts.dryRun = false
+	s.NoError(s3Restore(ctx, opts, "versions/", time.Now().Add(time.Minute).Format(time.RFC3339),
+		filterOptions{}, reportOptions{}))
+	exists, err := sthree.GetBucket("versions-test").Exists(ctx, "versions/versions.go")
+	s.NoError(err)
+	s.True(exists)
+
+	s.Error(s3Restore(ctx, opts, "versions/", "", filterOptions{}, reportOptions{}))
+	s.Error(s3Restore(ctx, opts, "versions/", "1h", filterOptions{}, reportOptions{format: "yaml"}))
+	s.Error(s3Undelete(ctx, opts, "versions/", filterOptions{include: []string{"[*.go"}},
+		reportOptions{}))
+
+	opts.localStorage = dir
+	s.Error(s3ListVersions(ctx, opts, "versions/", false, out))
+	s.Error(s3Undelete(ctx, opts, "versions/", filterOptions{}, reportOptions{}))
+}
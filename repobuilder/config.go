@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"io/ioutil"
 
+	"github.com/mongodb/curator/sthree"
 	"github.com/tychoish/grip"
 	"gopkg.in/yaml.v2"
 )
@@ -53,6 +54,52 @@ type RepositoryDefinition struct {
 	Edition       string   `bson:"edition" json:"edition" yaml:"edition"`
 	Architectures []string `bson:"architectures,omitempty" json:"architectures,omitempty" yaml:"architectures,omitempty"`
 	Component     string   `bson:"component" json:"component" yaml:"component"`
+
+	// Metadata holds the rules that set the headers and metadata
+	// of the files that the repository uploads. Repositories
+	// without rules use the default rules.
+	Metadata []sthree.MetadataRule `bson:"metadata,omitempty" json:"metadata,omitempty" yaml:"metadata,omitempty"`
+
+	// Encryption is the server-side encryption of the files that
+	// the repository uploads. Repositories without encryption use
+	// the default encryption of the bucket, if any.
+	Encryption sthree.Encryption `bson:"encryption,omitempty" json:"encryption,omitempty" yaml:"encryption,omitempty"`
+
+	// ACL holds the rules that set the permissions of the files
+	// that the repository uploads. Files that match no rule are
+	// public.
+	ACL []sthree.ACLRule `bson:"acl,omitempty" json:"acl,omitempty" yaml:"acl,omitempty"`
+}
+
+const (
+	shortCacheControl = "max-age=300"
+	longCacheControl  = "max-age=604800"
+)
+
+// defaultMetadataRules are the metadata rules of repositories that do
+// not define their own: the metadata and index pages of repositories,
+// which change every time the repository is rebuilt, are cached
+// briefly, while packages, which do not change, are cached for a
+// week.
+var defaultMetadataRules = []sthree.MetadataRule{
+	{Pattern: "*.deb", CacheControl: longCacheControl},
+	{Pattern: "*.rpm", CacheControl: longCacheControl},
+	{Pattern: "Release", CacheControl: shortCacheControl},
+	{Pattern: "Release.gpg", CacheControl: shortCacheControl},
+	{Pattern: "InRelease", CacheControl: shortCacheControl},
+	{Pattern: "Packages*", CacheControl: shortCacheControl},
+	{Pattern: "repomd.xml*", CacheControl: shortCacheControl},
+	{Pattern: "index.html", CacheControl: shortCacheControl},
+}
+
+// MetadataRules returns the metadata rules for the files of the
+// repository.
+func (dfn *RepositoryDefinition) MetadataRules() []sthree.MetadataRule {
+	if len(dfn.Metadata) == 0 {
+		return defaultMetadataRules
+	}
+
+	return dfn.Metadata
 }
 
 // NewRepositoryConfig produces a pointer to an initialized
@@ -123,6 +170,25 @@ func (c *RepositoryConfig) processRepos() error {
 			continue
 		}
 
+		for _, rule := range dfn.Metadata {
+			if err := rule.Validate(); err != nil {
+				catcher.Add(fmt.Errorf("invalid metadata for %s.%s: %s",
+					dfn.Edition, dfn.Name, err))
+			}
+		}
+
+		for _, rule := range dfn.ACL {
+			if err := rule.Validate(); err != nil {
+				catcher.Add(fmt.Errorf("invalid acl for %s.%s: %s",
+					dfn.Edition, dfn.Name, err))
+			}
+		}
+
+		if err := dfn.Encryption.Validate(); err != nil {
+			catcher.Add(fmt.Errorf("invalid encryption for %s.%s: %s",
+				dfn.Edition, dfn.Name, err))
+		}
+
 		if dfn.Type == DEB && len(dfn.Architectures) == 0 {
 			catcher.Add(fmt.Errorf("debian distro %s does not specify architecture list",
 				dfn.Name))
@@ -153,6 +219,33 @@ func (c *RepositoryConfig) GetRepositoryDefinition(name, edition string) (*Repos
 	return dfn, true
 }
 
+// bucketEncryption returns the encryption of the first repository in
+// the bucket that defines one, for jobs that rebuild the files of all
+// repositories in the bucket.
+func (c *RepositoryConfig) bucketEncryption(bucket string) sthree.Encryption {
+	for _, dfn := range c.Repos {
+		if dfn.Bucket == bucket && dfn.Encryption.Mode != sthree.EncryptionNone {
+			return dfn.Encryption
+		}
+	}
+
+	return sthree.Encryption{}
+}
+
+// bucketACLRules returns the ACL rules of all repositories in the
+// bucket, in the order of the configuration, for jobs that rebuild the
+// files of all repositories in the bucket.
+func (c *RepositoryConfig) bucketACLRules(bucket string) []sthree.ACLRule {
+	rules := []sthree.ACLRule{}
+	for _, dfn := range c.Repos {
+		if dfn.Bucket == bucket {
+			rules = append(rules, dfn.ACL...)
+		}
+	}
+
+	return rules
+}
+
 func (c *RepositoryDefinition) getArchForDistro(arch string) string {
 	if c.Type == DEB {
 		if arch == "x86_64" {
@@ -4,6 +4,8 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/goamz/goamz/s3"
+	"github.com/mongodb/curator/sthree"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 )
@@ -135,3 +137,103 @@ func (s *RepoConfigSuite) TestGetRepoMethodReturnsExpectedRepoObject() {
 	s.Equal(RPM, rhelEnterprise.Type)
 	s.Len(rhelEnterprise.Repos, 2)
 }
+
+func (s *RepoConfigSuite) TestMetadataRulesAreReadFromConfig() {
+	var err error
+
+	s.conf, err = GetConfig(s.file)
+	s.require.NoError(err)
+
+	rhel5, ok := s.conf.GetRepositoryDefinition("rhel5", "org")
+	s.require.True(ok)
+	rules := rhel5.MetadataRules()
+	s.require.Len(rules, 2)
+	s.Equal("*.rpm", rules[0].Pattern)
+	s.Equal("max-age=86400", rules[0].CacheControl)
+	s.Equal(map[string]string{"distro": "rhel5"}, rules[0].Meta)
+	s.Equal("repodata/", rules[1].Pattern)
+	s.Equal("no-cache", rules[1].CacheControl)
+
+	rhel7, ok := s.conf.GetRepositoryDefinition("rhel7", "org")
+	s.require.True(ok)
+	s.Equal(defaultMetadataRules, rhel7.MetadataRules())
+}
+
+func (s *RepoConfigSuite) TestInvalidMetadataRulesProduceError() {
+	s.conf.Repos = []*RepositoryDefinition{
+		{
+			Name:     "rhel7",
+			Type:     RPM,
+			Edition:  "org",
+			Metadata: []sthree.MetadataRule{{Pattern: "[*.rpm"}},
+		},
+	}
+
+	s.Error(s.conf.processRepos())
+}
+
+func (s *RepoConfigSuite) TestEncryptionIsReadFromConfig() {
+	var err error
+
+	s.conf, err = GetConfig(s.file)
+	s.require.NoError(err)
+
+	rhel6, ok := s.conf.GetRepositoryDefinition("rhel6", "org")
+	s.require.True(ok)
+	s.Equal(sthree.Encryption{Mode: sthree.EncryptionKMS, KMSKeyID: "alias/repo-test"},
+		rhel6.Encryption)
+
+	rhel7, ok := s.conf.GetRepositoryDefinition("rhel7", "org")
+	s.require.True(ok)
+	s.Equal(sthree.Encryption{}, rhel7.Encryption)
+
+	s.Equal(rhel6.Encryption, s.conf.bucketEncryption("repo-test.mongodb.org"))
+	s.Equal(sthree.Encryption{}, s.conf.bucketEncryption("other.mongodb.org"))
+}
+
+func (s *RepoConfigSuite) TestInvalidEncryptionProducesError() {
+	s.conf.Repos = []*RepositoryDefinition{
+		{
+			Name:       "rhel7",
+			Type:       RPM,
+			Edition:    "org",
+			Encryption: sthree.Encryption{Mode: sthree.EncryptionS3, KMSKeyID: "alias/repo-test"},
+		},
+	}
+
+	s.Error(s.conf.processRepos())
+}
+
+func (s *RepoConfigSuite) TestACLRulesAreReadFromConfig() {
+	var err error
+
+	s.conf, err = GetConfig(s.file)
+	s.require.NoError(err)
+
+	rhel6, ok := s.conf.GetRepositoryDefinition("rhel6", "org")
+	s.require.True(ok)
+	s.Equal([]sthree.ACLRule{
+		{Pattern: "*.rpm", ACL: s3.PublicRead},
+		{Pattern: "internal/", ACL: s3.Private},
+	}, rhel6.ACL)
+
+	rhel7, ok := s.conf.GetRepositoryDefinition("rhel7", "org")
+	s.require.True(ok)
+	s.Len(rhel7.ACL, 0)
+
+	s.Equal(rhel6.ACL, s.conf.bucketACLRules("repo-test.mongodb.org"))
+	s.Len(s.conf.bucketACLRules("other.mongodb.org"), 0)
+}
+
+func (s *RepoConfigSuite) TestInvalidACLRulesProduceError() {
+	s.conf.Repos = []*RepositoryDefinition{
+		{
+			Name:    "rhel7",
+			Type:    RPM,
+			Edition: "org",
+			ACL:     []sthree.ACLRule{{Pattern: "*.rpm", ACL: "public"}},
+		},
+	}
+
+	s.Error(s.conf.processRepos())
+}
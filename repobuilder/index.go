@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/mongodb/curator/sthree"
 	"github.com/tychoish/grip"
 )
 
@@ -56,6 +57,11 @@ func (c *RepositoryConfig) BuildIndexPageForDirectory(path, repoName string) err
 					return nil
 				}
 
+				// don't list the sync checksum cache
+				if filepath.Base(contentPath) == sthree.ChecksumCacheFileName {
+					return nil
+				}
+
 				// we want to avoid list things recursively on each page. instead we only things if
 				// it has one more element (i.e. a file name or sub directory) than the enclosing directory.
 				if getNumDirs(contentPath)-1 == numDirs {
@@ -6,21 +6,22 @@ import (
 	"github.com/mongodb/amboy/dependency"
 	"github.com/mongodb/amboy/job"
 	"github.com/mongodb/amboy/registry"
-	"github.com/mongodb/curator/sthree"
 	"github.com/pkg/errors"
 	"github.com/tychoish/grip"
+	"golang.org/x/net/context"
 )
 
 // IndexBuildJob implements the amboy.Job interface and provides a
 // mechanism to *only* rebuild index pages for a repository.
 type IndexBuildJob struct {
-	Conf      *RepositoryConfig `bson:"conf" json:"conf" yaml:"conf"`
-	Bucket    string            `bson:"bucket" json:"bucket" yaml:"bucket"`
-	Profile   string            `bson:"aws_profile" json:"aws_profile" yaml:"aws_profile"`
-	WorkSpace string            `bson:"local_workdir" json:"local_workdir" yaml:"local_workdir"`
-	RepoName  string            `bson:"repo_name" json:"repo_name" yaml:"repo_name"`
-	DryRun    bool              `bson:"dry_run" json:"dry_run" yaml:"dry_run"`
-	*job.Base `bson:"metadata" json:"metadata" yaml:"metadata"`
+	Conf         *RepositoryConfig `bson:"conf" json:"conf" yaml:"conf"`
+	Bucket       string            `bson:"bucket" json:"bucket" yaml:"bucket"`
+	Profile      string            `bson:"aws_profile" json:"aws_profile" yaml:"aws_profile"`
+	LocalStorage string            `bson:"local_storage" json:"local_storage" yaml:"local_storage"`
+	WorkSpace    string            `bson:"local_workdir" json:"local_workdir" yaml:"local_workdir"`
+	RepoName     string            `bson:"repo_name" json:"repo_name" yaml:"repo_name"`
+	DryRun       bool              `bson:"dry_run" json:"dry_run" yaml:"dry_run"`
+	*job.Base    `bson:"metadata" json:"metadata" yaml:"metadata"`
 }
 
 func init() {
@@ -53,9 +54,35 @@ func NewIndexBuildJob(conf *RepositoryConfig, workSpace, repoName, bucket string
 // Run downloads the repository, and generates index pages at all
 // levels of the repo.
 func (j *IndexBuildJob) Run() {
-	bucket := sthree.GetBucketWithProfile(j.Bucket, j.Profile)
+	j.RunContext(context.Background())
+}
+
+// RunContext rebuilds the index pages, as Run, but stops syncing
+// files to and from the bucket when the context is canceled.
+func (j *IndexBuildJob) RunContext(ctx context.Context) {
+	shared := getBucket(j.Bucket, j.Profile, j.LocalStorage)
 
-	err := bucket.Open()
+	// other jobs may use the shared bucket at the same time, so the
+	// settings of the index pages apply to a clone that the job
+	// owns.
+	bucket, err := shared.Clone()
+	if err != nil {
+		j.AddError(errors.Wrapf(err, "cloning bucket %s", shared))
+		return
+	}
+
+	catcher := grip.NewCatcher()
+	catcher.Add(bucket.SetMetadataRules(defaultMetadataRules))
+	if j.Conf != nil {
+		catcher.Add(bucket.SetEncryption(j.Conf.bucketEncryption(j.Bucket)))
+		catcher.Add(bucket.SetACLRules(j.Conf.bucketACLRules(j.Bucket)))
+	}
+	if catcher.HasErrors() {
+		j.AddError(errors.Wrapf(catcher.Resolve(), "configuring bucket %s", bucket))
+		return
+	}
+
+	err = bucket.Open(ctx)
 	if err != nil {
 		j.AddError(errors.Wrapf(err, "opening bucket %s", bucket))
 		return
@@ -72,19 +99,22 @@ func (j *IndexBuildJob) Run() {
 			return
 		}
 
-		err = bucket.Open()
+		err = bucket.Open(ctx)
 		if err != nil {
 			j.AddError(errors.Wrapf(err, "opening bucket %s [dry-run]", bucket))
 			return
 		}
 		defer bucket.Close()
 	}
+
+	// files are public unless an acl rule of a repository in the
+	// bucket matches them.
 	bucket.NewFilePermission = s3.PublicRead
 
 	defer j.MarkComplete()
 
 	grip.Infof("downloading from %s to %s", bucket, j.WorkSpace)
-	err = bucket.SyncFrom(j.WorkSpace, "", false)
+	_, err = bucket.SyncFrom(ctx, j.WorkSpace, "", false)
 	if err != nil {
 		j.AddError(errors.Wrapf(err, "sync from %s to %s", bucket, j.WorkSpace))
 		return
@@ -100,7 +130,7 @@ func (j *IndexBuildJob) Run() {
 		return
 	}
 
-	err = bucket.SyncTo(j.WorkSpace, "", false)
+	_, err = bucket.SyncTo(ctx, j.WorkSpace, "", false)
 	if err != nil {
 		j.AddError(errors.Wrapf(err, "problem uploading %s to %s",
 			j.WorkSpace, bucket))
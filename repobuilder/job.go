@@ -1,12 +1,14 @@
 package repobuilder
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/goamz/goamz/s3"
 	"github.com/mongodb/amboy"
@@ -17,6 +19,7 @@ import (
 	"github.com/mongodb/curator/sthree"
 	"github.com/pkg/errors"
 	"github.com/tychoish/grip"
+	"golang.org/x/net/context"
 )
 
 type jobImpl interface {
@@ -26,16 +29,22 @@ type jobImpl interface {
 
 // Job provides the common structure for a repository building Job.
 type Job struct {
-	Distro       *RepositoryDefinition `bson:"distro" json:"distro" yaml:"distro"`
-	Conf         *RepositoryConfig     `bson:"conf" json:"conf" yaml:"conf"`
-	DryRun       bool                  `bson:"dry_run" json:"dry_run" yaml:"dry_run"`
-	Output       map[string]string     `bson:"output" json:"output" yaml:"output"`
-	Version      string                `bson:"version" json:"version" yaml:"version"`
-	Arch         string                `bson:"arch" json:"arch" yaml:"arch"`
-	Profile      string                `bson:"aws_profile" json:"aws_profile" yaml:"aws_profile"`
-	WorkSpace    string                `bson:"local_workdir" json:"local_workdir" yaml:"local_workdir"`
-	PackagePaths []string              `bson:"package_paths" json:"package_paths" yaml:"package_paths"`
-	*job.Base    `bson:"metadata" json:"metadata" yaml:"metadata"`
+	Distro         *RepositoryDefinition `bson:"distro" json:"distro" yaml:"distro"`
+	Conf           *RepositoryConfig     `bson:"conf" json:"conf" yaml:"conf"`
+	DryRun         bool                  `bson:"dry_run" json:"dry_run" yaml:"dry_run"`
+	Output         map[string]string     `bson:"output" json:"output" yaml:"output"`
+	Version        string                `bson:"version" json:"version" yaml:"version"`
+	Arch           string                `bson:"arch" json:"arch" yaml:"arch"`
+	Profile        string                `bson:"aws_profile" json:"aws_profile" yaml:"aws_profile"`
+	LocalStorage   string                `bson:"local_storage" json:"local_storage" yaml:"local_storage"`
+	WorkSpace      string                `bson:"local_workdir" json:"local_workdir" yaml:"local_workdir"`
+	PackagePaths   []string              `bson:"package_paths" json:"package_paths" yaml:"package_paths"`
+	SyncReports    []*sthree.SyncReport  `bson:"sync_reports" json:"sync_reports" yaml:"sync_reports"`
+	BandwidthLimit int64                 `bson:"bandwidth_limit" json:"bandwidth_limit" yaml:"bandwidth_limit"`
+	MaxRequests    int                   `bson:"max_requests" json:"max_requests" yaml:"max_requests"`
+	Resume         bool                  `bson:"resume" json:"resume" yaml:"resume"`
+	ChecksumCache  bool                  `bson:"checksum_cache" json:"checksum_cache" yaml:"checksum_cache"`
+	*job.Base      `bson:"metadata" json:"metadata" yaml:"metadata"`
 
 	workingDirs []string
 	release     *curator.MongoDBVersion
@@ -243,10 +252,89 @@ func (j *Job) signFile(fileName, archiveExtension string, overwrite bool) error
 	return nil
 }
 
+// getBucket returns the bucket that repository jobs publish to: a
+// bucket using local storage, if localStorage is specified, or an S3
+// bucket using the credentials from the AWS profile.
+func getBucket(name, profile, localStorage string) *sthree.Bucket {
+	if localStorage != "" {
+		return sthree.GetLocalBucket(name, localStorage)
+	}
+
+	return sthree.GetBucketWithProfile(name, profile)
+}
+
+// addSyncReport records the report of a sync operation, if any.
+func (j *Job) addSyncReport(report *sthree.SyncReport) {
+	if report == nil {
+		return
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.SyncReports = append(j.SyncReports, report)
+}
+
+// syncProgressInterval is how often repository jobs log, and record
+// in their output, the progress of their sync operations.
+const syncProgressInterval = 30 * time.Second
+
+// recordProgress logs the progress of a sync operation, and records
+// it, as JSON, in the output of the job.
+func (j *Job) recordProgress(p sthree.SyncProgress) {
+	grip.Info(p.String())
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		grip.Warning(errors.Wrap(err, "problem encoding sync progress"))
+		return
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.Output["sync-"+p.Operation+"-"+p.Prefix] = string(data)
+}
+
 // Run is the main execution entry point into repository building, and is a component
 func (j *Job) Run() {
-	bucket := sthree.GetBucketWithProfile(j.Distro.Bucket, j.Profile)
-	err := bucket.Open()
+	j.RunContext(context.Background())
+}
+
+// RunContext builds the repository, as Run, but stops syncing files
+// to and from the bucket when the context is canceled. The sync
+// reports of the job describe the progress of canceled jobs.
+func (j *Job) RunContext(ctx context.Context) {
+	shared := getBucket(j.Distro.Bucket, j.Profile, j.LocalStorage)
+
+	// the limits are shared by all sync jobs of the bucket, and
+	// carry over to its clones.
+	catcher := grip.NewCatcher()
+	catcher.Add(shared.SetBandwidthLimit(j.BandwidthLimit))
+	catcher.Add(shared.SetMaxRequests(j.MaxRequests))
+	if catcher.HasErrors() {
+		j.AddError(errors.Wrapf(catcher.Resolve(), "configuring bucket %s", shared))
+		return
+	}
+
+	// other jobs may use the shared bucket at the same time, so the
+	// settings of this repository apply to a clone that the job
+	// owns, and carry over to the dry-run clone.
+	bucket, err := shared.Clone()
+	if err != nil {
+		j.AddError(errors.Wrapf(err, "cloning bucket %s", shared))
+		return
+	}
+
+	catcher.Add(bucket.SetMetadataRules(j.Distro.MetadataRules()))
+	catcher.Add(bucket.SetEncryption(j.Distro.Encryption))
+	catcher.Add(bucket.SetACLRules(j.Distro.ACL))
+	if catcher.HasErrors() {
+		j.AddError(errors.Wrapf(catcher.Resolve(), "configuring bucket %s", bucket))
+		return
+	}
+
+	err = bucket.Open(ctx)
 	if err != nil {
 		j.AddError(errors.Wrapf(err, "opening bucket %s", bucket))
 		return
@@ -263,7 +351,7 @@ func (j *Job) Run() {
 			return
 		}
 
-		err := bucket.Open()
+		err := bucket.Open(ctx)
 		if err != nil {
 			j.AddError(errors.Wrapf(err, "opening bucket %s [dry-run]", bucket))
 			return
@@ -271,8 +359,20 @@ func (j *Job) Run() {
 		defer bucket.Close()
 	}
 
+	// files are public unless an acl rule of the repository
+	// matches them.
 	bucket.NewFilePermission = s3.PublicRead
 
+	// when the workspace persists between rebuilds, cached checksums
+	// avoid hashing every package in the repository on every sync.
+	bucket.SetChecksumCache(j.ChecksumCache)
+
+	// with a persistent workspace, the journals of an interrupted
+	// build let the next build resume its syncs.
+	bucket.SetSyncJournal(j.Resume)
+
+	bucket.SetProgressHandler(syncProgressInterval, j.recordProgress)
+
 	defer j.MarkComplete()
 	wg := &sync.WaitGroup{}
 
@@ -294,7 +394,9 @@ func (j *Job) Run() {
 			}
 
 			grip.Infof("downloading from %s to %s", remote, local)
-			if err = bucket.SyncFrom(local, remote, false); err != nil {
+			report, err := bucket.SyncFrom(ctx, local, remote, false)
+			j.addSyncReport(report)
+			if err != nil {
 				j.AddError(errors.Wrapf(err, "sync from %s to %s", remote, local))
 				return
 			}
@@ -330,7 +432,8 @@ func (j *Job) Run() {
 			}
 
 			// do the sync. It's ok,
-			err = bucket.SyncTo(syncSource, filepath.Join(remote, changedComponent), false)
+			report, err = bucket.SyncTo(ctx, syncSource, filepath.Join(remote, changedComponent), false)
+			j.addSyncReport(report)
 			if err != nil {
 				j.AddError(errors.Wrapf(err, "problem uploading %s to %s/%s",
 					syncSource, bucket, changedComponent))
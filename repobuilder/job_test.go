@@ -1,13 +1,18 @@
 package repobuilder
 
 import (
+	"encoding/json"
+	"io/ioutil"
 	"os"
 	"testing"
 
+	"github.com/goamz/goamz/s3"
 	"github.com/mongodb/amboy/dependency"
+	"github.com/mongodb/curator/sthree"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"github.com/tychoish/grip"
+	"golang.org/x/net/context"
 )
 
 type RepoJobSuite struct {
@@ -48,3 +53,48 @@ func (s *RepoJobSuite) TestSetDependencyAcceptsDifferentAlwaysRunInstances() {
 	s.True(originalDep != s.j.Dependency())
 	s.Exactly(newDep, s.j.Dependency())
 }
+
+func (s *RepoJobSuite) TestProgressIsRecordedInOutput() {
+	progress := sthree.SyncProgress{Operation: "pull", Bucket: "repo", Prefix: "yum/redhat", Queued: 4}
+	progress.Completed = 1
+	s.j.recordProgress(progress)
+	progress.Completed = 4
+	progress.Done = true
+	s.j.recordProgress(progress)
+
+	s.Len(s.j.Output, 1)
+	p := sthree.SyncProgress{}
+	s.require.NoError(json.Unmarshal([]byte(s.j.Output["sync-pull-yum/redhat"]), &p))
+	s.Equal(4, p.Completed)
+	s.True(p.Done)
+}
+
+func (s *RepoJobSuite) TestJobsConfigureClonesOfTheSharedBucket() {
+	shared := sthree.GetBucketWithProfile("repobuilder-shared", "")
+	s.require.NotNil(shared)
+
+	workSpace, err := ioutil.TempDir("", "repobuilder")
+	s.require.NoError(err)
+	defer os.RemoveAll(workSpace)
+
+	s.j.WorkSpace = workSpace
+	s.j.Distro = &RepositoryDefinition{
+		Bucket:     "repobuilder-shared",
+		Encryption: sthree.Encryption{Mode: sthree.EncryptionS3},
+		ACL:        []sthree.ACLRule{{Pattern: "*.deb", ACL: s3.Private}},
+	}
+	s.j.RunContext(context.Background())
+	s.NoError(s.j.Error())
+
+	// the index job stops at its first sync, after configuring
+	// its bucket.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	index := NewIndexBuildJob(nil, workSpace, "", "repobuilder-shared", false)
+	index.RunContext(ctx)
+	s.Error(index.Error())
+
+	s.Len(shared.MetadataRules(), 0)
+	s.Equal(sthree.Encryption{}, shared.Encryption())
+	s.Len(shared.ACLRules(), 0)
+}
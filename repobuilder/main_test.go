@@ -0,0 +1,25 @@
+package repobuilder
+
+import (
+	"os"
+	"testing"
+
+	"github.com/mongodb/curator/sthree"
+	"github.com/mongodb/curator/sthree/fakes3"
+)
+
+// TestMain runs the tests in this package against an in-process fake
+// S3 server. Set the CURATOR_TEST_AWS environment variable to run the
+// tests against S3, using the default credentials.
+func TestMain(m *testing.M) {
+	srv, auth, region := fakes3.StartTestServer()
+	if srv == nil {
+		os.Exit(m.Run())
+	}
+
+	sthree.SetCredentials(sthree.AWSConnectionConfiguration{Auth: auth, Region: region})
+
+	code := m.Run()
+	srv.Close()
+	os.Exit(code)
+}
@@ -0,0 +1,185 @@
+package sthree
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/goamz/goamz/s3"
+	"github.com/pkg/errors"
+	"github.com/tychoish/grip"
+	"golang.org/x/net/context"
+)
+
+// ACLRule sets the canned ACL of uploaded and copied objects with keys
+// that match the pattern. Patterns are globs, with the same syntax as
+// the patterns of metadata rules.
+type ACLRule struct {
+	Pattern string `bson:"pattern" json:"pattern" yaml:"pattern"`
+	ACL     s3.ACL `bson:"acl" json:"acl" yaml:"acl"`
+}
+
+// ValidateACL returns an error if the ACL is not one of the canned ACLs
+// that S3 supports for objects.
+func ValidateACL(acl s3.ACL) error {
+	switch acl {
+	case s3.Private, s3.PublicRead, s3.PublicReadWrite, s3.AuthenticatedRead,
+		s3.BucketOwnerRead, s3.BucketOwnerFull:
+		return nil
+	default:
+		return errors.Errorf("'%s' is not a valid canned acl", acl)
+	}
+}
+
+// Validate returns an error if the pattern of the rule is not a valid
+// glob, or if the ACL of the rule is not valid.
+func (r ACLRule) Validate() error {
+	catcher := grip.NewCatcher()
+
+	if _, err := newGlobRule(r.Pattern); err != nil {
+		catcher.Add(errors.Wrap(err, "invalid acl rule"))
+	}
+
+	if err := ValidateACL(r.ACL); err != nil {
+		catcher.Add(errors.Wrapf(err, "invalid acl rule '%s'", r.Pattern))
+	}
+
+	return catcher.Resolve()
+}
+
+type aclRule struct {
+	ACLRule
+	glob *globRule
+}
+
+// SetACLRules sets the rules that determine the ACL of the objects that
+// Put, and therefore SyncTo, and CopyTo, and therefore SyncToBucket,
+// create in the bucket. The last rule that matches a key determines
+// its ACL, and objects with keys that match no rule use the
+// NewFilePermission of the bucket. Returns an error, and does not
+// change the rules of the bucket, if any rule is not valid.
+func (b *Bucket) SetACLRules(rules []ACLRule) error {
+	catcher := grip.NewCatcher()
+	compiled := make([]*aclRule, 0, len(rules))
+
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			catcher.Add(err)
+			continue
+		}
+
+		glob, _ := newGlobRule(rule.Pattern)
+		compiled = append(compiled, &aclRule{ACLRule: rule, glob: glob})
+	}
+
+	if catcher.HasErrors() {
+		return catcher.Resolve()
+	}
+
+	b.acl = compiled
+	return nil
+}
+
+// ACLRules returns the ACL rules of the bucket.
+func (b *Bucket) ACLRules() []ACLRule {
+	rules := make([]ACLRule, 0, len(b.acl))
+	for _, rule := range b.acl {
+		rules = append(rules, rule.ACLRule)
+	}
+
+	return rules
+}
+
+// permission returns the ACL of new objects with the key.
+func (b *Bucket) permission(key string) s3.ACL {
+	perm := b.NewFilePermission
+	name := strings.TrimPrefix(key, "/")
+
+	for _, rule := range b.acl {
+		if rule.glob.match(name) {
+			perm = rule.ACL
+		}
+	}
+
+	return perm
+}
+
+// SetACL replaces the ACL of every object with the prefix that matches
+// the filter of the bucket, using as many concurrent requests as the
+// bucket has jobs. When the ACL is empty, each object gets the ACL that
+// the ACL rules of the bucket, or its NewFilePermission, determine for
+// new objects with its key. Use SetACL to correct the permissions of
+// objects uploaded before a change to the rules. Returns an error if
+// the storage of the bucket does not support ACLs, or if any request
+// fails.
+func (b *Bucket) SetACL(ctx context.Context, prefix string, acl s3.ACL) error {
+	if acl != "" {
+		if err := ValidateACL(acl); err != nil {
+			return err
+		}
+	}
+
+	storage, ok := b.storage.(ACLStorage)
+	if !ok {
+		return errors.Errorf("the storage of bucket %s does not support acls", b.name)
+	}
+
+	keys := make(chan string)
+	go func() {
+		defer close(keys)
+		for item := range b.list(ctx, prefix) {
+			if !b.filter.Match(item.Key[len(prefix):]) {
+				grip.Debugf("%s/%s does not match the filter, not setting acl", b.name, item.Key)
+				continue
+			}
+
+			select {
+			case keys <- item.Key:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	numWorkers := b.numJobs
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+
+	catcher := grip.NewCatcher()
+	wg := &sync.WaitGroup{}
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keys {
+				perm := acl
+				if perm == "" {
+					perm = b.permission(key)
+				}
+
+				if b.dryRun {
+					grip.Noticef("dry-run: would set the acl of %s/%s to %s", b.name, key, perm)
+					continue
+				}
+
+				err := b.withRetries(ctx, fmt.Sprintf("set acl %s/%s", b.name, key), func() error {
+					return storage.SetACL(key, perm)
+				})
+				if err != nil {
+					catcher.Add(err)
+					continue
+				}
+
+				grip.Debugf("set the acl of %s/%s to %s", b.name, key, perm)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		catcher.Add(errors.Wrapf(err, "setting acls in %s/%s canceled", b.name, prefix))
+	}
+
+	return catcher.Resolve()
+}
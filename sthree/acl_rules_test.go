@@ -0,0 +1,165 @@
+package sthree
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/goamz/goamz/aws"
+	"github.com/goamz/goamz/s3"
+	"github.com/mongodb/curator/sthree/fakes3"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+// ACLRulesSuite tests the permissions of uploaded and copied objects,
+// and changes to the permissions of existing objects, using a fake S3
+// server.
+type ACLRulesSuite struct {
+	srv     *fakes3.Server
+	b       *Bucket
+	local   string
+	require *require.Assertions
+	suite.Suite
+}
+
+func TestACLRulesSuite(t *testing.T) {
+	suite.Run(t, new(ACLRulesSuite))
+}
+
+func (s *ACLRulesSuite) SetupSuite() {
+	s.require = s.Require()
+}
+
+func (s *ACLRulesSuite) SetupTest() {
+	s.srv = fakes3.NewServer()
+	auth := aws.Auth{AccessKey: "fake", SecretKey: "fake"}
+
+	s.b = &Bucket{
+		name:              "acl",
+		numJobs:           2,
+		NewFilePermission: s3.BucketOwnerFull,
+		retry:             RetryPolicy{MaxAttempts: 1},
+		storage:           NewS3Storage(s3.New(auth, s.srv.Region()).Bucket("acl")),
+	}
+	s.require.NoError(s.b.SetACLRules([]ACLRule{
+		{Pattern: "*.rpm", ACL: s3.PublicRead},
+		{Pattern: "repodata/", ACL: s3.PublicRead},
+		{Pattern: "internal-*.rpm", ACL: s3.Private},
+	}))
+	s.require.NoError(s.b.Open(context.Background()))
+
+	local, err := ioutil.TempDir("", uuid.NewV4().String())
+	s.require.NoError(err)
+	s.local = local
+
+	s.require.NoError(os.MkdirAll(filepath.Join(s.local, "repodata"), 0755))
+	for _, name := range []string{
+		"package.rpm",
+		"internal-package.rpm",
+		"manifest.json",
+		"repodata/repomd.xml",
+	} {
+		s.require.NoError(ioutil.WriteFile(filepath.Join(s.local, name), []byte(name), 0644))
+	}
+}
+
+func (s *ACLRulesSuite) TearDownTest() {
+	s.b.Close()
+	s.srv.Close()
+	s.NoError(os.RemoveAll(s.local))
+}
+
+func (s *ACLRulesSuite) TestValidation() {
+	s.NoError(ValidateACL(s3.PublicRead))
+	s.Error(ValidateACL(""))
+	s.Error(ValidateACL("public"))
+
+	s.NoError(ACLRule{Pattern: "*.deb", ACL: s3.Private}.Validate())
+	s.Error(ACLRule{Pattern: "[*.deb", ACL: s3.Private}.Validate())
+	s.Error(ACLRule{Pattern: "*.deb"}.Validate())
+
+	s.Error(s.b.SetACLRules([]ACLRule{
+		{Pattern: "*", ACL: s3.Private},
+		{Pattern: "*.deb", ACL: "public"},
+	}))
+	s.Len(s.b.ACLRules(), 3)
+}
+
+func (s *ACLRulesSuite) TestLastMatchingRuleDeterminesPermission() {
+	s.Equal(s3.PublicRead, s.b.permission("repo/x86_64/package.rpm"))
+	s.Equal(s3.Private, s.b.permission("repo/x86_64/internal-package.rpm"))
+	s.Equal(s3.PublicRead, s.b.permission("/repo/repodata/repomd.xml"))
+	s.Equal(s3.BucketOwnerFull, s.b.permission("repo/manifest.json"))
+
+	s.require.NoError(s.b.SetACLRules(nil))
+	s.Equal(s3.BucketOwnerFull, s.b.permission("repo/x86_64/package.rpm"))
+}
+
+func (s *ACLRulesSuite) TestSyncAppliesRules() {
+	_, err := s.b.SyncTo(context.Background(), s.local, "repo", false)
+	s.require.NoError(err)
+
+	s.Equal("public-read", s.srv.ACL("acl", "repo/package.rpm"))
+	s.Equal("private", s.srv.ACL("acl", "repo/internal-package.rpm"))
+	s.Equal("public-read", s.srv.ACL("acl", "repo/repodata/repomd.xml"))
+	s.Equal("bucket-owner-full-control", s.srv.ACL("acl", "repo/manifest.json"))
+}
+
+func (s *ACLRulesSuite) TestCopiesUseTargetRules() {
+	s.require.NoError(s.b.Put(context.Background(), filepath.Join(s.local, "manifest.json"),
+		"manifest.json"))
+
+	target, err := s.b.Clone()
+	s.require.NoError(err)
+	s.require.NoError(target.SetACLRules([]ACLRule{{Pattern: "*.json", ACL: s3.AuthenticatedRead}}))
+	s.require.NoError(s.b.CopyTo(context.Background(), target, "manifest.json", "copy.json"))
+
+	s.Equal("bucket-owner-full-control", s.srv.ACL("acl", "manifest.json"))
+	s.Equal("authenticated-read", s.srv.ACL("acl", "copy.json"))
+}
+
+func (s *ACLRulesSuite) TestSetACLChangesExistingObjects() {
+	s.require.NoError(s.b.SetACLRules(nil))
+	_, err := s.b.SyncTo(context.Background(), s.local, "repo", false)
+	s.require.NoError(err)
+	s.Equal("bucket-owner-full-control", s.srv.ACL("acl", "repo/package.rpm"))
+
+	filter := NewFilter()
+	s.require.NoError(filter.Include("*.rpm"))
+	s.b.SetFilter(filter)
+	s.NoError(s.b.SetACL(context.Background(), "repo", s3.PublicRead))
+	s.Equal("public-read", s.srv.ACL("acl", "repo/package.rpm"))
+	s.Equal("public-read", s.srv.ACL("acl", "repo/internal-package.rpm"))
+	s.Equal("bucket-owner-full-control", s.srv.ACL("acl", "repo/manifest.json"))
+
+	s.b.SetFilter(nil)
+	s.require.NoError(s.b.SetACLRules([]ACLRule{{Pattern: "internal-*", ACL: s3.Private}}))
+	s.NoError(s.b.SetACL(context.Background(), "repo", ""))
+	s.Equal("bucket-owner-full-control", s.srv.ACL("acl", "repo/package.rpm"))
+	s.Equal("private", s.srv.ACL("acl", "repo/internal-package.rpm"))
+
+	s.Error(s.b.SetACL(context.Background(), "repo", "public"))
+}
+
+func (s *ACLRulesSuite) TestSetACLWithOneRequestAtATime() {
+	_, err := s.b.SyncTo(context.Background(), s.local, "repo", false)
+	s.require.NoError(err)
+
+	s.require.NoError(s.b.SetMaxRequests(1))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	s.NoError(s.b.SetACL(ctx, "repo", s3.AuthenticatedRead))
+	s.Equal("authenticated-read", s.srv.ACL("acl", "repo/package.rpm"))
+	s.Equal("authenticated-read", s.srv.ACL("acl", "repo/repodata/repomd.xml"))
+}
+
+func (s *ACLRulesSuite) TestSetACLRequiresACLStorage() {
+	s.b.SetStorage(NewFileSystemStorage(s.local))
+	s.Error(s.b.SetACL(context.Background(), "", s3.PublicRead))
+}
@@ -1,10 +1,13 @@
 package sthree
 
 import (
+	"crypto/md5"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"mime"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -14,7 +17,6 @@ import (
 
 	"github.com/goamz/goamz/aws"
 	"github.com/goamz/goamz/s3"
-	"github.com/jpillora/backoff"
 	"github.com/mongodb/amboy"
 	"github.com/mongodb/amboy/queue"
 	"github.com/pkg/errors"
@@ -37,44 +39,118 @@ func init() {
 	rand.Seed(time.Now().Unix())
 }
 
-func getBackoff() *backoff.Backoff {
-	return &backoff.Backoff{
-		Min:    100 * time.Millisecond,
-		Max:    5 * time.Second,
-		Factor: 2,
-		Jitter: true,
-	}
-}
+// getTempPrefix is the prefix of the temporary files that Get writes
+// downloads to before renaming them into place.
+const getTempPrefix = ".sthree-get-"
 
 // AWSConnectionConfiguration defines configuration, including
 // authentication credentials and AWS region, used when creating new
 // connections to AWS components.
 type AWSConnectionConfiguration struct {
 	// AWS auth credentials, using a type defined in the goamz
-	// package.
+	// package. Only used when Credentials is nil.
 	Auth aws.Auth
 
+	// Credentials, if specified, provide the credentials for each
+	// request, which makes it possible to use temporary
+	// credentials that refresh before they expire (see
+	// DefaultCredentials.) Connections with temporary credentials
+	// always use version 4 signatures.
+	Credentials CredentialProvider
+
 	// Specify a region to use in the AWS connection. For S3
 	// operations this should not matter.
 	Region aws.Region
+
+	// Endpoint, if specified, is the URL of an S3-compatible
+	// object store (e.g. MinIO or Ceph) to use instead of the S3
+	// endpoint for the Region.
+	Endpoint string
+
+	// PathStyle, when true, addresses buckets as the first
+	// component of the path (e.g. "<endpoint>/<bucket>/<key>")
+	// rather than as a sub-domain of the endpoint's host. Only
+	// applies when Endpoint is specified. Most S3-compatible
+	// stores require path-style addressing.
+	PathStyle bool
+
+	// SignatureV4, when true, signs requests with version 4
+	// signatures rather than version 2 signatures. Buckets with
+	// SSE-KMS encryption always use version 4 signatures.
+	SignatureV4 bool
+}
+
+// region returns the goamz region for the connection, with the S3
+// endpoint and bucket addressing style overridden if the
+// configuration specifies a custom endpoint.
+func (c AWSConnectionConfiguration) region() aws.Region {
+	region := c.Region
+	if c.Endpoint == "" {
+		return region
+	}
+
+	region.S3Endpoint = strings.TrimRight(c.Endpoint, "/")
+	region.S3BucketEndpoint = ""
+
+	if !c.PathStyle {
+		if u, err := url.Parse(region.S3Endpoint); err == nil {
+			region.S3BucketEndpoint = fmt.Sprintf("%s://${bucket}.%s", u.Scheme, u.Host)
+		}
+	}
+
+	return region
+}
+
+// newStorage returns a Storage implementation for the named S3
+// bucket that uses the connection configuration. Storage for
+// connections with credential providers uses version 2 signatures
+// only if the current credentials are static and the configuration
+// does not require version 4 signatures.
+func (c AWSConnectionConfiguration) newStorage(name string) Storage {
+	if c.Credentials == nil {
+		return newS3Storage(s3.New(c.Auth, c.region()).Bucket(name), c.SignatureV4)
+	}
+
+	creds, err := c.Credentials.Retrieve()
+	if err != nil {
+		grip.Warning(errors.Wrapf(err, "problem retrieving credentials for bucket '%s'", name))
+	} else if !c.SignatureV4 && creds.SessionToken == "" && creds.Expiration.IsZero() {
+		auth := aws.Auth{AccessKey: creds.AccessKey, SecretKey: creds.SecretKey}
+		return newS3Storage(s3.New(auth, c.region()).Bucket(name), false)
+	}
+
+	return newS3StorageWithCredentials(s3.New(aws.Auth{}, c.region()).Bucket(name), c.Credentials)
 }
 
 // Bucket defines a tracking object for a bucket. Create access using the
 // global GetBucket factory, which allows users to pool bucket operations.
 type Bucket struct {
 	// The permission defined by NewFilePermission is used for all
-	// Put operations in the bucket.
-	NewFilePermission s3.ACL
-	dryRun            bool
-	credentials       AWSConnectionConfiguration
-	bucket            *s3.Bucket
-	s3                *s3.S3
-	name              string
-	numJobs           int
-	numRetries        int
-	queue             amboy.Queue
-	mutex             sync.Mutex
-	closer            context.CancelFunc
+	// Put operations in the bucket, except for keys that match an
+	// ACL rule (see SetACLRules).
+	NewFilePermission  s3.ACL
+	dryRun             bool
+	credentials        AWSConnectionConfiguration
+	storage            Storage
+	name               string
+	numJobs            int
+	retry              RetryPolicy
+	multipartThreshold int64
+	partSize           int64
+	compareMode        CompareMode
+	useChecksumCache   bool
+	useSyncJournal     bool
+	filter             *Filter
+	metadata           []*metadataRule
+	acl                []*aclRule
+	encryption         Encryption
+	bandwidth          *bandwidthLimiter
+	requests           requestLimiter
+	progressHandler    ProgressHandler
+	progressInterval   time.Duration
+	queue              amboy.Queue
+	mutex              sync.Mutex
+	closer             context.CancelFunc
 }
 
 // NewBucket clones the settings of one bucket into a new bucket. The
@@ -82,11 +158,28 @@ type Bucket struct {
 // it is closed.
 func (b *Bucket) NewBucket(name string) *Bucket {
 	new := &Bucket{
-		name:              name,
-		NewFilePermission: b.NewFilePermission,
-		credentials:       b.credentials,
-		numJobs:           b.numJobs,
-		numRetries:        20,
+		name:               name,
+		NewFilePermission:  b.NewFilePermission,
+		credentials:        b.credentials,
+		numJobs:            b.numJobs,
+		retry:              b.retry,
+		multipartThreshold: b.multipartThreshold,
+		partSize:           b.partSize,
+		compareMode:        b.compareMode,
+		useChecksumCache:   b.useChecksumCache,
+		useSyncJournal:     b.useSyncJournal,
+		filter:             b.filter,
+		metadata:           b.metadata,
+		acl:                b.acl,
+		encryption:         b.encryption,
+		bandwidth:          newBandwidthLimiter(b.bandwidth.limit()),
+		requests:           newRequestLimiter(cap(b.requests)),
+		progressHandler:    b.progressHandler,
+		progressInterval:   b.progressInterval,
+	}
+
+	if fs, ok := b.storage.(*fileStorage); ok {
+		new.storage = NewFileSystemStorage(filepath.Join(filepath.Dir(fs.root), name))
 	}
 
 	buckets.registerBucket(new)
@@ -106,7 +199,7 @@ func (b *Bucket) DryRunClone() (*Bucket, error) {
 	clone.dryRun = true
 
 	if b.queue != nil {
-		err = clone.Open()
+		err = clone.Open(context.Background())
 		if err != nil {
 			return nil, err
 		}
@@ -119,15 +212,29 @@ func (b *Bucket) DryRunClone() (*Bucket, error) {
 // resource.
 func (b *Bucket) Clone() (*Bucket, error) {
 	clone := &Bucket{
-		name:              b.name,
-		NewFilePermission: b.NewFilePermission,
-		credentials:       b.credentials,
-		numJobs:           b.numJobs,
-		numRetries:        b.numRetries,
+		name:               b.name,
+		NewFilePermission:  b.NewFilePermission,
+		credentials:        b.credentials,
+		storage:            b.storage,
+		numJobs:            b.numJobs,
+		retry:              b.retry,
+		multipartThreshold: b.multipartThreshold,
+		partSize:           b.partSize,
+		compareMode:        b.compareMode,
+		useChecksumCache:   b.useChecksumCache,
+		useSyncJournal:     b.useSyncJournal,
+		filter:             b.filter,
+		metadata:           b.metadata,
+		acl:                b.acl,
+		encryption:         b.encryption,
+		bandwidth:          b.bandwidth,
+		requests:           b.requests,
+		progressHandler:    b.progressHandler,
+		progressInterval:   b.progressInterval,
 	}
 
 	if b.queue != nil {
-		err := clone.Open()
+		err := clone.Open(context.Background())
 		if err != nil {
 			return nil, err
 		}
@@ -145,16 +252,29 @@ func (b *Bucket) String() string {
 // picked from either the AWS_ACCESS_KEY_ID and AWS_ACCESS_KEY
 // environment variables or, if they are not defined then from the
 // "$HOME/.aws/credentials" file (using the "default" profile unless
-// the AWS_PROFILE environment variable is set.)
+// the AWS_PROFILE environment variable is set), or the instance
+// metadata service (see DefaultCredentials.)
 //
 // This method redefines the internal representation of the
 // credentials and connection to S3. Callers can use this function
 // after the connection is open, *but* this may affect in progress
-// jobs in undefined ways.
+// jobs in undefined ways. Buckets with SSE-KMS encryption always use
+// version 4 signatures.
 func (b *Bucket) SetCredentials(c AWSConnectionConfiguration) {
+	if b.encryption.Mode == EncryptionKMS {
+		c.SignatureV4 = true
+	}
 	b.credentials = c
-	b.s3 = s3.New(b.credentials.Auth, b.credentials.Region)
-	b.bucket = b.s3.Bucket(b.name)
+	b.storage = b.credentials.newStorage(b.name)
+}
+
+// SetStorage replaces the storage backend that the Bucket uses for
+// all operations, which makes it possible to use a Bucket with
+// non-S3 storage (see NewFileSystemStorage.) Callers should set the
+// storage before opening the bucket, as changing the storage of an
+// open Bucket may affect in progress jobs in undefined ways.
+func (b *Bucket) SetStorage(s Storage) {
+	b.storage = s
 }
 
 // SetNumJobs allows callers to change the number of worker threads
@@ -172,35 +292,33 @@ func (b *Bucket) SetNumJobs(n int) error {
 	return nil
 }
 
-// SetNumRetries allows callers to change the number of retries put
-// and get operations will take in the cse of an error.
+// SetNumRetries allows callers to change the number of attempts
+// operations make in the case of an error, without changing the other
+// settings of the bucket's retry policy.
 func (b *Bucket) SetNumRetries(n int) error {
 	if n <= 0 {
 		return errors.Errorf("numRetries=%d, must be larger than 0", n)
 	}
 
-	b.numRetries = n
+	b.retry.MaxAttempts = n
 	return nil
 }
 
 // Open creates connections to S3 and starts a the worker pool to
-// process sync to/from jobs. Returns an error if there are issues
-// creating creating the worker queue. Does *not* return an error if
-// the Bucket has been opened, and is a noop in this case.
-func (b *Bucket) Open() error {
-	if b.s3 == nil {
-		b.s3 = s3.New(b.credentials.Auth, b.credentials.Region)
-	}
-
-	if b.bucket == nil || b.bucket.Name != b.name {
-		b.bucket = b.s3.Bucket(b.name)
+// process sync to/from jobs. The workers stop when the context is
+// canceled or when the Bucket is closed. Returns an error if there are
+// issues creating creating the worker queue. Does *not* return an
+// error if the Bucket has been opened, and is a noop in this case.
+func (b *Bucket) Open(ctx context.Context) error {
+	if b.storage == nil {
+		b.storage = b.credentials.newStorage(b.name)
 	}
 
 	b.mutex.Lock()
 	defer b.mutex.Unlock()
 
 	if b.queue == nil {
-		ctx, cancel := context.WithCancel(context.TODO())
+		ctx, cancel := context.WithCancel(ctx)
 		b.closer = cancel
 
 		b.queue = queue.NewLocalUnordered(b.numJobs)
@@ -241,8 +359,9 @@ func (b *Bucket) IsOpen() bool {
 // list returns a channel of strings of key names in the bucket. Allows
 // you to specify a prefix key that will limit the results returned in
 // the channel. If you do not want to limit using a prefix, pass an
-// empty string as the sole argument for list().
-func (b *Bucket) list(prefix string) <-chan s3.Key {
+// empty string as the prefix. The channel closes early if the context
+// is canceled.
+func (b *Bucket) list(ctx context.Context, prefix string) <-chan s3.Key {
 	output := make(chan s3.Key, 100)
 
 	// if the prefix doesn't have a trailing slash and isn't the
@@ -254,7 +373,7 @@ func (b *Bucket) list(prefix string) <-chan s3.Key {
 	go func() {
 		var lastKey string
 		for {
-			results, err := b.bucket.List(prefix, "", lastKey, 1000)
+			results, err := b.listPage(ctx, prefix, "", lastKey)
 			if err != nil {
 				grip.Error(err)
 				break
@@ -263,7 +382,12 @@ func (b *Bucket) list(prefix string) <-chan s3.Key {
 			for _, key := range results.Contents {
 				lastKey = key.Key
 
-				output <- key
+				select {
+				case output <- key:
+				case <-ctx.Done():
+					close(output)
+					return
+				}
 			}
 
 			if !results.IsTruncated {
@@ -278,58 +402,82 @@ func (b *Bucket) list(prefix string) <-chan s3.Key {
 
 // contents wraps and operates as list, but returns a map of names to
 // s3Item objects for random access patterns.
-func (b *Bucket) contents(prefix string) map[string]s3.Key {
+func (b *Bucket) contents(ctx context.Context, prefix string) map[string]s3.Key {
 	output := make(map[string]s3.Key)
 
-	for file := range b.list(prefix) {
+	for file := range b.list(ctx, prefix) {
 		output[file.Key] = file
 	}
 
 	return output
 }
 
-// Exists checks to see if a key exists in the bucket, retrying the request, if needed.
-func (b *Bucket) Exists(path string) (bool, error) {
+// Exists checks to see if a key exists in the bucket, retrying the
+// request, if needed, according to the bucket's retry policy.
+func (b *Bucket) Exists(ctx context.Context, path string) (bool, error) {
 	var exists bool
-	var err error
 
-	backoff := getBackoff()
+	err := b.withRetries(ctx, fmt.Sprintf("check existence of %s/%s", b.name, path), func() error {
+		var err error
+		exists, err = b.storage.Exists(path)
+		return err
+	})
 
-	for i := 1; i <= b.numRetries; i++ {
-		exists, err = b.bucket.Exists(path)
-		if err == nil {
-			return exists, nil
-		}
+	return exists, err
+}
 
-		err = errors.Wrapf(err, "error s3.EXISTS for %s/%s on attempt %d", b.name, path, i)
+// head returns information about the object at "path", or nil if the
+// object does not exist, in a retry loop.
+func (b *Bucket) head(ctx context.Context, path string) (*ObjectInfo, error) {
+	var info *ObjectInfo
 
-		if i < b.numRetries {
-			dur := backoff.Duration()
-			grip.Debugf("retrying s3.EXISTS attempt %d of %d (after %s), for %s (%+v)",
-				i, b.numRetries, dur, path, err)
-			time.Sleep(dur)
-		}
-	}
+	err := b.withRetries(ctx, fmt.Sprintf("check %s/%s", b.name, path), func() error {
+		var err error
+		info, err = b.storage.Head(path)
+		return err
+	})
 
-	return exists, err
+	return info, err
 }
 
 // Put uploads the local fileName to the remote path object in the
 // current bucket. Put attempts to determine the content type based on
 // the extension of the file, and defaults to "text/plain" if the
-// extension is not known. The permissions on the object use the value
-// of the Bucket.NewFilePermission property. Returns an error if the
-// underlying Put operation returns an error.
-func (b *Bucket) Put(fileName, path string) error {
-	if _, err := os.Stat(fileName); os.IsNotExist(err) {
+// extension is not known. The metadata rules of the bucket (see
+// SetMetadataRules) determine the other headers of the object, and
+// may override the content type, and the encryption of the bucket
+// (see SetEncryption) determines the encryption of the object. The
+// ACL rules of the bucket (see SetACLRules), or the
+// Bucket.NewFilePermission property, determine the permissions on the
+// object. Files larger than the multipart threshold (see
+// SetMultipartThreshold) upload in parts. Put stores
+// the modification time of the file in the object's metadata, for
+// sync operations, and with SSE-KMS encryption, the checksum of the
+// file. Returns an error if the underlying Put operation returns an
+// error, or if the context is canceled before the upload completes.
+func (b *Bucket) Put(ctx context.Context, fileName, path string) error {
+	if err := ctx.Err(); err != nil {
+		return errors.Wrapf(err, "upload of %s/%s canceled", b.name, path)
+	}
+
+	info, err := os.Stat(fileName)
+	if os.IsNotExist(err) {
 		return errors.Errorf("file '%s' does not exist", fileName)
 	}
+	if err != nil {
+		return errors.Wrapf(err, "error checking file '%s' before s3.Put", fileName)
+	}
 
-	mimeType := getMimeType(fileName)
-	contents, err := ioutil.ReadFile(fileName)
+	mimeType, opts := b.uploadOptions(path, getMimeType(fileName))
+	opts.Meta[mtimeMetadataKey] = []string{formatModTime(info.ModTime())}
+	opts.Encryption = b.encryption
 
-	if err != nil {
-		return errors.Wrapf(err, "error reading file '%s' before s3.Put", fileName)
+	if b.encryption.Mode == EncryptionKMS && !b.dryRun {
+		checksum, err := md5sum(fileName)
+		if err != nil {
+			return errors.Wrapf(err, "problem hashing '%s' before upload", fileName)
+		}
+		opts.Meta[checksumMetadataKey] = []string{checksum}
 	}
 
 	if b.dryRun {
@@ -337,33 +485,41 @@ func (b *Bucket) Put(fileName, path string) error {
 		return nil
 	}
 
-	// do put in a retry loop:
-	catcher := grip.NewCatcher()
-	backoff := getBackoff()
-	for i := 1; i <= b.numRetries; i++ {
-		err = b.bucket.Put(path, contents, mimeType, b.NewFilePermission, s3.Options{})
-		if err == nil {
-			grip.Debugf("uploaded %s -> %s/%s", fileName, b.name, path)
-			return nil
+	if mp, ok := b.useMultipart(info.Size()); ok {
+		err = b.putMultipart(ctx, mp, fileName, path, info.Size(), mimeType, opts)
+		if err != nil {
+			return errors.Wrapf(err, "could not upload %s/%s", b.name, path)
 		}
 
-		catcher.Add(errors.Wrapf(err, "error s3.PUT for %s/%s on attempt %d", path, b.name, i))
-
-		if i < b.numRetries {
-			grip.Warningln(err, "retrying...")
-			time.Sleep(backoff.Duration())
-			grip.Debugf("retrying s3.GET %d of %d, for %s", i, b.numRetries, path)
-		}
+		grip.Debugf("uploaded %s -> %s/%s", fileName, b.name, path)
+		return nil
 	}
 
-	if catcher.HasErrors() {
-		return errors.Errorf("could not upload %s/%s in %d attempts. Errors: %s",
-			b.name, path, b.numRetries, catcher.Resolve())
+	err = b.withRetries(ctx, fmt.Sprintf("upload %s/%s", b.name, path), func() error {
+		return b.putFile(ctx, fileName, path, info.Size(), mimeType, opts)
+	})
+	if err != nil {
+		return err
 	}
 
+	grip.Debugf("uploaded %s -> %s/%s", fileName, b.name, path)
 	return nil
 }
 
+// putFile streams the content of the local file to the object at
+// "path". Each attempt reopens the file, so that retries always
+// upload the file from the beginning.
+func (b *Bucket) putFile(ctx context.Context, fileName, path string, size int64, mimeType string,
+	opts UploadOptions) error {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return errors.Wrapf(err, "error opening file '%s' before s3.Put", fileName)
+	}
+	defer f.Close()
+
+	return b.storage.Put(path, b.transferReader(ctx, f), size, mimeType, b.permission(path), opts)
+}
+
 // getMimeType takes a file name, attempts to determine the extension
 // and resolve a MIME type for this value. If there is no resolvable
 // MIME type, getMimeType returns "text/plain". This is only used in
@@ -379,43 +535,36 @@ func getMimeType(fileName string) string {
 	return mimeType
 }
 
-// Get writes the content of the S3 object located at "path" to the
-// local file at the "fileName", creating enclosing directories as
-// needed.
-func (b *Bucket) Get(path, fileName string) error {
-	// do put in a retry loop:
-	catcher := grip.NewCatcher()
-
-	var data []byte
-	var err error
-
-	backoff := getBackoff()
-	for i := 1; i <= b.numRetries; i++ {
-		data, err = b.bucket.Get(path)
-
-		if err == nil {
-			grip.Debugf("downloaded %s/%s -> %s", b.name, path, fileName)
-			catcher = grip.NewCatcher() // reset the error handler in the case of success
-			break
-		}
-
-		catcher.Add(errors.Wrap(err, "aws error from s3.Get"))
+// md5sum returns the hex encoded MD5 checksum of the content of the
+// file, without reading the entire file into memory.
+func md5sum(fileName string) (string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return "", errors.Wrapf(err, "problem opening '%s'", fileName)
+	}
+	defer f.Close()
 
-		if i < b.numRetries {
-			grip.Warningln(err, "retrying...")
-			time.Sleep(backoff.Duration())
-			grip.Debugf("retrying s3.GET %d of %d, for %s", i, b.numRetries, path)
-		}
+	hash := md5.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return "", errors.Wrapf(err, "problem reading '%s'", fileName)
 	}
 
-	// return early if we encountered an error attempting to build
-	if catcher.HasErrors() {
-		return errors.Errorf("could not download %s/%s in %d attempts. Errors: %s",
-			b.name, path, b.numRetries, catcher.Resolve())
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// Get writes the content of the S3 object located at "path" to the
+// local file at the "fileName", creating enclosing directories as
+// needed. The content is streamed to a temporary file in the same
+// directory, which replaces "fileName" only after the download
+// completes, so failed and canceled downloads never leave a partial
+// file.
+func (b *Bucket) Get(ctx context.Context, path, fileName string) error {
+	if err := ctx.Err(); err != nil {
+		return errors.Wrapf(err, "download of %s/%s canceled", b.name, path)
 	}
 
 	dirName := filepath.Dir(fileName)
-	if _, err = os.Stat(dirName); os.IsNotExist(err) {
+	if _, err := os.Stat(dirName); os.IsNotExist(err) {
 		err = os.MkdirAll(dirName, 0755)
 		if err != nil {
 			return errors.Wrap(err, "creating directory for s3.Get operations")
@@ -423,12 +572,55 @@ func (b *Bucket) Get(path, fileName string) error {
 		grip.Debugf("created directory '%s' for object %s", dirName, fileName)
 	}
 
-	return errors.Wrapf(ioutil.WriteFile(fileName, data, 0644),
-		"writing file %s during s3 get", fileName)
+	err := b.withRetries(ctx, fmt.Sprintf("download %s/%s", b.name, path), func() error {
+		return b.getFile(ctx, path, fileName)
+	})
+	if err != nil {
+		return err
+	}
+
+	grip.Debugf("downloaded %s/%s -> %s", b.name, path, fileName)
+	return nil
+}
+
+// getFile streams the object at "path" into a temporary file next to
+// "fileName", and renames the temporary file into place if the
+// download succeeds. Otherwise getFile removes the temporary file.
+func (b *Bucket) getFile(ctx context.Context, path, fileName string) error {
+	reader, err := b.storage.Get(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	tmp, err := ioutil.TempFile(filepath.Dir(fileName), getTempPrefix)
+	if err != nil {
+		return errors.Wrapf(err, "creating temporary file for %s", fileName)
+	}
+
+	_, err = io.Copy(tmp, b.transferReader(ctx, reader))
+	grip.CatchError(tmp.Close())
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), fileName)
+	}
+
+	if err != nil {
+		grip.CatchError(os.Remove(tmp.Name()))
+		return errors.Wrapf(err, "writing file %s during s3 get", fileName)
+	}
+
+	return nil
 }
 
 // Delete removes a single object from an S3 bucket.
-func (b *Bucket) Delete(path string) error {
+func (b *Bucket) Delete(ctx context.Context, path string) error {
+	if err := ctx.Err(); err != nil {
+		return errors.Wrapf(err, "delete of %s/%s canceled", b.name, path)
+	}
+
 	grip.Noticef("removing %s.%s", b.name, path)
 
 	if b.dryRun {
@@ -436,51 +628,120 @@ func (b *Bucket) Delete(path string) error {
 		return nil
 	}
 
-	return errors.Wrapf(b.bucket.Del(path), "deleting %s from %s", path, b.name)
+	err := b.request(ctx, func() error { return b.storage.Delete(path) })
+	return errors.Wrapf(err, "deleting %s from %s", path, b.name)
 }
 
-// DeleteMany takes a variable number of strings, and sends a single
-// request to S3 to delete those keys from the bucket.
-func (b *Bucket) DeleteMany(paths ...string) error {
-	if len(paths) == 1 {
-		// getting the bucket contents is a comparatively
-		// expensive operation so makes sense to avoid it in
-		// this case.
-		if b.dryRun {
-			grip.Infof("dry-run: deleting object %s as a single object in a multi-delete call", paths[0])
-			return nil
-		}
-		return errors.Wrap(b.Delete(paths[0]), "single delete operation in multi-delete call")
-	}
-
-	contents := b.contents("")
-	toDelete := make(chan s3.Key)
+// DeleteMany deletes the objects with the keys, in batches of up to
+// 1000 keys per request. Rather than listing the bucket, DeleteMany
+// checks that each object exists with a HEAD request, using as many
+// concurrent requests as the bucket has jobs, and skips keys without
+// objects. Returns a report of the result for each key: deleted,
+// skipped because the object does not exist, or failed, with the
+// error of the check, of the request, or that S3 reported for the key
+// in the response to the request. Returns an error if any check or
+// deletion fails. In dry-run mode, the report is the plan of the
+// operation.
+func (b *Bucket) DeleteMany(ctx context.Context, paths ...string) (*SyncReport, error) {
+	report := newSyncReport(b, "delete", "")
+
+	keys := make(chan string)
 	go func() {
+		defer close(keys)
+		seen := make(map[string]bool, len(paths))
 		for _, p := range paths {
-			key, ok := contents[p]
-			if !ok {
-				grip.Warningf("path %s does not exist in bucket %s", p, b.name)
+			if seen[p] {
 				continue
 			}
+			seen[p] = true
 
-			toDelete <- key
+			select {
+			case keys <- p:
+			case <-ctx.Done():
+				return
+			}
 		}
+	}()
 
+	numWorkers := b.numJobs
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+
+	catcher := grip.NewCatcher()
+	toDelete := make(chan s3.Key)
+	wg := &sync.WaitGroup{}
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for key := range keys {
+				start := time.Now()
+
+				info, err := b.head(ctx, key)
+				if err != nil {
+					catcher.Add(err)
+					report.record(key, "", SyncDelete, 0, start, err)
+					continue
+				}
+
+				if info == nil {
+					grip.Warningf("path %s does not exist in bucket %s", key, b.name)
+					report.record(key, "", SyncSkipMissing, 0, start, nil)
+					continue
+				}
+
+				select {
+				case toDelete <- s3.Key{Key: key}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
 		close(toDelete)
 	}()
 
-	return b.deleteGroup(toDelete)
+	catcher.Add(b.deleteGroup(ctx, toDelete, report))
+	report.finish(ctx)
+
+	return report, catcher.Resolve()
 }
 
 // DeletePrefix removes all items in a bucket that have key names that
-// begin with a specific prefix.
-func (b *Bucket) DeletePrefix(prefix string) error {
-	return b.deleteGroup(b.list(prefix))
+// begin with a specific prefix, and that match the bucket's filter,
+// if any.
+func (b *Bucket) DeletePrefix(ctx context.Context, prefix string) error {
+	if b.filter.IsEmpty() {
+		return b.deleteGroup(ctx, b.list(ctx, prefix), nil)
+	}
+
+	toDelete := make(chan s3.Key)
+
+	go func() {
+		for item := range b.list(ctx, prefix) {
+			if b.filter.Match(strings.TrimPrefix(item.Key[len(prefix):], "/")) {
+				select {
+				case toDelete <- item:
+				case <-ctx.Done():
+				}
+			} else {
+				grip.Debugf("%s/%s does not match the filter, not deleting", b.name, item.Key)
+			}
+		}
+
+		close(toDelete)
+	}()
+
+	return b.deleteGroup(ctx, toDelete, nil)
 }
 
 // DeleteMatching removes all objects from a bucket, given a prefix,
 // that match a regular expression.
-func (b *Bucket) DeleteMatching(prefix, expression string) error {
+func (b *Bucket) DeleteMatching(ctx context.Context, prefix, expression string) error {
 	matcher, err := regexp.Compile(expression)
 	if err != nil {
 		return errors.Wrapf(err,
@@ -492,13 +753,17 @@ func (b *Bucket) DeleteMatching(prefix, expression string) error {
 
 	go func() {
 		var count int
-		list := b.list(prefix)
+		list := b.list(ctx, prefix)
 
 		for item := range list {
 			name := item.Key
 
 			if matcher.MatchString(name) {
-				toDelete <- item
+				select {
+				case toDelete <- item:
+				case <-ctx.Done():
+					continue
+				}
 				count++
 
 				grip.NoticeWhenf(b.dryRun, "found %s/%s to delete", b.name, name)
@@ -513,57 +778,42 @@ func (b *Bucket) DeleteMatching(prefix, expression string) error {
 		close(toDelete)
 	}()
 
-	return b.deleteGroup(toDelete)
+	return b.deleteGroup(ctx, toDelete, nil)
 }
 
-func (b *Bucket) deleteGroup(items <-chan s3.Key) error {
-	toDelete := s3.Delete{}
+// deleteGroup removes the items, in batches, until the channel closes,
+// and records the result for each key in the report, if any. If the
+// context is canceled, deleteGroup does not send further batches, and
+// returns the context's error.
+func (b *Bucket) deleteGroup(ctx context.Context, items <-chan s3.Key, report *SyncReport) error {
+	var batch []s3.Key
 	count := 0
 	catcher := grip.NewCatcher()
 
-	for {
+	for item := range items {
+		batch = append(batch, item)
+		grip.Infof("removing group, with %s/%s", b.name, item.Key)
+
 		// DeleteMulti maxes out at 1000 items per request. We
 		// should batch accordingly too.
-		if count == 1000 {
-			if b.dryRun {
-				grip.Infof("dry-run: would send a batch of delete operations to %s", b.name)
-			} else {
-				grip.Debugf("sending a batch of delete operations to %s", b.name)
-
-				catcher.Add(errors.Wrapf(b.bucket.DelMulti(toDelete),
-					"intermediate delete from %s, %d items encountered error",
-					b.name, count))
+		if len(batch) == 1000 {
+			if ctx.Err() == nil {
+				catcher.Add(b.deleteBatch(ctx, batch, report))
+				count += len(batch)
 			}
 
-			// reset the counters
-			toDelete = s3.Delete{}
-			count = 0
+			batch = nil
 		}
-
-		// pull from a channel, and add to the batch.
-		key, ok := <-items
-		if ok {
-			count++
-
-			toDelete.Objects = append(toDelete.Objects, s3.Object{Key: key.Key})
-			grip.Infof("removing group, with %s/%s", b.name, key.Key)
-
-			continue
-		}
-
-		break
 	}
 
-	if len(toDelete.Objects) > 0 {
-		if b.dryRun {
-			grip.Infof("dry-run: would send last batch of delete operations to %s", b.name)
-		} else {
-			grip.Debugf("sending last batch of delete operations to %s", b.name)
+	if err := ctx.Err(); err != nil {
+		catcher.Add(errors.Wrapf(err, "delete from %s canceled", b.name))
+		return catcher.Resolve()
+	}
 
-			catcher.Add(errors.Wrapf(b.bucket.DelMulti(toDelete),
-				"delete from %s, %d items encountered error",
-				b.name, len(toDelete.Objects)))
-		}
+	if len(batch) > 0 {
+		catcher.Add(b.deleteBatch(ctx, batch, report))
+		count += len(batch)
 	}
 
 	if catcher.HasErrors() {
@@ -575,35 +825,107 @@ func (b *Bucket) deleteGroup(items <-chan s3.Key) error {
 	return nil
 }
 
+// deleteBatch removes up to 1000 items with a single request, and
+// records the result for each key in the report, if any: the error
+// that S3 reported for the key, or for requests that fail, the error
+// of the request.
+func (b *Bucket) deleteBatch(ctx context.Context, items []s3.Key, report *SyncReport) error {
+	start := time.Now()
+
+	if b.dryRun {
+		grip.Infof("dry-run: would send a batch of %d delete operations to %s", len(items), b.name)
+		for _, item := range items {
+			report.record(item.Key, "", SyncDelete, 0, start, nil)
+		}
+		return nil
+	}
+
+	grip.Debugf("sending a batch of %d delete operations to %s", len(items), b.name)
+
+	toDelete := s3.Delete{Quiet: true}
+	for _, item := range items {
+		toDelete.Objects = append(toDelete.Objects, s3.Object{Key: item.Key})
+	}
+
+	err := b.request(ctx, func() error { return b.storage.DeleteMulti(toDelete) })
+	multiErr, partial := err.(*DeleteMultiError)
+	for _, item := range items {
+		keyErr := err
+		if partial {
+			keyErr = multiErr.Errors[item.Key]
+		}
+
+		report.record(item.Key, "", SyncDelete, 0, start, keyErr)
+	}
+
+	return errors.Wrapf(err, "delete from %s, %d items encountered error", b.name, len(items))
+}
+
 // SyncTo takes a local path, typically directory, and an S3 path
 // prefix, and dispatches a job to upload that file to S3 if it does
 // not exist or if the local file has different content from the
-// remote file. All operations execute in the worker pool, and SyncTo
-// waits for all jobs to complete before returning an aggregated error.
-func (b *Bucket) SyncTo(local, prefix string, withDelete bool) error {
+// remote file. If the bucket has a filter, SyncTo only considers files
+// whose paths, relative to the local path, match the filter. All
+// operations execute in the worker pool, and SyncTo waits for all
+// jobs to complete before returning a report of the operation and an
+// aggregated error. If the context is canceled, SyncTo stops
+// in-progress uploads, does not start new ones, and returns a report
+// of the files that it processed before the cancellation. With a sync
+// journal (see SetSyncJournal), SyncTo resumes an earlier push from
+// the local path to the prefix that did not finish.
+func (b *Bucket) SyncTo(ctx context.Context, local, prefix string,
+	withDelete bool) (*SyncReport, error) {
 	grip.Infof("sync push %s -> %s/%s", local, b.name, prefix)
 
-	remote := b.contents(prefix)
+	remote := b.contents(ctx, prefix)
+	cache := b.openChecksumCache(local)
+	journal := b.openSyncJournal(local, "push", prefix)
+	report := newSyncReport(b, "push", prefix)
+	report.Local = local
+	progress := b.trackProgress(report)
 
 	var counter int
 	catcher := grip.NewCatcher()
 
 	catcher.Add(filepath.Walk(local, func(path string, info os.FileInfo, err error) error {
+		if ctx.Err() != nil {
+			// stop walking, the operation reports the
+			// cancellation when all jobs have returned.
+			return filepath.SkipDir
+		}
+
 		if err != nil {
 			grip.Critical(errors.Wrapf(err, "problem finding file %s", path))
 			return nil
 		}
 
-		if info.IsDir() {
+		if info.IsDir() || path == filepath.Join(local, ChecksumCacheFileName) ||
+			isSyncJournal(local, path) {
 			return nil
 		}
 
+		progress.consider()
+
 		var keyName string
+		var name string
 		if local == path {
 			keyName = filepath.Join(prefix, path)
+			name = filepath.Base(path)
 		} else {
 			// need the extra character to avoid missing this because of the leading slash.
-			keyName = filepath.Join(prefix, path[len(local)+1:])
+			name = path[len(local)+1:]
+			keyName = filepath.Join(prefix, name)
+		}
+
+		if !b.filter.Match(filepath.ToSlash(name)) {
+			return nil
+		}
+
+		if journal.isComplete(keyName, pushVersion(info)) {
+			progress.queue(0)
+			report.record(keyName, path, SyncSkipCompleted, 0, time.Now(), nil)
+			counter++
+			return nil
 		}
 
 		remoteFile, ok := remote[keyName]
@@ -611,20 +933,36 @@ func (b *Bucket) SyncTo(local, prefix string, withDelete bool) error {
 			remoteFile = s3.Key{Key: keyName}
 		}
 
-		job := newSyncToJob(b, path, remoteFile, withDelete)
+		job := newSyncToJob(ctx, b, path, remoteFile, withDelete)
+		job.cache = cache
+		job.journal = journal
+		job.report = report
 
+		journal.queued(keyName)
 		err = errors.Wrap(b.queue.Put(job), "problem putting syncTo job into queue")
 		if err != nil {
 			catcher.Add(err)
 			return nil
 		}
 
+		progress.queue(info.Size())
 		counter++
 
 		return nil
 	}))
 
-	b.queue.Wait()
+	progress.scanned()
+	if !amboy.WaitCtx(ctx, b.queue) {
+		// jobs that do not stop when canceled may still be
+		// running, and complete after the operation returns,
+		// when the journal and the report ignore them.
+		progress.stop()
+		journal.close(false)
+		report.finish(ctx)
+
+		return report, errors.Wrapf(ctx.Err(), "sync push %s -> %s/%s canceled", local, b.name, prefix)
+	}
+	progress.stop()
 
 	for job := range b.queue.Results() {
 		err := job.Error()
@@ -633,6 +971,18 @@ func (b *Bucket) SyncTo(local, prefix string, withDelete bool) error {
 		}
 	}
 
+	if cache != nil {
+		grip.CatchWarning(cache.save())
+	}
+
+	if err := ctx.Err(); err != nil {
+		catcher.Add(errors.Wrapf(err, "sync push %s -> %s/%s canceled", local, b.name, prefix))
+	}
+
+	journal.close(!catcher.HasErrors())
+
+	report.finish(ctx)
+
 	if catcher.HasErrors() {
 		grip.Alertf("problem with sync push operation (%s -> %s/%s) [considered %d items]",
 			local, b.name, prefix, counter)
@@ -641,28 +991,75 @@ func (b *Bucket) SyncTo(local, prefix string, withDelete bool) error {
 			b.name, prefix, counter)
 	}
 
-	return catcher.Resolve()
+	return report, catcher.Resolve()
 }
 
 // SyncFrom takes a local path and the prefix of a keyname in S3, and
 // and downloads all objects in the bucket that have that prefix to
 // the local system at the path specified by "local". Will *not*
 // download files if the content of the local file have *not* changed.
-// All operations execute in the worker pool, and SyncTo waits for all
-// jobs to complete before returning an aggregated erro
-func (b *Bucket) SyncFrom(local, prefix string, withDelete bool) error {
+// If the bucket has a filter, SyncFrom only considers objects whose
+// keys, relative to the prefix, match the filter.
+// All operations execute in the worker pool, and SyncFrom waits for
+// all jobs to complete before returning a report of the operation and
+// an aggregated error. If the context is canceled, SyncFrom stops
+// in-progress downloads, does not start new ones, and returns a report
+// of the objects that it processed before the cancellation. With a
+// sync journal (see SetSyncJournal), SyncFrom resumes an earlier pull
+// from the prefix to the local path that did not finish.
+func (b *Bucket) SyncFrom(ctx context.Context, local, prefix string,
+	withDelete bool) (*SyncReport, error) {
 	catcher := grip.NewCatcher()
 	grip.Infof("sync pull %s/%s -> %s", b.name, prefix, local)
 
-	for remote := range b.list(prefix) {
-		job := newSyncFromJob(b, filepath.Join(local, remote.Key[len(prefix):]), remote, withDelete)
+	cache := b.openChecksumCache(local)
+	journal := b.openSyncJournal(local, "pull", prefix)
+	report := newSyncReport(b, "pull", prefix)
+	report.Local = local
+	progress := b.trackProgress(report)
+
+	for remote := range b.list(ctx, prefix) {
+		progress.consider()
+
+		name := strings.TrimPrefix(remote.Key[len(prefix):], "/")
+		if !b.filter.Match(name) {
+			continue
+		}
+
+		path := filepath.Join(local, name)
+		if journal.isComplete(remote.Key, pullVersion(remote)) {
+			if info, err := os.Stat(path); err == nil && info.Size() == remote.Size {
+				progress.queue(0)
+				report.record(remote.Key, path, SyncSkipCompleted, 0, time.Now(), nil)
+				continue
+			}
+		}
+
+		job := newSyncFromJob(ctx, b, path, remote, withDelete)
+		job.cache = cache
+		job.journal = journal
+		job.report = report
 
 		// add the job to the queue
-		catcher.Add(errors.Wrap(b.queue.Put(job),
-			"problem putting syncFrom job into worker queue"))
+		journal.queued(remote.Key)
+		err := b.queue.Put(job)
+		if err != nil {
+			catcher.Add(errors.Wrap(err, "problem putting syncFrom job into worker queue"))
+			continue
+		}
+
+		progress.queue(remote.Size)
 	}
 
-	b.queue.Wait()
+	progress.scanned()
+	if !amboy.WaitCtx(ctx, b.queue) {
+		progress.stop()
+		journal.close(false)
+		report.finish(ctx)
+
+		return report, errors.Wrapf(ctx.Err(), "sync pull %s/%s -> %s canceled", b.name, prefix, local)
+	}
+	progress.stop()
 
 	for job := range b.queue.Results() {
 		err := job.Error()
@@ -671,6 +1068,18 @@ func (b *Bucket) SyncFrom(local, prefix string, withDelete bool) error {
 		}
 	}
 
+	if cache != nil {
+		grip.CatchWarning(cache.save())
+	}
+
+	if err := ctx.Err(); err != nil {
+		catcher.Add(errors.Wrapf(err, "sync pull %s/%s -> %s canceled", b.name, prefix, local))
+	}
+
+	journal.close(!catcher.HasErrors())
+
+	report.finish(ctx)
+
 	if catcher.HasErrors() {
 		grip.Alertf("problem with sync pull operation (%s/%s -> %s)",
 			b.name, prefix, local)
@@ -678,5 +1087,183 @@ func (b *Bucket) SyncFrom(local, prefix string, withDelete bool) error {
 		grip.Infof("completed pull operation from %s/%s -> %s", b.name, prefix, local)
 	}
 
-	return catcher.Resolve()
+	return report, catcher.Resolve()
+}
+
+// CopyTo copies the object at "path" to "targetPath" in the target
+// bucket, which may be the same bucket, with the permissions that the
+// target bucket's ACL rules or NewFilePermission determine. When the
+// target bucket's storage can copy from this bucket's storage (e.g.
+// both buckets are in the same S3 service), the copy happens entirely
+// on the server. Otherwise, and for objects too large for a single
+// server-side copy, CopyTo downloads the object to a temporary file
+// and uploads it to the target bucket.
+func (b *Bucket) CopyTo(ctx context.Context, target *Bucket, path, targetPath string) error {
+	if err := ctx.Err(); err != nil {
+		return errors.Wrapf(err, "copy of %s/%s canceled", b.name, path)
+	}
+
+	if target.dryRun {
+		grip.Noticef("dry-run: would copy %s/%s -> %s/%s", b.name, path, target.name, targetPath)
+		return nil
+	}
+
+	info, err := b.head(ctx, path)
+	if err != nil {
+		return errors.Wrapf(err, "problem checking %s/%s before copy", b.name, path)
+	}
+	if info == nil {
+		return errors.Errorf("%s/%s does not exist", b.name, path)
+	}
+
+	cs, ok := target.storage.(CopyStorage)
+	if !ok || !cs.CanCopyFrom(b.storage) || info.Size > maxCopySize {
+		return b.copyThroughFile(ctx, target, path, targetPath, info)
+	}
+
+	op := fmt.Sprintf("copy %s/%s -> %s/%s", b.name, path, target.name, targetPath)
+	perm := target.permission(targetPath)
+	err = b.withRetries(ctx, op, func() error {
+		return cs.CopyFrom(b.storage, path, targetPath, perm, target.encryption)
+	})
+	if err != nil {
+		return err
+	}
+
+	grip.Debugf("copied %s/%s -> %s/%s", b.name, path, target.name, targetPath)
+	return nil
+}
+
+// copyThroughFile copies an object by downloading it to a temporary
+// file, and uploading the file to the target bucket, which preserves
+// the modification time metadata of the object.
+func (b *Bucket) copyThroughFile(ctx context.Context, target *Bucket, path, targetPath string,
+	info *ObjectInfo) error {
+	dir, err := ioutil.TempDir("", "sthree-copy-")
+	if err != nil {
+		return errors.Wrap(err, "problem creating temporary directory for copy")
+	}
+	defer os.RemoveAll(dir)
+
+	fileName := filepath.Join(dir, filepath.Base(path))
+	if err = b.Get(ctx, path, fileName); err != nil {
+		return errors.Wrapf(err, "problem downloading %s/%s for copy", b.name, path)
+	}
+
+	if mtime, ok := info.ModTime(); ok {
+		if err = os.Chtimes(fileName, mtime, mtime); err != nil {
+			return errors.Wrapf(err, "problem setting modification time of '%s'", fileName)
+		}
+	}
+
+	return errors.Wrapf(target.Put(ctx, fileName, targetPath),
+		"problem uploading %s/%s for copy", target.name, targetPath)
+}
+
+// SyncToBucket mirrors the objects in this bucket that have the prefix
+// to the target bucket, replacing the prefix with targetPrefix, and
+// copies objects that do not exist in the target or have different
+// content, using CopyTo. If the bucket has a filter, SyncToBucket only
+// considers objects whose keys, relative to the prefix, match the
+// filter. With withDelete, SyncToBucket also deletes objects under
+// targetPrefix that do not exist in the source. All copies execute in
+// this bucket's worker pool, and SyncToBucket waits for all jobs to
+// complete before returning a report of the operation and an
+// aggregated error. If the context is canceled, SyncToBucket does not
+// start new copies, or delete any objects, and returns a report of the
+// objects that it processed before the cancellation.
+func (b *Bucket) SyncToBucket(ctx context.Context, target *Bucket, prefix, targetPrefix string,
+	withDelete bool) (*SyncReport, error) {
+	grip.Infof("sync copy %s/%s -> %s/%s", b.name, prefix, target.name, targetPrefix)
+
+	report := newSyncReport(b, "copy", prefix)
+	report.Target = target.name + "/" + targetPrefix
+	report.DryRun = b.dryRun || target.dryRun
+	progress := b.trackProgress(report)
+
+	existing := target.contents(ctx, targetPrefix)
+	seen := make(map[string]bool)
+	catcher := grip.NewCatcher()
+
+	var counter int
+	for source := range b.list(ctx, prefix) {
+		progress.consider()
+
+		name := strings.TrimPrefix(source.Key[len(prefix):], "/")
+		if !b.filter.Match(name) {
+			continue
+		}
+
+		targetKey := filepath.ToSlash(filepath.Join(targetPrefix, name))
+		seen[targetKey] = true
+
+		targetFile, ok := existing[targetKey]
+		if !ok {
+			targetFile = s3.Key{Key: targetKey}
+		}
+
+		job := newSyncBucketJob(ctx, b, target, source, targetFile)
+		job.report = report
+
+		if err := b.queue.Put(job); err != nil {
+			catcher.Add(errors.Wrap(err, "problem putting sync bucket job into queue"))
+			continue
+		}
+
+		progress.queue(source.Size)
+		counter++
+	}
+
+	progress.scanned()
+	if !amboy.WaitCtx(ctx, b.queue) {
+		progress.stop()
+		report.finish(ctx)
+
+		return report, errors.Wrapf(ctx.Err(), "sync copy %s/%s -> %s/%s canceled",
+			b.name, prefix, target.name, targetPrefix)
+	}
+	progress.stop()
+
+	for job := range b.queue.Results() {
+		if err := job.Error(); err != nil {
+			catcher.Add(errors.Wrapf(err, "error in sync bucket job %s", job.ID()))
+		}
+	}
+
+	if err := ctx.Err(); err != nil {
+		catcher.Add(errors.Wrapf(err, "sync copy %s/%s -> %s/%s canceled",
+			b.name, prefix, target.name, targetPrefix))
+	}
+
+	if withDelete && !catcher.HasErrors() {
+		var extra []s3.Key
+		for key, item := range existing {
+			name := strings.TrimPrefix(key[len(targetPrefix):], "/")
+			if !seen[key] && b.filter.Match(name) {
+				extra = append(extra, item)
+			}
+		}
+
+		toDelete := make(chan s3.Key)
+		go func() {
+			for _, item := range extra {
+				toDelete <- item
+			}
+			close(toDelete)
+		}()
+
+		catcher.Add(target.deleteGroup(ctx, toDelete, report))
+	}
+
+	report.finish(ctx)
+
+	if catcher.HasErrors() {
+		grip.Alertf("problem with sync copy operation (%s/%s -> %s/%s) [considered %d items]",
+			b.name, prefix, target.name, targetPrefix, counter)
+	} else {
+		grip.Infof("completed copy operation from %s/%s -> %s/%s [considered %d items]",
+			b.name, prefix, target.name, targetPrefix, counter)
+	}
+
+	return report, catcher.Resolve()
 }
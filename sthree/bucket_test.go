@@ -2,21 +2,28 @@ package sthree
 
 import (
 	"crypto/md5"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strconv"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/goamz/goamz/aws"
 	"github.com/goamz/goamz/s3"
+	"github.com/mongodb/curator/sthree/fakes3"
 	"github.com/satori/go.uuid"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"github.com/tychoish/grip"
+	"golang.org/x/net/context"
 )
 
 // BucketSuite contains tests of the base bucket interface for
@@ -61,13 +68,13 @@ func (s *BucketSuite) SetupTest() {
 }
 
 func (s *BucketSuite) TearDownTest() {
-	grip.CatchError(s.b.DeletePrefix(s.uuid))
+	grip.CatchError(s.b.DeletePrefix(context.Background(), s.uuid))
 	buckets.removeBucket(s.b)
 }
 
 func (s *BucketSuite) TearDownSuite() {
 	b := GetBucket(s.bucketName)
-	s.NoError(b.DeletePrefix(s.uuid))
+	s.NoError(b.DeletePrefix(context.Background(), s.uuid))
 	s.NoError(os.RemoveAll(s.tempDir))
 	buckets.removeBucket(b)
 }
@@ -115,10 +122,11 @@ func (s *BucketSuite) TestCredentialSetterDoesNotOverrideCachedCredentialsBucket
 		Region: aws.USWest,
 	}
 
-	s.Equal(s.b.credentials.Region, aws.USEast)
+	original := s.b.credentials
+	s.Equal(s.b.credentials.Region, buckets.c.Region)
 	s.b.SetCredentials(newCreds)
 	s.Equal(s.b.credentials.Region, aws.USWest)
-	s.NotNil(s.b.bucket)
+	s.NotNil(s.b.storage)
 
 	// having changed the credentials for the bucket named test,
 	// means if we get another pointer to this variable it's set
@@ -127,6 +135,10 @@ func (s *BucketSuite) TestCredentialSetterDoesNotOverrideCachedCredentialsBucket
 	second := GetBucket("test-second-bucket")
 	s.NotEqual(s.b.credentials.Region, second.credentials.Region)
 	s.NotEqual(s.b.credentials.Region, copyOfOne.credentials.Region)
+
+	// restore the original credentials so that clean up
+	// operations use the same service as the rest of the suite.
+	s.b.SetCredentials(original)
 }
 
 func (s *BucketSuite) TestOpenMethodStartsQueueAndConnections() {
@@ -134,19 +146,19 @@ func (s *BucketSuite) TestOpenMethodStartsQueueAndConnections() {
 	s.False(s.b.IsOpen())
 
 	// abort if opening causes an error
-	s.require.NoError(s.b.Open())
+	s.require.NoError(s.b.Open(context.Background()))
 	s.True(s.b.queue.Started())
 
 	// confirm that the bucket is open
 	s.True(s.b.IsOpen())
-	s.NotNil(s.b.bucket)
+	s.NotNil(s.b.storage)
 	s.True(s.b.queue.Started())
 
 	// calling open a second time should be a noop and not change
 	// any of the properties
-	bucketFirst := s.b.bucket
-	s.NoError(s.b.Open())
-	s.Equal(*bucketFirst, *s.b.bucket)
+	storageFirst := s.b.storage
+	s.NoError(s.b.Open(context.Background()))
+	s.Equal(storageFirst, s.b.storage)
 
 	// cleanup at the end
 	s.b.Close()
@@ -154,18 +166,18 @@ func (s *BucketSuite) TestOpenMethodStartsQueueAndConnections() {
 }
 
 func (s *BucketSuite) TestContentsAndListProduceIdenticalData() {
-	s.require.NoError(s.b.Open())
+	s.require.NoError(s.b.Open(context.Background()))
 	var prefix string
 
 	var count int
 	seen := make(map[string]s3.Key)
 
-	for bucketItem := range s.b.list(prefix) {
+	for bucketItem := range s.b.list(context.Background(), prefix) {
 		seen[bucketItem.Key] = bucketItem
 		count++
 	}
 
-	content := s.b.contents(prefix)
+	content := s.b.contents(context.Background(), prefix)
 
 	s.Len(content, count)
 	s.Len(seen, count)
@@ -180,7 +192,7 @@ func (s *BucketSuite) TestJobNumberIsConfigurableBeforeBucketOpens() {
 	for i := 1; i < 20; i = i + 2 {
 		s.False(s.b.IsOpen())
 		s.NoError(s.b.SetNumJobs(i))
-		s.NoError(s.b.Open())
+		s.NoError(s.b.Open(context.Background()))
 		s.True(s.b.IsOpen())
 		s.True(s.b.queue.Started())
 		s.b.Close()
@@ -191,7 +203,7 @@ func (s *BucketSuite) TestRetriesNubmerIsSetableGreaterThanZero() {
 	for i := 1; i < 20; i++ {
 		err := s.b.SetNumRetries(i)
 		s.NoError(err)
-		s.Equal(i, s.b.numRetries)
+		s.Equal(i, s.b.retry.MaxAttempts)
 	}
 }
 
@@ -199,17 +211,17 @@ func (s *BucketSuite) TestRetriesNumberSetterDoesNotSetToLessThanOrEqualToZero()
 	num := 4
 
 	s.NoError(s.b.SetNumRetries(num))
-	s.Equal(num, s.b.numRetries)
+	s.Equal(num, s.b.retry.MaxAttempts)
 
 	for i := -20; i <= 0; i++ {
 		err := s.b.SetNumRetries(i)
 		s.Error(err)
-		s.Equal(num, s.b.numRetries)
+		s.Equal(num, s.b.retry.MaxAttempts)
 	}
 }
 
 func (s *BucketSuite) TestJobNumberIsNotConfigurableAfterBucketOpens() {
-	s.NoError(s.b.Open())
+	s.NoError(s.b.Open(context.Background()))
 	s.True(s.b.IsOpen())
 
 	existingNum := s.b.numJobs
@@ -221,11 +233,11 @@ func (s *BucketSuite) TestPutOptionUploadsFile() {
 	local := "bucket.go"
 	remote := filepath.Join(s.uuid, local+".one")
 
-	s.NoError(s.b.Open())
+	s.NoError(s.b.Open(context.Background()))
 
-	s.NoError(s.b.Put(local, remote))
+	s.NoError(s.b.Put(context.Background(), local, remote))
 
-	contents := s.b.contents(s.uuid)
+	contents := s.b.contents(context.Background(), s.uuid)
 	_, ok := contents[remote]
 	s.True(ok)
 }
@@ -234,7 +246,7 @@ func (s *BucketSuite) TestGetRetrievesFileIsTheSameAsSourceData() {
 	local := "bucket.go"
 	remote := filepath.Join(s.uuid, local+".two")
 
-	s.NoError(s.b.Open())
+	s.NoError(s.b.Open(context.Background()))
 
 	// get the hash of the files' contents
 	originalData, err := ioutil.ReadFile(local)
@@ -242,11 +254,11 @@ func (s *BucketSuite) TestGetRetrievesFileIsTheSameAsSourceData() {
 	originalHash := md5.Sum(originalData)
 
 	// upload the file to s3
-	s.NoError(s.b.Put(local, remote))
+	s.NoError(s.b.Put(context.Background(), local, remote))
 
 	// download the file to a temp location
 	copy := filepath.Join(s.tempDir, local)
-	s.NoError(s.b.Get(remote, copy))
+	s.NoError(s.b.Get(context.Background(), remote, copy))
 
 	// hash the copy
 	copyData, err := ioutil.ReadFile(copy)
@@ -261,10 +273,10 @@ func (s *BucketSuite) TestGetMakesEnclosingDirectories() {
 	local := "bucket.go"
 	remote := filepath.Join(s.uuid, local+".three")
 
-	s.NoError(s.b.Open())
+	s.NoError(s.b.Open(context.Background()))
 
 	// upload the file to s3
-	s.NoError(s.b.Put(local, remote))
+	s.NoError(s.b.Put(context.Background(), local, remote))
 
 	// download the file to a temp location, in a directory that doesn't exist
 	copy := filepath.Join(s.tempDir, "newDir", local)
@@ -273,32 +285,107 @@ func (s *BucketSuite) TestGetMakesEnclosingDirectories() {
 	_, err := os.Stat(filepath.Dir(copy))
 	s.True(os.IsNotExist(err))
 
-	s.NoError(s.b.Get(remote, copy))
+	s.NoError(s.b.Get(context.Background(), remote, copy))
 
 	_, err = os.Stat(copy)
 	s.False(os.IsNotExist(err))
 }
 
+// failingReadStorage wraps a Storage implementation so that object
+// readers fail after returning some of the content, to simulate
+// dropped connections during downloads.
+type failingReadStorage struct {
+	Storage
+}
+
+func (s failingReadStorage) Get(key string) (io.ReadCloser, error) {
+	reader, err := s.Storage.Get(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return failingReader{reader}, nil
+}
+
+type failingReader struct {
+	io.ReadCloser
+}
+
+func (r failingReader) Read(p []byte) (int, error) {
+	if len(p) > 8 {
+		p = p[:8]
+	}
+
+	n, _ := r.ReadCloser.Read(p)
+	return n, errors.New("connection reset")
+}
+
+func (s *BucketSuite) TestFailedGetDoesNotReplaceExistingFile() {
+	local := "bucket.go"
+	remote := filepath.Join(s.uuid, local+".partial")
+	s.NoError(s.b.Put(context.Background(), local, remote))
+
+	dir := filepath.Join(s.tempDir, "partial")
+	s.require.NoError(os.MkdirAll(dir, 0755))
+	dest := filepath.Join(dir, local)
+	s.require.NoError(ioutil.WriteFile(dest, []byte("original"), 0644))
+
+	b, err := s.b.Clone()
+	s.require.NoError(err)
+	b.SetStorage(failingReadStorage{s.b.storage})
+	s.NoError(b.SetNumRetries(1))
+
+	s.Error(b.Get(context.Background(), remote, dest))
+
+	data, err := ioutil.ReadFile(dest)
+	s.NoError(err)
+	s.Equal("original", string(data))
+
+	files, err := ioutil.ReadDir(dir)
+	s.NoError(err)
+	s.Len(files, 1)
+}
+
+func (s *BucketSuite) TestGetDoesNotLeaveTemporaryFiles() {
+	local := "bucket.go"
+	remote := filepath.Join(s.uuid, local+".complete")
+	s.NoError(s.b.Put(context.Background(), local, remote))
+
+	dir := filepath.Join(s.tempDir, "complete")
+	s.NoError(s.b.Get(context.Background(), remote, filepath.Join(dir, local)))
+
+	files, err := ioutil.ReadDir(dir)
+	s.NoError(err)
+	s.require.Len(files, 1)
+	s.Equal(local, files[0].Name())
+
+	checksum, err := md5sum(filepath.Join(dir, local))
+	s.NoError(err)
+	data, err := ioutil.ReadFile(local)
+	s.NoError(err)
+	s.Equal(fmt.Sprintf("%x", md5.Sum(data)), checksum)
+}
+
 func (s *BucketSuite) TestPutReturnsErrorForFilesThatDoNotExist() {
-	s.Error(s.b.Put("foo/bar.go", filepath.Join(s.uuid, "foo/baz.go")))
+	s.Error(s.b.Put(context.Background(), "foo/bar.go", filepath.Join(s.uuid, "foo/baz.go")))
 }
 
 func (s *BucketSuite) TestDeleteOperationRemovesPathFromBucket() {
 	local := "bucket.go"
 	remote := filepath.Join(s.uuid, local+".four")
 
-	s.NoError(s.b.Open())
+	s.NoError(s.b.Open(context.Background()))
 
 	// upload the file to s3
-	s.NoError(s.b.Put(local, remote))
+	s.NoError(s.b.Put(context.Background(), local, remote))
 
-	contents := s.b.contents(s.uuid)
+	contents := s.b.contents(context.Background(), s.uuid)
 	_, ok := contents[remote]
 	s.True(ok)
 
-	s.NoError(s.b.Delete(remote))
+	s.NoError(s.b.Delete(context.Background(), remote))
 
-	contents = s.b.contents(s.uuid)
+	contents = s.b.contents(context.Background(), s.uuid)
 	_, ok = contents[remote]
 	s.False(ok)
 }
@@ -307,71 +394,75 @@ func (s *BucketSuite) TestDryRunDeleteOperationDoesNotRemovePathsFromBucket() {
 	local := "bucket.go"
 	remote := filepath.Join(s.uuid, local+".four")
 
-	s.NoError(s.b.Open())
+	s.NoError(s.b.Open(context.Background()))
 	s.False(s.b.dryRun)
 	bucket, err := s.b.DryRunClone()
 	s.True(bucket.dryRun)
 	s.NoError(err)
-	s.NoError(bucket.Open())
+	s.NoError(bucket.Open(context.Background()))
 	defer bucket.Close()
 
 	// upload the file to s3
-	s.NoError(s.b.Put(local, remote))
+	s.NoError(s.b.Put(context.Background(), local, remote))
 
-	_, ok := s.b.contents(s.uuid)[remote]
+	_, ok := s.b.contents(context.Background(), s.uuid)[remote]
 	s.True(ok)
 
-	_, ok = bucket.contents(s.uuid)[remote]
+	_, ok = bucket.contents(context.Background(), s.uuid)[remote]
 	s.True(ok)
 
-	s.NoError(bucket.Delete(remote))
+	s.NoError(bucket.Delete(context.Background(), remote))
 
-	_, ok = bucket.contents(s.uuid)[remote]
+	_, ok = bucket.contents(context.Background(), s.uuid)[remote]
 	s.True(ok)
 }
 
 func (s *BucketSuite) TestDeleteManyOperationRemovesManyPathsFromBucket() {
 	local := "bucket.go"
-	s.NoError(s.b.Open())
+	s.NoError(s.b.Open(context.Background()))
 	prefix := uuid.NewV4().String()
 
-	s.Len(s.b.contents(filepath.Join(s.uuid, prefix)), 0)
+	s.Len(s.b.contents(context.Background(), filepath.Join(s.uuid, prefix)), 0)
 
 	var toDelete []string
 
 	for i := 0; i < 20; i++ {
 		name := filepath.Join(s.uuid, prefix, local+".five."+strconv.Itoa(i))
-		s.NoError(s.b.Put(local, name))
+		s.NoError(s.b.Put(context.Background(), local, name))
 		toDelete = append(toDelete, name)
 	}
 
-	s.Len(s.b.contents(filepath.Join(s.uuid, prefix)), 20)
+	s.Len(s.b.contents(context.Background(), filepath.Join(s.uuid, prefix)), 20)
 
-	s.NoError(s.b.DeleteMany(toDelete...))
+	report, err := s.b.DeleteMany(context.Background(), toDelete...)
+	s.NoError(err)
+	s.Equal(20, report.Count(SyncDelete))
 
-	s.Len(s.b.contents(filepath.Join(s.uuid, prefix)), 0)
+	s.Len(s.b.contents(context.Background(), filepath.Join(s.uuid, prefix)), 0)
 }
 
 func (s *BucketSuite) TestDeleteManySpecialCasesSingleOperation() {
 	local := "bucket.go"
-	s.NoError(s.b.Open())
+	s.NoError(s.b.Open(context.Background()))
 	prefix := uuid.NewV4().String()
 
-	s.Len(s.b.contents(filepath.Join(s.uuid, prefix)), 0)
+	s.Len(s.b.contents(context.Background(), filepath.Join(s.uuid, prefix)), 0)
 	name := filepath.Join(s.uuid, prefix, local+".fiveish.0")
-	s.NoError(s.b.Put(local, name))
-	s.Len(s.b.contents(filepath.Join(s.uuid, prefix)), 1)
+	s.NoError(s.b.Put(context.Background(), local, name))
+	s.Len(s.b.contents(context.Background(), filepath.Join(s.uuid, prefix)), 1)
 
-	s.NoError(s.b.DeleteMany(name))
-	s.Len(s.b.contents(filepath.Join(s.uuid, prefix)), 0)
+	report, err := s.b.DeleteMany(context.Background(), name)
+	s.NoError(err)
+	s.Equal(1, report.Count(SyncDelete))
+	s.Len(s.b.contents(context.Background(), filepath.Join(s.uuid, prefix)), 0)
 }
 
 func (s *BucketSuite) TestDeleteMatchingRemovesSomePaths() {
 	local := "bucket.go"
-	s.NoError(s.b.Open())
+	s.NoError(s.b.Open(context.Background()))
 	prefix := uuid.NewV4().String()
 
-	s.Len(s.b.contents(filepath.Join(s.uuid, prefix)), 0)
+	s.Len(s.b.contents(context.Background(), filepath.Join(s.uuid, prefix)), 0)
 
 	var toDelete []string
 	size := 20
@@ -395,7 +486,7 @@ func (s *BucketSuite) TestDeleteMatchingRemovesSomePaths() {
 				s.False(matcher.MatchString(name))
 			}
 
-			s.NoError(s.b.Put(local, name))
+			s.NoError(s.b.Put(context.Background(), local, name))
 			mutex.Lock()
 			toDelete = append(toDelete, name)
 			mutex.Unlock()
@@ -404,12 +495,12 @@ func (s *BucketSuite) TestDeleteMatchingRemovesSomePaths() {
 	}
 	wg.Wait()
 
-	s.Len(s.b.contents(filepath.Join(s.uuid, prefix)), size)
+	s.Len(s.b.contents(context.Background(), filepath.Join(s.uuid, prefix)), size)
 
 	s.False(s.b.dryRun)
-	s.NoError(s.b.DeleteMatching(filepath.Join(s.uuid, prefix), expression))
+	s.NoError(s.b.DeleteMatching(context.Background(), filepath.Join(s.uuid, prefix), expression))
 
-	s.Equal(len(s.b.contents(filepath.Join(s.uuid, prefix))), size/2)
+	s.Equal(len(s.b.contents(context.Background(), filepath.Join(s.uuid, prefix))), size/2)
 }
 
 func numFilesInPath(path string, includeDirs bool) (int, error) {
@@ -437,17 +528,17 @@ func (s *BucketSuite) TestSyncToUploadsNewFilesWithoutError() {
 
 	remotePrefix := filepath.Join(s.uuid, "sync-to-one")
 
-	s.NoError(s.b.Open())
+	s.NoError(s.b.Open(context.Background()))
 
-	s.Len(s.b.contents(remotePrefix), 0)
+	s.Len(s.b.contents(context.Background(), remotePrefix), 0)
 
 	for i := 0; i < 3; i++ {
-		err = s.b.SyncTo(pwd, remotePrefix, false)
+		_, err = s.b.SyncTo(context.Background(), pwd, remotePrefix, false)
 		s.NoError(err)
 
 		num, err := numFilesInPath(pwd, false)
 		s.NoError(err)
-		s.Len(s.b.contents(remotePrefix), num)
+		s.Len(s.b.contents(context.Background(), remotePrefix), num)
 	}
 }
 
@@ -460,19 +551,19 @@ func (s *BucketSuite) TestSyncToDryRunDoesNotUploadFiles() {
 	bucket, err := s.b.DryRunClone()
 	s.NoError(err)
 
-	s.NoError(bucket.Open())
+	s.NoError(bucket.Open(context.Background()))
 
-	s.Len(bucket.contents(remotePrefix), 0)
+	s.Len(bucket.contents(context.Background(), remotePrefix), 0)
 
-	err = bucket.SyncTo(pwd, remotePrefix, false)
+	_, err = bucket.SyncTo(context.Background(), pwd, remotePrefix, false)
 	s.NoError(err)
 
-	s.Len(s.b.contents(remotePrefix), 0)
+	s.Len(s.b.contents(context.Background(), remotePrefix), 0)
 }
 
 func (s *BucketSuite) TestCloneOpenBucketReturnsOpenBucket() {
 	s.False(s.b.IsOpen())
-	s.NoError(s.b.Open())
+	s.NoError(s.b.Open(context.Background()))
 	s.True(s.b.IsOpen())
 
 	clone, err := s.b.Clone()
@@ -483,26 +574,26 @@ func (s *BucketSuite) TestCloneOpenBucketReturnsOpenBucket() {
 func (s *BucketSuite) TestSyncFromDownloadsFiles() {
 	pwd, err := os.Getwd()
 	s.NoError(err)
-	s.NoError(s.b.Open())
+	s.NoError(s.b.Open(context.Background()))
 
 	remotePrefix := filepath.Join(s.uuid, "sync-from-one")
 
-	s.Len(s.b.contents(remotePrefix), 0)
+	s.Len(s.b.contents(context.Background(), remotePrefix), 0)
 
 	// populate bucket.
-	err = s.b.SyncTo(pwd, remotePrefix, false)
+	_, err = s.b.SyncTo(context.Background(), pwd, remotePrefix, false)
 	s.NoError(err)
 	numFiles, err := numFilesInPath(pwd, false)
 	s.NoError(err)
 
 	// make sure we uploaded files
-	s.Len(s.b.contents(remotePrefix), numFiles)
+	s.Len(s.b.contents(context.Background(), remotePrefix), numFiles)
 	s.True(numFiles > 0)
 
 	// do this in a loop to make sure it's idempotent.
 	for i := 0; i < 3; i++ {
 		local := filepath.Join(s.tempDir, "sync-from-one")
-		err = s.b.SyncFrom(local, remotePrefix, false)
+		_, err = s.b.SyncFrom(context.Background(), local, remotePrefix, false)
 		s.NoError(err)
 
 		// make sure we pulled the right number of files out of the
@@ -522,28 +613,28 @@ func (s *BucketSuite) TestSyncFromDryRunDoesNotUploadFiles() {
 	bucket, err := s.b.DryRunClone()
 	s.NoError(err)
 
-	s.NoError(bucket.Open())
+	s.NoError(bucket.Open(context.Background()))
 
-	s.Len(bucket.contents(remotePrefix), 0)
+	s.Len(bucket.contents(context.Background(), remotePrefix), 0)
 
-	err = bucket.SyncFrom(pwd, remotePrefix, false)
+	_, err = bucket.SyncFrom(context.Background(), pwd, remotePrefix, false)
 	s.NoError(err)
 
-	s.Len(s.b.contents(remotePrefix), 0)
+	s.Len(s.b.contents(context.Background(), remotePrefix), 0)
 
 }
 
 func (s *BucketSuite) TestSyncFromTestWhenFilesHaveChanged() {
 	pwd, err := os.Getwd()
 	s.NoError(err)
-	s.NoError(s.b.Open())
+	s.NoError(s.b.Open(context.Background()))
 
 	remotePrefix := filepath.Join(s.uuid, "sync-round-trip")
-	err = s.b.SyncTo(pwd, remotePrefix, false)
+	_, err = s.b.SyncTo(context.Background(), pwd, remotePrefix, false)
 	s.NoError(err)
 
 	local := filepath.Join(s.tempDir, "sync-round-trip")
-	err = s.b.SyncFrom(local, remotePrefix, false)
+	_, err = s.b.SyncFrom(context.Background(), local, remotePrefix, false)
 	s.NoError(err)
 
 	err = filepath.Walk(local, func(p string, info os.FileInfo, err error) error {
@@ -557,7 +648,7 @@ func (s *BucketSuite) TestSyncFromTestWhenFilesHaveChanged() {
 	})
 	s.NoError(err)
 
-	err = s.b.SyncFrom(local, remotePrefix, false)
+	_, err = s.b.SyncFrom(context.Background(), local, remotePrefix, false)
 	s.NoError(err)
 
 	err = filepath.Walk(local, func(p string, info os.FileInfo, err error) error {
@@ -578,3 +669,145 @@ func (s *BucketSuite) TestSyncFromTestWhenFilesHaveChanged() {
 
 	s.NoError(err)
 }
+
+// DeleteManySuite tests deleting objects by key, using a fake S3
+// server.
+type DeleteManySuite struct {
+	srv     *fakes3.Server
+	s3      *s3.Bucket
+	b       *Bucket
+	require *require.Assertions
+	suite.Suite
+}
+
+func TestDeleteManySuite(t *testing.T) {
+	suite.Run(t, new(DeleteManySuite))
+}
+
+func (s *DeleteManySuite) SetupSuite() {
+	s.require = s.Require()
+}
+
+func (s *DeleteManySuite) SetupTest() {
+	s.srv = fakes3.NewServer()
+	auth := aws.Auth{AccessKey: "fake", SecretKey: "fake"}
+	s.s3 = s3.New(auth, s.srv.Region()).Bucket("delete")
+
+	s.b = &Bucket{
+		name:    "delete",
+		numJobs: 2,
+		retry:   RetryPolicy{MaxAttempts: 1},
+		storage: NewS3Storage(s.s3),
+	}
+
+	for _, key := range []string{"a", "b", "c", "d"} {
+		s.require.NoError(s.s3.Put(key, []byte(key), "text/plain", s3.Private, s3.Options{}))
+	}
+}
+
+func (s *DeleteManySuite) TearDownTest() {
+	s.srv.Close()
+}
+
+func (s *DeleteManySuite) TestDeletesOnlyExistingKeysWithoutListing() {
+	// listing the bucket fails, so the delete must not list it.
+	s.srv.FailRequestsWith(1, http.StatusForbidden, "AccessDenied", func(r *http.Request) bool {
+		return r.Method == "GET"
+	})
+
+	report, err := s.b.DeleteMany(context.Background(), "a", "b", "missing", "a")
+	s.require.NoError(err)
+	s.Equal("delete", report.Operation)
+	s.Equal(2, report.Count(SyncDelete))
+	s.Equal(1, report.Count(SyncSkipMissing))
+	s.Len(report.Items, 3)
+	s.Equal("missing", report.Items[2].Key)
+
+	s.Equal([]string{"c", "d"}, s.srv.Keys("delete"))
+}
+
+func (s *DeleteManySuite) TestReportsErrorsOfIndividualKeys() {
+	s.srv.FailDeletes("AccessDenied", "b", "c")
+
+	report, err := s.b.DeleteMany(context.Background(), "a", "b", "c")
+	s.require.Error(err)
+	s.Contains(err.Error(), "AccessDenied")
+	s.Equal(1, report.Count(SyncDelete))
+	s.Equal(2, report.Count(SyncFailed))
+	s.Equal("b", report.Items[1].Key)
+	s.Contains(report.Items[1].Error, "AccessDenied")
+
+	err = s.b.storage.DeleteMulti(s3.Delete{Objects: []s3.Object{{Key: "c"}, {Key: "d"}}})
+	multiErr, ok := err.(*DeleteMultiError)
+	s.require.True(ok)
+	s.Len(multiErr.Errors, 1)
+	s.Equal("AccessDenied", ErrorCode(multiErr.Errors["c"]))
+
+	s.Equal([]string{"b", "c"}, s.srv.Keys("delete"))
+}
+
+func (s *DeleteManySuite) TestReportsFailedRequests() {
+	s.srv.FailRequestsWith(1, http.StatusForbidden, "AccessDenied", func(r *http.Request) bool {
+		return r.Method == "HEAD" && strings.HasSuffix(r.URL.Path, "/a")
+	})
+
+	report, err := s.b.DeleteMany(context.Background(), "a", "b")
+	s.Error(err)
+	s.Equal(1, report.Count(SyncFailed))
+	s.Equal(1, report.Count(SyncDelete))
+
+	s.srv.FailRequests(1, func(r *http.Request) bool { return r.Method == "POST" })
+	report, err = s.b.DeleteMany(context.Background(), "a", "c")
+	s.Error(err)
+	s.Equal(2, report.Count(SyncFailed))
+	s.Equal([]string{"a", "c", "d"}, s.srv.Keys("delete"))
+}
+
+func (s *DeleteManySuite) TestDeletesWithOneRequestAtATime() {
+	s.require.NoError(s.b.SetMaxRequests(1))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	report, err := s.b.DeleteMany(ctx, "a", "b", "c", "missing")
+	s.require.NoError(err)
+	s.Equal(3, report.Count(SyncDelete))
+	s.Equal(1, report.Count(SyncSkipMissing))
+	s.Equal([]string{"d"}, s.srv.Keys("delete"))
+}
+
+func (s *DeleteManySuite) TestDryRunReportsPlan() {
+	dryRun, err := s.b.DryRunClone()
+	s.require.NoError(err)
+	defer dryRun.Close()
+
+	report, err := dryRun.DeleteMany(context.Background(), "a", "missing")
+	s.require.NoError(err)
+	s.True(report.DryRun)
+	s.Equal(1, report.Count(SyncDelete))
+	s.Equal(1, report.Count(SyncSkipMissing))
+	s.Len(s.srv.Keys("delete"), 4)
+}
+
+func (s *DeleteManySuite) TestSyncToBucketReportsFailedDeletes() {
+	target := &Bucket{
+		name:    "delete-target",
+		numJobs: 2,
+		retry:   RetryPolicy{MaxAttempts: 1},
+		storage: NewS3Storage(s3.New(s.s3.Auth, s.srv.Region()).Bucket("delete-target")),
+	}
+	s.require.NoError(s.b.Open(context.Background()))
+	defer s.b.Close()
+
+	for _, key := range []string{"extra/one", "extra/two"} {
+		s.require.NoError(target.storage.Put(key, strings.NewReader(key), int64(len(key)), "text/plain",
+			s3.Private, UploadOptions{}))
+	}
+	s.srv.FailDeletes("AccessDenied", "extra/two")
+
+	report, err := s.b.SyncToBucket(context.Background(), target, "none", "extra", true)
+	s.Error(err)
+	s.Equal(1, report.Count(SyncDelete))
+	s.Equal(1, report.Count(SyncFailed))
+	s.Equal([]string{"extra/two"}, s.srv.Keys("delete-target"))
+}
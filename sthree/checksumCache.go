@@ -0,0 +1,234 @@
+package sthree
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/tychoish/grip"
+)
+
+// ChecksumCacheFileName is the name of the file, in the root of the
+// local directory of a sync operation, that stores the checksum
+// cache. Sync operations never upload this file, and tools that list
+// local directories may want to ignore it as well.
+const ChecksumCacheFileName = ".curator-checksums.json"
+
+// checksumCache stores the checksums of local files, so that repeated
+// sync operations only need to hash files that have changed since
+// the last sync. Entries are keyed by the path of the file relative
+// to the root, and are only valid while the size and modification
+// time of the file are the same as when the file was hashed.
+type checksumCache struct {
+	root    string
+	entries map[string]*checksumCacheEntry
+	changed bool
+	mutex   sync.Mutex
+}
+
+type checksumCacheEntry struct {
+	Size    int64 `json:"size"`
+	ModTime int64 `json:"mtime"`
+
+	// Checksums are keyed by the part size of the checksum, and
+	// "0" for the MD5 checksum of the whole file.
+	Checksums map[string]string `json:"checksums"`
+}
+
+// newChecksumCache returns an empty checksum cache for the files in
+// the root directory.
+func newChecksumCache(root string) *checksumCache {
+	return &checksumCache{
+		root:    root,
+		entries: make(map[string]*checksumCacheEntry),
+	}
+}
+
+// loadChecksumCache reads the checksum cache for the root
+// directory. Missing or unreadable cache files produce an empty cache,
+// as the cache is only an optimization.
+func loadChecksumCache(root string) *checksumCache {
+	c := newChecksumCache(root)
+
+	data, err := ioutil.ReadFile(c.fileName())
+	if os.IsNotExist(err) {
+		return c
+	}
+
+	if err == nil {
+		err = json.Unmarshal(data, &c.entries)
+	}
+
+	if err != nil {
+		grip.Warning(errors.Wrapf(err, "problem reading checksum cache '%s', ignoring",
+			c.fileName()))
+		c.entries = make(map[string]*checksumCacheEntry)
+	}
+
+	return c
+}
+
+func (c *checksumCache) fileName() string {
+	return filepath.Join(c.root, ChecksumCacheFileName)
+}
+
+func (c *checksumCache) key(fileName string) (string, bool) {
+	rel, err := filepath.Rel(c.root, fileName)
+	if err != nil {
+		return "", false
+	}
+
+	return filepath.ToSlash(rel), true
+}
+
+// get returns the cached checksum of the file for the part size, if
+// the file has not changed since the checksum was cached. A nil cache
+// never has entries.
+func (c *checksumCache) get(fileName string, info os.FileInfo, partSize int64) (string, bool) {
+	if c == nil {
+		return "", false
+	}
+
+	key, ok := c.key(fileName)
+	if !ok {
+		return "", false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || entry.Size != info.Size() || entry.ModTime != info.ModTime().UnixNano() {
+		return "", false
+	}
+
+	sum, ok := entry.Checksums[strconv.FormatInt(partSize, 10)]
+	return sum, ok
+}
+
+// set adds the checksum of the file for the part size to the cache,
+// replacing all checksums for the file if it has changed. Setting a
+// checksum in a nil cache is a noop.
+func (c *checksumCache) set(fileName string, info os.FileInfo, partSize int64, sum string) {
+	if c == nil {
+		return
+	}
+
+	key, ok := c.key(fileName)
+	if !ok {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok || entry.Size != info.Size() || entry.ModTime != info.ModTime().UnixNano() {
+		entry = &checksumCacheEntry{
+			Size:      info.Size(),
+			ModTime:   info.ModTime().UnixNano(),
+			Checksums: make(map[string]string),
+		}
+		c.entries[key] = entry
+	}
+
+	entry.Checksums[strconv.FormatInt(partSize, 10)] = sum
+	c.changed = true
+}
+
+// remove drops the checksums of the file, which the caller is about
+// to replace or delete, from the cache. Removing a file from a nil
+// cache is a noop.
+func (c *checksumCache) remove(fileName string) {
+	if c == nil {
+		return
+	}
+
+	key, ok := c.key(fileName)
+	if !ok {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if _, ok = c.entries[key]; ok {
+		delete(c.entries, key)
+		c.changed = true
+	}
+}
+
+// save removes entries for files that no longer exist, and then, if
+// the cache has changed, writes the cache to a temporary file that
+// replaces the cache file.
+func (c *checksumCache) save() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for key := range c.entries {
+		if _, err := os.Stat(filepath.Join(c.root, filepath.FromSlash(key))); os.IsNotExist(err) {
+			delete(c.entries, key)
+			c.changed = true
+		}
+	}
+
+	if !c.changed {
+		return nil
+	}
+
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return errors.Wrap(err, "problem encoding checksum cache")
+	}
+
+	if err = os.MkdirAll(c.root, 0755); err != nil {
+		return errors.Wrapf(err, "problem creating directory '%s'", c.root)
+	}
+
+	tmp, err := ioutil.TempFile(c.root, ChecksumCacheFileName)
+	if err != nil {
+		return errors.Wrap(err, "problem creating temporary file for checksum cache")
+	}
+
+	_, err = tmp.Write(data)
+	grip.CatchError(tmp.Close())
+	if err == nil {
+		err = os.Rename(tmp.Name(), c.fileName())
+	}
+
+	if err != nil {
+		grip.CatchError(os.Remove(tmp.Name()))
+		return errors.Wrapf(err, "problem writing checksum cache '%s'", c.fileName())
+	}
+
+	c.changed = false
+	return nil
+}
+
+// SetChecksumCache enables or disables the checksum cache for sync
+// operations. When enabled, SyncTo and SyncFrom store the checksums of
+// local files in a hidden file in the root of the local directory,
+// and only hash files whose size or modification time has changed
+// since the last sync. The cache only affects the checksum comparison
+// mode.
+func (b *Bucket) SetChecksumCache(enabled bool) {
+	b.useChecksumCache = enabled
+}
+
+// openChecksumCache returns the checksum cache for a sync operation
+// on the local directory, or nil if the bucket does not use a cache.
+func (b *Bucket) openChecksumCache(local string) *checksumCache {
+	if !b.useChecksumCache || (b.compareMode != "" && b.compareMode != CompareChecksum) {
+		return nil
+	}
+
+	if info, err := os.Stat(local); err == nil && !info.IsDir() {
+		return nil
+	}
+
+	return loadChecksumCache(local)
+}
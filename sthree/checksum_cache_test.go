@@ -0,0 +1,200 @@
+package sthree
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+// ChecksumCacheSuite tests the local checksum cache, and its use in
+// sync operations with local storage.
+type ChecksumCacheSuite struct {
+	root    string
+	local   string
+	b       *Bucket
+	require *require.Assertions
+	suite.Suite
+}
+
+func TestChecksumCacheSuite(t *testing.T) {
+	suite.Run(t, new(ChecksumCacheSuite))
+}
+
+func (s *ChecksumCacheSuite) SetupSuite() {
+	s.require = s.Require()
+}
+
+func (s *ChecksumCacheSuite) SetupTest() {
+	root, err := ioutil.TempDir("", uuid.NewV4().String())
+	s.require.NoError(err)
+	s.root = root
+	s.local = filepath.Join(root, "local")
+	s.require.NoError(os.MkdirAll(s.local, 0755))
+
+	for name, content := range map[string]string{"a.txt": "one", "dir/b.txt": "two"} {
+		fileName := filepath.Join(s.local, name)
+		s.require.NoError(os.MkdirAll(filepath.Dir(fileName), 0755))
+		s.require.NoError(ioutil.WriteFile(fileName, []byte(content), 0644))
+	}
+
+	s.b = &Bucket{
+		name:    "cache",
+		numJobs: 2,
+		retry:   RetryPolicy{MaxAttempts: 1},
+		storage: NewFileSystemStorage(filepath.Join(root, "bucket")),
+	}
+	s.b.SetChecksumCache(true)
+	s.require.NoError(s.b.Open(context.Background()))
+}
+
+func (s *ChecksumCacheSuite) TearDownTest() {
+	s.b.Close()
+	s.NoError(os.RemoveAll(s.root))
+}
+
+func (s *ChecksumCacheSuite) stat(name string) os.FileInfo {
+	info, err := os.Stat(filepath.Join(s.local, name))
+	s.require.NoError(err)
+	return info
+}
+
+func (s *ChecksumCacheSuite) TestEntriesAreInvalidatedByChanges() {
+	c := loadChecksumCache(s.local)
+	fileName := filepath.Join(s.local, "a.txt")
+	info := s.stat("a.txt")
+
+	_, ok := c.get(fileName, info, 0)
+	s.False(ok)
+
+	c.set(fileName, info, 0, "checksum")
+	c.set(fileName, info, minPartSize, "checksum-2")
+	sum, ok := c.get(fileName, info, 0)
+	s.True(ok)
+	s.Equal("checksum", sum)
+	sum, ok = c.get(fileName, info, minPartSize)
+	s.True(ok)
+	s.Equal("checksum-2", sum)
+
+	mtime := info.ModTime().Add(time.Second)
+	s.require.NoError(os.Chtimes(fileName, mtime, mtime))
+	info = s.stat("a.txt")
+	_, ok = c.get(fileName, info, 0)
+	s.False(ok)
+
+	// setting a checksum for a changed file removes the stale
+	// checksums.
+	c.set(fileName, info, 0, "new")
+	_, ok = c.get(fileName, info, minPartSize)
+	s.False(ok)
+}
+
+func (s *ChecksumCacheSuite) TestNilCacheHasNoEntries() {
+	var c *checksumCache
+	fileName := filepath.Join(s.local, "a.txt")
+
+	c.set(fileName, s.stat("a.txt"), 0, "checksum")
+	_, ok := c.get(fileName, s.stat("a.txt"), 0)
+	s.False(ok)
+}
+
+func (s *ChecksumCacheSuite) TestSaveAndLoadRoundTrip() {
+	c := loadChecksumCache(s.local)
+	c.set(filepath.Join(s.local, "a.txt"), s.stat("a.txt"), 0, "one")
+	c.set(filepath.Join(s.local, "dir", "b.txt"), s.stat("dir/b.txt"), 0, "two")
+	s.NoError(c.save())
+
+	s.NoError(os.Remove(filepath.Join(s.local, "a.txt")))
+	c = loadChecksumCache(s.local)
+	s.Len(c.entries, 2)
+	s.NoError(c.save())
+
+	c = loadChecksumCache(s.local)
+	s.Len(c.entries, 1)
+	sum, ok := c.get(filepath.Join(s.local, "dir", "b.txt"), s.stat("dir/b.txt"), 0)
+	s.True(ok)
+	s.Equal("two", sum)
+}
+
+func (s *ChecksumCacheSuite) TestCorruptCacheFilesAreIgnored() {
+	s.require.NoError(ioutil.WriteFile(filepath.Join(s.local, ChecksumCacheFileName), []byte("{"),
+		0644))
+
+	c := loadChecksumCache(s.local)
+	s.Len(c.entries, 0)
+}
+
+func (s *ChecksumCacheSuite) TestSyncToUsesCacheAndNeverUploadsIt() {
+	_, err := s.b.SyncTo(context.Background(), s.local, "sync", false)
+	s.NoError(err)
+	_, err = s.b.SyncTo(context.Background(), s.local, "sync", false)
+	s.NoError(err)
+
+	c := loadChecksumCache(s.local)
+	s.Len(c.entries, 2)
+	s.Len(s.b.contents(context.Background(), "sync"), 2)
+
+	// change a file without changing its size or modification
+	// time: the cached checksum hides the change.
+	info := s.stat("a.txt")
+	fileName := filepath.Join(s.local, "a.txt")
+	s.require.NoError(ioutil.WriteFile(fileName, []byte("ONE"), 0644))
+	s.require.NoError(os.Chtimes(fileName, info.ModTime(), info.ModTime()))
+	_, err = s.b.SyncTo(context.Background(), s.local, "sync", false)
+	s.NoError(err)
+
+	reader, err := s.b.storage.Get("sync/a.txt")
+	s.require.NoError(err)
+	data, err := ioutil.ReadAll(reader)
+	s.NoError(reader.Close())
+	s.NoError(err)
+	s.Equal("one", string(data))
+
+	// without the cache, sync detects the change.
+	s.b.SetChecksumCache(false)
+	_, err = s.b.SyncTo(context.Background(), s.local, "sync", false)
+	s.NoError(err)
+	reader, err = s.b.storage.Get("sync/a.txt")
+	s.require.NoError(err)
+	data, err = ioutil.ReadAll(reader)
+	s.NoError(reader.Close())
+	s.NoError(err)
+	s.Equal("ONE", string(data))
+}
+
+func (s *ChecksumCacheSuite) TestSyncFromCachesDownloadedChecksums() {
+	_, err := s.b.SyncTo(context.Background(), s.local, "sync", false)
+	s.NoError(err)
+
+	dest := filepath.Join(s.root, "dest")
+	_, err = s.b.SyncFrom(context.Background(), dest, "sync", false)
+	s.NoError(err)
+
+	c := loadChecksumCache(dest)
+	s.require.Len(c.entries, 2)
+
+	info, err := os.Stat(filepath.Join(dest, "a.txt"))
+	s.require.NoError(err)
+	sum, ok := c.get(filepath.Join(dest, "a.txt"), info, 0)
+	s.True(ok)
+	s.Equal("f97c5d29941bfb1b2fdab0874906ab82", sum)
+}
+
+func (s *ChecksumCacheSuite) TestCacheIsOnlyUsedForChecksumComparisons() {
+	s.NotNil(s.b.openChecksumCache(s.local))
+
+	s.NoError(s.b.SetCompareMode(CompareSize))
+	s.Nil(s.b.openChecksumCache(s.local))
+
+	s.NoError(s.b.SetCompareMode(CompareChecksum))
+	s.Nil(s.b.openChecksumCache(filepath.Join(s.local, "a.txt")))
+
+	s.b.SetChecksumCache(false)
+	s.Nil(s.b.openChecksumCache(s.local))
+}
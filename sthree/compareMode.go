@@ -0,0 +1,146 @@
+package sthree
+
+import (
+	"os"
+
+	"github.com/goamz/goamz/s3"
+	"github.com/pkg/errors"
+)
+
+// CompareMode determines how sync operations decide whether a local
+// file and a remote object differ, and therefore whether to transfer
+// the file.
+type CompareMode string
+
+const (
+	// CompareChecksum compares the MD5 checksum of the local file
+	// with the ETag of the object, or, for objects encrypted with
+	// SSE-KMS, the checksum in the metadata of the object. This is
+	// the most accurate, and default, mode, but requires reading
+	// every local file. Encrypted objects without checksum metadata
+	// compare as in the CompareSizeAndModTime mode.
+	CompareChecksum CompareMode = "checksum"
+
+	// CompareSizeAndModTime compares the sizes of the file and the
+	// object, and the modification time of the local file with the
+	// modification time stored in the object's metadata at upload
+	// time, similar to rsync. For objects without this metadata,
+	// uploads compare with the time of the last upload instead.
+	CompareSizeAndModTime CompareMode = "size-mtime"
+
+	// CompareSize only compares the sizes of the file and the
+	// object.
+	CompareSize CompareMode = "size"
+
+	// CompareAlways transfers every file, without comparison.
+	CompareAlways CompareMode = "always"
+)
+
+// Validate returns an error if the mode is not one of the defined
+// comparison modes.
+func (m CompareMode) Validate() error {
+	switch m {
+	case CompareChecksum, CompareSizeAndModTime, CompareSize, CompareAlways:
+		return nil
+	default:
+		return errors.Errorf("'%s' is not a valid comparison mode", m)
+	}
+}
+
+// SetCompareMode sets the comparison mode that SyncTo and SyncFrom
+// use to decide which files to transfer. The default mode is
+// CompareChecksum.
+func (b *Bucket) SetCompareMode(mode CompareMode) error {
+	if err := mode.Validate(); err != nil {
+		return err
+	}
+
+	b.compareMode = mode
+	return nil
+}
+
+// isDifferent returns true if a sync operation should transfer the
+// local file to or from the remote object, according to the bucket's
+// comparison mode. The push argument is true for uploads. The
+// checksum cache may be nil.
+func (b *Bucket) isDifferent(localPath string, local os.FileInfo, remote *ObjectInfo, push bool,
+	cache *checksumCache) (bool, error) {
+	switch b.compareMode {
+	case CompareAlways:
+		return true, nil
+	case CompareSize:
+		return local.Size() != remote.Size, nil
+	case CompareSizeAndModTime:
+		return isDifferentSizeOrModTime(local, remote, push), nil
+	default:
+		remoteChecksum := remote.checksum()
+
+		// objects encrypted with SSE-KMS that other clients
+		// uploaded do not have checksums, so compare their
+		// sizes and modification times instead.
+		if remoteChecksum == "" && remote.ServerSideEncryption == "aws:kms" {
+			return isDifferentSizeOrModTime(local, remote, push), nil
+		}
+
+		// if s3 doesn't report a hash for the object, then
+		// there's no need to hash the file: always transfer.
+		if remoteChecksum == "" {
+			return true, nil
+		}
+
+		localChecksum, err := b.checksum(localPath, local, remoteChecksum, cache)
+		if err != nil {
+			return false, errors.Wrap(err, "problem reading file before hashing for sync operation")
+		}
+
+		return localChecksum != remoteChecksum, nil
+	}
+}
+
+// isIdenticalToListed returns true if the entry of the object in a
+// list result shows that the local file has the same content as the
+// object, so that sync jobs can skip the HEAD request for the object.
+// List results do not include the metadata of objects, so only the
+// checksum and size modes compare list entries, and checksums that
+// differ are not conclusive, as the ETags of objects encrypted with
+// SSE-KMS are not checksums. Returns false for objects that were not
+// in the list result, and if the file cannot be hashed.
+func (b *Bucket) isIdenticalToListed(localPath string, local os.FileInfo, listed s3.Key,
+	cache *checksumCache) bool {
+	if listed.ETag == "" {
+		return false
+	}
+
+	remote := objectInfoFromKey(listed)
+
+	switch b.compareMode {
+	case CompareSize:
+		return local.Size() == remote.Size
+	case CompareChecksum, "":
+		remoteChecksum := remote.checksum()
+		localChecksum, err := b.checksum(localPath, local, remoteChecksum, cache)
+
+		return err == nil && localChecksum == remoteChecksum
+	default:
+		return false
+	}
+}
+
+// isDifferentSizeOrModTime implements the CompareSizeAndModTime mode.
+func isDifferentSizeOrModTime(local os.FileInfo, remote *ObjectInfo, push bool) bool {
+	if local.Size() != remote.Size {
+		return true
+	}
+
+	if mtime, ok := remote.ModTime(); ok {
+		return local.ModTime().Unix() != mtime.Unix()
+	}
+
+	if push {
+		// the object was uploaded after the file last changed,
+		// most likely from this file.
+		return local.ModTime().After(remote.LastModified)
+	}
+
+	return local.ModTime().Unix() != remote.LastModified.Unix()
+}
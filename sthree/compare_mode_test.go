@@ -0,0 +1,280 @@
+package sthree
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/goamz/goamz/aws"
+	"github.com/goamz/goamz/s3"
+	"github.com/mongodb/curator/sthree/fakes3"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+// CompareModeSuite tests the comparison modes of sync operations,
+// using a dedicated fake S3 server.
+type CompareModeSuite struct {
+	srv     *fakes3.Server
+	b       *Bucket
+	local   string
+	require *require.Assertions
+	suite.Suite
+}
+
+func TestCompareModeSuite(t *testing.T) {
+	suite.Run(t, new(CompareModeSuite))
+}
+
+func (s *CompareModeSuite) SetupSuite() {
+	s.require = s.Require()
+}
+
+func (s *CompareModeSuite) SetupTest() {
+	s.srv = fakes3.NewServer()
+	auth := aws.Auth{AccessKey: "fake", SecretKey: "fake"}
+
+	s.b = &Bucket{
+		name:    "compare",
+		numJobs: 2,
+		retry:   RetryPolicy{MaxAttempts: 1},
+		storage: NewS3Storage(s3.New(auth, s.srv.Region()).Bucket("compare")),
+	}
+	s.require.NoError(s.b.Open(context.Background()))
+
+	local, err := ioutil.TempDir("", uuid.NewV4().String())
+	s.require.NoError(err)
+	s.local = local
+
+	s.require.NoError(ioutil.WriteFile(filepath.Join(s.local, "one.txt"), []byte("one"), 0644))
+	s.require.NoError(ioutil.WriteFile(filepath.Join(s.local, "two.txt"), []byte("two"), 0644))
+}
+
+func (s *CompareModeSuite) TearDownTest() {
+	s.b.Close()
+	s.srv.Close()
+	s.NoError(os.RemoveAll(s.local))
+}
+
+// touch changes the modification time of a local file without
+// changing its content.
+func (s *CompareModeSuite) touch(name string, mtime time.Time) {
+	s.require.NoError(os.Chtimes(filepath.Join(s.local, name), mtime, mtime))
+}
+
+// uploadTimes returns the last modified time of every object with the
+// prefix.
+func (s *CompareModeSuite) uploadTimes() map[string]string {
+	out := make(map[string]string)
+	for key, obj := range s.b.contents(context.Background(), "sync") {
+		out[key] = obj.LastModified
+	}
+
+	return out
+}
+
+func (s *CompareModeSuite) syncTwice(mode CompareMode) (map[string]string, map[string]string) {
+	s.require.NoError(s.b.SetCompareMode(mode))
+	_, err := s.b.SyncTo(context.Background(), s.local, "sync", false)
+	s.require.NoError(err)
+	before := s.uploadTimes()
+
+	time.Sleep(10 * time.Millisecond)
+	s.touch("one.txt", time.Now().Add(time.Hour))
+	_, err = s.b.SyncTo(context.Background(), s.local, "sync", false)
+	s.require.NoError(err)
+
+	return before, s.uploadTimes()
+}
+
+func (s *CompareModeSuite) TestModeValidation() {
+	modes := []CompareMode{CompareChecksum, CompareSizeAndModTime, CompareSize, CompareAlways}
+	for _, mode := range modes {
+		s.NoError(mode.Validate())
+		s.NoError(s.b.SetCompareMode(mode))
+		s.Equal(mode, s.b.compareMode)
+	}
+
+	s.Error(CompareMode("").Validate())
+	s.Error(s.b.SetCompareMode("mtime"))
+	s.Equal(CompareAlways, s.b.compareMode)
+}
+
+func (s *CompareModeSuite) TestPutStoresModificationTime() {
+	mtime := time.Date(2016, time.June, 1, 12, 0, 0, 0, time.UTC)
+	s.touch("one.txt", mtime)
+	s.require.NoError(s.b.Put(context.Background(), filepath.Join(s.local, "one.txt"), "one.txt"))
+
+	info, err := s.b.head(context.Background(), "one.txt")
+	s.require.NoError(err)
+	s.require.NotNil(info)
+	s.Equal(int64(3), info.Size)
+
+	stored, ok := info.ModTime()
+	s.True(ok)
+	s.True(mtime.Equal(stored))
+
+	info, err = s.b.head(context.Background(), "missing.txt")
+	s.NoError(err)
+	s.Nil(info)
+}
+
+func (s *CompareModeSuite) TestChecksumModeIgnoresModificationTimes() {
+	before, after := s.syncTwice(CompareChecksum)
+	s.Len(before, 2)
+	s.Equal(before, after)
+}
+
+func (s *CompareModeSuite) TestSizeModeIgnoresModificationTimes() {
+	before, after := s.syncTwice(CompareSize)
+	s.Len(before, 2)
+	s.Equal(before, after)
+}
+
+func (s *CompareModeSuite) TestSizeAndModTimeModeUploadsTouchedFiles() {
+	before, after := s.syncTwice(CompareSizeAndModTime)
+	s.Len(before, 2)
+	s.NotEqual(before["sync/one.txt"], after["sync/one.txt"])
+	s.Equal(before["sync/two.txt"], after["sync/two.txt"])
+}
+
+func (s *CompareModeSuite) TestAlwaysModeUploadsAllFiles() {
+	before, after := s.syncTwice(CompareAlways)
+	s.Len(before, 2)
+	s.NotEqual(before["sync/one.txt"], after["sync/one.txt"])
+	s.NotEqual(before["sync/two.txt"], after["sync/two.txt"])
+}
+
+func (s *CompareModeSuite) TestSyncFromPreservesModificationTimes() {
+	mtime := time.Date(2016, time.June, 1, 12, 0, 0, 0, time.UTC)
+	s.touch("one.txt", mtime)
+	s.require.NoError(s.b.SetCompareMode(CompareSizeAndModTime))
+	_, err := s.b.SyncTo(context.Background(), s.local, "sync", false)
+	s.require.NoError(err)
+
+	// another machine, with no local files, pulls the files
+	dest, err := ioutil.TempDir("", uuid.NewV4().String())
+	s.require.NoError(err)
+	defer os.RemoveAll(dest)
+	_, err = s.b.SyncFrom(context.Background(), dest, "sync", false)
+	s.require.NoError(err)
+
+	info, err := os.Stat(filepath.Join(dest, "one.txt"))
+	s.require.NoError(err)
+	s.True(mtime.Equal(info.ModTime()))
+
+	// local changes that keep the size and time are not detected
+	// in this mode, and are not overwritten.
+	s.require.NoError(ioutil.WriteFile(filepath.Join(dest, "one.txt"), []byte("ONE"), 0644))
+	s.require.NoError(os.Chtimes(filepath.Join(dest, "one.txt"), mtime, mtime))
+	_, err = s.b.SyncFrom(context.Background(), dest, "sync", false)
+	s.require.NoError(err)
+	data, err := ioutil.ReadFile(filepath.Join(dest, "one.txt"))
+	s.NoError(err)
+	s.Equal("ONE", string(data))
+
+	// ... but they are in checksum mode.
+	s.require.NoError(s.b.SetCompareMode(CompareChecksum))
+	_, err = s.b.SyncFrom(context.Background(), dest, "sync", false)
+	s.require.NoError(err)
+	data, err = ioutil.ReadFile(filepath.Join(dest, "one.txt"))
+	s.NoError(err)
+	s.Equal("one", string(data))
+}
+
+func (s *CompareModeSuite) TestModTimeComparisonWithoutMetadata() {
+	fileName := filepath.Join(s.local, "one.txt")
+	uploaded := time.Now().Truncate(time.Second)
+	remote := &ObjectInfo{Size: 3, LastModified: uploaded}
+	s.require.NoError(s.b.SetCompareMode(CompareSizeAndModTime))
+
+	// files modified before the last upload are unchanged
+	s.touch("one.txt", uploaded.Add(-time.Minute))
+	local, err := os.Stat(fileName)
+	s.require.NoError(err)
+	different, err := s.b.isDifferent(fileName, local, remote, true, nil)
+	s.NoError(err)
+	s.False(different)
+
+	// ... unless the sizes differ
+	remote.Size = 4
+	different, err = s.b.isDifferent(fileName, local, remote, true, nil)
+	s.NoError(err)
+	s.True(different)
+	remote.Size = 3
+
+	// and files modified after the upload are different
+	s.touch("one.txt", uploaded.Add(time.Minute))
+	local, err = os.Stat(fileName)
+	s.require.NoError(err)
+	different, err = s.b.isDifferent(fileName, local, remote, true, nil)
+	s.NoError(err)
+	s.True(different)
+
+	// downloads compare with the upload time exactly
+	different, err = s.b.isDifferent(fileName, local, remote, false, nil)
+	s.NoError(err)
+	s.True(different)
+	s.touch("one.txt", uploaded)
+	local, err = os.Stat(fileName)
+	s.require.NoError(err)
+	different, err = s.b.isDifferent(fileName, local, remote, false, nil)
+	s.NoError(err)
+	s.False(different)
+}
+
+func (s *CompareModeSuite) TestIdenticalFilesSkipHeadRequests() {
+	// the filter never fails requests, but counts the HEAD requests.
+	var mutex sync.Mutex
+	var heads int
+	s.srv.FailRequests(1, func(r *http.Request) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if r.Method == "HEAD" {
+			heads++
+		}
+		return false
+	})
+	countHeads := func() int {
+		mutex.Lock()
+		defer mutex.Unlock()
+		n := heads
+		heads = 0
+		return n
+	}
+
+	for _, mode := range []CompareMode{CompareChecksum, CompareSize} {
+		s.require.NoError(s.b.SetCompareMode(mode))
+		_, err := s.b.SyncTo(context.Background(), s.local, "sync", false)
+		s.require.NoError(err)
+		countHeads()
+
+		_, err = s.b.SyncTo(context.Background(), s.local, "sync", false)
+		s.require.NoError(err)
+		s.Equal(0, countHeads(), string(mode))
+
+		report, err := s.b.SyncFrom(context.Background(), s.local, "sync", false)
+		s.require.NoError(err)
+		s.Equal(2, report.Count(SyncSkipIdentical))
+		s.Equal(0, countHeads(), string(mode))
+	}
+
+	// files that differ from the list result, and comparisons that
+	// need the metadata of objects, still check the objects.
+	s.require.NoError(s.b.SetCompareMode(CompareChecksum))
+	s.require.NoError(ioutil.WriteFile(filepath.Join(s.local, "one.txt"), []byte("ONE"), 0644))
+	_, err := s.b.SyncTo(context.Background(), s.local, "sync", false)
+	s.require.NoError(err)
+	s.Equal(1, countHeads())
+
+	s.require.NoError(s.b.SetCompareMode(CompareSizeAndModTime))
+	_, err = s.b.SyncTo(context.Background(), s.local, "sync", false)
+	s.require.NoError(err)
+	s.Equal(2, countHeads())
+}
@@ -0,0 +1,59 @@
+package sthree
+
+import (
+	"io"
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// contextReader wraps a reader so that reads fail once the context is
+// canceled, which stops in progress uploads and downloads at the next
+// read rather than at the end of the transfer.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func newContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{ctx: ctx, r: r}
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	return r.r.Read(p)
+}
+
+// contextReadSeeker is a contextReader for readers that also support
+// seeking, such as the parts of multipart uploads, which the S3 client
+// rewinds to compute checksums and to retry requests.
+type contextReadSeeker struct {
+	contextReader
+	s io.Seeker
+}
+
+func newContextReadSeeker(ctx context.Context, r io.ReadSeeker) io.ReadSeeker {
+	return &contextReadSeeker{contextReader: contextReader{ctx: ctx, r: r}, s: r}
+}
+
+func (r *contextReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return r.s.Seek(offset, whence)
+}
+
+// wait blocks for the duration, typically the backoff between the
+// attempts of a retry loop, and returns early, with the context's
+// error, if the context is canceled.
+func wait(ctx context.Context, dur time.Duration) error {
+	timer := time.NewTimer(dur)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,205 @@
+package sthree
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/goamz/goamz/s3"
+	"github.com/mongodb/amboy"
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+// ContextSuite tests the cancellation of bucket operations, with
+// local storage.
+type ContextSuite struct {
+	root    string
+	local   string
+	b       *Bucket
+	require *require.Assertions
+	suite.Suite
+}
+
+func TestContextSuite(t *testing.T) {
+	suite.Run(t, new(ContextSuite))
+}
+
+func (s *ContextSuite) SetupSuite() {
+	s.require = s.Require()
+}
+
+func (s *ContextSuite) SetupTest() {
+	root, err := ioutil.TempDir("", uuid.NewV4().String())
+	s.require.NoError(err)
+	s.root = root
+	s.local = filepath.Join(root, "local")
+
+	for _, name := range []string{"a.txt", "b.txt", "dir/c.txt"} {
+		fileName := filepath.Join(s.local, name)
+		s.require.NoError(os.MkdirAll(filepath.Dir(fileName), 0755))
+		s.require.NoError(ioutil.WriteFile(fileName, []byte(name), 0644))
+	}
+
+	s.b = &Bucket{
+		name:    "context",
+		numJobs: 2,
+		retry:   RetryPolicy{MaxAttempts: 1},
+		storage: NewFileSystemStorage(filepath.Join(root, "bucket")),
+	}
+	s.require.NoError(s.b.Open(context.Background()))
+}
+
+func (s *ContextSuite) TearDownTest() {
+	s.b.Close()
+	s.NoError(os.RemoveAll(s.root))
+}
+
+func (s *ContextSuite) TestReaderFailsAfterCancellation() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := newContextReader(ctx, bytes.NewBufferString("content"))
+
+	buf := make([]byte, 3)
+	n, err := r.Read(buf)
+	s.NoError(err)
+	s.Equal("con", string(buf[:n]))
+
+	cancel()
+	n, err = r.Read(buf)
+	s.Equal(0, n)
+	s.Equal(context.Canceled, err)
+}
+
+func (s *ContextSuite) TestWaitReturnsEarlyWhenCanceled() {
+	s.NoError(wait(context.Background(), time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	s.Equal(context.Canceled, wait(ctx, time.Minute))
+	s.True(time.Since(start) < time.Second)
+}
+
+func (s *ContextSuite) TestOperationsFailWithCanceledContext() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := s.b.Put(ctx, filepath.Join(s.local, "a.txt"), "a.txt")
+	s.Equal(context.Canceled, errors.Cause(err))
+	s.Error(s.b.Get(ctx, "a.txt", filepath.Join(s.root, "a.txt")))
+	s.Error(s.b.Delete(ctx, "a.txt"))
+	_, err = s.b.List(ctx, "", true)
+	s.Error(err)
+
+	listing, err := s.b.List(context.Background(), "", true)
+	s.NoError(err)
+	s.Len(listing.Objects, 0)
+}
+
+func (s *ContextSuite) TestCanceledSyncReturnsPartialReport() {
+	report, err := s.b.SyncTo(context.Background(), s.local, "prefix", false)
+	s.require.NoError(err)
+	s.False(report.Canceled)
+	s.Equal(3, report.Count(SyncUpload))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	report, err = s.b.SyncFrom(ctx, filepath.Join(s.root, "dest"), "prefix", false)
+	s.Error(err)
+	s.require.NotNil(report)
+	s.True(report.Canceled)
+	s.Len(report.Items, 0)
+
+	report, err = s.b.SyncTo(ctx, s.local, "prefix", false)
+	s.Error(err)
+	s.True(report.Canceled)
+	s.Len(report.Items, 0)
+}
+
+// blockingStorage is storage with uploads and downloads that do not
+// return until the test releases them, regardless of the context of
+// the operation.
+type blockingStorage struct {
+	Storage
+	release chan struct{}
+}
+
+func (s *blockingStorage) Put(key string, r io.Reader, size int64, contentType string, perm s3.ACL,
+	opts UploadOptions) error {
+	<-s.release
+	return s.Storage.Put(key, r, size, contentType, perm, opts)
+}
+
+func (s *blockingStorage) Get(key string) (io.ReadCloser, error) {
+	<-s.release
+	return s.Storage.Get(key)
+}
+
+func (s *ContextSuite) TestSyncsReturnWhenCanceledWhileJobsRun() {
+	_, err := s.b.SyncTo(context.Background(), s.local, "prefix", false)
+	s.require.NoError(err)
+
+	release := make(chan struct{})
+	defer close(release)
+	s.b.SetStorage(&blockingStorage{Storage: s.b.storage, release: release})
+
+	for name, op := range map[string]func(context.Context) (*SyncReport, error){
+		"push": func(ctx context.Context) (*SyncReport, error) {
+			return s.b.SyncTo(ctx, s.local, "other", false)
+		},
+		"pull": func(ctx context.Context) (*SyncReport, error) {
+			return s.b.SyncFrom(ctx, filepath.Join(s.root, "dest"), "prefix", false)
+		},
+		"copy": func(ctx context.Context) (*SyncReport, error) {
+			return s.b.SyncToBucket(ctx, s.b, "prefix", "copy", false)
+		},
+	} {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		start := time.Now()
+		report, err := op(ctx)
+		cancel()
+
+		s.Error(err, name)
+		s.Equal(context.DeadlineExceeded, errors.Cause(err), name)
+		s.True(time.Since(start) < 5*time.Second, name)
+		s.require.NotNil(report, name)
+		s.True(report.Canceled, name)
+	}
+}
+
+func (s *ContextSuite) TestJobsThatCompleteAfterCancellationDoNotChangeResults() {
+	_, err := s.b.SyncTo(context.Background(), s.local, "prefix", false)
+	s.require.NoError(err)
+
+	release := make(chan struct{})
+	s.b.SetStorage(&blockingStorage{Storage: s.b.storage, release: release})
+	s.b.SetSyncJournal(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	report, err := s.b.SyncTo(ctx, s.local, "other", false)
+	s.Error(err)
+	s.require.NotNil(report)
+	items := len(report.Items)
+
+	// the jobs that were waiting for the storage complete after
+	// the operation returned.
+	close(release)
+	amboy.Wait(s.b.queue)
+
+	s.Len(report.Items, items)
+	s.Equal(0, report.Count(SyncUpload))
+
+	journal, err := ioutil.ReadFile(filepath.Join(s.local, syncJournalFileName("push")))
+	s.require.NoError(err)
+	s.NotContains(string(journal), `"state":"complete"`)
+}
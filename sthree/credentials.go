@@ -0,0 +1,796 @@
+package sthree
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goamz/goamz/aws"
+	"github.com/pkg/errors"
+	"github.com/tychoish/grip"
+	"github.com/vaughan0/go-ini"
+)
+
+const (
+	// defaultRefreshWindow is how long before credentials expire
+	// that refreshing credentials retrieve new credentials, so that
+	// requests in long operations never use expired credentials.
+	defaultRefreshWindow = 5 * time.Minute
+
+	// refreshRetryInterval is how long refreshing credentials wait
+	// after a failure to retrieve credentials before trying again.
+	refreshRetryInterval = 10 * time.Second
+
+	defaultSTSEndpoint      = "https://sts.amazonaws.com"
+	defaultSessionDuration  = time.Hour
+	defaultEC2MetadataURL   = "http://169.254.169.254"
+	defaultECSMetadataURL   = "http://169.254.170.2"
+	metadataRequestTimeout  = 2 * time.Second
+	metadataTokenTTLSeconds = "21600"
+
+	// maxProfileDepth limits the length of the chains of profiles
+	// that assume roles with the credentials of other profiles.
+	maxProfileDepth = 5
+)
+
+// Credentials are AWS security credentials. Temporary credentials,
+// for instance the credentials of an assumed role, have a session
+// token and an expiration time.
+//
+// Credentials implement CredentialProvider, and always provide
+// themselves, which makes it possible to use static credentials
+// wherever a provider is required.
+type Credentials struct {
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Expiration   time.Time
+}
+
+// Retrieve returns the credentials.
+func (c Credentials) Retrieve() (Credentials, error) {
+	return c, nil
+}
+
+// expiresBefore returns true if the credentials expire before the
+// time. Credentials without an expiration time never expire.
+func (c Credentials) expiresBefore(t time.Time) bool {
+	return !c.Expiration.IsZero() && c.Expiration.Before(t)
+}
+
+// CredentialProvider is the interface of sources of AWS credentials.
+// Use NewRefreshingCredentials to cache the credentials of providers
+// that make requests to retrieve credentials.
+type CredentialProvider interface {
+	Retrieve() (Credentials, error)
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Provider chains and refreshing credentials
+//
+////////////////////////////////////////////////////////////////////////
+
+type credentialChain struct {
+	providers []CredentialProvider
+}
+
+// NewCredentialChain returns a provider that retrieves credentials
+// from the first of the providers that has credentials.
+func NewCredentialChain(providers ...CredentialProvider) CredentialProvider {
+	return &credentialChain{providers: providers}
+}
+
+func (c *credentialChain) Retrieve() (Credentials, error) {
+	catcher := grip.NewCatcher()
+
+	for _, p := range c.providers {
+		creds, err := p.Retrieve()
+		if err == nil {
+			return creds, nil
+		}
+		catcher.Add(err)
+	}
+
+	return Credentials{}, errors.Wrap(catcher.Resolve(), "no valid aws credentials found")
+}
+
+type refreshingCredentials struct {
+	provider CredentialProvider
+	window   time.Duration
+	creds    Credentials
+	err      error
+	retryAt  time.Time
+	mutex    sync.Mutex
+}
+
+// NewRefreshingCredentials returns a provider that caches the
+// credentials of another provider, and retrieves new credentials
+// five minutes before the cached credentials expire. If a refresh
+// fails, the provider returns the cached credentials until they
+// expire, and waits before trying again. The provider is safe for
+// concurrent use.
+func NewRefreshingCredentials(p CredentialProvider) CredentialProvider {
+	return &refreshingCredentials{provider: p, window: defaultRefreshWindow}
+}
+
+func (r *refreshingCredentials) Retrieve() (Credentials, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+	haveCreds := r.creds.AccessKey != "" && !r.creds.expiresBefore(now)
+
+	if haveCreds && !r.creds.expiresBefore(now.Add(r.window)) {
+		return r.creds, nil
+	}
+
+	if r.err != nil && now.Before(r.retryAt) {
+		if haveCreds {
+			return r.creds, nil
+		}
+		return Credentials{}, r.err
+	}
+
+	creds, err := r.provider.Retrieve()
+	if err != nil {
+		r.err = err
+		r.retryAt = now.Add(refreshRetryInterval)
+
+		if haveCreds {
+			grip.Warning(errors.Wrapf(err, "problem refreshing aws credentials, which expire at %s",
+				r.creds.Expiration.Format(time.RFC3339)))
+			return r.creds, nil
+		}
+
+		return Credentials{}, err
+	}
+
+	r.creds = creds
+	r.err = nil
+	grip.DebugWhenf(!creds.Expiration.IsZero(), "retrieved aws credentials that expire at %s",
+		creds.Expiration.Format(time.RFC3339))
+
+	return creds, nil
+}
+
+// DefaultCredentials returns the provider of the credentials for the
+// profile. Without a profile, the provider uses the first of:
+//
+//   - the AWS_ACCESS_KEY_ID (or AWS_ACCESS_KEY), AWS_SECRET_ACCESS_KEY
+//     (or AWS_SECRET_KEY), and AWS_SESSION_TOKEN environment variables;
+//
+//   - the profile named by the AWS_PROFILE environment variable, or the
+//     "default" profile, in the shared credentials and config files
+//     (see SharedCredentials);
+//
+//   - the ECS container or EC2 instance metadata endpoint.
+//
+// With a profile, the provider only uses that profile of the shared
+// files. The credentials of the provider refresh before they expire.
+func DefaultCredentials(profile string) CredentialProvider {
+	if profile != "" {
+		return NewRefreshingCredentials(SharedCredentials{Profile: profile})
+	}
+
+	return NewRefreshingCredentials(NewCredentialChain(EnvCredentials{}, SharedCredentials{},
+		MetadataCredentials{}))
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Environment variables
+//
+////////////////////////////////////////////////////////////////////////
+
+// EnvCredentials provide credentials from the standard AWS
+// environment variables.
+type EnvCredentials struct{}
+
+func (EnvCredentials) Retrieve() (Credentials, error) {
+	creds := Credentials{
+		AccessKey:    firstEnv("AWS_ACCESS_KEY_ID", "AWS_ACCESS_KEY"),
+		SecretKey:    firstEnv("AWS_SECRET_ACCESS_KEY", "AWS_SECRET_KEY"),
+		SessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		return Credentials{}, errors.New("aws credential environment variables are not set")
+	}
+
+	return creds, nil
+}
+
+// firstEnv returns the value of the first of the environment
+// variables that is set.
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if value := os.Getenv(name); value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Shared credentials and config files
+//
+////////////////////////////////////////////////////////////////////////
+
+// SharedCredentials provide the credentials of a profile in the shared
+// AWS credentials and config files. Profiles may specify:
+//
+//   - static credentials, with aws_access_key_id, aws_secret_access_key,
+//     and optionally aws_session_token;
+//
+//   - a role to assume, with role_arn and either source_profile, the
+//     profile with the credentials that assume the role, or
+//     credential_source, one of "Environment", "Ec2InstanceMetadata",
+//     or "EcsContainer". The optional external_id, role_session_name,
+//     and duration_seconds settings configure the session;
+//
+//   - a command that prints credentials, with credential_process.
+//
+// Settings in the credentials file take precedence over settings in
+// the config file. SharedCredentials read the files each time they
+// retrieve credentials, and never change the environment, so
+// providers for different profiles are safe to use concurrently.
+type SharedCredentials struct {
+	// Filename is the path of the credentials file. Defaults to
+	// the AWS_SHARED_CREDENTIALS_FILE or AWS_CREDENTIAL_FILE
+	// environment variable, or "$HOME/.aws/credentials".
+	Filename string
+
+	// ConfigFilename is the path of the config file. Defaults to
+	// the AWS_CONFIG_FILE environment variable, or
+	// "$HOME/.aws/config".
+	ConfigFilename string
+
+	// Profile is the name of the profile. Defaults to the
+	// AWS_PROFILE environment variable, or "default".
+	Profile string
+}
+
+func (s SharedCredentials) Retrieve() (Credentials, error) {
+	profile := s.Profile
+	if profile == "" {
+		profile = firstEnv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+
+	files, err := s.load()
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	provider, err := files.provider(profile, 0)
+	if err != nil {
+		return Credentials{}, err
+	}
+
+	return provider.Retrieve()
+}
+
+// sharedFiles are the settings of the profiles in the shared
+// credentials and config files.
+type sharedFiles struct {
+	credentials ini.File
+	config      ini.File
+}
+
+func (s SharedCredentials) load() (*sharedFiles, error) {
+	credsPath := s.Filename
+	if credsPath == "" {
+		credsPath = firstEnv("AWS_SHARED_CREDENTIALS_FILE", "AWS_CREDENTIAL_FILE")
+	}
+	configPath := s.ConfigFilename
+	if configPath == "" {
+		configPath = os.Getenv("AWS_CONFIG_FILE")
+	}
+
+	if credsPath == "" || configPath == "" {
+		home := firstEnv("HOME", "USERPROFILE")
+		if home == "" {
+			return nil, errors.New("cannot find the home directory for the shared aws credentials files")
+		}
+
+		if credsPath == "" {
+			credsPath = filepath.Join(home, ".aws", "credentials")
+		}
+		if configPath == "" {
+			configPath = filepath.Join(home, ".aws", "config")
+		}
+	}
+
+	files := &sharedFiles{credentials: ini.File{}, config: ini.File{}}
+	found := false
+
+	for _, f := range []struct {
+		path string
+		file ini.File
+	}{{credsPath, files.credentials}, {configPath, files.config}} {
+		if err := f.file.LoadFile(f.path); err != nil {
+			if os.IsNotExist(errors.Cause(err)) {
+				continue
+			}
+			return nil, errors.Wrapf(err, "problem reading aws credentials file '%s'", f.path)
+		}
+		found = true
+	}
+
+	if !found {
+		return nil, errors.Errorf("neither '%s' nor '%s' exist", credsPath, configPath)
+	}
+
+	return files, nil
+}
+
+// profile returns the settings of the profile. The config file names
+// profiles other than the default "profile <name>".
+func (f *sharedFiles) profile(name string) (ini.Section, bool) {
+	settings := ini.Section{}
+
+	configName := "profile " + name
+	if _, ok := f.config[configName]; !ok && name == "default" {
+		configName = name
+	}
+
+	config, inConfig := f.config[configName]
+	for k, v := range config {
+		settings[k] = v
+	}
+
+	creds, inCreds := f.credentials[name]
+	for k, v := range creds {
+		settings[k] = v
+	}
+
+	return settings, inConfig || inCreds
+}
+
+// provider returns the provider of the credentials of the profile.
+func (f *sharedFiles) provider(name string, depth int) (CredentialProvider, error) {
+	if depth > maxProfileDepth {
+		return nil, errors.Errorf("profile '%s' is part of a chain of more than %d source profiles",
+			name, maxProfileDepth)
+	}
+
+	settings, ok := f.profile(name)
+	if !ok {
+		return nil, errors.Errorf("aws profile '%s' does not exist", name)
+	}
+
+	if roleARN := settings["role_arn"]; roleARN != "" {
+		return f.assumeRole(name, settings, depth)
+	}
+
+	if command := settings["credential_process"]; command != "" {
+		return ProcessCredentials{Command: command}, nil
+	}
+
+	return staticProfileCredentials(name, settings)
+}
+
+func staticProfileCredentials(name string, settings ini.Section) (CredentialProvider, error) {
+	creds := Credentials{
+		AccessKey:    settings["aws_access_key_id"],
+		SecretKey:    settings["aws_secret_access_key"],
+		SessionToken: settings["aws_session_token"],
+	}
+
+	if creds.AccessKey == "" || creds.SecretKey == "" {
+		return nil, errors.Errorf("aws profile '%s' does not have credentials", name)
+	}
+
+	return creds, nil
+}
+
+func (f *sharedFiles) assumeRole(name string, settings ini.Section,
+	depth int) (CredentialProvider, error) {
+	role := AssumeRoleCredentials{
+		RoleARN:     settings["role_arn"],
+		ExternalID:  settings["external_id"],
+		SessionName: settings["role_session_name"],
+	}
+
+	if value := settings["duration_seconds"]; value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid duration_seconds in aws profile '%s'", name)
+		}
+		role.Duration = time.Duration(seconds) * time.Second
+	}
+
+	source, hasSource := settings["source_profile"]
+	credSource, hasCredSource := settings["credential_source"]
+
+	switch {
+	case hasSource && hasCredSource:
+		return nil, errors.Errorf("aws profile '%s' specifies both source_profile and credential_source",
+			name)
+	case hasSource && source == name:
+		// a profile may assume a role with its own static credentials.
+		creds, err := staticProfileCredentials(name, settings)
+		if err != nil {
+			return nil, err
+		}
+		role.Source = creds
+	case hasSource:
+		creds, err := f.provider(source, depth+1)
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem resolving source profile of aws profile '%s'", name)
+		}
+		role.Source = creds
+	case hasCredSource:
+		switch credSource {
+		case "Environment":
+			role.Source = EnvCredentials{}
+		case "Ec2InstanceMetadata", "EcsContainer":
+			role.Source = MetadataCredentials{}
+		default:
+			return nil, errors.Errorf("aws profile '%s' has unsupported credential_source '%s'",
+				name, credSource)
+		}
+	default:
+		return nil, errors.Errorf("aws profile '%s' has a role_arn without a source_profile "+
+			"or credential_source", name)
+	}
+
+	return role, nil
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// STS assume role
+//
+////////////////////////////////////////////////////////////////////////
+
+// AssumeRoleCredentials provide temporary credentials for a role,
+// from the AWS Security Token Service, using the credentials of
+// another provider.
+type AssumeRoleCredentials struct {
+	// Source provides the credentials that assume the role.
+	Source CredentialProvider
+
+	// RoleARN is the ARN of the role to assume.
+	RoleARN string
+
+	// ExternalID, if specified, is the external ID that the trust
+	// policy of the role requires.
+	ExternalID string
+
+	// SessionName is the name of the role session. Defaults to a
+	// name based on the current time.
+	SessionName string
+
+	// Duration is the lifetime of the credentials. Defaults to one
+	// hour.
+	Duration time.Duration
+
+	// Endpoint is the URL of the STS endpoint. Defaults to
+	// "https://sts.amazonaws.com".
+	Endpoint string
+}
+
+type assumeRoleResponse struct {
+	Credentials struct {
+		AccessKeyID     string    `xml:"AccessKeyId"`
+		SecretAccessKey string    `xml:"SecretAccessKey"`
+		SessionToken    string    `xml:"SessionToken"`
+		Expiration      time.Time `xml:"Expiration"`
+	} `xml:"AssumeRoleResult>Credentials"`
+}
+
+type stsErrorResponse struct {
+	Code    string `xml:"Error>Code"`
+	Message string `xml:"Error>Message"`
+}
+
+func (a AssumeRoleCredentials) Retrieve() (Credentials, error) {
+	if a.Source == nil {
+		return Credentials{}, errors.Errorf("no source credentials to assume role '%s'", a.RoleARN)
+	}
+
+	source, err := a.Source.Retrieve()
+	if err != nil {
+		return Credentials{}, errors.Wrapf(err, "problem retrieving credentials to assume role '%s'",
+			a.RoleARN)
+	}
+
+	endpoint := a.Endpoint
+	if endpoint == "" {
+		endpoint = defaultSTSEndpoint
+	}
+
+	sessionName := a.SessionName
+	if sessionName == "" {
+		sessionName = fmt.Sprintf("curator-%d", time.Now().UnixNano())
+	}
+
+	duration := a.Duration
+	if duration == 0 {
+		duration = defaultSessionDuration
+	}
+
+	params := url.Values{
+		"Action":          []string{"AssumeRole"},
+		"Version":         []string{"2011-06-15"},
+		"RoleArn":         []string{a.RoleARN},
+		"RoleSessionName": []string{sessionName},
+		"DurationSeconds": []string{strconv.Itoa(int(duration / time.Second))},
+	}
+	if a.ExternalID != "" {
+		params.Set("ExternalId", a.ExternalID)
+	}
+
+	req, err := http.NewRequest("GET", strings.TrimRight(endpoint, "/")+"/?"+params.Encode(), nil)
+	if err != nil {
+		return Credentials{}, errors.Wrap(err, "problem building sts request")
+	}
+	signV4(req, source, "sts", "us-east-1", time.Now().UTC())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return Credentials{}, errors.Wrapf(err, "problem assuming role '%s'", a.RoleARN)
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return Credentials{}, errors.Wrapf(err, "problem reading sts response for role '%s'", a.RoleARN)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		stsErr := stsErrorResponse{}
+		_ = xml.Unmarshal(data, &stsErr)
+		return Credentials{}, errors.Errorf("problem assuming role '%s': %s (%s: %s)",
+			a.RoleARN, resp.Status, stsErr.Code, stsErr.Message)
+	}
+
+	out := assumeRoleResponse{}
+	if err = xml.Unmarshal(data, &out); err != nil {
+		return Credentials{}, errors.Wrapf(err, "problem parsing sts response for role '%s'", a.RoleARN)
+	}
+
+	creds := Credentials{
+		AccessKey:    out.Credentials.AccessKeyID,
+		SecretKey:    out.Credentials.SecretAccessKey,
+		SessionToken: out.Credentials.SessionToken,
+		Expiration:   out.Credentials.Expiration,
+	}
+	if creds.AccessKey == "" {
+		return Credentials{}, errors.Errorf("sts response for role '%s' has no credentials", a.RoleARN)
+	}
+
+	return creds, nil
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// EC2 and ECS metadata endpoints
+//
+////////////////////////////////////////////////////////////////////////
+
+// MetadataCredentials provide the credentials of the ECS task or EC2
+// instance. In ECS tasks, the provider uses the endpoint in the
+// AWS_CONTAINER_CREDENTIALS_RELATIVE_URI or
+// AWS_CONTAINER_CREDENTIALS_FULL_URI environment variable (with the
+// AWS_CONTAINER_AUTHORIZATION_TOKEN), and otherwise it uses the EC2
+// instance metadata service, with a session token when the service
+// supports them. Set AWS_EC2_METADATA_DISABLED to "true" to disable
+// the EC2 metadata service.
+type MetadataCredentials struct {
+	// Endpoint is the URL of the EC2 instance metadata service.
+	// Defaults to "http://169.254.169.254".
+	Endpoint string
+}
+
+type metadataCredentials struct {
+	Code            string
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string
+	Token           string
+	Expiration      time.Time
+}
+
+func (m MetadataCredentials) Retrieve() (Credentials, error) {
+	client := &http.Client{Timeout: metadataRequestTimeout}
+
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); uri != "" {
+		return m.retrieveECS(client, defaultECSMetadataURL+uri)
+	}
+	if uri := os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"); uri != "" {
+		return m.retrieveECS(client, uri)
+	}
+
+	if strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+		return Credentials{}, errors.New("the ec2 metadata service is disabled")
+	}
+
+	return m.retrieveEC2(client)
+}
+
+func (m MetadataCredentials) retrieveECS(client *http.Client, uri string) (Credentials, error) {
+	header := http.Header{}
+	if token := os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN"); token != "" {
+		header.Set("Authorization", token)
+	}
+
+	data, err := metadataRequest(client, "GET", uri, header)
+	if err != nil {
+		return Credentials{}, errors.Wrap(err, "problem retrieving ecs container credentials")
+	}
+
+	return parseMetadataCredentials(data)
+}
+
+func (m MetadataCredentials) retrieveEC2(client *http.Client) (Credentials, error) {
+	endpoint := strings.TrimRight(m.Endpoint, "/")
+	if endpoint == "" {
+		endpoint = defaultEC2MetadataURL
+	}
+
+	header := http.Header{}
+
+	// the metadata service of instances that require session tokens
+	// (IMDSv2) rejects requests without them; otherwise, requests
+	// without tokens are fine.
+	token, err := metadataRequest(client, "PUT", endpoint+"/latest/api/token",
+		http.Header{"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": []string{metadataTokenTTLSeconds}})
+	if err == nil {
+		header.Set("X-Aws-Ec2-Metadata-Token", string(token))
+	}
+
+	path := endpoint + "/latest/meta-data/iam/security-credentials/"
+	roles, err := metadataRequest(client, "GET", path, header)
+	if err != nil {
+		return Credentials{}, errors.Wrap(err, "problem retrieving ec2 instance role")
+	}
+
+	role := strings.TrimSpace(strings.SplitN(string(roles), "\n", 2)[0])
+	if role == "" {
+		return Credentials{}, errors.New("the ec2 instance does not have a role")
+	}
+
+	data, err := metadataRequest(client, "GET", path+role, header)
+	if err != nil {
+		return Credentials{}, errors.Wrapf(err,
+			"problem retrieving credentials of ec2 instance role '%s'", role)
+	}
+
+	return parseMetadataCredentials(data)
+}
+
+func metadataRequest(client *http.Client, method, uri string, header http.Header) ([]byte, error) {
+	req, err := http.NewRequest(method, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("%s %s: %s", method, uri, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+func parseMetadataCredentials(data []byte) (Credentials, error) {
+	out := metadataCredentials{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return Credentials{}, errors.Wrap(err, "problem parsing metadata credentials")
+	}
+
+	if out.Code != "" && out.Code != "Success" {
+		return Credentials{}, errors.Errorf("metadata service returned '%s'", out.Code)
+	}
+
+	if out.AccessKeyID == "" || out.SecretAccessKey == "" {
+		return Credentials{}, errors.New("metadata service returned no credentials")
+	}
+
+	return Credentials{
+		AccessKey:    out.AccessKeyID,
+		SecretKey:    out.SecretAccessKey,
+		SessionToken: out.Token,
+		Expiration:   out.Expiration,
+	}, nil
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Credential processes
+//
+////////////////////////////////////////////////////////////////////////
+
+// ProcessCredentials provide the credentials that a command prints to
+// standard output, in the JSON format of the credential_process
+// setting of the shared config file. The provider runs the command
+// with the shell.
+type ProcessCredentials struct {
+	Command string
+}
+
+type processCredentials struct {
+	Version         int
+	AccessKeyID     string `json:"AccessKeyId"`
+	SecretAccessKey string
+	SessionToken    string
+	Expiration      *time.Time
+}
+
+func (p ProcessCredentials) Retrieve() (Credentials, error) {
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.Command("cmd.exe", "/C", p.Command)
+	} else {
+		cmd = exec.Command("sh", "-c", p.Command)
+	}
+
+	out := &bytes.Buffer{}
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	cmd.Env = os.Environ()
+
+	if err := cmd.Run(); err != nil {
+		return Credentials{}, errors.Wrapf(err, "problem running credential process '%s'", p.Command)
+	}
+
+	output := processCredentials{}
+	if err := json.Unmarshal(out.Bytes(), &output); err != nil {
+		return Credentials{}, errors.Wrapf(err, "problem parsing the output of credential process '%s'",
+			p.Command)
+	}
+
+	if output.Version != 1 {
+		return Credentials{}, errors.Errorf("credential process '%s' returned unsupported version %d",
+			p.Command, output.Version)
+	}
+
+	if output.AccessKeyID == "" || output.SecretAccessKey == "" {
+		return Credentials{}, errors.Errorf("credential process '%s' returned no credentials", p.Command)
+	}
+
+	creds := Credentials{
+		AccessKey:    output.AccessKeyID,
+		SecretKey:    output.SecretAccessKey,
+		SessionToken: output.SessionToken,
+	}
+	if output.Expiration != nil {
+		creds.Expiration = *output.Expiration
+	}
+
+	return creds, nil
+}
+
+// authCredentials returns the credentials of the goamz authentication.
+func authCredentials(auth aws.Auth) Credentials {
+	return Credentials{
+		AccessKey:    auth.AccessKey,
+		SecretKey:    auth.SecretKey,
+		SessionToken: auth.Token(),
+		Expiration:   auth.Expiration(),
+	}
+}
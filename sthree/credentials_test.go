@@ -0,0 +1,509 @@
+package sthree
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+var credentialEnvVars = []string{
+	"AWS_ACCESS_KEY_ID", "AWS_ACCESS_KEY", "AWS_SECRET_ACCESS_KEY", "AWS_SECRET_KEY",
+	"AWS_SESSION_TOKEN", "AWS_PROFILE", "AWS_SHARED_CREDENTIALS_FILE", "AWS_CREDENTIAL_FILE",
+	"AWS_CONFIG_FILE", "AWS_CONTAINER_CREDENTIALS_RELATIVE_URI", "AWS_CONTAINER_CREDENTIALS_FULL_URI",
+	"AWS_CONTAINER_AUTHORIZATION_TOKEN", "AWS_EC2_METADATA_DISABLED",
+}
+
+// CredentialsSuite tests the credential providers, with fake STS and
+// metadata services, and shared credentials files in a temporary
+// directory. The suite clears the AWS environment variables for each
+// test, and restores them afterwards.
+type CredentialsSuite struct {
+	dir     string
+	env     map[string]string
+	require *require.Assertions
+	suite.Suite
+}
+
+func TestCredentialsSuite(t *testing.T) {
+	suite.Run(t, new(CredentialsSuite))
+}
+
+func (s *CredentialsSuite) SetupSuite() {
+	s.require = s.Require()
+}
+
+func (s *CredentialsSuite) SetupTest() {
+	s.env = make(map[string]string)
+	for _, name := range credentialEnvVars {
+		s.env[name] = os.Getenv(name)
+		s.require.NoError(os.Unsetenv(name))
+	}
+
+	dir, err := ioutil.TempDir("", "sthree-credentials")
+	s.require.NoError(err)
+	s.dir = dir
+}
+
+func (s *CredentialsSuite) TearDownTest() {
+	for name, value := range s.env {
+		if value == "" {
+			s.NoError(os.Unsetenv(name))
+			continue
+		}
+		s.NoError(os.Setenv(name, value))
+	}
+
+	s.NoError(os.RemoveAll(s.dir))
+}
+
+func (s *CredentialsSuite) writeFile(name, content string) string {
+	path := filepath.Join(s.dir, name)
+	s.require.NoError(ioutil.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func (s *CredentialsSuite) TestEnvCredentials() {
+	_, err := EnvCredentials{}.Retrieve()
+	s.Error(err)
+
+	s.require.NoError(os.Setenv("AWS_ACCESS_KEY", "key"))
+	s.require.NoError(os.Setenv("AWS_SECRET_KEY", "secret"))
+	creds, err := EnvCredentials{}.Retrieve()
+	s.NoError(err)
+	s.Equal(Credentials{AccessKey: "key", SecretKey: "secret"}, creds)
+
+	s.require.NoError(os.Setenv("AWS_ACCESS_KEY_ID", "key-id"))
+	s.require.NoError(os.Setenv("AWS_SESSION_TOKEN", "token"))
+	creds, err = EnvCredentials{}.Retrieve()
+	s.NoError(err)
+	s.Equal(Credentials{AccessKey: "key-id", SecretKey: "secret", SessionToken: "token"}, creds)
+}
+
+func (s *CredentialsSuite) TestSharedCredentialsProfiles() {
+	shared := SharedCredentials{
+		Filename: s.writeFile("credentials", `
+[default]
+aws_access_key_id = default-key
+aws_secret_access_key = default-secret
+
+[both]
+aws_access_key_id = creds-key
+aws_secret_access_key = creds-secret
+`),
+		ConfigFilename: s.writeFile("config", `
+[profile both]
+aws_access_key_id = config-key
+aws_secret_access_key = config-secret
+aws_session_token = config-token
+
+[profile config-only]
+aws_access_key_id = config-only-key
+aws_secret_access_key = config-only-secret
+
+[profile empty]
+region = us-west-2
+`),
+	}
+
+	creds, err := shared.Retrieve()
+	s.NoError(err)
+	s.Equal("default-key", creds.AccessKey)
+
+	s.require.NoError(os.Setenv("AWS_PROFILE", "config-only"))
+	creds, err = shared.Retrieve()
+	s.NoError(err)
+	s.Equal("config-only-key", creds.AccessKey)
+	s.Equal("config-only", os.Getenv("AWS_PROFILE"))
+
+	shared.Profile = "both"
+	creds, err = shared.Retrieve()
+	s.NoError(err)
+	s.Equal(Credentials{
+		AccessKey:    "creds-key",
+		SecretKey:    "creds-secret",
+		SessionToken: "config-token",
+	}, creds)
+
+	for _, profile := range []string{"empty", "missing"} {
+		shared.Profile = profile
+		_, err = shared.Retrieve()
+		s.Error(err, profile)
+	}
+
+	missing := filepath.Join(s.dir, "none")
+	_, err = SharedCredentials{Filename: missing, ConfigFilename: missing}.Retrieve()
+	s.Error(err)
+}
+
+func (s *CredentialsSuite) TestSharedCredentialsUseEnvironmentPaths() {
+	s.require.NoError(os.Setenv("AWS_SHARED_CREDENTIALS_FILE",
+		s.writeFile("creds", "[default]\naws_access_key_id = a\naws_secret_access_key = b\n")))
+	s.require.NoError(os.Setenv("AWS_CONFIG_FILE", filepath.Join(s.dir, "missing")))
+
+	creds, err := SharedCredentials{}.Retrieve()
+	s.NoError(err)
+	s.Equal("a", creds.AccessKey)
+}
+
+func (s *CredentialsSuite) TestSharedProfilesDescribeRoles() {
+	files, err := SharedCredentials{
+		Filename: s.writeFile("credentials", `
+[base]
+aws_access_key_id = base-key
+aws_secret_access_key = base-secret
+`),
+		ConfigFilename: s.writeFile("config", `
+[profile role]
+role_arn = arn:aws:iam::123456789012:role/deploy
+source_profile = base
+external_id = external
+role_session_name = session
+duration_seconds = 900
+
+[profile chained]
+role_arn = arn:aws:iam::123456789012:role/other
+source_profile = role
+
+[profile self]
+role_arn = arn:aws:iam::123456789012:role/self
+source_profile = self
+aws_access_key_id = self-key
+aws_secret_access_key = self-secret
+
+[profile env]
+role_arn = arn:aws:iam::123456789012:role/env
+credential_source = Environment
+
+[profile process]
+credential_process = /usr/local/bin/get-credentials --account 1
+
+[profile loop]
+role_arn = arn:aws:iam::123456789012:role/loop
+source_profile = loop2
+
+[profile loop2]
+role_arn = arn:aws:iam::123456789012:role/loop
+source_profile = loop
+
+[profile no-source]
+role_arn = arn:aws:iam::123456789012:role/none
+
+[profile bad-source]
+role_arn = arn:aws:iam::123456789012:role/none
+credential_source = Somewhere
+`),
+	}.load()
+	s.require.NoError(err)
+
+	p, err := files.provider("role", 0)
+	s.require.NoError(err)
+	s.Equal(AssumeRoleCredentials{
+		Source:      Credentials{AccessKey: "base-key", SecretKey: "base-secret"},
+		RoleARN:     "arn:aws:iam::123456789012:role/deploy",
+		ExternalID:  "external",
+		SessionName: "session",
+		Duration:    15 * time.Minute,
+	}, p)
+
+	p, err = files.provider("chained", 0)
+	s.require.NoError(err)
+	s.IsType(AssumeRoleCredentials{}, p.(AssumeRoleCredentials).Source)
+
+	p, err = files.provider("self", 0)
+	s.require.NoError(err)
+	s.Equal(Credentials{AccessKey: "self-key", SecretKey: "self-secret"},
+		p.(AssumeRoleCredentials).Source)
+
+	p, err = files.provider("env", 0)
+	s.require.NoError(err)
+	s.Equal(EnvCredentials{}, p.(AssumeRoleCredentials).Source)
+
+	p, err = files.provider("process", 0)
+	s.require.NoError(err)
+	s.Equal(ProcessCredentials{Command: "/usr/local/bin/get-credentials --account 1"}, p)
+
+	for _, profile := range []string{"loop", "no-source", "bad-source"} {
+		_, err = files.provider(profile, 0)
+		s.Error(err, profile)
+	}
+}
+
+func (s *CredentialsSuite) TestAssumeRole() {
+	var query url.Values
+	var header http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		header = r.Header
+
+		if query.Get("ExternalId") != "external" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `<ErrorResponse><Error><Type>Sender</Type><Code>AccessDenied</Code>`+
+				`<Message>not authorized</Message></Error></ErrorResponse>`)
+			return
+		}
+
+		fmt.Fprint(w, `<AssumeRoleResponse><AssumeRoleResult><Credentials>`+
+			`<AccessKeyId>role-key</AccessKeyId><SecretAccessKey>role-secret</SecretAccessKey>`+
+			`<SessionToken>role-token</SessionToken><Expiration>2030-01-02T03:04:05Z</Expiration>`+
+			`</Credentials></AssumeRoleResult></AssumeRoleResponse>`)
+	}))
+	defer srv.Close()
+
+	role := AssumeRoleCredentials{
+		Source: Credentials{
+			AccessKey:    "source-key",
+			SecretKey:    "source-secret",
+			SessionToken: "source-token",
+		},
+		RoleARN:    "arn:aws:iam::123456789012:role/deploy",
+		ExternalID: "external",
+		Endpoint:   srv.URL,
+	}
+
+	creds, err := role.Retrieve()
+	s.require.NoError(err)
+	s.Equal(Credentials{
+		AccessKey:    "role-key",
+		SecretKey:    "role-secret",
+		SessionToken: "role-token",
+		Expiration:   time.Date(2030, time.January, 2, 3, 4, 5, 0, time.UTC),
+	}, creds)
+
+	s.Equal("AssumeRole", query["Action"][0])
+	s.Equal(role.RoleARN, query["RoleArn"][0])
+	s.Equal("3600", query["DurationSeconds"][0])
+	s.True(strings.HasPrefix(query["RoleSessionName"][0], "curator-"))
+	s.Contains(header.Get("Authorization"), "Credential=source-key/")
+	s.Contains(header.Get("Authorization"), "/us-east-1/sts/aws4_request")
+	s.Equal("source-token", header.Get("X-Amz-Security-Token"))
+
+	role.ExternalID = "wrong"
+	_, err = role.Retrieve()
+	s.require.Error(err)
+	s.Contains(err.Error(), "AccessDenied")
+
+	role.Source = nil
+	_, err = role.Retrieve()
+	s.Error(err)
+}
+
+func (s *CredentialsSuite) TestEC2Metadata() {
+	requireToken := true
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/latest/api/token" {
+			if r.Method != "PUT" || !requireToken {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			fmt.Fprint(w, "imds-token")
+			return
+		}
+
+		if requireToken && r.Header.Get("X-Aws-Ec2-Metadata-Token") != "imds-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch r.URL.Path {
+		case "/latest/meta-data/iam/security-credentials/":
+			fmt.Fprint(w, "instance-role\n")
+		case "/latest/meta-data/iam/security-credentials/instance-role":
+			fmt.Fprint(w, `{"Code": "Success", "AccessKeyId": "ec2-key", "SecretAccessKey": "ec2-secret",`+
+				`"Token": "ec2-token", "Expiration": "2030-01-02T03:04:05Z"}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	metadata := MetadataCredentials{Endpoint: srv.URL}
+	expected := Credentials{
+		AccessKey:    "ec2-key",
+		SecretKey:    "ec2-secret",
+		SessionToken: "ec2-token",
+		Expiration:   time.Date(2030, time.January, 2, 3, 4, 5, 0, time.UTC),
+	}
+
+	creds, err := metadata.Retrieve()
+	s.NoError(err)
+	s.Equal(expected, creds)
+
+	requireToken = false
+	creds, err = metadata.Retrieve()
+	s.NoError(err)
+	s.Equal(expected, creds)
+
+	s.require.NoError(os.Setenv("AWS_EC2_METADATA_DISABLED", "true"))
+	_, err = metadata.Retrieve()
+	s.Error(err)
+}
+
+func (s *CredentialsSuite) TestECSMetadata() {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/credentials" || r.Header.Get("Authorization") != "ecs-auth" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		fmt.Fprint(w, `{"AccessKeyId": "ecs-key", "SecretAccessKey": "ecs-secret", "Token": "ecs-token"}`)
+	}))
+	defer srv.Close()
+
+	s.require.NoError(os.Setenv("AWS_CONTAINER_CREDENTIALS_FULL_URI", srv.URL+"/credentials"))
+	_, err := MetadataCredentials{}.Retrieve()
+	s.Error(err)
+
+	s.require.NoError(os.Setenv("AWS_CONTAINER_AUTHORIZATION_TOKEN", "ecs-auth"))
+	creds, err := MetadataCredentials{}.Retrieve()
+	s.NoError(err)
+	s.Equal(Credentials{AccessKey: "ecs-key", SecretKey: "ecs-secret", SessionToken: "ecs-token"},
+		creds)
+}
+
+func (s *CredentialsSuite) TestProcessCredentials() {
+	script := s.writeFile("credentials.json",
+		`{"Version": 1, "AccessKeyId": "process-key", "SecretAccessKey": "process-secret",`+
+			`"SessionToken": "process-token", "Expiration": "2030-01-02T03:04:05Z"}`)
+
+	creds, err := ProcessCredentials{Command: "cat " + script}.Retrieve()
+	s.NoError(err)
+	s.Equal(Credentials{
+		AccessKey:    "process-key",
+		SecretKey:    "process-secret",
+		SessionToken: "process-token",
+		Expiration:   time.Date(2030, time.January, 2, 3, 4, 5, 0, time.UTC),
+	}, creds)
+
+	for _, command := range []string{
+		"exit 1",
+		"echo not json",
+		`echo '{"Version": 2, "AccessKeyId": "a", "SecretAccessKey": "b"}'`,
+		`echo '{"Version": 1}'`,
+	} {
+		_, err = ProcessCredentials{Command: command}.Retrieve()
+		s.Error(err, command)
+	}
+}
+
+// countingProvider returns credentials that expire after its lifetime,
+// with access keys that count its calls, or its error.
+type countingProvider struct {
+	calls    int
+	lifetime time.Duration
+	err      error
+}
+
+func (p *countingProvider) Retrieve() (Credentials, error) {
+	p.calls++
+	if p.err != nil {
+		return Credentials{}, p.err
+	}
+
+	creds := Credentials{AccessKey: fmt.Sprint("key-", p.calls), SecretKey: "secret"}
+	if p.lifetime > 0 {
+		creds.Expiration = time.Now().Add(p.lifetime)
+	}
+
+	return creds, nil
+}
+
+func (s *CredentialsSuite) TestRefreshingCredentialsCacheUntilExpiration() {
+	static := &countingProvider{}
+	refreshing := NewRefreshingCredentials(static)
+	for i := 0; i < 3; i++ {
+		creds, err := refreshing.Retrieve()
+		s.NoError(err)
+		s.Equal("key-1", creds.AccessKey)
+	}
+	s.Equal(1, static.calls)
+
+	temporary := &countingProvider{lifetime: time.Hour}
+	refreshing = NewRefreshingCredentials(temporary)
+	_, err := refreshing.Retrieve()
+	s.NoError(err)
+	_, err = refreshing.Retrieve()
+	s.NoError(err)
+	s.Equal(1, temporary.calls)
+
+	// credentials that expire within the refresh window refresh.
+	expiring := &countingProvider{lifetime: time.Minute}
+	refreshing = NewRefreshingCredentials(expiring)
+	_, err = refreshing.Retrieve()
+	s.NoError(err)
+	creds, err := refreshing.Retrieve()
+	s.NoError(err)
+	s.Equal("key-2", creds.AccessKey)
+}
+
+func (s *CredentialsSuite) TestRefreshingCredentialsUseCachedCredentialsAfterFailures() {
+	expiring := &countingProvider{lifetime: time.Minute}
+	refreshing := NewRefreshingCredentials(expiring)
+	_, err := refreshing.Retrieve()
+	s.require.NoError(err)
+
+	expiring.err = errors.New("sts is unavailable")
+	for i := 0; i < 3; i++ {
+		creds, err := refreshing.Retrieve()
+		s.NoError(err)
+		s.Equal("key-1", creds.AccessKey)
+	}
+	s.Equal(2, expiring.calls, "failures should not retry before the retry interval")
+
+	failing := &countingProvider{err: errors.New("no credentials")}
+	refreshing = NewRefreshingCredentials(failing)
+	_, err = refreshing.Retrieve()
+	s.Error(err)
+	_, err = refreshing.Retrieve()
+	s.Error(err)
+	s.Equal(1, failing.calls)
+}
+
+func (s *CredentialsSuite) TestCredentialChainUsesFirstProviderWithCredentials() {
+	chain := NewCredentialChain(EnvCredentials{},
+		Credentials{AccessKey: "static", SecretKey: "secret"})
+	creds, err := chain.Retrieve()
+	s.NoError(err)
+	s.Equal("static", creds.AccessKey)
+
+	s.require.NoError(os.Setenv("AWS_ACCESS_KEY_ID", "env"))
+	s.require.NoError(os.Setenv("AWS_SECRET_ACCESS_KEY", "secret"))
+	creds, err = chain.Retrieve()
+	s.NoError(err)
+	s.Equal("env", creds.AccessKey)
+
+	_, err = NewCredentialChain(EnvCredentials{},
+		&countingProvider{err: errors.New("none")}).Retrieve()
+	s.NoError(err)
+
+	s.require.NoError(os.Unsetenv("AWS_ACCESS_KEY_ID"))
+	_, err = NewCredentialChain(EnvCredentials{},
+		&countingProvider{err: errors.New("none")}).Retrieve()
+	s.Error(err)
+}
+
+func (s *CredentialsSuite) TestConnectionsWithTemporaryCredentialsUseSignatureV4() {
+	conf := AWSConnectionConfiguration{Credentials: Credentials{AccessKey: "a", SecretKey: "b"}}
+	storage := conf.newStorage("bucket").(*s3Storage)
+	s.Nil(storage.signer)
+	s.Equal("a", storage.bucket.S3.Auth.AccessKey)
+
+	conf.Credentials = Credentials{AccessKey: "a", SecretKey: "b", SessionToken: "c"}
+	storage = conf.newStorage("bucket").(*s3Storage)
+	s.NotNil(storage.signer)
+	s.Equal("", storage.bucket.S3.Auth.AccessKey)
+
+	conf.Credentials = &countingProvider{err: errors.New("none")}
+	storage = conf.newStorage("bucket").(*s3Storage)
+	s.NotNil(storage.signer)
+}
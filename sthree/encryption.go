@@ -0,0 +1,97 @@
+package sthree
+
+import (
+	"github.com/pkg/errors"
+)
+
+// EncryptionMode is the server-side encryption that uploads request
+// for new objects.
+type EncryptionMode string
+
+const (
+	// EncryptionNone does not request encryption, so objects use
+	// the default encryption of the bucket, if any.
+	EncryptionNone EncryptionMode = ""
+
+	// EncryptionS3 encrypts objects with keys that S3 manages
+	// (SSE-S3).
+	EncryptionS3 EncryptionMode = "sse-s3"
+
+	// EncryptionKMS encrypts objects with a key in the AWS Key
+	// Management Service (SSE-KMS): the key of the Encryption, or
+	// the default S3 key of the account.
+	EncryptionKMS EncryptionMode = "sse-kms"
+)
+
+// Encryption describes the server-side encryption of uploads. The
+// KMSKeyID, which is the ID or ARN of a KMS key, only applies to the
+// SSE-KMS mode.
+type Encryption struct {
+	Mode     EncryptionMode `bson:"mode" json:"mode" yaml:"mode"`
+	KMSKeyID string         `bson:"kms_key_id,omitempty" json:"kms_key_id,omitempty" yaml:"kms_key_id,omitempty"`
+}
+
+// Validate returns an error if the mode is not a valid encryption
+// mode, or if the encryption has a key without the SSE-KMS mode.
+func (e Encryption) Validate() error {
+	switch e.Mode {
+	case EncryptionNone, EncryptionS3, EncryptionKMS:
+	default:
+		return errors.Errorf("'%s' is not a valid encryption mode", e.Mode)
+	}
+
+	if e.KMSKeyID != "" && e.Mode != EncryptionKMS {
+		return errors.Errorf("kms key '%s' requires the '%s' encryption mode", e.KMSKeyID, EncryptionKMS)
+	}
+
+	return nil
+}
+
+// headerValue returns the value of the x-amz-server-side-encryption
+// header for the mode.
+func (e Encryption) headerValue() string {
+	switch e.Mode {
+	case EncryptionS3:
+		return "AES256"
+	case EncryptionKMS:
+		return "aws:kms"
+	default:
+		return ""
+	}
+}
+
+// SetEncryption sets the server-side encryption of all uploads and
+// server-side copies to the bucket, which metadata rules cannot
+// override. Returns an error, and does not change the encryption of
+// the bucket, if the encryption is not valid.
+//
+// S3 only accepts requests for objects encrypted with SSE-KMS that
+// use version 4 signatures, so buckets with SSE-KMS encryption sign
+// all requests, including downloads, with version 4 signatures. Set
+// the encryption before opening the bucket.
+//
+// The ETags of objects encrypted with SSE-KMS are not MD5 checksums,
+// so uploads store the checksum of each file in the metadata of the
+// object, which sync operations compare instead of the ETag.
+func (b *Bucket) SetEncryption(e Encryption) error {
+	if err := e.Validate(); err != nil {
+		return err
+	}
+
+	b.encryption = e
+
+	if e.Mode == EncryptionKMS {
+		b.credentials.SignatureV4 = true
+		if s, ok := b.storage.(*s3Storage); ok && s.signer == nil {
+			b.storage = newS3Storage(s.bucket, true)
+		}
+	}
+
+	return nil
+}
+
+// Encryption returns the server-side encryption of uploads to the
+// bucket.
+func (b *Bucket) Encryption() Encryption {
+	return b.encryption
+}
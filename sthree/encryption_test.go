@@ -0,0 +1,222 @@
+package sthree
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/goamz/goamz/aws"
+	"github.com/goamz/goamz/s3"
+	"github.com/mongodb/curator/sthree/fakes3"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+// EncryptionSuite tests server-side encryption of uploads, using a
+// fake S3 server that records the signatures of requests.
+type EncryptionSuite struct {
+	srv        *fakes3.Server
+	b          *Bucket
+	local      string
+	signatures []string
+	mutex      sync.Mutex
+	require    *require.Assertions
+	suite.Suite
+}
+
+func TestEncryptionSuite(t *testing.T) {
+	suite.Run(t, new(EncryptionSuite))
+}
+
+func (s *EncryptionSuite) SetupSuite() {
+	s.require = s.Require()
+}
+
+func (s *EncryptionSuite) SetupTest() {
+	s.srv = fakes3.NewServer()
+	s.signatures = []string{}
+
+	// the filter never fails requests, but records the
+	// authorization header of every request.
+	s.srv.FailRequestsWith(1, http.StatusForbidden, "AccessDenied", func(r *http.Request) bool {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+		s.signatures = append(s.signatures, r.Header.Get("Authorization"))
+		return false
+	})
+
+	auth := aws.Auth{AccessKey: "fake", SecretKey: "fake"}
+	s.b = &Bucket{
+		name:    "encryption",
+		numJobs: 2,
+		retry:   RetryPolicy{MaxAttempts: 1},
+		storage: NewS3Storage(s3.New(auth, s.srv.Region()).Bucket("encryption")),
+	}
+
+	local, err := ioutil.TempDir("", uuid.NewV4().String())
+	s.require.NoError(err)
+	s.local = local
+
+	s.require.NoError(ioutil.WriteFile(filepath.Join(s.local, "one.txt"), []byte("one"), 0644))
+	s.require.NoError(ioutil.WriteFile(filepath.Join(s.local, "two.txt"), []byte("two"), 0644))
+}
+
+func (s *EncryptionSuite) TearDownTest() {
+	s.b.Close()
+	s.srv.Close()
+	s.NoError(os.RemoveAll(s.local))
+}
+
+func (s *EncryptionSuite) head(key string) *ObjectInfo {
+	info, err := s.b.head(context.Background(), key)
+	s.require.NoError(err)
+	s.require.NotNil(info)
+	return info
+}
+
+func (s *EncryptionSuite) etags(prefix string) map[string]string {
+	out := make(map[string]string)
+	for key, obj := range s.b.contents(context.Background(), prefix) {
+		out[key] = obj.ETag
+	}
+
+	return out
+}
+
+func (s *EncryptionSuite) TestValidation() {
+	s.NoError(Encryption{}.Validate())
+	s.NoError(Encryption{Mode: EncryptionS3}.Validate())
+	s.NoError(Encryption{Mode: EncryptionKMS}.Validate())
+	s.NoError(Encryption{Mode: EncryptionKMS, KMSKeyID: "alias/curator"}.Validate())
+
+	s.Error(Encryption{Mode: "aes"}.Validate())
+	s.Error(Encryption{Mode: EncryptionS3, KMSKeyID: "alias/curator"}.Validate())
+
+	s.Error(s.b.SetEncryption(Encryption{KMSKeyID: "alias/curator"}))
+	s.Equal(Encryption{}, s.b.Encryption())
+}
+
+func (s *EncryptionSuite) TestS3EncryptionUsesVersion2Signatures() {
+	s.require.NoError(s.b.SetEncryption(Encryption{Mode: EncryptionS3}))
+	s.require.NoError(s.b.Open(context.Background()))
+	s.require.NoError(s.b.Put(context.Background(), filepath.Join(s.local, "one.txt"), "one.txt"))
+
+	info := s.head("one.txt")
+	s.Equal("AES256", info.ServerSideEncryption)
+	s.Equal(strings.Trim(info.ETag, "\""), info.checksum())
+
+	s.require.NotEmpty(s.signatures)
+	for _, sig := range s.signatures {
+		s.True(strings.HasPrefix(sig, "AWS "), sig)
+	}
+}
+
+func (s *EncryptionSuite) TestKMSEncryptionStoresChecksums() {
+	s.require.NoError(s.b.SetEncryption(Encryption{Mode: EncryptionKMS, KMSKeyID: "alias/curator"}))
+	s.require.NoError(s.b.Open(context.Background()))
+	s.require.NoError(s.b.Put(context.Background(), filepath.Join(s.local, "one.txt"), "one.txt"))
+
+	info := s.head("one.txt")
+	s.Equal("aws:kms", info.ServerSideEncryption)
+	s.Equal("f97c5d29941bfb1b2fdab0874906ab82", info.checksum())
+	s.NotEqual(strings.Trim(info.ETag, "\""), info.checksum())
+
+	s.require.NotEmpty(s.signatures)
+	for _, sig := range s.signatures {
+		s.True(strings.HasPrefix(sig, "AWS4-HMAC-SHA256 Credential=fake/"), sig)
+	}
+}
+
+func (s *EncryptionSuite) TestKMSEncryptionSkipsUnchangedFiles() {
+	s.require.NoError(s.b.SetEncryption(Encryption{Mode: EncryptionKMS}))
+	s.require.NoError(s.b.Open(context.Background()))
+
+	_, err := s.b.SyncTo(context.Background(), s.local, "sync", false)
+	s.require.NoError(err)
+	before := s.etags("sync")
+	s.Len(before, 2)
+
+	_, err = s.b.SyncTo(context.Background(), s.local, "sync", false)
+	s.require.NoError(err)
+	s.Equal(before, s.etags("sync"))
+
+	s.require.NoError(ioutil.WriteFile(filepath.Join(s.local, "two.txt"), []byte("owt"), 0644))
+	_, err = s.b.SyncTo(context.Background(), s.local, "sync", false)
+	s.require.NoError(err)
+	after := s.etags("sync")
+	s.Equal(before["sync/one.txt"], after["sync/one.txt"])
+	s.NotEqual(before["sync/two.txt"], after["sync/two.txt"])
+}
+
+func (s *EncryptionSuite) TestKMSEncryptionComparesObjectsWithoutChecksums() {
+	s.require.NoError(s.b.SetEncryption(Encryption{Mode: EncryptionKMS}))
+	s.require.NoError(s.b.Open(context.Background()))
+
+	// objects from other clients have neither checksum metadata
+	// nor MD5 ETags.
+	s.require.NoError(s.b.storage.Put("sync/one.txt", bytes.NewReader([]byte("one")), 3, "text/plain",
+		s3.Private,
+		UploadOptions{Encryption: Encryption{Mode: EncryptionKMS}}))
+	s.Equal("", s.head("sync/one.txt").checksum())
+
+	_, err := s.b.SyncTo(context.Background(), s.local, "sync", false)
+	s.require.NoError(err)
+	s.NotEqual("", s.head("sync/one.txt").checksum())
+}
+
+func (s *EncryptionSuite) TestKMSEncryptionAppliesToMultipartUploads() {
+	s.require.NoError(s.b.SetEncryption(Encryption{Mode: EncryptionKMS, KMSKeyID: "alias/curator"}))
+	s.require.NoError(s.b.SetMultipartThreshold(minPartSize))
+	s.require.NoError(s.b.Open(context.Background()))
+
+	fileName := filepath.Join(s.local, "large.bin")
+	s.require.NoError(ioutil.WriteFile(fileName, bytes.Repeat([]byte("a"), int(minPartSize)+1), 0644))
+	s.require.NoError(s.b.Put(context.Background(), fileName, "large.bin"))
+
+	info := s.head("large.bin")
+	s.Equal("aws:kms", info.ServerSideEncryption)
+	s.Len(info.checksum(), 32)
+}
+
+func (s *EncryptionSuite) TestMultipartUploadsStartEncrypted() {
+	// as with a bucket policy that requires encryption, the server
+	// rejects uploads that do not request encryption.
+	s.srv.FailRequestsWith(1, http.StatusForbidden, "AccessDenied", func(r *http.Request) bool {
+		_, initiate := r.URL.Query()["uploads"]
+		return (r.Method == "PUT" || initiate && r.Method == "POST") &&
+			r.URL.Query().Get("partNumber") == "" &&
+			r.Header.Get("X-Amz-Server-Side-Encryption") != "AES256"
+	})
+
+	s.require.NoError(s.b.SetEncryption(Encryption{Mode: EncryptionS3}))
+	s.require.NoError(s.b.SetMultipartThreshold(minPartSize))
+	s.require.NoError(s.b.Open(context.Background()))
+
+	fileName := filepath.Join(s.local, "large.bin")
+	s.require.NoError(ioutil.WriteFile(fileName, bytes.Repeat([]byte("a"), int(minPartSize)+1), 0644))
+	s.require.NoError(s.b.Put(context.Background(), fileName, "large.bin"))
+
+	info := s.head("large.bin")
+	s.Equal("AES256", info.ServerSideEncryption)
+	s.Contains(info.ETag, "-")
+}
+
+func (s *EncryptionSuite) TestServerSideCopiesUseTargetEncryption() {
+	s.require.NoError(s.b.Open(context.Background()))
+	s.require.NoError(s.b.Put(context.Background(), filepath.Join(s.local, "one.txt"), "one.txt"))
+
+	target, err := s.b.Clone()
+	s.require.NoError(err)
+	s.require.NoError(target.SetEncryption(Encryption{Mode: EncryptionS3}))
+	s.require.NoError(s.b.CopyTo(context.Background(), target, "one.txt", "copy.txt"))
+
+	s.Equal("", s.head("one.txt").ServerSideEncryption)
+	s.Equal("AES256", s.head("copy.txt").ServerSideEncryption)
+}
@@ -0,0 +1,1208 @@
+/*
+Package fakes3 provides an in-process, in-memory stand in for the
+subset of the S3 REST API that curator uses: listing keys (with
+prefixes, delimiters, and markers), GET, PUT, HEAD, and DELETE of
+objects, canned object ACLs, server-side copies, multi-object delete,
+multipart uploads, and object versions. Objects have MD5 ETags, like
+objects uploaded to S3 in a single request, except for objects
+created by multipart uploads, which have ETags in the "<md5 of part
+md5s>-<number of parts>" form that S3 uses, and objects encrypted
+with SSE-KMS, which have ETags that are not checksums of their
+content.
+
+Buckets keep versions of objects once versioning is enabled, with
+EnableVersioning or a PUT request for the versioning configuration of
+the bucket. In versioned buckets, writes add versions, deletes add
+delete markers, and requests with a versionId parameter read and
+permanently delete specific versions. Version listings of buckets
+without versioning list the current objects, with "null" version IDs.
+
+The server uses path-style addressing, creates buckets on first use,
+and does not check request signatures, so any credentials work, but it
+rejects requests with pre-signed URLs that have expired. Use the Region
+method to get an aws.Region that directs goamz clients, and curator's
+sthree buckets, to the server:
+
+	srv := fakes3.NewServer()
+	defer srv.Close()
+
+	sthree.SetCredentials(sthree.AWSConnectionConfiguration{
+		Region: srv.Region(),
+	})
+*/
+package fakes3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goamz/goamz/aws"
+)
+
+// timeFormat is the format S3 uses for timestamps in XML responses.
+const timeFormat = "2006-01-02T15:04:05.000Z"
+
+// Server is an in-memory fake S3 server, backed by an
+// httptest.Server. Servers are safe for concurrent use.
+type Server struct {
+	srv        *httptest.Server
+	mu         sync.Mutex
+	buckets    map[string]*bucket
+	nextID     int
+	failCount  int
+	failStatus int
+	failCode   string
+	failFilter func(*http.Request) bool
+
+	// deleteFailures are the error codes of keys that multi-object
+	// deletes do not remove.
+	deleteFailures map[string]string
+}
+
+type bucket struct {
+	name    string
+	objects map[string]*object
+	uploads map[string]*upload
+
+	// versions are the versions and delete markers of each key,
+	// oldest first, once versioning is enabled.
+	versioned bool
+	versions  map[string][]*object
+}
+
+type upload struct {
+	key       string
+	header    http.Header
+	acl       string
+	initiated time.Time
+	parts     map[int][]byte
+}
+
+type object struct {
+	data         []byte
+	etag         string
+	lastModified time.Time
+	header       http.Header
+	acl          string
+	versionID    string
+	deleteMarker bool
+}
+
+// NewServer starts and returns a new fake S3 server. Callers must
+// call Close to shut down the server.
+func NewServer() *Server {
+	s := &Server{
+		buckets: make(map[string]*bucket),
+	}
+
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+
+	return s
+}
+
+// URL returns the base URL of the server, in the form
+// "http://ipaddr:port", with no trailing slash.
+func (s *Server) URL() string {
+	return s.srv.URL
+}
+
+// Region returns an aws.Region that directs S3 requests to the
+// server, using path-style addressing.
+func (s *Server) Region() aws.Region {
+	return aws.Region{
+		Name:       "fakes3",
+		S3Endpoint: s.srv.URL,
+	}
+}
+
+// Close shuts down the server, and blocks until all outstanding
+// requests have completed.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// Keys returns a sorted list of the names of all objects in the
+// bucket.
+func (s *Server) Keys(bucketName string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.getBucket(bucketName)
+	keys := make([]string, 0, len(b.objects))
+	for k := range b.objects {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// ACL returns the canned ACL of the object, or an empty string if the
+// object does not exist. Objects created without an x-amz-acl header
+// are private.
+func (s *Server) ACL(bucketName, key string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.getBucket(bucketName).objects[key]
+	if !ok {
+		return ""
+	}
+
+	return obj.acl
+}
+
+// getBucket returns the named bucket, creating it if needed. Callers
+// must hold the lock.
+func (s *Server) getBucket(name string) *bucket {
+	b, ok := s.buckets[name]
+	if !ok {
+		b = &bucket{
+			name:     name,
+			objects:  make(map[string]*object),
+			uploads:  make(map[string]*upload),
+			versions: make(map[string][]*object),
+		}
+		s.buckets[name] = b
+	}
+
+	return b
+}
+
+// EnableVersioning enables versioning for the bucket. Objects that
+// exist when versioning starts become the first versions of their
+// keys.
+func (s *Server) EnableVersioning(bucketName string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.getBucket(bucketName).enableVersioning(s)
+}
+
+func (b *bucket) enableVersioning(s *Server) {
+	if b.versioned {
+		return
+	}
+
+	b.versioned = true
+	for key, obj := range b.objects {
+		obj.versionID = s.newVersionID()
+		b.versions[key] = []*object{obj}
+	}
+}
+
+// Versions returns the IDs of the versions and delete markers of the
+// key, newest first. Delete markers have a "(delete marker)" suffix.
+func (s *Server) Versions(bucketName, key string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	versions := s.getBucket(bucketName).versions[key]
+	ids := make([]string, 0, len(versions))
+	for i := len(versions) - 1; i >= 0; i-- {
+		id := versions[i].versionID
+		if versions[i].deleteMarker {
+			id += " (delete marker)"
+		}
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// newVersionID returns a new, unique version ID. Callers must hold
+// the lock.
+func (s *Server) newVersionID() string {
+	s.nextID++
+	return fmt.Sprintf("version-%06d", s.nextID)
+}
+
+// store makes the object the current object of the key, and in
+// versioned buckets, its latest version. Callers must hold the lock.
+func (b *bucket) store(s *Server, key string, obj *object) {
+	b.objects[key] = obj
+
+	if b.versioned {
+		obj.versionID = s.newVersionID()
+		b.versions[key] = append(b.versions[key], obj)
+	}
+}
+
+// remove deletes the current object of the key, and in versioned
+// buckets, adds a delete marker. Callers must hold the lock.
+func (b *bucket) remove(s *Server, key string) *object {
+	delete(b.objects, key)
+
+	if !b.versioned {
+		return nil
+	}
+
+	marker := &object{
+		lastModified: time.Now().UTC(),
+		versionID:    s.newVersionID(),
+		deleteMarker: true,
+	}
+	b.versions[key] = append(b.versions[key], marker)
+
+	return marker
+}
+
+// version returns the version of the key with the ID, which is "null"
+// for objects in buckets without versioning. Callers must hold the
+// lock.
+func (b *bucket) version(key, id string) (*object, bool) {
+	if !b.versioned {
+		obj, ok := b.objects[key]
+		return obj, ok && id == "null"
+	}
+
+	for _, obj := range b.versions[key] {
+		if obj.versionID == id {
+			return obj, true
+		}
+	}
+
+	return nil, false
+}
+
+// removeVersion permanently deletes a version or delete marker of the
+// key, and makes the latest remaining version, if it is not a delete
+// marker, the current object. Removing a version that does not exist
+// is not an error. Callers must hold the lock.
+func (b *bucket) removeVersion(key, id string) {
+	if !b.versioned {
+		if id == "null" {
+			delete(b.objects, key)
+		}
+		return
+	}
+
+	versions := b.versions[key]
+	for idx, obj := range versions {
+		if obj.versionID == id {
+			versions = append(versions[:idx], versions[idx+1:]...)
+			break
+		}
+	}
+
+	if len(versions) == 0 {
+		delete(b.versions, key)
+		delete(b.objects, key)
+		return
+	}
+
+	b.versions[key] = versions
+	if latest := versions[len(versions)-1]; latest.deleteMarker {
+		delete(b.objects, key)
+	} else {
+		b.objects[key] = latest
+	}
+}
+
+// Uploads returns a sorted list of the keys of the incomplete
+// multipart uploads in the bucket. Keys with more than one incomplete
+// upload appear more than once.
+func (s *Server) Uploads(bucketName string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	b := s.getBucket(bucketName)
+	keys := make([]string, 0, len(b.uploads))
+	for _, u := range b.uploads {
+		keys = append(keys, u.key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// FailRequests causes the server to respond to the next n requests
+// for which the filter returns true with a "503 SlowDown" error,
+// which the goamz client does not retry on its own. A nil filter
+// matches all requests.
+func (s *Server) FailRequests(n int, filter func(r *http.Request) bool) {
+	s.FailRequestsWith(n, http.StatusServiceUnavailable, "SlowDown", filter)
+}
+
+// FailRequestsWith is FailRequests, with the status and S3 error code
+// (e.g. 403 and "AccessDenied") of the error responses.
+func (s *Server) FailRequestsWith(n, status int, code string, filter func(r *http.Request) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failCount = n
+	s.failStatus = status
+	s.failCode = code
+	s.failFilter = filter
+}
+
+// FailDeletes causes multi-object deletes to report errors with the S3
+// error code (e.g. "AccessDenied") for the keys, in responses that
+// otherwise succeed, and to not remove the keys, until the next call.
+func (s *Server) FailDeletes(code string, keys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteFailures = make(map[string]string, len(keys))
+	for _, key := range keys {
+		s.deleteFailures[key] = code
+	}
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Request Handling
+//
+////////////////////////////////////////////////////////////////////////
+
+type errorResponse struct {
+	XMLName xml.Name `xml:"Error"`
+	Code    string   `xml:"Code"`
+	Message string   `xml:"Message"`
+	Key     string   `xml:"Key,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, key string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(status)
+
+	if r.Method == "HEAD" {
+		return
+	}
+
+	writeXML(w, errorResponse{Code: code, Message: code, Key: key})
+}
+
+// presignExpired returns true for requests with pre-signed URLs that
+// expired before the time, or that have invalid expirations.
+func presignExpired(r *http.Request, now time.Time) bool {
+	query := r.URL.Query()
+	if query.Get("X-Amz-Date") == "" {
+		return false
+	}
+
+	signed, err := time.Parse("20060102T150405Z", query.Get("X-Amz-Date"))
+	if err != nil {
+		return true
+	}
+
+	seconds, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil {
+		return true
+	}
+
+	return now.After(signed.Add(time.Duration(seconds) * time.Second))
+}
+
+func writeXML(w http.ResponseWriter, v interface{}) {
+	data, err := xml.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("fakes3: problem encoding response: %+v", err))
+	}
+
+	_, _ = w.Write([]byte(xml.Header))
+	_, _ = w.Write(data)
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, "/"), "/", 2)
+	if parts[0] == "" {
+		writeError(w, r, http.StatusBadRequest, "InvalidBucketName", "")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failCount > 0 && (s.failFilter == nil || s.failFilter(r)) {
+		s.failCount--
+		writeError(w, r, s.failStatus, s.failCode, "")
+		return
+	}
+
+	if presignExpired(r, time.Now()) {
+		writeError(w, r, http.StatusForbidden, "AccessDenied", "")
+		return
+	}
+
+	b := s.getBucket(parts[0])
+
+	if len(parts) == 1 || parts[1] == "" {
+		s.serveBucket(w, r, b)
+		return
+	}
+
+	s.serveObject(w, r, b, parts[1])
+}
+
+func (s *Server) serveBucket(w http.ResponseWriter, r *http.Request, b *bucket) {
+	query := r.URL.Query()
+
+	switch r.Method {
+	case "GET":
+		if _, ok := query["uploads"]; ok {
+			s.listUploads(w, r, b)
+			return
+		}
+		if _, ok := query["versions"]; ok {
+			s.listVersions(w, r, b)
+			return
+		}
+		s.list(w, r, b)
+	case "POST":
+		if _, ok := query["delete"]; ok {
+			s.deleteMulti(w, r, b)
+			return
+		}
+		writeError(w, r, http.StatusNotImplemented, "NotImplemented", "")
+	case "PUT":
+		if _, ok := query["versioning"]; ok {
+			s.putVersioning(w, r, b)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	case "HEAD":
+		w.WriteHeader(http.StatusOK)
+	case "DELETE":
+		if len(b.objects) > 0 {
+			writeError(w, r, http.StatusConflict, "BucketNotEmpty", "")
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", "")
+	}
+}
+
+func (s *Server) serveObject(w http.ResponseWriter, r *http.Request, b *bucket, key string) {
+	query := r.URL.Query()
+	if _, ok := query["uploads"]; ok && r.Method == "POST" {
+		s.initUpload(w, r, b, key)
+		return
+	}
+	if id := query.Get("uploadId"); id != "" {
+		s.serveUpload(w, r, b, key, id)
+		return
+	}
+	if _, ok := query["acl"]; ok && r.Method == "PUT" {
+		s.putACL(w, r, b, key)
+		return
+	}
+
+	versionID, hasVersion := query["versionId"]
+
+	switch r.Method {
+	case "GET", "HEAD":
+		obj, ok := b.objects[key]
+		if hasVersion {
+			obj, ok = b.version(key, versionID[0])
+			if !ok {
+				writeError(w, r, http.StatusNotFound, "NoSuchVersion", key)
+				return
+			}
+			if obj.deleteMarker {
+				w.Header().Set("X-Amz-Delete-Marker", "true")
+				writeError(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", key)
+				return
+			}
+		}
+		if !ok {
+			writeError(w, r, http.StatusNotFound, "NoSuchKey", key)
+			return
+		}
+
+		for k, v := range obj.header {
+			w.Header()[k] = v
+		}
+		w.Header().Set("ETag", obj.etag)
+		w.Header().Set("Last-Modified", obj.lastModified.Format(http.TimeFormat))
+		w.Header().Set("Content-Length", strconv.Itoa(len(obj.data)))
+		if obj.versionID != "" {
+			w.Header().Set("X-Amz-Version-Id", obj.versionID)
+		}
+		w.WriteHeader(http.StatusOK)
+
+		if r.Method == "GET" {
+			_, _ = w.Write(obj.data)
+		}
+	case "PUT":
+		if source := r.Header.Get("X-Amz-Copy-Source"); source != "" {
+			s.copyObject(w, r, b, key, source)
+			return
+		}
+
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "IncompleteBody", key)
+			return
+		}
+
+		header := storedHeaders(r.Header)
+		obj := &object{
+			data:         data,
+			etag:         s.etag(data, header),
+			lastModified: time.Now().UTC(),
+			header:       header,
+			acl:          requestACL(r),
+		}
+		b.store(s, key, obj)
+
+		w.Header().Set("ETag", obj.etag)
+		if obj.versionID != "" {
+			w.Header().Set("X-Amz-Version-Id", obj.versionID)
+		}
+		w.WriteHeader(http.StatusOK)
+	case "DELETE":
+		if hasVersion {
+			b.removeVersion(key, versionID[0])
+			w.Header().Set("X-Amz-Version-Id", versionID[0])
+		} else if marker := b.remove(s, key); marker != nil {
+			w.Header().Set("X-Amz-Delete-Marker", "true")
+			w.Header().Set("X-Amz-Version-Id", marker.versionID)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", key)
+	}
+}
+
+// storedHeaders returns the subset of the request headers of a PUT
+// request that S3 returns with the object.
+func storedHeaders(in http.Header) http.Header {
+	out := http.Header{}
+
+	for k, v := range in {
+		switch {
+		case strings.HasPrefix(k, "X-Amz-Meta-"), k == "Content-Type",
+			k == "Cache-Control", k == "Content-Encoding", k == "Content-Disposition",
+			k == "X-Amz-Server-Side-Encryption", k == "X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id":
+			out[k] = v
+		}
+	}
+
+	return out
+}
+
+// etag returns the ETag of a single-part object with the data and
+// stored headers. As in S3, objects encrypted with SSE-KMS have ETags
+// that are not the MD5 checksum of their content.
+func (s *Server) etag(data []byte, header http.Header) string {
+	if header.Get("X-Amz-Server-Side-Encryption") == "aws:kms" {
+		s.nextID++
+		return fmt.Sprintf("\"%x\"", md5.Sum(append([]byte(fmt.Sprintf("kms-%d:", s.nextID)), data...)))
+	}
+
+	return fmt.Sprintf("\"%x\"", md5.Sum(data))
+}
+
+// requestACL returns the canned ACL of the x-amz-acl header of the
+// request, which defaults to private.
+func requestACL(r *http.Request) string {
+	if acl := r.Header.Get("X-Amz-Acl"); acl != "" {
+		return acl
+	}
+
+	return "private"
+}
+
+// putACL replaces the ACL of an existing object with the canned ACL of
+// the request.
+func (s *Server) putACL(w http.ResponseWriter, r *http.Request, b *bucket, key string) {
+	obj, ok := b.objects[key]
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "NoSuchKey", key)
+		return
+	}
+
+	obj.acl = requestACL(r)
+	w.WriteHeader(http.StatusOK)
+}
+
+type copyObjectResult struct {
+	XMLName      xml.Name `xml:"CopyObjectResult"`
+	ETag         string   `xml:"ETag"`
+	LastModified string   `xml:"LastModified"`
+}
+
+// copyObject implements server-side copies, from any bucket on the
+// server. The source is the URL-encoded "<bucket>/<key>" value of the
+// x-amz-copy-source header, with an optional "?versionId=<id>" suffix
+// to copy a specific version. As in S3, copies that are not encrypted
+// with SSE-KMS have MD5 ETags even when the source object was uploaded
+// in parts, and copy the metadata of the source unless the request has
+// the REPLACE metadata directive. The encryption of the copy depends
+// only on the request.
+func (s *Server) copyObject(w http.ResponseWriter, r *http.Request, b *bucket, key, source string) {
+	sourceURL, err := url.Parse("/" + strings.TrimPrefix(source, "/"))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "InvalidArgument", key)
+		return
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(sourceURL.Path, "/"), "/", 2)
+	if len(parts) != 2 || parts[1] == "" {
+		writeError(w, r, http.StatusBadRequest, "InvalidArgument", key)
+		return
+	}
+
+	src, ok := s.getBucket(parts[0]).objects[parts[1]]
+	if id := sourceURL.Query().Get("versionId"); id != "" {
+		src, ok = s.getBucket(parts[0]).version(parts[1], id)
+		if !ok || src.deleteMarker {
+			writeError(w, r, http.StatusNotFound, "NoSuchVersion", parts[1])
+			return
+		}
+	}
+	if !ok {
+		writeError(w, r, http.StatusNotFound, "NoSuchKey", parts[1])
+		return
+	}
+
+	header := storedHeaders(r.Header)
+	if r.Header.Get("X-Amz-Metadata-Directive") != "REPLACE" {
+		header = http.Header{}
+		for k, v := range src.header {
+			header[k] = v
+		}
+		for _, k := range []string{
+			"X-Amz-Server-Side-Encryption",
+			"X-Amz-Server-Side-Encryption-Aws-Kms-Key-Id",
+		} {
+			delete(header, k)
+			if v, ok := r.Header[k]; ok {
+				header[k] = v
+			}
+		}
+	}
+
+	obj := &object{
+		data:         src.data,
+		etag:         s.etag(src.data, header),
+		lastModified: time.Now().UTC(),
+		header:       header,
+		acl:          requestACL(r),
+	}
+	b.store(s, key, obj)
+
+	if obj.versionID != "" {
+		w.Header().Set("X-Amz-Version-Id", obj.versionID)
+	}
+	writeXML(w, copyObjectResult{
+		ETag:         obj.etag,
+		LastModified: obj.lastModified.Format(timeFormat),
+	})
+}
+
+type listKey struct {
+	Key          string `xml:"Key"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag"`
+	Size         int    `xml:"Size"`
+	StorageClass string `xml:"StorageClass"`
+}
+
+type listPrefix struct {
+	Prefix string `xml:"Prefix"`
+}
+
+type listBucketResult struct {
+	XMLName        xml.Name     `xml:"ListBucketResult"`
+	Prefix         string       `xml:"Prefix"`
+	Delimiter      string       `xml:"Delimiter"`
+	Marker         string       `xml:"Marker"`
+	NextMarker     string       `xml:"NextMarker,omitempty"`
+	MaxKeys        int          `xml:"MaxKeys"`
+	IsTruncated    bool         `xml:"IsTruncated"`
+	Contents       []listKey    `xml:"Contents"`
+	CommonPrefixes []listPrefix `xml:"CommonPrefixes"`
+}
+
+func (s *Server) list(w http.ResponseWriter, r *http.Request, b *bucket) {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	delim := query.Get("delimiter")
+	marker := query.Get("marker")
+
+	max := 1000
+	if v := query.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, r, http.StatusBadRequest, "InvalidArgument", "")
+			return
+		}
+		if n > 0 && n < max {
+			max = n
+		}
+	}
+
+	names := make([]string, 0, len(b.objects))
+	for name := range b.objects {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	resp := listBucketResult{
+		Prefix:    prefix,
+		Delimiter: delim,
+		Marker:    marker,
+		MaxKeys:   max,
+	}
+
+	var last string
+	for _, name := range names {
+		entry := name
+		isPrefix := false
+		if delim != "" {
+			if idx := strings.Index(name[len(prefix):], delim); idx >= 0 {
+				entry = name[:len(prefix)+idx+len(delim)]
+				isPrefix = true
+				if l := len(resp.CommonPrefixes); l > 0 && resp.CommonPrefixes[l-1].Prefix == entry {
+					continue
+				}
+			}
+		}
+
+		if entry <= marker {
+			continue
+		}
+
+		if len(resp.Contents)+len(resp.CommonPrefixes) >= max {
+			resp.IsTruncated = true
+			resp.NextMarker = last
+			break
+		}
+
+		last = entry
+		if isPrefix {
+			resp.CommonPrefixes = append(resp.CommonPrefixes, listPrefix{Prefix: entry})
+			continue
+		}
+
+		obj := b.objects[name]
+		resp.Contents = append(resp.Contents, listKey{
+			Key:          name,
+			LastModified: obj.lastModified.Format(timeFormat),
+			ETag:         obj.etag,
+			Size:         len(obj.data),
+			StorageClass: "STANDARD",
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	writeXML(w, resp)
+}
+
+type deleteRequest struct {
+	Quiet   bool `xml:"Quiet"`
+	Objects []struct {
+		Key       string `xml:"Key"`
+		VersionID string `xml:"VersionId"`
+	} `xml:"Object"`
+}
+
+type deletedKey struct {
+	Key       string `xml:"Key"`
+	VersionID string `xml:"VersionId,omitempty"`
+}
+
+type deleteError struct {
+	Key     string `xml:"Key"`
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+type deleteResult struct {
+	XMLName xml.Name      `xml:"DeleteResult"`
+	Deleted []deletedKey  `xml:"Deleted"`
+	Errors  []deleteError `xml:"Error"`
+}
+
+func (s *Server) deleteMulti(w http.ResponseWriter, r *http.Request, b *bucket) {
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "IncompleteBody", "")
+		return
+	}
+
+	req := deleteRequest{}
+	if err = xml.NewDecoder(bytes.NewReader(body)).Decode(&req); err != nil {
+		writeError(w, r, http.StatusBadRequest, "MalformedXML", "")
+		return
+	}
+
+	if len(req.Objects) > 1000 {
+		writeError(w, r, http.StatusBadRequest, "MalformedXML", "")
+		return
+	}
+
+	resp := deleteResult{}
+	for _, obj := range req.Objects {
+		if code, ok := s.deleteFailures[obj.Key]; ok {
+			resp.Errors = append(resp.Errors, deleteError{Key: obj.Key, Code: code, Message: code})
+			continue
+		}
+
+		if obj.VersionID != "" {
+			b.removeVersion(obj.Key, obj.VersionID)
+		} else {
+			b.remove(s, obj.Key)
+		}
+
+		if !req.Quiet {
+			resp.Deleted = append(resp.Deleted, deletedKey{Key: obj.Key, VersionID: obj.VersionID})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	writeXML(w, resp)
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Versions
+//
+////////////////////////////////////////////////////////////////////////
+
+type versioningConfiguration struct {
+	Status string `xml:"Status"`
+}
+
+// putVersioning enables or suspends versioning for the bucket.
+// Suspended buckets keep their versions, and continue to add
+// versions, as this server does not implement "null" versions.
+func (s *Server) putVersioning(w http.ResponseWriter, r *http.Request, b *bucket) {
+	conf := versioningConfiguration{}
+	if err := xml.NewDecoder(r.Body).Decode(&conf); err != nil {
+		writeError(w, r, http.StatusBadRequest, "MalformedXML", "")
+		return
+	}
+
+	if conf.Status == "Enabled" {
+		b.enableVersioning(s)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// listVersion is an entry of a version listing. The name of the
+// element is "Version" or "DeleteMarker", and delete markers do not
+// have ETags or sizes.
+type listVersion struct {
+	XMLName      xml.Name
+	Key          string `xml:"Key"`
+	VersionID    string `xml:"VersionId"`
+	IsLatest     bool   `xml:"IsLatest"`
+	LastModified string `xml:"LastModified"`
+	ETag         string `xml:"ETag,omitempty"`
+	Size         *int   `xml:"Size,omitempty"`
+	StorageClass string `xml:"StorageClass,omitempty"`
+}
+
+type listVersionsResult struct {
+	XMLName             xml.Name      `xml:"ListVersionsResult"`
+	Name                string        `xml:"Name"`
+	Prefix              string        `xml:"Prefix"`
+	KeyMarker           string        `xml:"KeyMarker"`
+	VersionIDMarker     string        `xml:"VersionIdMarker"`
+	NextKeyMarker       string        `xml:"NextKeyMarker,omitempty"`
+	NextVersionIDMarker string        `xml:"NextVersionIdMarker,omitempty"`
+	MaxKeys             int           `xml:"MaxKeys"`
+	IsTruncated         bool          `xml:"IsTruncated"`
+	Versions            []listVersion `xml:"Version"`
+}
+
+// listVersions lists the versions and delete markers of keys with the
+// prefix, sorted by key and, for each key, newest first, after the
+// key-marker and version-id-marker parameters. Delimiters are not
+// supported.
+func (s *Server) listVersions(w http.ResponseWriter, r *http.Request, b *bucket) {
+	query := r.URL.Query()
+	prefix := query.Get("prefix")
+	keyMarker := query.Get("key-marker")
+	versionMarker := query.Get("version-id-marker")
+
+	max := 1000
+	if v := query.Get("max-keys"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			writeError(w, r, http.StatusBadRequest, "InvalidArgument", "")
+			return
+		}
+		if n > 0 && n < max {
+			max = n
+		}
+	}
+
+	history := b.versions
+	if !b.versioned {
+		history = make(map[string][]*object, len(b.objects))
+		for key, obj := range b.objects {
+			history[key] = []*object{obj}
+		}
+	}
+
+	names := make([]string, 0, len(history))
+	for name := range history {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	resp := listVersionsResult{
+		Name:            b.name,
+		Prefix:          prefix,
+		KeyMarker:       keyMarker,
+		VersionIDMarker: versionMarker,
+		MaxKeys:         max,
+	}
+
+	for _, name := range names {
+		if name < keyMarker || (name == keyMarker && versionMarker == "") {
+			continue
+		}
+
+		// skip the versions of the marker key up to and
+		// including the version marker.
+		skipping := name == keyMarker
+		versions := history[name]
+		for idx := len(versions) - 1; idx >= 0; idx-- {
+			obj := versions[idx]
+			id := obj.versionID
+			if !b.versioned {
+				id = "null"
+			}
+
+			if skipping {
+				skipping = id != versionMarker
+				continue
+			}
+
+			if len(resp.Versions) >= max {
+				last := resp.Versions[len(resp.Versions)-1]
+				resp.IsTruncated = true
+				resp.NextKeyMarker = last.Key
+				resp.NextVersionIDMarker = last.VersionID
+				break
+			}
+
+			entry := listVersion{
+				XMLName:      xml.Name{Local: "Version"},
+				Key:          name,
+				VersionID:    id,
+				IsLatest:     idx == len(versions)-1,
+				LastModified: obj.lastModified.Format(timeFormat),
+			}
+			if obj.deleteMarker {
+				entry.XMLName.Local = "DeleteMarker"
+			} else {
+				size := len(obj.data)
+				entry.ETag = obj.etag
+				entry.Size = &size
+				entry.StorageClass = "STANDARD"
+			}
+
+			resp.Versions = append(resp.Versions, entry)
+		}
+
+		if resp.IsTruncated {
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	writeXML(w, resp)
+}
+
+////////////////////////////////////////////////////////////////////////
+//
+// Multipart Uploads
+//
+////////////////////////////////////////////////////////////////////////
+
+// minPartSize is the smallest size that S3 accepts for parts other
+// than the last part of a multipart upload.
+const minPartSize = 5 * 1024 * 1024
+
+type initUploadResult struct {
+	XMLName  xml.Name `xml:"InitiateMultipartUploadResult"`
+	Bucket   string   `xml:"Bucket"`
+	Key      string   `xml:"Key"`
+	UploadID string   `xml:"UploadId"`
+}
+
+func (s *Server) initUpload(w http.ResponseWriter, r *http.Request, b *bucket, key string) {
+	s.nextID++
+	id := fmt.Sprintf("upload-%d", s.nextID)
+	b.uploads[id] = &upload{
+		key:       key,
+		header:    storedHeaders(r.Header),
+		acl:       requestACL(r),
+		initiated: time.Now().UTC(),
+		parts:     make(map[int][]byte),
+	}
+
+	w.Header().Set("Content-Type", "application/xml")
+	writeXML(w, initUploadResult{Bucket: b.name, Key: key, UploadID: id})
+}
+
+func (s *Server) serveUpload(w http.ResponseWriter, r *http.Request, b *bucket, key, id string) {
+	u, ok := b.uploads[id]
+	if !ok || u.key != key {
+		writeError(w, r, http.StatusNotFound, "NoSuchUpload", key)
+		return
+	}
+
+	switch r.Method {
+	case "PUT":
+		n, err := strconv.Atoi(r.URL.Query().Get("partNumber"))
+		if err != nil || n < 1 || n > 10000 {
+			writeError(w, r, http.StatusBadRequest, "InvalidArgument", key)
+			return
+		}
+
+		data, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "IncompleteBody", key)
+			return
+		}
+
+		u.parts[n] = data
+		w.Header().Set("ETag", fmt.Sprintf("\"%x\"", md5.Sum(data)))
+		w.WriteHeader(http.StatusOK)
+	case "POST":
+		s.completeUpload(w, r, b, id, u)
+	case "DELETE":
+		delete(b.uploads, id)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, r, http.StatusMethodNotAllowed, "MethodNotAllowed", key)
+	}
+}
+
+type completeUploadRequest struct {
+	Parts []struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	} `xml:"Part"`
+}
+
+type completeUploadResult struct {
+	XMLName xml.Name `xml:"CompleteMultipartUploadResult"`
+	Bucket  string   `xml:"Bucket"`
+	Key     string   `xml:"Key"`
+	ETag    string   `xml:"ETag"`
+}
+
+func (s *Server) completeUpload(w http.ResponseWriter, r *http.Request, b *bucket, id string,
+	u *upload) {
+	req := completeUploadRequest{}
+	if err := xml.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Parts) == 0 {
+		writeError(w, r, http.StatusBadRequest, "MalformedXML", u.key)
+		return
+	}
+
+	var data []byte
+	var digests []byte
+	for idx, p := range req.Parts {
+		part, ok := u.parts[p.PartNumber]
+		if !ok {
+			writeError(w, r, http.StatusBadRequest, "InvalidPart", u.key)
+			return
+		}
+
+		sum := md5.Sum(part)
+		if strings.Trim(p.ETag, "\"") != hex.EncodeToString(sum[:]) {
+			writeError(w, r, http.StatusBadRequest, "InvalidPart", u.key)
+			return
+		}
+
+		if idx > 0 && p.PartNumber <= req.Parts[idx-1].PartNumber {
+			writeError(w, r, http.StatusBadRequest, "InvalidPartOrder", u.key)
+			return
+		}
+
+		if idx < len(req.Parts)-1 && len(part) < minPartSize {
+			writeError(w, r, http.StatusBadRequest, "EntityTooSmall", u.key)
+			return
+		}
+
+		data = append(data, part...)
+		digests = append(digests, sum[:]...)
+	}
+
+	obj := &object{
+		data:         data,
+		etag:         fmt.Sprintf("\"%x-%d\"", md5.Sum(digests), len(req.Parts)),
+		lastModified: time.Now().UTC(),
+		header:       u.header,
+		acl:          u.acl,
+	}
+	b.store(s, u.key, obj)
+	delete(b.uploads, id)
+
+	w.Header().Set("Content-Type", "application/xml")
+	writeXML(w, completeUploadResult{Bucket: b.name, Key: u.key, ETag: obj.etag})
+}
+
+type listUpload struct {
+	Key       string `xml:"Key"`
+	UploadID  string `xml:"UploadId"`
+	Initiated string `xml:"Initiated"`
+}
+
+type uploadsByKey []listUpload
+
+func (u uploadsByKey) Len() int      { return len(u) }
+func (u uploadsByKey) Swap(i, j int) { u[i], u[j] = u[j], u[i] }
+func (u uploadsByKey) Less(i, j int) bool {
+	if u[i].Key != u[j].Key {
+		return u[i].Key < u[j].Key
+	}
+	return u[i].UploadID < u[j].UploadID
+}
+
+type listUploadsResult struct {
+	XMLName        xml.Name     `xml:"ListMultipartUploadsResult"`
+	Bucket         string       `xml:"Bucket"`
+	Prefix         string       `xml:"Prefix"`
+	IsTruncated    bool         `xml:"IsTruncated"`
+	Uploads        []listUpload `xml:"Upload"`
+	CommonPrefixes []listPrefix `xml:"CommonPrefixes"`
+}
+
+// listUploads lists all incomplete uploads with the prefix, in a
+// single page. Delimiters are not supported.
+func (s *Server) listUploads(w http.ResponseWriter, r *http.Request, b *bucket) {
+	prefix := r.URL.Query().Get("prefix")
+	resp := listUploadsResult{Bucket: b.name, Prefix: prefix}
+
+	for id, u := range b.uploads {
+		if strings.HasPrefix(u.key, prefix) {
+			resp.Uploads = append(resp.Uploads, listUpload{
+				Key:       u.key,
+				UploadID:  id,
+				Initiated: u.initiated.Format(timeFormat),
+			})
+		}
+	}
+
+	sort.Sort(uploadsByKey(resp.Uploads))
+
+	w.Header().Set("Content-Type", "application/xml")
+	writeXML(w, resp)
+}
@@ -0,0 +1,333 @@
+package fakes3
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goamz/goamz/aws"
+	"github.com/goamz/goamz/s3"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// ServerSuite exercises the fake S3 server using the goamz client,
+// which is the same client that the sthree package uses.
+type ServerSuite struct {
+	srv     *Server
+	bucket  *s3.Bucket
+	require *require.Assertions
+	suite.Suite
+}
+
+func TestServerSuite(t *testing.T) {
+	suite.Run(t, new(ServerSuite))
+}
+
+func (s *ServerSuite) SetupSuite() {
+	s.require = s.Require()
+}
+
+func (s *ServerSuite) SetupTest() {
+	s.srv = NewServer()
+	auth := aws.Auth{AccessKey: "fake", SecretKey: "fake"}
+	s.bucket = s3.New(auth, s.srv.Region()).Bucket("test-bucket")
+}
+
+func (s *ServerSuite) TearDownTest() {
+	s.srv.Close()
+}
+
+func (s *ServerSuite) TestPutGetRoundTrip() {
+	s.require.NoError(s.bucket.Put("a/b", []byte("hello"), "text/plain", s3.Private, s3.Options{}))
+
+	data, err := s.bucket.Get("a/b")
+	s.NoError(err)
+	s.Equal("hello", string(data))
+
+	s.Equal([]string{"a/b"}, s.srv.Keys("test-bucket"))
+}
+
+func (s *ServerSuite) TestMissingObjectsReturnErrors() {
+	_, err := s.bucket.Get("missing")
+	s.require.Error(err)
+	s3err, ok := err.(*s3.Error)
+	s.require.True(ok)
+	s.Equal(404, s3err.StatusCode)
+	s.Equal("NoSuchKey", s3err.Code)
+
+	exists, err := s.bucket.Exists("missing")
+	s.NoError(err)
+	s.False(exists)
+}
+
+func (s *ServerSuite) TestHeadReturnsETagAndMetadata() {
+	s.require.NoError(s.bucket.Put("obj", []byte("content"), "text/plain", s3.Private,
+		s3.Options{CacheControl: "max-age=60", Meta: map[string][]string{"foo": {"bar"}}}))
+
+	exists, err := s.bucket.Exists("obj")
+	s.NoError(err)
+	s.True(exists)
+
+	resp, err := s.bucket.Head("obj", nil)
+	s.require.NoError(err)
+	s.Equal(fmt.Sprintf("\"%x\"", md5.Sum([]byte("content"))), resp.Header.Get("ETag"))
+	s.Equal("max-age=60", resp.Header.Get("Cache-Control"))
+	s.Equal("bar", resp.Header.Get("X-Amz-Meta-Foo"))
+	s.Equal("7", resp.Header.Get("Content-Length"))
+}
+
+func (s *ServerSuite) TestListSupportsMarkersAndPrefixes() {
+	for i := 0; i < 25; i++ {
+		s.require.NoError(s.bucket.Put(fmt.Sprintf("prefix/%02d", i), []byte(strconv.Itoa(i)),
+			"text/plain", s3.Private, s3.Options{}))
+	}
+	s.require.NoError(s.bucket.Put("other", []byte("x"), "text/plain", s3.Private, s3.Options{}))
+
+	var seen []string
+	var marker string
+	for {
+		resp, err := s.bucket.List("prefix/", "", marker, 10)
+		s.require.NoError(err)
+
+		for _, key := range resp.Contents {
+			content := strconv.Itoa(len(seen))
+			s.Equal(fmt.Sprintf("\"%x\"", md5.Sum([]byte(content))), key.ETag)
+
+			seen = append(seen, key.Key)
+			marker = key.Key
+		}
+
+		if !resp.IsTruncated {
+			break
+		}
+		s.Equal(marker, resp.NextMarker)
+	}
+
+	s.Len(seen, 25)
+	s.Equal("prefix/00", seen[0])
+	s.Equal("prefix/24", seen[24])
+}
+
+func (s *ServerSuite) TestListWithDelimiterGroupsCommonPrefixes() {
+	for _, key := range []string{"a/1", "a/2", "b/1", "c"} {
+		s.require.NoError(s.bucket.Put(key, []byte(key), "text/plain", s3.Private, s3.Options{}))
+	}
+
+	resp, err := s.bucket.List("", "/", "", 1000)
+	s.require.NoError(err)
+	s.Equal([]string{"a/", "b/"}, resp.CommonPrefixes)
+	s.require.Len(resp.Contents, 1)
+	s.Equal("c", resp.Contents[0].Key)
+	s.Equal(int64(1), resp.Contents[0].Size)
+}
+
+func (s *ServerSuite) TestDeleteAndMultiDelete() {
+	for i := 0; i < 5; i++ {
+		s.require.NoError(s.bucket.Put(strconv.Itoa(i), []byte("x"), "text/plain", s3.Private,
+			s3.Options{}))
+	}
+
+	s.NoError(s.bucket.Del("0"))
+	s.NoError(s.bucket.Del("does-not-exist"))
+	s.NoError(s.bucket.DelMulti(s3.Delete{Objects: []s3.Object{{Key: "1"}, {Key: "2"}, {Key: "3"}}}))
+
+	s.Equal([]string{"4"}, s.srv.Keys("test-bucket"))
+
+	// failed keys are errors in a successful response, which the
+	// goamz client ignores.
+	s.srv.FailDeletes("AccessDenied", "4")
+	s.NoError(s.bucket.DelMulti(s3.Delete{Objects: []s3.Object{{Key: "4"}}}))
+	s.Equal([]string{"4"}, s.srv.Keys("test-bucket"))
+
+	s.srv.FailDeletes("AccessDenied")
+	s.NoError(s.bucket.DelMulti(s3.Delete{Objects: []s3.Object{{Key: "4"}}}))
+	s.Len(s.srv.Keys("test-bucket"), 0)
+}
+
+func (s *ServerSuite) TestMultipartUploadRoundTrip() {
+	multi, err := s.bucket.InitMulti("multi", "text/plain", s3.Private)
+	s.require.NoError(err)
+	s.Equal([]string{"multi"}, s.srv.Uploads("test-bucket"))
+
+	first := bytes.Repeat([]byte("a"), minPartSize)
+	second := []byte("the end")
+
+	// upload parts out of order
+	two, err := multi.PutPart(2, bytes.NewReader(second))
+	s.require.NoError(err)
+	one, err := multi.PutPart(1, bytes.NewReader(first))
+	s.require.NoError(err)
+
+	s.require.NoError(multi.Complete([]s3.Part{two, one}))
+	s.Len(s.srv.Uploads("test-bucket"), 0)
+
+	data, err := s.bucket.Get("multi")
+	s.NoError(err)
+	s.Equal(append(first, second...), data)
+
+	resp, err := s.bucket.Head("multi", nil)
+	s.require.NoError(err)
+	s.True(strings.HasSuffix(resp.Header.Get("ETag"), "-2\""))
+}
+
+func (s *ServerSuite) TestMultipartRejectsSmallParts() {
+	multi, err := s.bucket.InitMulti("small", "text/plain", s3.Private)
+	s.require.NoError(err)
+
+	one, err := multi.PutPart(1, strings.NewReader("too small"))
+	s.require.NoError(err)
+	two, err := multi.PutPart(2, strings.NewReader("last"))
+	s.require.NoError(err)
+
+	err = multi.Complete([]s3.Part{one, two})
+	s.require.Error(err)
+	s.Equal("EntityTooSmall", err.(*s3.Error).Code)
+}
+
+func (s *ServerSuite) TestListAndAbortMultipartUploads() {
+	_, err := s.bucket.InitMulti("a/one", "text/plain", s3.Private)
+	s.require.NoError(err)
+	_, err = s.bucket.InitMulti("b/two", "text/plain", s3.Private)
+	s.require.NoError(err)
+
+	multis, _, err := s.bucket.ListMulti("a/", "")
+	s.require.NoError(err)
+	s.require.Len(multis, 1)
+	s.Equal("a/one", multis[0].Key)
+
+	s.NoError(multis[0].Abort())
+	s.Equal([]string{"b/two"}, s.srv.Uploads("test-bucket"))
+}
+
+func (s *ServerSuite) TestFailRequestsInjectsErrors() {
+	s.srv.FailRequests(1, func(r *http.Request) bool { return r.Method == "PUT" })
+
+	_, err := s.bucket.Get("missing")
+	s.Equal("NoSuchKey", err.(*s3.Error).Code)
+
+	err = s.bucket.Put("key", []byte("x"), "text/plain", s3.Private, s3.Options{})
+	s.require.Error(err)
+	s.Equal("SlowDown", err.(*s3.Error).Code)
+
+	s.NoError(s.bucket.Put("key", []byte("x"), "text/plain", s3.Private, s3.Options{}))
+
+	s.srv.FailRequestsWith(1, http.StatusForbidden, "AccessDenied", nil)
+	_, err = s.bucket.Get("key")
+	s.require.Error(err)
+	s.Equal(http.StatusForbidden, err.(*s3.Error).StatusCode)
+	s.Equal("AccessDenied", err.(*s3.Error).Code)
+}
+
+func (s *ServerSuite) TestCopyObjectsBetweenBuckets() {
+	s.require.NoError(s.bucket.Put("a b+c", []byte("content"), "text/plain", s3.Private,
+		s3.Options{Meta: map[string][]string{"foo": {"bar"}}}))
+
+	other := s3.New(s.bucket.Auth, s.srv.Region()).Bucket("other-bucket")
+	_, err := other.PutCopy("copy", s3.Private, s3.CopyOptions{MetadataDirective: "COPY"},
+		"test-bucket/a%20b%2Bc")
+	s.require.NoError(err)
+
+	data, err := other.Get("copy")
+	s.NoError(err)
+	s.Equal("content", string(data))
+
+	resp, err := other.Head("copy", nil)
+	s.require.NoError(err)
+	s.Equal("bar", resp.Header.Get("X-Amz-Meta-Foo"))
+
+	_, err = other.PutCopy("missing", s3.Private, s3.CopyOptions{}, "test-bucket/missing")
+	s.require.Error(err)
+	s.Equal("NoSuchKey", err.(*s3.Error).Code)
+}
+
+func (s *ServerSuite) TestExpiredPresignedURLsAreRejected() {
+	s.require.NoError(s.bucket.Put("key", []byte("x"), "text/plain", s3.Private, s3.Options{}))
+
+	signed := time.Now().UTC().Add(-time.Hour).Format("20060102T150405Z")
+	for expires, status := range map[string]int{
+		"7200": http.StatusOK,
+		"60":   http.StatusForbidden,
+		"":     http.StatusForbidden,
+	} {
+		resp, err := http.Get(s.bucket.URL("key") + "?X-Amz-Date=" + signed + "&X-Amz-Expires=" + expires)
+		s.require.NoError(err)
+		s.NoError(resp.Body.Close())
+		s.Equal(status, resp.StatusCode, expires)
+	}
+}
+
+func (s *ServerSuite) TestVersionedBucketsKeepVersions() {
+	s.require.NoError(s.bucket.Put("a", []byte("one"), "text/plain", s3.Private, s3.Options{}))
+	s.srv.EnableVersioning("test-bucket")
+	s.require.NoError(s.bucket.Put("a", []byte("two"), "text/plain", s3.Private, s3.Options{}))
+	s.require.NoError(s.bucket.Del("a"))
+
+	versions := s.srv.Versions("test-bucket", "a")
+	s.require.Len(versions, 3)
+	s.True(strings.HasSuffix(versions[0], "(delete marker)"))
+	s.Len(s.srv.Keys("test-bucket"), 0)
+
+	listing := s.listVersions("")
+	s.require.Len(listing, 3)
+	s.Equal("DeleteMarker", listing[0].XMLName.Local)
+	s.True(listing[0].IsLatest)
+	s.Equal("Version", listing[1].XMLName.Local)
+	s.Equal(versions[1], listing[1].VersionID)
+	s.Equal(versions[2], listing[2].VersionID)
+
+	listing = s.listVersions("&key-marker=a&version-id-marker=" + listing[1].VersionID)
+	s.require.Len(listing, 1)
+	s.Equal(versions[2], listing[0].VersionID)
+
+	get, err := http.Get(s.srv.URL() + "/test-bucket/a?versionId=" + versions[2])
+	s.require.NoError(err)
+	defer get.Body.Close()
+	data, err := ioutil.ReadAll(get.Body)
+	s.NoError(err)
+	s.Equal("one", string(data))
+
+	// removing the delete marker makes the previous version current.
+	marker := strings.Fields(versions[0])[0]
+	s.NoError(s.bucket.DelMulti(s3.Delete{Objects: []s3.Object{{Key: "a", VersionId: marker}}}))
+	content, err := s.bucket.Get("a")
+	s.NoError(err)
+	s.Equal("two", string(content))
+
+	_, err = s.bucket.PutCopy("b", s3.Private, s3.CopyOptions{},
+		"test-bucket/a?versionId="+versions[2])
+	s.require.NoError(err)
+	content, err = s.bucket.Get("b")
+	s.NoError(err)
+	s.Equal("one", string(content))
+}
+
+// listVersions returns the entries of a version listing of the bucket,
+// with the query parameters, in order. The goamz client does not parse
+// version listings correctly.
+func (s *ServerSuite) listVersions(params string) []listVersion {
+	resp, err := http.Get(s.srv.URL() + "/test-bucket/?versions" + params)
+	s.require.NoError(err)
+	defer resp.Body.Close()
+
+	result := struct {
+		Entries []listVersion `xml:",any"`
+	}{}
+	s.require.NoError(xml.NewDecoder(resp.Body).Decode(&result))
+
+	var entries []listVersion
+	for _, entry := range result.Entries {
+		if entry.XMLName.Local == "Version" || entry.XMLName.Local == "DeleteMarker" {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
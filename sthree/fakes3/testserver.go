@@ -0,0 +1,28 @@
+package fakes3
+
+import (
+	"os"
+
+	"github.com/goamz/goamz/aws"
+	"github.com/tychoish/grip"
+)
+
+// StartTestServer starts a new in-process server for the tests of a
+// package, so that they do not require AWS credentials or network
+// access, and returns the server with the credentials and region that
+// direct buckets to it, typically with sthree.SetCredentials. The
+// server does not check the credentials. Callers must close the
+// server when the tests finish.
+//
+// Returns a nil server when the CURATOR_TEST_AWS environment variable
+// is set, to run the tests against S3, using the default credentials.
+func StartTestServer() (*Server, aws.Auth, aws.Region) {
+	if os.Getenv("CURATOR_TEST_AWS") != "" {
+		return nil, aws.Auth{}, aws.Region{}
+	}
+
+	srv := NewServer()
+	grip.Noticef("running s3 tests against a fake s3 server at %s", srv.URL())
+
+	return srv, aws.Auth{AccessKey: "fakes3", SecretKey: "fakes3"}, srv.Region()
+}
@@ -0,0 +1,384 @@
+package sthree
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/goamz/goamz/s3"
+	"github.com/pkg/errors"
+	"github.com/tychoish/grip"
+)
+
+// s3TimeFormat is the format that S3 uses for the LastModified
+// field of keys in list results.
+const s3TimeFormat = "2006-01-02T15:04:05.000Z"
+
+// fileStorageTempPrefix is the prefix of the temporary files that
+// the file system storage writes before atomically renaming them
+// into place. These files are never listed.
+const fileStorageTempPrefix = ".sthree-tmp-"
+
+// fileStorage implements the Storage interface on top of a local
+// directory: keys are relative paths within the root directory. The
+// storage caches the ETags of the files, so that repeated listings
+// only hash files that have changed.
+type fileStorage struct {
+	root  string
+	etags *checksumCache
+}
+
+// NewFileSystemStorage returns a Storage implementation that stores
+// objects as files in the root directory. ETags are the MD5 checksum
+// of the file, as they are for S3 objects uploaded in a single
+// request. The modification time of each file is the value of the
+// object's mtime metadata, if set at upload time, and is the only
+// metadata that the file system storage preserves. ACLs, content
+// types, and other upload options are ignored.
+func NewFileSystemStorage(root string) Storage {
+	return &fileStorage{root: root, etags: newChecksumCache(root)}
+}
+
+// path returns the name of the file for the key. Returns an error for
+// keys that refer to files outside of the root directory (e.g.
+// "../key"), which S3 keys may do, but local storage must not.
+func (s *fileStorage) path(key string) (string, error) {
+	fileName := filepath.Join(s.root, filepath.FromSlash(key))
+
+	rel, err := filepath.Rel(s.root, fileName)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errors.Errorf("key '%s' is outside of the storage root '%s'", key, s.root)
+	}
+
+	return fileName, nil
+}
+
+func (s *fileStorage) Put(key string, r io.Reader, size int64, contentType string, perm s3.ACL,
+	opts UploadOptions) error {
+	fileName, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	dirName := filepath.Dir(fileName)
+
+	if err := os.MkdirAll(dirName, 0755); err != nil {
+		return errors.Wrapf(err, "problem creating directory '%s'", dirName)
+	}
+
+	tmp, err := ioutil.TempFile(dirName, fileStorageTempPrefix)
+	if err != nil {
+		return errors.Wrapf(err, "problem creating temporary file for '%s'", key)
+	}
+
+	n, err := io.Copy(tmp, r)
+	grip.CatchError(tmp.Close())
+	if err == nil && n != size {
+		err = errors.Errorf("wrote %d bytes, expected %d", n, size)
+	}
+
+	// temporary files are only readable by their owner, and other
+	// users (e.g. web servers) must be able to read the objects.
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+
+	if err == nil {
+		if value := opts.Meta[mtimeMetadataKey]; len(value) > 0 {
+			if mtime, ok := parseModTime(value[0]); ok {
+				err = os.Chtimes(tmp.Name(), mtime, mtime)
+			}
+		}
+	}
+
+	if err != nil {
+		grip.CatchError(os.Remove(tmp.Name()))
+		return errors.Wrapf(err, "problem writing '%s'", key)
+	}
+
+	s.etags.remove(fileName)
+	return errors.Wrapf(os.Rename(tmp.Name(), fileName), "problem renaming file for '%s'", key)
+}
+
+// CanCopyFrom returns true for other file system storage, which
+// includes other local buckets.
+func (s *fileStorage) CanCopyFrom(src Storage) bool {
+	_, ok := src.(*fileStorage)
+	return ok
+}
+
+// CopyFrom copies the file, preserving its modification time, which
+// is the only metadata that the file system storage supports.
+func (s *fileStorage) CopyFrom(src Storage, srcKey, key string, perm s3.ACL, enc Encryption) error {
+	other, ok := src.(*fileStorage)
+	if !ok {
+		return errors.New("file system storage can only copy from other file system storage")
+	}
+
+	fileName, err := other.path(srcKey)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return errors.Wrapf(err, "problem opening '%s'", srcKey)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return errors.Wrapf(err, "problem reading '%s'", srcKey)
+	}
+
+	return s.Put(key, f, info.Size(), "", perm, UploadOptions{Options: s3.Options{
+		Meta: map[string][]string{mtimeMetadataKey: {formatModTime(info.ModTime())}},
+	}})
+}
+
+func (s *fileStorage) Get(key string) (io.ReadCloser, error) {
+	fileName, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem opening '%s'", key)
+	}
+
+	return f, nil
+}
+
+func (s *fileStorage) Exists(key string) (bool, error) {
+	fileName, err := s.path(key)
+	if err != nil {
+		return false, err
+	}
+
+	info, err := os.Stat(fileName)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	if err != nil {
+		return false, errors.Wrapf(err, "problem checking '%s'", key)
+	}
+
+	return !info.IsDir(), nil
+}
+
+func (s *fileStorage) Head(key string) (*ObjectInfo, error) {
+	fileName, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := os.Stat(fileName)
+	if os.IsNotExist(err) || (err == nil && info.IsDir()) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem checking '%s'", key)
+	}
+
+	k, err := s.key(fileName, info)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem reading '%s'", key)
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         info.Size(),
+		ETag:         k.ETag,
+		LastModified: info.ModTime(),
+		Meta: map[string]string{
+			mtimeMetadataKey: formatModTime(info.ModTime()),
+		},
+	}, nil
+}
+
+func (s *fileStorage) key(fileName string, info os.FileInfo) (s3.Key, error) {
+	rel, err := filepath.Rel(s.root, fileName)
+	if err != nil {
+		return s3.Key{}, err
+	}
+
+	etag, err := s.etag(fileName, info)
+	if err != nil {
+		return s3.Key{}, err
+	}
+
+	return s3.Key{
+		Key:          filepath.ToSlash(rel),
+		Size:         info.Size(),
+		LastModified: info.ModTime().UTC().Format(s3TimeFormat),
+		ETag:         etag,
+	}, nil
+}
+
+// etag returns the ETag of the file, which is the MD5 checksum of its
+// content, from the cache if the file has not changed since the
+// storage last hashed it.
+func (s *fileStorage) etag(fileName string, info os.FileInfo) (string, error) {
+	if etag, ok := s.etags.get(fileName, info, 0); ok {
+		return etag, nil
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hash := md5.New()
+	if _, err = io.Copy(hash, f); err != nil {
+		return "", err
+	}
+
+	etag := fmt.Sprintf("\"%x\"", hash.Sum(nil))
+	s.etags.set(fileName, info, 0, etag)
+
+	return etag, nil
+}
+
+// List walks the portion of the directory tree that can contain keys
+// with the prefix, and assembles a result that mirrors the S3 list
+// bucket response for the same arguments. The walk skips directories
+// that only contain keys before the marker, and only reads the files
+// of the page to compute their ETags.
+func (s *fileStorage) List(prefix, delim, marker string, max int) (*s3.ListResp, error) {
+	if max <= 0 {
+		max = 1000
+	}
+
+	resp := &s3.ListResp{
+		Prefix:    prefix,
+		Delimiter: delim,
+		Marker:    marker,
+		MaxKeys:   max,
+	}
+
+	start := s.root
+	if idx := strings.LastIndex(prefix, "/"); idx >= 0 {
+		var err error
+		if start, err = s.path(prefix[:idx]); err != nil {
+			return nil, err
+		}
+	}
+
+	var names []string
+	infos := make(map[string]os.FileInfo)
+	err := filepath.Walk(start, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+
+		rel, err := filepath.Rel(s.root, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+
+		if info.IsDir() {
+			// all keys in the directory sort before the
+			// marker, unless the directory is a prefix of the
+			// marker or sorts after it.
+			if dir := name + "/"; path != start && dir < marker && !strings.HasPrefix(marker, dir) {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		if strings.HasPrefix(info.Name(), fileStorageTempPrefix) {
+			return nil
+		}
+
+		if strings.HasPrefix(name, prefix) && name > marker {
+			names = append(names, name)
+			infos[name] = info
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem listing '%s'", s.root)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		entry := name
+		isPrefix := false
+		if delim != "" {
+			if idx := strings.Index(name[len(prefix):], delim); idx >= 0 {
+				entry = name[:len(prefix)+idx+len(delim)]
+				isPrefix = true
+				if l := len(resp.CommonPrefixes); l > 0 && resp.CommonPrefixes[l-1] == entry {
+					continue
+				}
+			}
+		}
+
+		if entry <= marker {
+			continue
+		}
+
+		if len(resp.Contents)+len(resp.CommonPrefixes) >= max {
+			resp.IsTruncated = true
+			break
+		}
+
+		if isPrefix {
+			resp.CommonPrefixes = append(resp.CommonPrefixes, entry)
+			continue
+		}
+
+		key, err := s.key(filepath.Join(s.root, filepath.FromSlash(name)), infos[name])
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem reading '%s'", name)
+		}
+		resp.Contents = append(resp.Contents, key)
+	}
+
+	return resp, nil
+}
+
+func (s *fileStorage) Delete(key string) error {
+	fileName, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	s.etags.remove(fileName)
+	err = os.Remove(fileName)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrapf(err, "problem removing '%s'", key)
+	}
+
+	return nil
+}
+
+func (s *fileStorage) DeleteMulti(objects s3.Delete) error {
+	errs := make(map[string]error)
+
+	for _, obj := range objects.Objects {
+		if err := s.Delete(obj.Key); err != nil {
+			errs[obj.Key] = err
+		}
+	}
+
+	if len(errs) > 0 {
+		return &DeleteMultiError{Errors: errs}
+	}
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package sthree
+
+import (
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Filter selects the files and objects that sync and prefix delete
+// operations act on. Filters match slash-separated names relative to
+// the local directory or the remote prefix of the operation.
+//
+// A name matches the filter if it matches at least one include rule,
+// or if the filter has no include rules, and does not match any
+// exclude rule: exclude rules take precedence over include rules. The
+// zero value, and a nil filter, match all names.
+type Filter struct {
+	includes []filterRule
+	excludes []filterRule
+}
+
+type filterRule interface {
+	match(name string) bool
+}
+
+// NewFilter returns an empty filter, which matches all names.
+func NewFilter() *Filter {
+	return &Filter{}
+}
+
+// Include adds a glob pattern that names must match. Patterns use the
+// syntax of path.Match. A pattern without a "/", for example
+// "*.html", matches any element of the name, while a pattern with a
+// "/", for example "repodata/*.xml", matches the leading elements of
+// the name. In both cases, a pattern that matches a directory matches
+// all names in that directory, and a pattern with a trailing "/" only
+// matches directories.
+func (f *Filter) Include(pattern string) error {
+	rule, err := newGlobRule(pattern)
+	if err != nil {
+		return err
+	}
+
+	f.includes = append(f.includes, rule)
+	return nil
+}
+
+// Exclude adds a glob pattern, with the same syntax as Include, that
+// names must not match.
+func (f *Filter) Exclude(pattern string) error {
+	rule, err := newGlobRule(pattern)
+	if err != nil {
+		return err
+	}
+
+	f.excludes = append(f.excludes, rule)
+	return nil
+}
+
+// IncludeRegex adds a regular expression that names must match. The
+// expression matches anywhere in the name, unless it is anchored with
+// "^" or "$".
+func (f *Filter) IncludeRegex(expression string) error {
+	rule, err := newRegexRule(expression)
+	if err != nil {
+		return err
+	}
+
+	f.includes = append(f.includes, rule)
+	return nil
+}
+
+// ExcludeRegex adds a regular expression, with the same semantics as
+// IncludeRegex, that names must not match.
+func (f *Filter) ExcludeRegex(expression string) error {
+	rule, err := newRegexRule(expression)
+	if err != nil {
+		return err
+	}
+
+	f.excludes = append(f.excludes, rule)
+	return nil
+}
+
+// IsEmpty returns true if the filter has no rules, and therefore
+// matches all names.
+func (f *Filter) IsEmpty() bool {
+	return f == nil || (len(f.includes) == 0 && len(f.excludes) == 0)
+}
+
+// Match returns true if the operation should act on the named file
+// or object.
+func (f *Filter) Match(name string) bool {
+	if f.IsEmpty() {
+		return true
+	}
+
+	name = strings.TrimPrefix(name, "/")
+
+	if len(f.includes) > 0 {
+		included := false
+		for _, rule := range f.includes {
+			if rule.match(name) {
+				included = true
+				break
+			}
+		}
+
+		if !included {
+			return false
+		}
+	}
+
+	for _, rule := range f.excludes {
+		if rule.match(name) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type globRule struct {
+	pattern  string
+	anchored bool
+	dirOnly  bool
+}
+
+func newGlobRule(pattern string) (*globRule, error) {
+	rule := &globRule{
+		dirOnly: strings.HasSuffix(pattern, "/"),
+		pattern: strings.Trim(pattern, "/"),
+	}
+
+	if rule.pattern == "" {
+		return nil, errors.Errorf("'%s' is not a valid filter pattern", pattern)
+	}
+
+	if _, err := path.Match(rule.pattern, ""); err != nil {
+		return nil, errors.Wrapf(err, "'%s' is not a valid filter pattern", pattern)
+	}
+
+	rule.anchored = strings.Contains(rule.pattern, "/")
+
+	return rule, nil
+}
+
+func (r *globRule) match(name string) bool {
+	elems := strings.Split(name, "/")
+
+	for i := range elems {
+		if r.dirOnly && i == len(elems)-1 {
+			break
+		}
+
+		candidate := elems[i]
+		if r.anchored {
+			candidate = strings.Join(elems[:i+1], "/")
+		}
+
+		if ok, _ := path.Match(r.pattern, candidate); ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+type regexRule struct {
+	matcher *regexp.Regexp
+}
+
+func newRegexRule(expression string) (*regexRule, error) {
+	matcher, err := regexp.Compile(expression)
+	if err != nil {
+		return nil, errors.Wrapf(err, "'%s' is not a valid filter expression", expression)
+	}
+
+	return &regexRule{matcher: matcher}, nil
+}
+
+func (r *regexRule) match(name string) bool {
+	return r.matcher.MatchString(name)
+}
+
+// SetFilter sets the filter that SyncTo, SyncFrom, and DeletePrefix
+// use to select files and objects. A nil filter selects everything.
+func (b *Bucket) SetFilter(f *Filter) {
+	b.filter = f
+}
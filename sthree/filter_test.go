@@ -0,0 +1,206 @@
+package sthree
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+// FilterSuite tests include and exclude filters, and their use in
+// sync and delete operations with local storage.
+type FilterSuite struct {
+	root    string
+	local   string
+	b       *Bucket
+	require *require.Assertions
+	suite.Suite
+}
+
+func TestFilterSuite(t *testing.T) {
+	suite.Run(t, new(FilterSuite))
+}
+
+func (s *FilterSuite) SetupSuite() {
+	s.require = s.Require()
+}
+
+func (s *FilterSuite) SetupTest() {
+	root, err := ioutil.TempDir("", uuid.NewV4().String())
+	s.require.NoError(err)
+	s.root = root
+	s.local = filepath.Join(root, "local")
+
+	for _, name := range []string{"index.html", "repodata/repomd.xml", "repodata/index.html",
+		"RPMS/a.rpm", "RPMS/b.rpm"} {
+		fileName := filepath.Join(s.local, name)
+		s.require.NoError(os.MkdirAll(filepath.Dir(fileName), 0755))
+		s.require.NoError(ioutil.WriteFile(fileName, []byte(name), 0644))
+	}
+
+	s.b = &Bucket{
+		name:    "filter",
+		numJobs: 2,
+		retry:   RetryPolicy{MaxAttempts: 1},
+		storage: NewFileSystemStorage(filepath.Join(root, "bucket")),
+	}
+	s.require.NoError(s.b.Open(context.Background()))
+}
+
+func (s *FilterSuite) TearDownTest() {
+	s.b.Close()
+	s.NoError(os.RemoveAll(s.root))
+}
+
+func (s *FilterSuite) keys(prefix string) []string {
+	var out []string
+	for key := range s.b.contents(context.Background(), prefix) {
+		out = append(out, key)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func (s *FilterSuite) TestEmptyFiltersMatchEverything() {
+	var nilFilter *Filter
+	s.True(nilFilter.IsEmpty())
+	s.True(nilFilter.Match("anything"))
+
+	s.True(NewFilter().IsEmpty())
+	s.True(NewFilter().Match("anything"))
+}
+
+func (s *FilterSuite) TestGlobPatterns() {
+	cases := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"*.html", "index.html", true},
+		{"*.html", "a/b/index.html", true},
+		{"*.html", "a/index.html/file", true},
+		{"*.html", "a/b/index.htm", false},
+		{"repodata", "repodata/repomd.xml", true},
+		{"repodata", "7/x86_64/repodata/repomd.xml", true},
+		{"repodata/", "repodata/repomd.xml", true},
+		{"repodata/", "repodata", false},
+		{"repodata/*.xml", "repodata/repomd.xml", true},
+		{"repodata/*.xml", "7/repodata/repomd.xml", false},
+		{"/RPMS/", "RPMS/a.rpm", true},
+		{"7/*/repodata", "7/x86_64/repodata/repomd.xml", true},
+	}
+
+	for _, c := range cases {
+		f := NewFilter()
+		s.require.NoError(f.Include(c.pattern))
+		s.Equal(c.match, f.Match(c.name), "%s %s", c.pattern, c.name)
+	}
+}
+
+func (s *FilterSuite) TestExcludesTakePrecedenceOverIncludes() {
+	f := NewFilter()
+	s.NoError(f.Include("repodata/"))
+	s.NoError(f.IncludeRegex(`\.rpm$`))
+	s.NoError(f.Exclude("*.html"))
+	s.NoError(f.ExcludeRegex("^RPMS/b"))
+
+	s.True(f.Match("repodata/repomd.xml"))
+	s.True(f.Match("/RPMS/a.rpm"))
+	s.False(f.Match("repodata/index.html"))
+	s.False(f.Match("RPMS/b.rpm"))
+	s.False(f.Match("index.html"))
+	s.False(f.Match("other"))
+}
+
+func (s *FilterSuite) TestInvalidRulesAreErrors() {
+	f := NewFilter()
+	s.Error(f.Include("["))
+	s.Error(f.Exclude("/"))
+	s.Error(f.IncludeRegex("("))
+	s.Error(f.ExcludeRegex("a(b"))
+	s.True(f.IsEmpty())
+}
+
+func (s *FilterSuite) TestSyncToSkipsFilteredFiles() {
+	f := NewFilter()
+	s.require.NoError(f.Exclude("*.html"))
+	s.b.SetFilter(f)
+
+	_, err := s.b.SyncTo(context.Background(), s.local, "repo", false)
+	s.NoError(err)
+	s.Equal([]string{"repo/RPMS/a.rpm", "repo/RPMS/b.rpm", "repo/repodata/repomd.xml"}, s.keys("repo"))
+}
+
+func (s *FilterSuite) TestSyncFromOnlyDownloadsIncludedObjects() {
+	_, err := s.b.SyncTo(context.Background(), s.local, "repo", false)
+	s.require.NoError(err)
+
+	f := NewFilter()
+	s.require.NoError(f.Include("repodata/"))
+	s.b.SetFilter(f)
+
+	dest := filepath.Join(s.root, "dest")
+	_, err = s.b.SyncFrom(context.Background(), dest, "repo", false)
+	s.NoError(err)
+
+	var files []string
+	s.NoError(filepath.Walk(dest, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, path[len(dest)+1:])
+		}
+		return err
+	}))
+	sort.Strings(files)
+	s.Equal([]string{"repodata/index.html", "repodata/repomd.xml"}, files)
+}
+
+func (s *FilterSuite) TestDeletePrefixOnlyDeletesMatchingObjects() {
+	_, err := s.b.SyncTo(context.Background(), s.local, "repo", false)
+	s.require.NoError(err)
+
+	f := NewFilter()
+	s.require.NoError(f.IncludeRegex(`\.rpm$`))
+	s.b.SetFilter(f)
+
+	s.NoError(s.b.DeletePrefix(context.Background(), "repo"))
+	s.Equal([]string{"repo/index.html", "repo/repodata/index.html", "repo/repodata/repomd.xml"},
+		s.keys("repo"))
+
+	clone, err := s.b.Clone()
+	s.require.NoError(err)
+	defer clone.Close()
+	s.Equal(f, clone.filter)
+}
+
+func (s *FilterSuite) TestPatternsMatchNamesRelativeToPrefixWithoutTrailingSlash() {
+	_, err := s.b.SyncTo(context.Background(), s.local, "repo", false)
+	s.require.NoError(err)
+
+	f := NewFilter()
+	s.require.NoError(f.Include("RPMS/*.rpm"))
+	s.b.SetFilter(f)
+
+	dest := filepath.Join(s.root, "dest")
+	_, err = s.b.SyncFrom(context.Background(), dest, "repo", false)
+	s.NoError(err)
+
+	var files []string
+	s.NoError(filepath.Walk(dest, func(path string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			files = append(files, path[len(dest)+1:])
+		}
+		return err
+	}))
+	sort.Strings(files)
+	s.Equal([]string{"RPMS/a.rpm", "RPMS/b.rpm"}, files)
+
+	s.NoError(s.b.DeletePrefix(context.Background(), "repo"))
+	s.Equal([]string{"repo/index.html", "repo/repodata/index.html", "repo/repodata/repomd.xml"},
+		s.keys("repo"))
+}
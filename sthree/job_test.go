@@ -8,6 +8,7 @@ import (
 	"github.com/goamz/goamz/s3"
 	"github.com/mongodb/amboy"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
 )
 
 // BucketJobSuite collects tests of the amboy.Job implementations that
@@ -38,12 +39,14 @@ func TestBucketJobSuiteWithDelete(t *testing.T) {
 
 func (s *BucketJobSuite) SetupSuite() {
 	s.bucket = GetBucket("build-test-curator")
-	s.NoError(s.bucket.Open())
+	s.NoError(s.bucket.Open(context.Background()))
 }
 
 func (s *BucketJobSuite) SetupTest() {
-	s.toJob = newSyncToJob(s.bucket, "local-file-name", s3.Key{Key: "remote-file-name"}, s.withDelete)
-	s.fromJob = newSyncFromJob(s.bucket, "local-file-name", s3.Key{}, s.withDelete)
+	s.toJob = newSyncToJob(context.Background(), s.bucket, "local-file-name",
+		s3.Key{Key: "remote-file-name"}, s.withDelete)
+	s.fromJob = newSyncFromJob(context.Background(), s.bucket, "local-file-name", s3.Key{},
+		s.withDelete)
 	s.jobs = []amboy.Job{s.toJob, s.fromJob}
 }
 
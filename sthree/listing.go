@@ -0,0 +1,161 @@
+package sthree
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/goamz/goamz/s3"
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// Listing describes the objects in a bucket that have a prefix.
+type Listing struct {
+	Prefix string `json:"prefix"`
+
+	// Objects are the objects, sorted by key. Listings only include
+	// the key, size, ETag, and modification time of objects.
+	Objects []ObjectInfo `json:"objects"`
+
+	// Prefixes are the common prefixes, each ending in a "/", of
+	// keys that non-recursive listings do not include, like the
+	// sub-directories of a directory.
+	Prefixes []string `json:"prefixes,omitempty"`
+}
+
+// PrefixUsage describes the total size of the objects that have a
+// prefix.
+type PrefixUsage struct {
+	Prefix  string `json:"prefix"`
+	Objects int    `json:"objects"`
+	Size    int64  `json:"size"`
+}
+
+// List returns the objects in the bucket that have the prefix. The
+// prefix is literal, so use a trailing "/" to list the contents of a
+// "directory." Recursive listings include all objects with the
+// prefix. Other listings only include objects without a "/" in the
+// remainder of their keys, and group other keys by their common
+// prefixes, like a directory listing.
+func (b *Bucket) List(ctx context.Context, prefix string, recursive bool) (*Listing, error) {
+	var delim string
+	if !recursive {
+		delim = "/"
+	}
+
+	out := &Listing{Prefix: prefix}
+
+	var marker string
+	for {
+		resp, err := b.listPage(ctx, prefix, delim, marker)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, key := range resp.Contents {
+			out.Objects = append(out.Objects, objectInfoFromKey(key))
+			marker = key.Key
+		}
+
+		for _, p := range resp.CommonPrefixes {
+			out.Prefixes = append(out.Prefixes, p)
+			if p > marker {
+				marker = p
+			}
+		}
+
+		if !resp.IsTruncated {
+			break
+		}
+
+		if resp.NextMarker != "" {
+			marker = resp.NextMarker
+		}
+	}
+
+	return out, nil
+}
+
+// DiskUsage returns the number and total size of the objects that
+// have the prefix, grouped by the "directories" of their keys up to
+// depth levels below the prefix. Objects in deeper directories count
+// towards their ancestor at the depth, so a depth of 0 returns a
+// single total for the prefix. Results are sorted by prefix.
+func (b *Bucket) DiskUsage(ctx context.Context, prefix string, depth int) ([]PrefixUsage, error) {
+	if depth < 0 {
+		return nil, errors.Errorf("depth=%d, must not be negative", depth)
+	}
+
+	listing, err := b.List(ctx, prefix, true)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make(map[string]*PrefixUsage)
+	for _, obj := range listing.Objects {
+		dirs := strings.Split(strings.TrimPrefix(obj.Key[len(prefix):], "/"), "/")
+		dirs = dirs[:len(dirs)-1]
+		if len(dirs) > depth {
+			dirs = dirs[:depth]
+		}
+
+		name := prefix
+		if len(dirs) > 0 {
+			name = strings.TrimSuffix(prefix, "/")
+			if name != "" {
+				name += "/"
+			}
+			name += strings.Join(dirs, "/") + "/"
+		}
+
+		group, ok := groups[name]
+		if !ok {
+			group = &PrefixUsage{Prefix: name}
+			groups[name] = group
+		}
+
+		group.Objects++
+		group.Size += obj.Size
+	}
+
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	out := make([]PrefixUsage, 0, len(names))
+	for _, name := range names {
+		out = append(out, *groups[name])
+	}
+
+	return out, nil
+}
+
+// listPage returns a single page of list results in a retry loop.
+func (b *Bucket) listPage(ctx context.Context, prefix, delim, marker string) (*s3.ListResp, error) {
+	var resp *s3.ListResp
+
+	err := b.withRetries(ctx, fmt.Sprintf("list %s/%s", b.name, prefix), func() error {
+		var err error
+		resp, err = b.storage.List(prefix, delim, marker, 1000)
+		return err
+	})
+
+	return resp, err
+}
+
+// objectInfoFromKey converts a key from a list result.
+func objectInfoFromKey(key s3.Key) ObjectInfo {
+	info := ObjectInfo{
+		Key:  key.Key,
+		Size: key.Size,
+		ETag: key.ETag,
+	}
+
+	info.LastModified, _ = time.Parse(s3TimeFormat, key.LastModified)
+
+	return info
+}
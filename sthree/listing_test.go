@@ -0,0 +1,150 @@
+package sthree
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/goamz/goamz/aws"
+	"github.com/goamz/goamz/s3"
+	"github.com/mongodb/curator/sthree/fakes3"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+// ListingSuite tests the public listing operations against both
+// storage implementations.
+type ListingSuite struct {
+	storage func(root string, srv *fakes3.Server) Storage
+	srv     *fakes3.Server
+	root    string
+	b       *Bucket
+	require *require.Assertions
+	suite.Suite
+}
+
+func TestListingSuiteWithFileStorage(t *testing.T) {
+	suite.Run(t, &ListingSuite{
+		storage: func(root string, _ *fakes3.Server) Storage {
+			return NewFileSystemStorage(root)
+		},
+	})
+}
+
+func TestListingSuiteWithS3Storage(t *testing.T) {
+	suite.Run(t, &ListingSuite{
+		storage: func(_ string, srv *fakes3.Server) Storage {
+			auth := aws.Auth{AccessKey: "fake", SecretKey: "fake"}
+			return NewS3Storage(s3.New(auth, srv.Region()).Bucket("listing"))
+		},
+	})
+}
+
+func (s *ListingSuite) SetupSuite() {
+	s.require = s.Require()
+}
+
+func (s *ListingSuite) SetupTest() {
+	root, err := ioutil.TempDir("", uuid.NewV4().String())
+	s.require.NoError(err)
+	s.root = root
+	s.srv = fakes3.NewServer()
+
+	s.b = &Bucket{
+		name:    "listing",
+		retry:   RetryPolicy{MaxAttempts: 1},
+		storage: s.storage(filepath.Join(root, "bucket"), s.srv),
+	}
+
+	for name, size := range map[string]int{
+		"repo/index.html":              10,
+		"repo/7/x86_64/a.rpm":          100,
+		"repo/7/x86_64/b.rpm":          200,
+		"repo/7/x86_64/repodata/x.xml": 5,
+		"repo/8/x86_64/c.rpm":          1000,
+		"other/file":                   1,
+	} {
+		fileName := filepath.Join(root, "files", name)
+		s.require.NoError(os.MkdirAll(filepath.Dir(fileName), 0755))
+		s.require.NoError(ioutil.WriteFile(fileName, make([]byte, size), 0644))
+		s.require.NoError(s.b.Put(context.Background(), fileName, name))
+	}
+}
+
+func (s *ListingSuite) TearDownTest() {
+	s.srv.Close()
+	s.NoError(os.RemoveAll(s.root))
+}
+
+func (s *ListingSuite) keys(listing *Listing) []string {
+	var out []string
+	for _, obj := range listing.Objects {
+		out = append(out, obj.Key)
+	}
+	return out
+}
+
+func (s *ListingSuite) TestRecursiveListingIncludesAllObjects() {
+	listing, err := s.b.List(context.Background(), "repo/", true)
+	s.require.NoError(err)
+
+	s.Equal([]string{"repo/7/x86_64/a.rpm", "repo/7/x86_64/b.rpm", "repo/7/x86_64/repodata/x.xml",
+		"repo/8/x86_64/c.rpm", "repo/index.html"}, s.keys(listing))
+	s.Len(listing.Prefixes, 0)
+
+	obj := listing.Objects[0]
+	s.Equal(int64(100), obj.Size)
+	s.Equal(fmt.Sprintf("\"%x\"", md5.Sum(make([]byte, 100))), obj.ETag)
+	s.False(obj.LastModified.IsZero())
+}
+
+func (s *ListingSuite) TestListingGroupsKeysByDirectory() {
+	listing, err := s.b.List(context.Background(), "repo/", false)
+	s.require.NoError(err)
+
+	s.Equal([]string{"repo/index.html"}, s.keys(listing))
+	s.Equal([]string{"repo/7/", "repo/8/"}, listing.Prefixes)
+
+	listing, err = s.b.List(context.Background(), "", false)
+	s.require.NoError(err)
+	s.Len(listing.Objects, 0)
+	s.Equal([]string{"other/", "repo/"}, listing.Prefixes)
+}
+
+func (s *ListingSuite) TestListingMissingPrefixIsEmpty() {
+	listing, err := s.b.List(context.Background(), "missing/", true)
+	s.require.NoError(err)
+	s.Len(listing.Objects, 0)
+	s.Len(listing.Prefixes, 0)
+}
+
+func (s *ListingSuite) TestDiskUsageAggregatesToDepth() {
+	usage, err := s.b.DiskUsage(context.Background(), "repo/", 0)
+	s.require.NoError(err)
+	s.Equal([]PrefixUsage{{Prefix: "repo/", Objects: 5, Size: 1315}}, usage)
+
+	usage, err = s.b.DiskUsage(context.Background(), "repo", 1)
+	s.require.NoError(err)
+	s.Equal([]PrefixUsage{
+		{Prefix: "repo", Objects: 1, Size: 10},
+		{Prefix: "repo/7/", Objects: 3, Size: 305},
+		{Prefix: "repo/8/", Objects: 1, Size: 1000},
+	}, usage)
+
+	usage, err = s.b.DiskUsage(context.Background(), "", 3)
+	s.require.NoError(err)
+	s.Equal([]PrefixUsage{
+		{Prefix: "other/", Objects: 1, Size: 1},
+		{Prefix: "repo/", Objects: 1, Size: 10},
+		{Prefix: "repo/7/x86_64/", Objects: 3, Size: 305},
+		{Prefix: "repo/8/x86_64/", Objects: 1, Size: 1000},
+	}, usage)
+
+	_, err = s.b.DiskUsage(context.Background(), "", -1)
+	s.Error(err)
+}
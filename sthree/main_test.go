@@ -0,0 +1,29 @@
+package sthree
+
+import (
+	"os"
+	"testing"
+
+	"github.com/mongodb/curator/sthree/fakes3"
+	"github.com/tychoish/grip"
+)
+
+// TestMain runs the tests in this package against an in-process fake
+// S3 server. Set the CURATOR_TEST_AWS environment variable to run the
+// tests against S3, using the default credentials.
+func TestMain(m *testing.M) {
+	srv, auth, region := fakes3.StartTestServer()
+	if srv == nil {
+		os.Exit(m.Run())
+	}
+
+	// the registry tests expect to find credentials in the environment.
+	grip.CatchError(os.Setenv("AWS_ACCESS_KEY_ID", auth.AccessKey))
+	grip.CatchError(os.Setenv("AWS_SECRET_ACCESS_KEY", auth.SecretKey))
+
+	SetCredentials(AWSConnectionConfiguration{Auth: auth, Region: region})
+
+	code := m.Run()
+	srv.Close()
+	os.Exit(code)
+}
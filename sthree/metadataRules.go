@@ -0,0 +1,131 @@
+package sthree
+
+import (
+	"strings"
+
+	"github.com/goamz/goamz/s3"
+	"github.com/pkg/errors"
+	"github.com/tychoish/grip"
+)
+
+// MetadataRule sets the headers, user metadata, and encryption of
+// uploaded objects with keys that match the pattern. Patterns are
+// globs, with the same syntax as Filter.Include, that match the
+// entire key of the object: "*.rpm" matches all RPM packages, and
+// "repodata/repomd.xml" only matches the file at the top of the
+// bucket.
+//
+// Empty fields do not change the object: the content type defaults
+// to the type for the extension of the file. Meta holds user metadata
+// fields, without the "x-amz-meta-" prefix, and SSE enables
+// server-side encryption with S3-managed keys.
+type MetadataRule struct {
+	Pattern            string            `bson:"pattern" json:"pattern" yaml:"pattern"`
+	ContentType        string            `bson:"content_type,omitempty" json:"content_type,omitempty" yaml:"content_type,omitempty"`
+	CacheControl       string            `bson:"cache_control,omitempty" json:"cache_control,omitempty" yaml:"cache_control,omitempty"`
+	ContentEncoding    string            `bson:"content_encoding,omitempty" json:"content_encoding,omitempty" yaml:"content_encoding,omitempty"`
+	ContentDisposition string            `bson:"content_disposition,omitempty" json:"content_disposition,omitempty" yaml:"content_disposition,omitempty"`
+	Meta               map[string]string `bson:"meta,omitempty" json:"meta,omitempty" yaml:"meta,omitempty"`
+	SSE                bool              `bson:"sse,omitempty" json:"sse,omitempty" yaml:"sse,omitempty"`
+}
+
+// Validate returns an error if the pattern of the rule is not a valid
+// glob, or if the rule sets user metadata that curator reserves.
+func (r MetadataRule) Validate() error {
+	catcher := grip.NewCatcher()
+
+	if _, err := newGlobRule(r.Pattern); err != nil {
+		catcher.Add(errors.Wrap(err, "invalid metadata rule"))
+	}
+
+	for key := range r.Meta {
+		name := strings.ToLower(key)
+		switch {
+		case name == "":
+			catcher.Add(errors.Errorf("metadata rule '%s' has an empty metadata field name", r.Pattern))
+		case name == mtimeMetadataKey, name == checksumMetadataKey:
+			catcher.Add(errors.Errorf("metadata rule '%s' cannot set the '%s' field, which curator uses",
+				r.Pattern, name))
+		case strings.ContainsAny(name, " :\t\r\n"):
+			catcher.Add(errors.Errorf("metadata rule '%s' has an invalid field name '%s'", r.Pattern, key))
+		}
+	}
+
+	return catcher.Resolve()
+}
+
+type metadataRule struct {
+	MetadataRule
+	glob *globRule
+}
+
+// SetMetadataRules sets the rules that Put, and therefore SyncTo,
+// uses to determine the headers and metadata of uploaded objects. All
+// rules that match a key apply in order, so later rules override the
+// fields that earlier rules set, and user metadata from all matching
+// rules is merged. Returns an error, and does not change the rules of
+// the bucket, if any rule is not valid. Server-side copies keep the
+// metadata of the source object.
+func (b *Bucket) SetMetadataRules(rules []MetadataRule) error {
+	catcher := grip.NewCatcher()
+	compiled := make([]*metadataRule, 0, len(rules))
+
+	for _, rule := range rules {
+		if err := rule.Validate(); err != nil {
+			catcher.Add(err)
+			continue
+		}
+
+		glob, _ := newGlobRule(rule.Pattern)
+		compiled = append(compiled, &metadataRule{MetadataRule: rule, glob: glob})
+	}
+
+	if catcher.HasErrors() {
+		return catcher.Resolve()
+	}
+
+	b.metadata = compiled
+	return nil
+}
+
+// MetadataRules returns the metadata rules of the bucket.
+func (b *Bucket) MetadataRules() []MetadataRule {
+	rules := make([]MetadataRule, 0, len(b.metadata))
+	for _, rule := range b.metadata {
+		rules = append(rules, rule.MetadataRule)
+	}
+
+	return rules
+}
+
+// uploadOptions returns the content type and upload options for the
+// key, given the content type for the extension of the file, by
+// applying the bucket's metadata rules.
+func (b *Bucket) uploadOptions(key, contentType string) (string, UploadOptions) {
+	opts := UploadOptions{Options: s3.Options{Meta: map[string][]string{}}}
+
+	for _, rule := range b.metadata {
+		if !rule.glob.match(strings.TrimPrefix(key, "/")) {
+			continue
+		}
+
+		if rule.ContentType != "" {
+			contentType = rule.ContentType
+		}
+		if rule.CacheControl != "" {
+			opts.CacheControl = rule.CacheControl
+		}
+		if rule.ContentEncoding != "" {
+			opts.ContentEncoding = rule.ContentEncoding
+		}
+		if rule.ContentDisposition != "" {
+			opts.ContentDisposition = rule.ContentDisposition
+		}
+		for k, v := range rule.Meta {
+			opts.Meta[strings.ToLower(k)] = []string{v}
+		}
+		opts.SSE = opts.SSE || rule.SSE
+	}
+
+	return contentType, opts
+}
@@ -0,0 +1,166 @@
+package sthree
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/goamz/goamz/aws"
+	"github.com/goamz/goamz/s3"
+	"github.com/mongodb/curator/sthree/fakes3"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+// MetadataRulesSuite tests the headers and metadata that uploads set
+// on objects, using a fake S3 server.
+type MetadataRulesSuite struct {
+	srv     *fakes3.Server
+	b       *Bucket
+	tempDir string
+	require *require.Assertions
+	suite.Suite
+}
+
+func TestMetadataRulesSuite(t *testing.T) {
+	suite.Run(t, new(MetadataRulesSuite))
+}
+
+func (s *MetadataRulesSuite) SetupSuite() {
+	s.require = s.Require()
+}
+
+func (s *MetadataRulesSuite) SetupTest() {
+	tempDir, err := ioutil.TempDir("", uuid.NewV4().String())
+	s.require.NoError(err)
+	s.tempDir = tempDir
+
+	s.srv = fakes3.NewServer()
+	auth := aws.Auth{AccessKey: "fake", SecretKey: "fake"}
+
+	s.b = &Bucket{
+		name:    "metadata",
+		retry:   RetryPolicy{MaxAttempts: 1},
+		storage: NewS3Storage(s3.New(auth, s.srv.Region()).Bucket("metadata")),
+	}
+
+	s.require.NoError(s.b.SetMetadataRules([]MetadataRule{
+		{Pattern: "*", CacheControl: "max-age=300", Meta: map[string]string{"Team": "build"}},
+		{Pattern: "*.rpm", CacheControl: "max-age=604800", ContentDisposition: "attachment", SSE: true},
+		{Pattern: "repodata/*.xml.gz", ContentType: "application/x-gzip", ContentEncoding: "identity",
+			Meta: map[string]string{"kind": "repodata"}},
+	}))
+}
+
+func (s *MetadataRulesSuite) TearDownTest() {
+	s.srv.Close()
+	s.NoError(os.RemoveAll(s.tempDir))
+}
+
+func (s *MetadataRulesSuite) writeFile(name string, data []byte) string {
+	fileName := filepath.Join(s.tempDir, name)
+	s.require.NoError(ioutil.WriteFile(fileName, data, 0644))
+	return fileName
+}
+
+func (s *MetadataRulesSuite) head(key string) *ObjectInfo {
+	info, err := s.b.storage.Head(key)
+	s.require.NoError(err)
+	s.require.NotNil(info)
+	return info
+}
+
+func (s *MetadataRulesSuite) TestRulesApplyInOrder() {
+	contentType, opts := s.b.uploadOptions("repo/x86_64/package.rpm",
+		"application/x-redhat-package-manager")
+	s.Equal("application/x-redhat-package-manager", contentType)
+	s.Equal("max-age=604800", opts.CacheControl)
+	s.Equal("attachment", opts.ContentDisposition)
+	s.True(opts.SSE)
+	s.Equal([]string{"build"}, opts.Meta["team"])
+
+	contentType, opts = s.b.uploadOptions("repodata/primary.xml.gz", "text/plain")
+	s.Equal("application/x-gzip", contentType)
+	s.Equal("max-age=300", opts.CacheControl)
+	s.Equal("identity", opts.ContentEncoding)
+	s.False(opts.SSE)
+	s.Equal([]string{"repodata"}, opts.Meta["kind"])
+	s.Equal([]string{"build"}, opts.Meta["team"])
+
+	// anchored patterns only match from the start of the key.
+	contentType, opts = s.b.uploadOptions("repo/repodata/primary.xml.gz", "text/plain")
+	s.Equal("text/plain", contentType)
+	s.Equal("", opts.ContentEncoding)
+	s.Len(opts.Meta, 1)
+}
+
+func (s *MetadataRulesSuite) TestPutSetsHeaders() {
+	fileName := s.writeFile("package.rpm", []byte("rpm"))
+	s.require.NoError(s.b.Put(context.Background(), fileName, "repo/package.rpm"))
+
+	info := s.head("repo/package.rpm")
+	s.Equal("max-age=604800", info.CacheControl)
+	s.Equal("attachment", info.ContentDisposition)
+	s.Equal("application/x-redhat-package-manager", info.ContentType)
+	s.Equal("build", info.Meta["team"])
+	_, ok := info.ModTime()
+	s.True(ok)
+}
+
+func (s *MetadataRulesSuite) TestMultipartUploadsSetHeaders() {
+	s.require.NoError(s.b.SetMultipartThreshold(minPartSize))
+	s.require.NoError(s.b.SetPartSize(minPartSize))
+
+	data := make([]byte, minPartSize+1024)
+	_, err := rand.Read(data)
+	s.require.NoError(err)
+	fileName := s.writeFile("large.rpm", data)
+
+	s.require.NoError(s.b.Put(context.Background(), fileName, "large.rpm"))
+	info := s.head("large.rpm")
+	s.Equal("max-age=604800", info.CacheControl)
+	s.Equal("attachment", info.ContentDisposition)
+	s.Equal("build", info.Meta["team"])
+	_, ok := info.ModTime()
+	s.True(ok)
+
+	out := filepath.Join(s.tempDir, "out.rpm")
+	s.require.NoError(s.b.Get(context.Background(), "large.rpm", out))
+	downloaded, err := ioutil.ReadFile(out)
+	s.require.NoError(err)
+	s.True(bytes.Equal(data, downloaded))
+
+	// without rules, objects keep their multipart etag.
+	s.require.NoError(s.b.SetMetadataRules(nil))
+	s.require.NoError(s.b.Put(context.Background(), fileName, "plain.rpm"))
+	s.True(strings.HasSuffix(s.head("plain.rpm").ETag, "-2\""))
+	s.Equal("", s.head("plain.rpm").CacheControl)
+}
+
+func (s *MetadataRulesSuite) TestInvalidRulesAreRejected() {
+	for _, rule := range []MetadataRule{
+		{Pattern: ""},
+		{Pattern: "[*.rpm"},
+		{Pattern: "*.rpm", Meta: map[string]string{"": "value"}},
+		{Pattern: "*.rpm", Meta: map[string]string{"Curator-Mtime": "0"}},
+		{Pattern: "*.rpm", Meta: map[string]string{"has space": "value"}},
+	} {
+		s.Error(rule.Validate(), rule.Pattern)
+		s.Error(s.b.SetMetadataRules([]MetadataRule{{Pattern: "*.deb"}, rule}))
+	}
+
+	// failed updates do not change the rules.
+	s.Len(s.b.MetadataRules(), 3)
+}
+
+func (s *MetadataRulesSuite) TestClonesKeepRules() {
+	clone, err := s.b.Clone()
+	s.require.NoError(err)
+	s.Equal(s.b.MetadataRules(), clone.MetadataRules())
+}
@@ -0,0 +1,383 @@
+package sthree
+
+import (
+	"crypto/md5"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/goamz/goamz/s3"
+	"github.com/pkg/errors"
+	"github.com/tychoish/grip"
+	"golang.org/x/net/context"
+)
+
+const (
+	// minPartSize is the smallest size that S3 accepts for parts,
+	// other than the last part, of a multipart upload.
+	minPartSize = 5 * 1024 * 1024
+
+	// maxParts is the largest number of parts that S3 accepts for
+	// a single multipart upload.
+	maxParts = 10000
+
+	// defaultMultipartThreshold is the file size above which Put
+	// uses multipart uploads, for new buckets.
+	defaultMultipartThreshold = 64 * 1024 * 1024
+
+	// defaultPartSize is the size of parts for new buckets.
+	defaultPartSize = 16 * 1024 * 1024
+
+	// partConcurrency is the number of parts of a single file
+	// that Put uploads in parallel. Sync operations run several
+	// Put operations in parallel, so this number is small.
+	partConcurrency = 4
+
+	// staleUploadAge is the age of incomplete multipart uploads
+	// that Put aborts before uploading a file to the same key.
+	// Younger uploads may belong to other processes that are
+	// uploading the key at the same time.
+	staleUploadAge = 24 * time.Hour
+)
+
+// commonPartSizes are the part sizes, in megabytes, that popular S3
+// clients use for multipart uploads. Sync operations use these sizes,
+// in addition to the bucket's own part size, to compute the checksums
+// of local files for comparison with the ETags of multipart objects.
+var commonPartSizes = []int64{5, 8, 10, 15, 16, 25, 32, 50, 64, 100, 128, 256, 512, 1024}
+
+// SetMultipartThreshold sets the file size, in bytes, above which Put
+// (and therefore SyncTo) uploads files in parts, if the bucket's
+// storage supports multipart uploads. A threshold of 0 disables
+// multipart uploads.
+func (b *Bucket) SetMultipartThreshold(size int64) error {
+	if size < 0 {
+		return errors.Errorf("multipartThreshold=%d, must not be negative", size)
+	}
+
+	b.multipartThreshold = size
+	return nil
+}
+
+// SetPartSize sets the size, in bytes, of the parts of multipart
+// uploads. S3 requires parts of at least 5 MB. For very large files,
+// Put uses larger parts as needed to stay within the S3 limit of
+// 10,000 parts per upload.
+func (b *Bucket) SetPartSize(size int64) error {
+	if size < minPartSize {
+		return errors.Errorf("partSize=%d, must be at least %d", size, minPartSize)
+	}
+
+	b.partSize = size
+	return nil
+}
+
+// useMultipart returns the multipart implementation of the bucket's
+// storage, if the file is large enough to need a multipart upload and
+// the storage supports them.
+func (b *Bucket) useMultipart(size int64) (MultipartStorage, bool) {
+	if b.multipartThreshold <= 0 || size < b.multipartThreshold {
+		return nil, false
+	}
+
+	mp, ok := b.storage.(MultipartStorage)
+	return mp, ok
+}
+
+// getPartSize returns the part size for a file of the specified
+// size.
+func (b *Bucket) getPartSize(size int64) int64 {
+	partSize := b.partSize
+	if partSize < minPartSize {
+		partSize = minPartSize
+	}
+
+	if min := (size + maxParts - 1) / maxParts; partSize < min {
+		partSize = min
+	}
+
+	return partSize
+}
+
+// putMultipart uploads the file in parts, in parallel. Each part, and
+// each request that starts, completes, or aborts the upload, has its
+// own retry loop, so a failure only requires repeating that request
+// rather than uploading the entire file again. If the upload fails,
+// putMultipart aborts it, so that the uploaded parts do not remain in
+// the bucket, which includes uploads that fail because the context is
+// canceled.
+func (b *Bucket) putMultipart(ctx context.Context, mp MultipartStorage, fileName, path string,
+	size int64, mimeType string, opts UploadOptions) error {
+	b.abortStaleUploads(ctx, mp, path, time.Now().Add(-staleUploadAge))
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return errors.Wrapf(err, "error opening file '%s' before s3.Put", fileName)
+	}
+	defer f.Close()
+
+	var upload MultipartUpload
+	op := fmt.Sprintf("start multipart upload for %s/%s", b.name, path)
+	err = b.withRetries(ctx, op, func() error {
+		var err error
+		upload, err = mp.InitMultipart(path, mimeType, b.permission(path), opts)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	partSize := b.getPartSize(size)
+	numParts := int((size + partSize - 1) / partSize)
+	if numParts == 0 {
+		numParts = 1
+	}
+
+	grip.Debugf("uploading %s -> %s/%s in %d parts", fileName, b.name, path, numParts)
+
+	parts := make([]s3.Part, numParts)
+	catcher := grip.NewCatcher()
+	partNumbers := make(chan int, numParts)
+	for n := 0; n < numParts; n++ {
+		partNumbers <- n
+	}
+	close(partNumbers)
+
+	wg := &sync.WaitGroup{}
+	for w := 0; w < partConcurrency && w < numParts; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range partNumbers {
+				// stop uploading parts once any part has
+				// failed, as the upload will be aborted.
+				if catcher.HasErrors() {
+					return
+				}
+
+				offset := int64(n) * partSize
+				length := partSize
+				if offset+length > size {
+					length = size - offset
+				}
+
+				part, err := b.putPart(ctx, upload, n+1, io.NewSectionReader(f, offset, length))
+				if err != nil {
+					catcher.Add(err)
+					return
+				}
+				parts[n] = part
+			}
+		}()
+	}
+	wg.Wait()
+
+	if !catcher.HasErrors() {
+		op = fmt.Sprintf("complete multipart upload for %s/%s", b.name, path)
+		catcher.Add(b.withRetries(ctx, op, func() error { return upload.Complete(parts) }))
+	}
+
+	if catcher.HasErrors() {
+		// abort the upload even if the context is canceled, as
+		// its parts would otherwise remain in the bucket.
+		op = fmt.Sprintf("abort multipart upload for %s/%s", b.name, path)
+		grip.CatchWarning(b.withRetries(context.Background(), op, upload.Abort))
+
+		if err = ctx.Err(); err != nil {
+			return errors.Wrapf(err, "multipart upload of %s/%s canceled", b.name, path)
+		}
+
+		return catcher.Resolve()
+	}
+
+	return nil
+}
+
+// putPart uploads a single part of a multipart upload, in a retry
+// loop.
+func (b *Bucket) putPart(ctx context.Context, upload MultipartUpload, n int,
+	r io.ReadSeeker) (s3.Part, error) {
+	if err := ctx.Err(); err != nil {
+		return s3.Part{}, errors.Wrapf(err, "upload of part %d of %s/%s canceled", n, b.name,
+			upload.Key())
+	}
+
+	r = b.transferReadSeeker(ctx, r)
+
+	var part s3.Part
+	op := fmt.Sprintf("upload part %d of %s/%s", n, b.name, upload.Key())
+	err := b.withRetries(ctx, op, func() error {
+		var err error
+		part, err = upload.PutPart(n, r)
+		return err
+	})
+
+	return part, err
+}
+
+// abortStaleUploads aborts incomplete multipart uploads for the key
+// that started before the cutoff, which remain in the bucket, and
+// incur storage costs, when a process exits before completing or
+// aborting an upload. Errors are logged but not returned, as they do
+// not prevent a new upload.
+func (b *Bucket) abortStaleUploads(ctx context.Context, mp MultipartStorage, path string,
+	cutoff time.Time) {
+	var uploads []MultipartUpload
+	op := fmt.Sprintf("list multipart uploads for %s/%s", b.name, path)
+	err := b.withRetries(ctx, op, func() error {
+		var err error
+		uploads, err = mp.ListMultipart(path)
+		return err
+	})
+	if err != nil {
+		grip.Warning(err)
+		return
+	}
+
+	for _, upload := range uploads {
+		if upload.Key() != path || !upload.Initiated().Before(cutoff) {
+			continue
+		}
+
+		grip.Noticef("aborting stale multipart upload for %s/%s, started at %s",
+			b.name, path, upload.Initiated())
+		op = fmt.Sprintf("abort stale multipart upload for %s/%s", b.name, path)
+		grip.CatchWarning(b.withRetries(ctx, op, upload.Abort))
+	}
+}
+
+// parseMultipartETag returns the number of parts of an object with
+// the specified ETag, which has the "<md5 of part md5s>-<parts>" form
+// for objects uploaded in parts. Returns false for all other ETags.
+func parseMultipartETag(etag string) (int, bool) {
+	idx := strings.LastIndex(etag, "-")
+	if idx < 0 {
+		return 0, false
+	}
+
+	numParts, err := strconv.Atoi(etag[idx+1:])
+	if err != nil || numParts < 1 {
+		return 0, false
+	}
+
+	return numParts, true
+}
+
+// multipartChecksum returns the ETag that S3 would report, without
+// quotes, for the file if it were uploaded in parts of partSize.
+func multipartChecksum(fileName string, partSize int64) (string, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return "", errors.Wrapf(err, "problem opening '%s'", fileName)
+	}
+	defer f.Close()
+
+	var digests []byte
+	numParts := 0
+	for {
+		hash := md5.New()
+		n, err := io.CopyN(hash, f, partSize)
+		if err != nil && err != io.EOF {
+			return "", errors.Wrapf(err, "problem reading '%s'", fileName)
+		}
+
+		if n > 0 || numParts == 0 {
+			digests = hash.Sum(digests)
+			numParts++
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return fmt.Sprintf("%x-%d", md5.Sum(digests), numParts), nil
+}
+
+// candidatePartSizes returns the part sizes, starting with the part
+// size that this bucket would use, that split a file of the specified
+// size into numParts parts.
+func (b *Bucket) candidatePartSizes(size int64, numParts int) []int64 {
+	var out []int64
+	seen := make(map[int64]bool)
+
+	sizes := []int64{b.getPartSize(size)}
+	for _, mb := range commonPartSizes {
+		sizes = append(sizes, mb*1024*1024)
+	}
+
+	for _, partSize := range sizes {
+		if seen[partSize] {
+			continue
+		}
+		seen[partSize] = true
+
+		n := (size + partSize - 1) / partSize
+		if n == 0 {
+			n = 1
+		}
+
+		if n == int64(numParts) {
+			out = append(out, partSize)
+		}
+	}
+
+	return out
+}
+
+// checksum returns the checksum of the local file in the same form as
+// the (unquoted) ETag of the remote object, so that sync operations
+// can compare them directly. For objects uploaded in a single request
+// the checksum is the MD5 of the file. For objects uploaded in parts,
+// the ETag depends on the part size, which S3 does not report, so
+// checksum tries the part sizes that would produce the same number of
+// parts, and returns the first match, if any. Checksums come from,
+// and are added to, the cache, which may be nil.
+func (b *Bucket) checksum(fileName string, info os.FileInfo, etag string,
+	cache *checksumCache) (string, error) {
+	numParts, ok := parseMultipartETag(etag)
+	if !ok {
+		if sum, ok := cache.get(fileName, info, 0); ok {
+			return sum, nil
+		}
+
+		sum, err := md5sum(fileName)
+		if err != nil {
+			return "", err
+		}
+
+		cache.set(fileName, info, 0, sum)
+		return sum, nil
+	}
+
+	candidates := b.candidatePartSizes(info.Size(), numParts)
+	if len(candidates) == 0 {
+		// the file cannot have the same content as the
+		// object, so the checksum of the file doesn't matter.
+		return b.checksum(fileName, info, "", cache)
+	}
+
+	var sum string
+	var err error
+	for _, partSize := range candidates {
+		var ok bool
+		sum, ok = cache.get(fileName, info, partSize)
+		if !ok {
+			sum, err = multipartChecksum(fileName, partSize)
+			if err != nil {
+				return "", err
+			}
+			cache.set(fileName, info, partSize, sum)
+		}
+
+		if sum == etag {
+			break
+		}
+	}
+
+	return sum, nil
+}
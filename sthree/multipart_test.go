@@ -0,0 +1,346 @@
+package sthree
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goamz/goamz/aws"
+	"github.com/goamz/goamz/s3"
+	"github.com/mongodb/curator/sthree/fakes3"
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+// MultipartSuite tests multipart uploads, using a dedicated fake S3
+// server so that tests can inspect incomplete uploads and inject
+// errors.
+type MultipartSuite struct {
+	srv     *fakes3.Server
+	b       *Bucket
+	tempDir string
+	large   string
+	data    []byte
+	require *require.Assertions
+	suite.Suite
+}
+
+func TestMultipartSuite(t *testing.T) {
+	suite.Run(t, new(MultipartSuite))
+}
+
+func (s *MultipartSuite) SetupSuite() {
+	s.require = s.Require()
+
+	tempDir, err := ioutil.TempDir("", uuid.NewV4().String())
+	s.require.NoError(err)
+	s.tempDir = tempDir
+
+	// two full parts and a short final part.
+	s.data = make([]byte, 2*minPartSize+1024)
+	_, err = rand.Read(s.data)
+	s.require.NoError(err)
+
+	s.large = filepath.Join(s.tempDir, "large.tgz")
+	s.require.NoError(ioutil.WriteFile(s.large, s.data, 0644))
+}
+
+func (s *MultipartSuite) TearDownSuite() {
+	s.NoError(os.RemoveAll(s.tempDir))
+}
+
+func (s *MultipartSuite) SetupTest() {
+	s.srv = fakes3.NewServer()
+	auth := aws.Auth{AccessKey: "fake", SecretKey: "fake"}
+
+	s.b = &Bucket{
+		name:    "multipart",
+		retry:   RetryPolicy{MaxAttempts: 3},
+		storage: NewS3Storage(s3.New(auth, s.srv.Region()).Bucket("multipart")),
+	}
+	s.require.NoError(s.b.SetMultipartThreshold(minPartSize))
+	s.require.NoError(s.b.SetPartSize(minPartSize))
+}
+
+func (s *MultipartSuite) TearDownTest() {
+	s.srv.Close()
+}
+
+func (s *MultipartSuite) etag(key string) string {
+	resp, err := s.b.storage.List(key, "", "", 1)
+	s.require.NoError(err)
+	s.require.Len(resp.Contents, 1)
+
+	return resp.Contents[0].ETag
+}
+
+func (s *MultipartSuite) isPartRequest(r *http.Request) bool {
+	return r.URL.Query().Get("partNumber") != ""
+}
+
+func (s *MultipartSuite) TestLargeFilesUploadInParts() {
+	s.NoError(s.b.Put(context.Background(), s.large, "release/large.tgz"))
+
+	s.True(strings.HasSuffix(s.etag("release/large.tgz"), "-3\""))
+	s.Len(s.srv.Uploads("multipart"), 0)
+
+	dest := filepath.Join(s.tempDir, "download", "large.tgz")
+	s.NoError(s.b.Get(context.Background(), "release/large.tgz", dest))
+	data, err := ioutil.ReadFile(dest)
+	s.NoError(err)
+	s.True(bytes.Equal(s.data, data))
+}
+
+func (s *MultipartSuite) TestSmallFilesUseSinglePut() {
+	s.NoError(s.b.Put(context.Background(), "multipart.go", "small"))
+
+	data, err := ioutil.ReadFile("multipart.go")
+	s.require.NoError(err)
+	s.Equal(fmt.Sprintf("\"%x\"", md5.Sum(data)), s.etag("small"))
+}
+
+func (s *MultipartSuite) TestZeroThresholdDisablesMultipart() {
+	s.NoError(s.b.SetMultipartThreshold(0))
+	s.NoError(s.b.Put(context.Background(), s.large, "large"))
+
+	s.Equal(fmt.Sprintf("\"%x\"", md5.Sum(s.data)), s.etag("large"))
+}
+
+func (s *MultipartSuite) TestFailedPartsAreRetriedIndividually() {
+	s.srv.FailRequests(2, s.isPartRequest)
+
+	s.NoError(s.b.Put(context.Background(), s.large, "retried"))
+	s.True(strings.HasSuffix(s.etag("retried"), "-3\""))
+	s.Len(s.srv.Uploads("multipart"), 0)
+}
+
+func (s *MultipartSuite) TestFailedUploadsAreAborted() {
+	s.srv.FailRequests(100, s.isPartRequest)
+
+	s.Error(s.b.Put(context.Background(), s.large, "failed"))
+	s.Len(s.srv.Keys("multipart"), 0)
+	s.Len(s.srv.Uploads("multipart"), 0)
+}
+
+func (s *MultipartSuite) TestFailedControlRequestsAreRetried() {
+	for name, filter := range map[string]func(r *http.Request) bool{
+		"start": func(r *http.Request) bool {
+			_, ok := r.URL.Query()["uploads"]
+			return ok && r.Method == "POST"
+		},
+		"complete": func(r *http.Request) bool {
+			return r.URL.Query().Get("uploadId") != "" && r.Method == "POST"
+		},
+	} {
+		s.srv.FailRequests(2, filter)
+
+		s.NoError(s.b.Put(context.Background(), s.large, name), name)
+		s.True(strings.HasSuffix(s.etag(name), "-3\""), name)
+		s.Len(s.srv.Uploads("multipart"), 0, name)
+	}
+}
+
+func (s *MultipartSuite) TestFailedAbortsAreRetried() {
+	aborts := 0
+	s.srv.FailRequests(100, func(r *http.Request) bool {
+		if r.Method == "DELETE" && r.URL.Query().Get("uploadId") != "" {
+			aborts++
+			return aborts == 1
+		}
+		return s.isPartRequest(r)
+	})
+
+	s.Error(s.b.Put(context.Background(), s.large, "failed"))
+	s.Len(s.srv.Keys("multipart"), 0)
+	s.Len(s.srv.Uploads("multipart"), 0)
+}
+
+func (s *MultipartSuite) TestCanceledUploadsAreAborted() {
+	s.srv.FailRequests(1000, s.isPartRequest)
+	s.b.retry.MaxAttempts = 20
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := s.b.Put(ctx, s.large, "canceled")
+	s.Error(err)
+	s.Equal(context.DeadlineExceeded, errors.Cause(err))
+	s.True(time.Since(start) < 10*time.Second)
+	s.Len(s.srv.Keys("multipart"), 0)
+	s.Len(s.srv.Uploads("multipart"), 0)
+}
+
+func (s *MultipartSuite) TestStaleUploadsForKeyAreAborted() {
+	mp := s.b.storage.(MultipartStorage)
+	for _, key := range []string{"stale", "stale-but-different"} {
+		_, err := mp.InitMultipart(key, "application/x-gzip", s3.Private, UploadOptions{})
+		s.require.NoError(err)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	cutoff := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	_, err := mp.InitMultipart("stale", "application/x-gzip", s3.Private, UploadOptions{})
+	s.require.NoError(err)
+	s.Len(s.srv.Uploads("multipart"), 3)
+
+	uploads, err := mp.ListMultipart("stale")
+	s.require.NoError(err)
+	s.require.Len(uploads, 3)
+	s.True(uploads[0].Initiated().Before(cutoff))
+
+	// only the older upload for the key is stale.
+	s.b.abortStaleUploads(context.Background(), mp, "stale", cutoff)
+	s.Equal([]string{"stale", "stale-but-different"}, s.srv.Uploads("multipart"))
+}
+
+func (s *MultipartSuite) TestRecentUploadsForKeyAreNotAborted() {
+	mp := s.b.storage.(MultipartStorage)
+	_, err := mp.InitMultipart("concurrent", "application/x-gzip", s3.Private, UploadOptions{})
+	s.require.NoError(err)
+
+	s.NoError(s.b.Put(context.Background(), s.large, "concurrent"))
+	s.Equal([]string{"concurrent"}, s.srv.Uploads("multipart"))
+}
+
+func (s *MultipartSuite) TestUploadsStoreModificationTimes() {
+	s.NoError(s.b.Put(context.Background(), s.large, "mtime.tgz"))
+
+	info, err := s.b.storage.Head("mtime.tgz")
+	s.require.NoError(err)
+	s.require.NotNil(info)
+	s.True(strings.HasSuffix(info.ETag, "-3\""))
+
+	stat, err := os.Stat(s.large)
+	s.require.NoError(err)
+	mtime, ok := info.ModTime()
+	s.require.True(ok)
+	s.Equal(stat.ModTime().Unix(), mtime.Unix())
+}
+
+func (s *MultipartSuite) TestLocalStorageDoesNotUseMultipart() {
+	s.b.SetStorage(NewFileSystemStorage(filepath.Join(s.tempDir, "local")))
+
+	s.NoError(s.b.Put(context.Background(), s.large, "local.tgz"))
+	s.Equal(fmt.Sprintf("\"%x\"", md5.Sum(s.data)), s.etag("local.tgz"))
+}
+
+func (s *MultipartSuite) TestSettersValidateSizes() {
+	s.Error(s.b.SetMultipartThreshold(-1))
+	s.NoError(s.b.SetMultipartThreshold(0))
+
+	s.Error(s.b.SetPartSize(0))
+	s.Error(s.b.SetPartSize(minPartSize - 1))
+	s.NoError(s.b.SetPartSize(minPartSize * 2))
+	s.Equal(int64(minPartSize*2), s.b.partSize)
+}
+
+func (s *MultipartSuite) TestPartSizeGrowsToStayWithinPartLimit() {
+	s.Equal(int64(minPartSize), s.b.getPartSize(100))
+	s.Equal(int64(minPartSize), s.b.getPartSize(minPartSize*maxParts))
+
+	size := int64(minPartSize*maxParts + 1)
+	partSize := s.b.getPartSize(size)
+	s.True(partSize > minPartSize)
+	s.True((size+partSize-1)/partSize <= maxParts)
+}
+
+func (s *MultipartSuite) TestMultipartETagParsing() {
+	for etag, parts := range map[string]int{
+		"d41d8cd98f00b204e9800998ecf8427e-1":  1,
+		"d41d8cd98f00b204e9800998ecf8427e-12": 12,
+	} {
+		n, ok := parseMultipartETag(etag)
+		s.True(ok)
+		s.Equal(parts, n)
+	}
+
+	for _, etag := range []string{"", "d41d8cd98f00b204e9800998ecf8427e", "abc-", "abc-0", "abc-x"} {
+		_, ok := parseMultipartETag(etag)
+		s.False(ok, etag)
+	}
+}
+
+func (s *MultipartSuite) TestChecksumMatchesMultipartETags() {
+	s.NoError(s.b.Put(context.Background(), s.large, "large"))
+	etag := strings.Trim(s.etag("large"), "\"")
+
+	info, err := os.Stat(s.large)
+	s.require.NoError(err)
+	checksum, err := s.b.checksum(s.large, info, etag, nil)
+	s.NoError(err)
+	s.Equal(etag, checksum)
+
+	// objects uploaded by other clients, with other part sizes,
+	// also match.
+	s.NoError(s.b.SetPartSize(8 * 1024 * 1024))
+	s.NoError(s.b.Put(context.Background(), s.large, "large-eight"))
+	s.NoError(s.b.SetPartSize(minPartSize))
+	etag = strings.Trim(s.etag("large-eight"), "\"")
+	s.True(strings.HasSuffix(etag, "-2"))
+
+	checksum, err = s.b.checksum(s.large, info, etag, nil)
+	s.NoError(err)
+	s.Equal(etag, checksum)
+
+	// changed files do not match.
+	changed := filepath.Join(s.tempDir, "changed.tgz")
+	data := append([]byte{}, s.data...)
+	data[0]++
+	s.require.NoError(ioutil.WriteFile(changed, data, 0644))
+	changedInfo, err := os.Stat(changed)
+	s.require.NoError(err)
+	checksum, err = s.b.checksum(changed, changedInfo, etag, nil)
+	s.NoError(err)
+	s.NotEqual(etag, checksum)
+
+	// single part objects use the md5 of the file
+	checksum, err = s.b.checksum(s.large, info, "", nil)
+	s.NoError(err)
+	s.Equal(fmt.Sprintf("%x", md5.Sum(s.data)), checksum)
+}
+
+func (s *MultipartSuite) TestSyncDoesNotTransferUnchangedMultipartObjects() {
+	local := filepath.Join(s.tempDir, "sync-source")
+	s.require.NoError(os.MkdirAll(local, 0755))
+	s.require.NoError(ioutil.WriteFile(filepath.Join(local, "large.tgz"), s.data, 0644))
+
+	s.b.numJobs = 2
+	s.require.NoError(s.b.Open(context.Background()))
+	defer s.b.Close()
+
+	_, err := s.b.SyncTo(context.Background(), local, "sync", false)
+	s.NoError(err)
+	first := s.b.contents(context.Background(), "sync")["sync/large.tgz"]
+	s.True(strings.HasSuffix(first.ETag, "-3\""))
+
+	time.Sleep(10 * time.Millisecond)
+	_, err = s.b.SyncTo(context.Background(), local, "sync", false)
+	s.NoError(err)
+	s.Equal(first.LastModified,
+		s.b.contents(context.Background(), "sync")["sync/large.tgz"].LastModified)
+
+	// sync back into the source directory, which should not
+	// replace the file.
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	fileName := filepath.Join(local, "large.tgz")
+	s.require.NoError(os.Chtimes(fileName, past, past))
+	_, err = s.b.SyncFrom(context.Background(), local, "sync", false)
+	s.NoError(err)
+	info, err := os.Stat(fileName)
+	s.require.NoError(err)
+	s.True(past.Equal(info.ModTime()))
+}
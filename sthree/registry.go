@@ -1,12 +1,15 @@
 package sthree
 
 import (
-	"os"
+	"net/url"
+	"path/filepath"
+	"reflect"
 	"runtime"
 	"sync"
 
 	"github.com/goamz/goamz/aws"
 	"github.com/goamz/goamz/s3"
+	"github.com/pkg/errors"
 	"github.com/tychoish/grip"
 )
 
@@ -19,9 +22,10 @@ var buckets *bucketRegistry
 // "buckets" instance, but the methods "SetCredentials" and
 // "GetBucket" provide public wrappers around/for the global registry.
 type bucketRegistry struct {
-	m map[string]*Bucket
-	l sync.Mutex
-	c AWSConnectionConfiguration
+	m        map[string]*Bucket
+	l        sync.Mutex
+	c        AWSConnectionConfiguration
+	profiles map[string]CredentialProvider
 }
 
 func init() {
@@ -33,23 +37,17 @@ func init() {
 
 func newBucketRegistry() *bucketRegistry {
 	return &bucketRegistry{
-		m: make(map[string]*Bucket),
-		c: AWSConnectionConfiguration{},
+		m:        make(map[string]*Bucket),
+		c:        AWSConnectionConfiguration{},
+		profiles: make(map[string]CredentialProvider),
 	}
 }
 
 func (r *bucketRegistry) init() {
-	auth, err := aws.EnvAuth()
-	grip.CatchDebug(err)
-	if err != nil {
-		auth, err = aws.SharedAuth()
-		grip.CatchWarning(err)
-	}
-
 	r.l.Lock()
 	defer r.l.Unlock()
 
-	r.c.Auth = auth
+	r.c.Credentials = DefaultCredentials("")
 	r.c.Region = aws.USEast
 }
 
@@ -58,7 +56,9 @@ func (r *bucketRegistry) init() {
 // read the AWS_ACCESS_KEY_ID and AWS_ACCESS_KEY environment variables
 // and then fall back to reading from the "$HOME/.aws/credentials"
 // file (using the "default" profile unless the AWS_PROFILE
-// environment variable is set.)
+// environment variable is set), and then to the instance metadata
+// service (see DefaultCredentials.) If the configuration does not
+// specify a region or an endpoint, the existing values are retained.
 func SetCredentials(c AWSConnectionConfiguration) {
 	buckets.setCredentials(c)
 }
@@ -71,9 +71,59 @@ func (r *bucketRegistry) setCredentials(c AWSConnectionConfiguration) {
 		c.Region = r.c.Region
 	}
 
+	if c.Endpoint == "" {
+		c.Endpoint = r.c.Endpoint
+		c.PathStyle = r.c.PathStyle
+	}
+
 	r.c = c
 }
 
+// SetEndpoint configures the region, S3-compatible endpoint, and
+// bucket addressing style that new Bucket instances use, without
+// changing the default credentials. An empty region leaves the
+// current region unchanged, and an empty endpoint uses the standard
+// S3 endpoint for the region. Region names that AWS does not define
+// are only valid with a custom endpoint.
+func SetEndpoint(region, endpoint string, pathStyle bool) error {
+	return buckets.setEndpoint(region, endpoint, pathStyle)
+}
+
+func (r *bucketRegistry) setEndpoint(region, endpoint string, pathStyle bool) error {
+	if endpoint != "" {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return errors.Wrapf(err, "problem parsing endpoint '%s'", endpoint)
+		}
+
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.Errorf("endpoint '%s' must be an http or https url", endpoint)
+		}
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if region != "" {
+		awsRegion, ok := aws.Regions[region]
+		if !ok {
+			if endpoint == "" {
+				return errors.Errorf("'%s' is not a known aws region", region)
+			}
+			awsRegion = aws.Region{Name: region}
+		}
+		r.c.Region = awsRegion
+	}
+
+	r.c.Endpoint = endpoint
+	r.c.PathStyle = pathStyle
+
+	grip.InfoWhenf(endpoint != "", "using s3 endpoint '%s' (region=%s, path-style=%t)",
+		endpoint, r.c.Region.Name, pathStyle)
+
+	return nil
+}
+
 // GetBucket takes the name of a bucket and returns a Bucket
 // object. Creates a new Bucket object if one does not exist using the
 // default credentials (see SetCredentials) for more information.
@@ -83,34 +133,81 @@ func GetBucket(name string) *Bucket {
 
 func (r *bucketRegistry) getBucket(name string) *Bucket {
 	r.l.Lock()
-	defer r.l.Unlock()
+	creds := r.c
+	r.l.Unlock()
 
-	return r.getBucketWithCredentials(name, r.c)
+	return r.getBucketWithCredentials(name, creds)
 }
 
 // GetBucketWithProfile makes it possible to get a Bucket instance
-// that uses credentials from a non-default AWS profile.
+// that uses credentials from a non-default AWS profile. Profiles may
+// assume roles or run credential processes (see SharedCredentials),
+// and buckets for the same profile share credentials, which refresh
+// before they expire.
 func GetBucketWithProfile(name, profile string) *Bucket {
 	return buckets.getBucketFromProfile(name, profile)
 }
 
 func (r *bucketRegistry) getBucketFromProfile(name, account string) *Bucket {
+	r.l.Lock()
+	provider, ok := r.profiles[account]
+	if !ok {
+		provider = DefaultCredentials(account)
+		r.profiles[account] = provider
+	}
+
+	creds := AWSConnectionConfiguration{
+		Credentials: provider,
+		Region:      r.c.Region,
+		Endpoint:    r.c.Endpoint,
+		PathStyle:   r.c.PathStyle,
+		SignatureV4: r.c.SignatureV4,
+	}
+	r.l.Unlock()
+
+	return r.getBucketWithCredentials(name, creds)
+}
+
+// GetLocalBucket returns a Bucket instance that stores objects in
+// the local file system rather than in S3, using a directory named
+// for the bucket within the root directory. Local buckets support
+// all Bucket operations, and make it possible to build and publish
+// repositories into a directory tree for staging or for mirrors.
+func GetLocalBucket(name, root string) *Bucket {
+	return buckets.getLocalBucket(name, root)
+}
+
+func (r *bucketRegistry) getLocalBucket(name, root string) *Bucket {
 	r.l.Lock()
 	defer r.l.Unlock()
 
-	previousProfile := os.Getenv("AWS_PROFILE")
-	defer grip.CatchError(os.Setenv("AWS_PROFILE", previousProfile))
+	path := filepath.Join(root, name)
 
-	grip.CatchError(os.Setenv("AWS_PROFILE", account))
+	b, ok := r.m[name]
+	if ok {
+		if fs, isLocal := b.storage.(*fileStorage); isLocal && fs.root == path {
+			return b
+		}
+	}
 
-	auth, err := aws.SharedAuth()
-	grip.CatchWarning(err)
-	creds := AWSConnectionConfiguration{
-		Auth:   auth,
-		Region: r.c.Region,
+	b = &Bucket{
+		NewFilePermission:  s3.BucketOwnerFull,
+		storage:            NewFileSystemStorage(path),
+		name:               name,
+		numJobs:            runtime.NumCPU() * 2,
+		retry:              DefaultRetryPolicy(),
+		multipartThreshold: defaultMultipartThreshold,
+		partSize:           defaultPartSize,
 	}
 
-	return r.getBucketWithCredentials(name, creds)
+	grip.Noticef("using local storage in '%s' for bucket '%s'", path, name)
+
+	grip.WarningWhenln(ok, "overwriting previous connection to '", name,
+		"' after accessing an existing bucket with local storage.")
+
+	r.m[name] = b
+
+	return b
 }
 
 ////////////////////////////////////////////////
@@ -131,21 +228,41 @@ func (r *bucketRegistry) registerBucket(b *Bucket) {
 	r.m[b.name] = b
 }
 
+// getBucketWithCredentials returns the registered bucket with the
+// name if it uses the same connection, and otherwise creates and
+// registers a new bucket. Callers must not hold the registry's lock:
+// creating the storage retrieves credentials, which may require
+// requests to the instance metadata service or to STS.
 func (r *bucketRegistry) getBucketWithCredentials(name string, creds AWSConnectionConfiguration) *Bucket {
-	b, ok := r.m[name]
-	if ok && (b.credentials.Auth == creds.Auth && b.credentials.Region == creds.Region) {
+	r.l.Lock()
+	b := r.cachedBucket(name, creds)
+	r.l.Unlock()
+
+	if b != nil {
+		return b
+	}
+
+	storage := creds.newStorage(name)
+
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	// another caller may have created the bucket while this call
+	// retrieved credentials.
+	if b = r.cachedBucket(name, creds); b != nil {
 		return b
 	}
 
-	client := s3.New(creds.Auth, creds.Region)
+	_, ok := r.m[name]
 	b = &Bucket{
-		NewFilePermission: s3.BucketOwnerFull,
-		s3:                client,
-		bucket:            client.Bucket(name),
-		credentials:       creds,
-		name:              name,
-		numJobs:           runtime.NumCPU() * 2,
-		numRetries:        20,
+		NewFilePermission:  s3.BucketOwnerFull,
+		storage:            storage,
+		credentials:        creds,
+		name:               name,
+		numJobs:            runtime.NumCPU() * 2,
+		retry:              DefaultRetryPolicy(),
+		multipartThreshold: defaultMultipartThreshold,
+		partSize:           defaultPartSize,
 	}
 
 	grip.Noticef("creating new connection to bucket '%s'", name)
@@ -158,6 +275,47 @@ func (r *bucketRegistry) getBucketWithCredentials(name string, creds AWSConnecti
 	return b
 }
 
+// cachedBucket returns the registered S3 bucket with the name, if it
+// uses the same connection, and nil otherwise. Callers must hold the
+// registry's lock.
+func (r *bucketRegistry) cachedBucket(name string, creds AWSConnectionConfiguration) *Bucket {
+	b, ok := r.m[name]
+	if !ok || !sameConnection(b.credentials, creds) {
+		return nil
+	}
+
+	if _, isLocal := b.storage.(*fileStorage); isLocal {
+		return nil
+	}
+
+	return b
+}
+
+// sameConnection returns true if the configurations connect to S3
+// with the same settings and credential provider. Providers are the
+// same only when they are the same pointer (e.g. the providers of
+// DefaultCredentials): comparing other values with == panics for
+// providers that are not comparable, such as structs with maps.
+func sameConnection(a, b AWSConnectionConfiguration) bool {
+	pa, pb := a.Credentials, b.Credentials
+	a.Credentials, b.Credentials = nil, nil
+
+	return a == b && sameProvider(pa, pb)
+}
+
+func sameProvider(a, b CredentialProvider) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Kind() != reflect.Ptr || va.Type() != vb.Type() {
+		return false
+	}
+
+	return va.Pointer() == vb.Pointer()
+}
+
 func (r *bucketRegistry) removeBucket(b *Bucket) {
 	r.l.Lock()
 	defer r.l.Unlock()
@@ -3,12 +3,15 @@ package sthree
 import (
 	"os"
 	"testing"
+	"time"
 
 	"github.com/goamz/goamz/aws"
 	"github.com/goamz/goamz/s3"
+	"github.com/mongodb/curator/sthree/fakes3"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
 	"github.com/tychoish/grip"
+	"golang.org/x/net/context"
 )
 
 // RegistrySuite collects tests of the bucketRegistry, which provides
@@ -55,18 +58,25 @@ func (s *RegistrySuite) TestInitialStateIsEmpty() {
 
 	s.Equal(s.registry.c.Auth.AccessKey, "")
 	s.Equal(s.registry.c.Auth.SecretKey, "")
+	s.Nil(s.registry.c.Credentials)
 }
 
 func (s *RegistrySuite) TestImpactOfInitializationOperation() {
-	s.NoError(os.Setenv("AWS_PROFILE", "default"))
+	for _, name := range []string{"AWS_ACCESS_KEY_ID", "AWS_SECRET_ACCESS_KEY"} {
+		defer os.Setenv(name, os.Getenv(name))
+	}
+	s.NoError(os.Setenv("AWS_ACCESS_KEY_ID", "foo"))
+	s.NoError(os.Setenv("AWS_SECRET_ACCESS_KEY", "bar"))
+
 	s.registry.init()
 
 	s.Equal(s.registry.c.Region, aws.USEast)
+	s.Require().NotNil(s.registry.c.Credentials)
 
-	// these checks depend on having aws credentials in
-	// ~/.aws/credentials or environment variables
-	s.NotEqual("", s.registry.c.Auth.AccessKey)
-	s.NotEqual("", s.registry.c.Auth.SecretKey)
+	creds, err := s.registry.c.Credentials.Retrieve()
+	s.NoError(err)
+	s.Equal("foo", creds.AccessKey)
+	s.Equal("bar", creds.SecretKey)
 }
 
 func (s *RegistrySuite) TestSetCredentialChangesInternalValue() {
@@ -139,7 +149,7 @@ func (s *RegistrySuite) TestBucketCreationFromExistingBucket() {
 	second := b.NewBucket(name + "two")
 	defer second.Close()
 
-	s.NoError(second.Open())
+	s.NoError(second.Open(context.Background()))
 
 	s.Len(buckets.m, 2)
 	s.Equal(b.NewFilePermission, second.NewFilePermission)
@@ -156,7 +166,7 @@ func (s *RegistrySuite) TestRemoveBucketFromRegistryOnClose() {
 	b := buckets.getBucket("test")
 
 	s.Len(buckets.m, 1)
-	s.NoError(b.Open())
+	s.NoError(b.Open(context.Background()))
 	b.Close()
 	s.require.Len(s.registry.m, 0)
 }
@@ -244,3 +254,144 @@ func (s *RegistrySuite) TestGetBucketFromCacheWithProfileSet() {
 	two := GetBucketWithProfile(bucketName, "foo")
 	s.Equal(one.credentials, two.credentials)
 }
+
+func (s *RegistrySuite) TestProfilesDoNotChangeEnvironment() {
+	defer os.Setenv("AWS_PROFILE", os.Getenv("AWS_PROFILE"))
+	s.NoError(os.Setenv("AWS_PROFILE", "env"))
+
+	one := s.registry.getBucketFromProfile("one", "first")
+	two := s.registry.getBucketFromProfile("two", "second")
+	three := s.registry.getBucketFromProfile("three", "first")
+
+	s.Equal("env", os.Getenv("AWS_PROFILE"))
+	s.NotNil(one.credentials.Credentials)
+	s.NotEqual(one.credentials.Credentials, two.credentials.Credentials)
+	s.Exactly(one.credentials.Credentials, three.credentials.Credentials)
+}
+
+// test custom endpoint configuration
+
+func (s *RegistrySuite) TestSetEndpointValidatesInput() {
+	s.Error(s.registry.setEndpoint("", "not a url", true))
+	s.Error(s.registry.setEndpoint("", "ftp://example.net", true))
+	s.Error(s.registry.setEndpoint("not-a-region", "", false))
+	s.Equal(s.registry.c.Region, aws.Region{})
+	s.Equal("", s.registry.c.Endpoint)
+
+	s.NoError(s.registry.setEndpoint("us-west-2", "", false))
+	s.Equal(aws.USWest2, s.registry.c.Region)
+
+	s.NoError(s.registry.setEndpoint("on-prem", "https://objects.example.net", true))
+	s.Equal("on-prem", s.registry.c.Region.Name)
+	s.Equal("https://objects.example.net", s.registry.c.Endpoint)
+	s.True(s.registry.c.PathStyle)
+}
+
+func (s *RegistrySuite) TestSetCredentialsRetainsEndpoint() {
+	s.NoError(s.registry.setEndpoint("us-east-1", "http://localhost:9000", true))
+	s.registry.setCredentials(AWSConnectionConfiguration{
+		Auth: aws.Auth{AccessKey: "foo", SecretKey: "bar"},
+	})
+
+	s.Equal("http://localhost:9000", s.registry.c.Endpoint)
+	s.True(s.registry.c.PathStyle)
+	s.Equal(aws.USEast, s.registry.c.Region)
+}
+
+func (s *RegistrySuite) TestEndpointAddressingStyle() {
+	conf := AWSConnectionConfiguration{
+		Region:   aws.USEast,
+		Endpoint: "https://objects.example.net:9000/",
+	}
+
+	region := conf.region()
+	s.Equal("https://objects.example.net:9000", region.S3Endpoint)
+	s.Equal("https://${bucket}.objects.example.net:9000", region.S3BucketEndpoint)
+
+	conf.PathStyle = true
+	region = conf.region()
+	s.Equal("https://objects.example.net:9000", region.S3Endpoint)
+	s.Equal("", region.S3BucketEndpoint)
+
+	conf.Endpoint = ""
+	s.Equal(aws.USEast, conf.region())
+}
+
+func (s *RegistrySuite) TestBucketsUseCustomEndpoint() {
+	srv := fakes3.NewServer()
+	defer srv.Close()
+
+	s.NoError(s.registry.setEndpoint("", srv.URL(), true))
+	b := s.registry.getBucket("endpoint-test")
+	s.require.NoError(b.Open(context.Background()))
+	defer b.Close()
+
+	s.NoError(b.Put(context.Background(), "registry.go", "custom/registry.go"))
+	s.Equal([]string{"custom/registry.go"}, srv.Keys("endpoint-test"))
+}
+
+// mapCredentials is a provider that is not comparable.
+type mapCredentials map[string]string
+
+func (c mapCredentials) Retrieve() (Credentials, error) {
+	return Credentials{AccessKey: c["access"], SecretKey: c["secret"]}, nil
+}
+
+func (s *RegistrySuite) TestProvidersThatAreNotComparableDoNotPanic() {
+	creds := mapCredentials{"access": "a", "secret": "b"}
+	s.registry.setCredentials(AWSConnectionConfiguration{Credentials: creds})
+
+	var first, second *Bucket
+	s.NotPanics(func() {
+		first = s.registry.getBucket("registry-provider")
+		second = s.registry.getBucket("registry-provider")
+	})
+	s.NotNil(first)
+	s.NotNil(second)
+}
+
+func (s *RegistrySuite) TestBucketsWithTheSameProviderAreCached() {
+	provider := &Credentials{AccessKey: "a", SecretKey: "b"}
+	s.registry.setCredentials(AWSConnectionConfiguration{Credentials: provider})
+
+	first := s.registry.getBucket("registry-provider")
+	s.True(first == s.registry.getBucket("registry-provider"))
+
+	provider = &Credentials{AccessKey: "a", SecretKey: "b"}
+	s.registry.setCredentials(AWSConnectionConfiguration{Credentials: provider})
+	s.False(first == s.registry.getBucket("registry-provider"))
+}
+
+// blockingCredentials is a provider that does not return until the
+// release channel closes.
+type blockingCredentials struct {
+	started chan struct{}
+	release chan struct{}
+}
+
+func (c *blockingCredentials) Retrieve() (Credentials, error) {
+	close(c.started)
+	<-c.release
+	return Credentials{AccessKey: "a", SecretKey: "b"}, nil
+}
+
+func (s *RegistrySuite) TestRegistryDoesNotRetrieveCredentialsWithLock() {
+	provider := &blockingCredentials{started: make(chan struct{}), release: make(chan struct{})}
+	defer close(provider.release)
+
+	s.registry.setCredentials(AWSConnectionConfiguration{Credentials: provider})
+	go s.registry.getBucket("registry-blocked")
+	<-provider.started
+
+	done := make(chan struct{})
+	go func() {
+		s.registry.getLocalBucket("registry-local", os.TempDir())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		s.Fail("registry held its lock while retrieving credentials")
+	}
+}
@@ -0,0 +1,274 @@
+package sthree
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tychoish/grip"
+	"golang.org/x/net/context"
+)
+
+// RetentionPolicy determines the objects that Expire deletes. Each
+// rule is optional, and an object expires if any rule selects it:
+//
+//   - MaxAge expires objects last modified longer ago than the
+//     duration.
+//   - KeepNewest expires all but the newest KeepNewest objects of
+//     each group. With GroupBy, a regular expression, objects with
+//     names (relative to the prefix) that match the expression are in
+//     the group of their submatches, or of the whole match if the
+//     expression has no groups, and objects that do not match are not
+//     subject to the rule. Without GroupBy, all objects are in one
+//     group.
+//   - MaxSize expires the oldest objects that the other rules keep,
+//     until the total size of the remaining objects is at most MaxSize
+//     bytes.
+//
+// For example, a KeepNewest of 14 and a GroupBy of "^([^/]+)/" keeps
+// the 14 newest objects in each "directory" below the prefix.
+type RetentionPolicy struct {
+	MaxAge     time.Duration
+	KeepNewest int
+	GroupBy    string
+	MaxSize    int64
+}
+
+// Validate returns an error if the policy has no rules, has negative
+// limits, or has a grouping expression that is not valid or that has
+// no KeepNewest rule.
+func (p RetentionPolicy) Validate() error {
+	if p.MaxAge < 0 || p.KeepNewest < 0 || p.MaxSize < 0 {
+		return errors.New("retention limits must not be negative")
+	}
+
+	if p.MaxAge == 0 && p.KeepNewest == 0 && p.MaxSize == 0 {
+		return errors.New("retention policies must have a maximum age, a number of objects " +
+			"to keep, or a maximum size")
+	}
+
+	if p.GroupBy != "" {
+		if p.KeepNewest == 0 {
+			return errors.New("grouping objects requires a number of objects to keep in each group")
+		}
+
+		if _, err := regexp.Compile(p.GroupBy); err != nil {
+			return errors.Wrapf(err, "problem compiling grouping expression '%s'", p.GroupBy)
+		}
+	}
+
+	return nil
+}
+
+// expiredObject is an object that a retention policy selects, and the
+// rule that selects it.
+type expiredObject struct {
+	info   ObjectInfo
+	reason string
+}
+
+// Expire deletes the objects with the prefix that match the filter of
+// the bucket and that the retention policy selects, using as many
+// concurrent requests as the bucket has jobs. Objects modified at the
+// same time are ordered by key, so that the object with the greatest
+// key (e.g. the latest of date-named builds) is the newest. Returns a
+// report that records each object as deleted, with its size and the
+// rule that selected it ("age", "count", or "size"), or as kept. In
+// dry-run mode, the report is the plan of the operation. Returns an
+// error if the policy is not valid, if listing the objects fails, in
+// which case Expire deletes nothing, or if any deletion fails.
+func (b *Bucket) Expire(ctx context.Context, prefix string,
+	policy RetentionPolicy) (*SyncReport, error) {
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	grip.Infof("expiring objects in %s/%s", b.name, prefix)
+
+	report := newSyncReport(b, "expire", prefix)
+	listing, err := b.List(ctx, prefix, true)
+	if err != nil {
+		report.finish(ctx)
+		return report, err
+	}
+
+	var objects []ObjectInfo
+	for _, obj := range listing.Objects {
+		if !b.filter.Match(obj.Key[len(prefix):]) {
+			grip.Debugf("%s/%s does not match the filter, not expiring", b.name, obj.Key)
+			continue
+		}
+
+		objects = append(objects, obj)
+	}
+
+	expired, kept := policy.apply(prefix, objects, time.Now())
+	for _, obj := range kept {
+		report.add(SyncReportItem{Key: obj.Key, Action: SyncKeep})
+	}
+
+	err = b.deleteExpired(ctx, report, expired)
+	report.finish(ctx)
+
+	grip.Noticef("expired %d of %d objects in %s/%s", len(expired), len(objects), b.name, prefix)
+
+	return report, err
+}
+
+// apply returns the objects that the policy expires at the time, and
+// the objects that it keeps. The policy must be valid.
+func (p RetentionPolicy) apply(prefix string, objects []ObjectInfo,
+	now time.Time) ([]expiredObject, []ObjectInfo) {
+	sorted := make([]ObjectInfo, len(objects))
+	copy(sorted, objects)
+	sort.Sort(objectsByAge(sorted))
+
+	var grouping *regexp.Regexp
+	if p.GroupBy != "" {
+		grouping = regexp.MustCompile(p.GroupBy)
+	}
+
+	var expired []expiredObject
+	var kept []ObjectInfo
+	var keptSize int64
+	var full bool
+	groups := make(map[string]int)
+
+	for _, obj := range sorted {
+		var reason string
+
+		if p.MaxAge > 0 && obj.LastModified.Before(now.Add(-p.MaxAge)) {
+			reason = "age"
+		}
+
+		if p.KeepNewest > 0 {
+			group, ok := "", true
+			if grouping != nil {
+				group, ok = groupName(grouping, strings.TrimPrefix(obj.Key[len(prefix):], "/"))
+			}
+
+			if ok {
+				groups[group]++
+				if groups[group] > p.KeepNewest && reason == "" {
+					reason = "count"
+				}
+			}
+		}
+
+		// once an object does not fit, older objects do not
+		// either, so that size limits never keep an object
+		// without the newer objects.
+		if reason == "" && p.MaxSize > 0 && (full || keptSize+obj.Size > p.MaxSize) {
+			full = true
+			reason = "size"
+		}
+
+		if reason != "" {
+			expired = append(expired, expiredObject{info: obj, reason: reason})
+			continue
+		}
+
+		keptSize += obj.Size
+		kept = append(kept, obj)
+	}
+
+	return expired, kept
+}
+
+// groupName returns the group of the name, and false if the name does
+// not match the grouping expression.
+func groupName(grouping *regexp.Regexp, name string) (string, bool) {
+	match := grouping.FindStringSubmatch(name)
+	if match == nil {
+		return "", false
+	}
+
+	if len(match) == 1 {
+		return match[0], true
+	}
+
+	return strings.Join(match[1:], "\x00"), true
+}
+
+// objectsByAge sorts objects newest first.
+type objectsByAge []ObjectInfo
+
+func (o objectsByAge) Len() int      { return len(o) }
+func (o objectsByAge) Swap(i, j int) { o[i], o[j] = o[j], o[i] }
+func (o objectsByAge) Less(i, j int) bool {
+	if o[i].LastModified.Equal(o[j].LastModified) {
+		return o[i].Key > o[j].Key
+	}
+
+	return o[i].LastModified.After(o[j].LastModified)
+}
+
+// deleteExpired deletes the objects, using as many concurrent requests
+// as the bucket has jobs, and records each deletion in the report.
+func (b *Bucket) deleteExpired(ctx context.Context, report *SyncReport,
+	objects []expiredObject) error {
+	queue := make(chan expiredObject)
+	go func() {
+		defer close(queue)
+		for _, obj := range objects {
+			select {
+			case queue <- obj:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	numWorkers := b.numJobs
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+
+	catcher := grip.NewCatcher()
+	wg := &sync.WaitGroup{}
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for obj := range queue {
+				start := time.Now()
+				key := obj.info.Key
+
+				var err error
+				if b.dryRun {
+					grip.Noticef("dry-run: would delete %s/%s (%s)", b.name, key, obj.reason)
+				} else {
+					err = b.withRetries(ctx, fmt.Sprintf("expire %s/%s", b.name, key), func() error {
+						return b.storage.Delete(key)
+					})
+					catcher.Add(err)
+				}
+
+				item := SyncReportItem{
+					Key:      key,
+					Action:   SyncDelete,
+					Bytes:    obj.info.Size,
+					Duration: time.Since(start),
+					Reason:   obj.reason,
+				}
+				if err != nil {
+					item.Action = SyncFailed
+					item.Bytes = 0
+					item.Error = err.Error()
+				}
+				report.add(item)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		catcher.Add(errors.Wrapf(err, "expiring objects in %s/%s canceled", b.name, report.Prefix))
+	}
+
+	return catcher.Resolve()
+}
@@ -0,0 +1,203 @@
+package sthree
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goamz/goamz/aws"
+	"github.com/goamz/goamz/s3"
+	"github.com/mongodb/curator/sthree/fakes3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+func TestRetentionPolicyValidation(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.NoError(RetentionPolicy{MaxAge: time.Hour}.Validate())
+	assert.NoError(RetentionPolicy{KeepNewest: 3, GroupBy: `^(\w+)-`}.Validate())
+	assert.NoError(RetentionPolicy{MaxSize: 1024}.Validate())
+
+	for _, policy := range []RetentionPolicy{
+		{},
+		{GroupBy: "^builds/"},
+		{MaxAge: -time.Hour},
+		{KeepNewest: -1, MaxSize: 10},
+		{KeepNewest: 3, GroupBy: "[builds"},
+	} {
+		assert.Error(policy.Validate(), "%+v", policy)
+	}
+}
+
+func TestRetentionPolicySelectsObjects(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Date(2017, 3, 2, 12, 0, 0, 0, time.UTC)
+
+	var objects []ObjectInfo
+	for day, name := range []string{"a-1", "b-1", "a-2", "b-2", "a-3", "b-3", "other"} {
+		objects = append(objects, ObjectInfo{
+			Key:          "nightly/" + name,
+			Size:         10,
+			LastModified: now.Add(time.Duration(day-7) * 24 * time.Hour),
+		})
+	}
+
+	keys := func(policy RetentionPolicy) ([]string, []string) {
+		expired, kept := policy.apply("nightly", objects, now)
+
+		var reasons, names []string
+		for _, obj := range expired {
+			reasons = append(reasons, obj.info.Key[len("nightly/"):]+":"+obj.reason)
+		}
+		for _, obj := range kept {
+			names = append(names, obj.Key[len("nightly/"):])
+		}
+
+		return reasons, names
+	}
+
+	expired, kept := keys(RetentionPolicy{MaxAge: 4*24*time.Hour - time.Minute})
+	assert.Equal([]string{"b-2:age", "a-2:age", "b-1:age", "a-1:age"}, expired)
+	assert.Equal([]string{"other", "b-3", "a-3"}, kept)
+
+	// objects that do not match the grouping expression are not
+	// subject to the count rule.
+	expired, kept = keys(RetentionPolicy{KeepNewest: 2, GroupBy: `^(\w)-\d$`})
+	assert.Equal([]string{"b-1:count", "a-1:count"}, expired)
+	assert.Len(kept, 5)
+
+	expired, _ = keys(RetentionPolicy{KeepNewest: 4})
+	assert.Equal([]string{"a-2:count", "b-1:count", "a-1:count"}, expired)
+
+	expired, kept = keys(RetentionPolicy{MaxSize: 25, KeepNewest: 1, GroupBy: `^(\w)-`})
+	assert.Equal([]string{"other", "b-3"}, kept)
+	assert.Equal("a-3:size", expired[0])
+	assert.Equal("b-2:count", expired[1])
+
+	// objects modified at the same time are newest by key.
+	objects = []ObjectInfo{
+		{Key: "nightly/2017-03-01", LastModified: now},
+		{Key: "nightly/2017-03-02", LastModified: now},
+	}
+	expired, kept = keys(RetentionPolicy{KeepNewest: 1})
+	assert.Equal([]string{"2017-03-01:count"}, expired)
+	assert.Equal([]string{"2017-03-02"}, kept)
+}
+
+// RetentionSuite tests expiring objects with retention policies, using
+// a fake S3 server.
+type RetentionSuite struct {
+	srv     *fakes3.Server
+	s3      *s3.Bucket
+	b       *Bucket
+	require *require.Assertions
+	suite.Suite
+}
+
+func TestRetentionSuite(t *testing.T) {
+	suite.Run(t, new(RetentionSuite))
+}
+
+func (s *RetentionSuite) SetupSuite() {
+	s.require = s.Require()
+}
+
+func (s *RetentionSuite) SetupTest() {
+	s.srv = fakes3.NewServer()
+	auth := aws.Auth{AccessKey: "fake", SecretKey: "fake"}
+	s.s3 = s3.New(auth, s.srv.Region()).Bucket("retention")
+
+	s.b = &Bucket{
+		name:    "retention",
+		numJobs: 2,
+		retry:   RetryPolicy{MaxAttempts: 1},
+		storage: NewS3Storage(s.s3),
+	}
+	s.require.NoError(s.b.Open(context.Background()))
+
+	for _, key := range []string{"builds/1.tgz", "builds/2.tgz", "builds/3.txt", "other"} {
+		s.require.NoError(s.s3.Put(key, []byte(key), "text/plain", s3.Private, s3.Options{}))
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func (s *RetentionSuite) TearDownTest() {
+	s.b.Close()
+	s.srv.Close()
+}
+
+func (s *RetentionSuite) TestExpireKeepsNewestObjects() {
+	report, err := s.b.Expire(context.Background(), "builds/", RetentionPolicy{KeepNewest: 1})
+	s.require.NoError(err)
+	s.Equal("expire", report.Operation)
+	s.Equal(2, report.Count(SyncDelete))
+	s.Equal(1, report.Count(SyncKeep))
+	s.Equal(int64(24), report.Bytes())
+	s.Equal("count", report.Items[0].Reason)
+
+	s.Equal([]string{"builds/3.txt", "other"}, s.srv.Keys("retention"))
+}
+
+func (s *RetentionSuite) TestExpireWithOneRequestAtATime() {
+	s.require.NoError(s.b.SetMaxRequests(1))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	report, err := s.b.Expire(ctx, "builds/", RetentionPolicy{MaxAge: time.Nanosecond})
+	s.require.NoError(err)
+	s.Equal(3, report.Count(SyncDelete))
+	s.Equal([]string{"other"}, s.srv.Keys("retention"))
+}
+
+func (s *RetentionSuite) TestExpireHonorsFilterAndDryRun() {
+	dryRun, err := s.b.DryRunClone()
+	s.require.NoError(err)
+	defer dryRun.Close()
+
+	report, err := dryRun.Expire(context.Background(), "builds/",
+		RetentionPolicy{MaxAge: time.Nanosecond})
+	s.require.NoError(err)
+	s.True(report.DryRun)
+	s.Equal(3, report.Count(SyncDelete))
+	s.Len(s.srv.Keys("retention"), 4)
+
+	filter := NewFilter()
+	s.require.NoError(filter.Include("*.tgz"))
+	s.b.SetFilter(filter)
+
+	report, err = s.b.Expire(context.Background(), "builds/", RetentionPolicy{MaxAge: time.Nanosecond})
+	s.require.NoError(err)
+	s.Equal(2, report.Count(SyncDelete))
+	s.Equal([]string{"builds/3.txt", "other"}, s.srv.Keys("retention"))
+}
+
+func (s *RetentionSuite) TestFailedDeletesAreReported() {
+	s.srv.FailRequestsWith(1, http.StatusForbidden, "AccessDenied", func(r *http.Request) bool {
+		return r.Method == "DELETE" && strings.HasSuffix(r.URL.Path, "/1.tgz")
+	})
+
+	report, err := s.b.Expire(context.Background(), "builds/", RetentionPolicy{MaxSize: 12})
+	s.Error(err)
+	s.Equal(1, report.Count(SyncFailed))
+	s.Equal(1, report.Count(SyncDelete))
+	s.Equal("builds/1.tgz", report.Items[0].Key)
+	s.Contains(report.Items[0].Error, "AccessDenied")
+	s.Equal([]string{"builds/1.tgz", "builds/3.txt", "other"}, s.srv.Keys("retention"))
+}
+
+func (s *RetentionSuite) TestFailedListingsDeleteNothing() {
+	s.srv.FailRequestsWith(1, http.StatusForbidden, "AccessDenied", func(r *http.Request) bool {
+		return r.Method == "GET"
+	})
+
+	_, err := s.b.Expire(context.Background(), "builds/", RetentionPolicy{MaxAge: time.Nanosecond})
+	s.Error(err)
+	s.Len(s.srv.Keys("retention"), 4)
+
+	_, err = s.b.Expire(context.Background(), "builds/", RetentionPolicy{})
+	s.Error(err)
+}
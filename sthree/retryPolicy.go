@@ -0,0 +1,248 @@
+package sthree
+
+import (
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/goamz/goamz/s3"
+	"github.com/jpillora/backoff"
+	"github.com/pkg/errors"
+	"github.com/tychoish/grip"
+	"golang.org/x/net/context"
+)
+
+// RetryPolicy determines how Bucket operations retry failed requests
+// to S3: each operation makes at most MaxAttempts attempts, and waits
+// between attempts with an exponential backoff, which starts at
+// MinDelay and never exceeds MaxDelay. With Jitter, the backoff
+// randomizes each delay, so that concurrent jobs do not retry in
+// lockstep.
+//
+// Operations only retry errors that may succeed on a later attempt
+// (see IsRetryable), and fail immediately for other errors, such as
+// access denied errors and missing buckets.
+type RetryPolicy struct {
+	MaxAttempts int
+	MinDelay    time.Duration
+	MaxDelay    time.Duration
+	Jitter      bool
+}
+
+const (
+	defaultRetryAttempts = 20
+	defaultRetryMinDelay = 100 * time.Millisecond
+	defaultRetryMaxDelay = 5 * time.Second
+)
+
+// DefaultRetryPolicy returns the retry policy of new buckets: 20
+// attempts, with delays between 100 milliseconds and 5 seconds, and
+// jitter.
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: defaultRetryAttempts,
+		MinDelay:    defaultRetryMinDelay,
+		MaxDelay:    defaultRetryMaxDelay,
+		Jitter:      true,
+	}
+}
+
+// Validate returns an error if the policy does not allow at least one
+// attempt, or if the delays are negative or out of order.
+func (p RetryPolicy) Validate() error {
+	if p.MaxAttempts <= 0 {
+		return errors.Errorf("max attempts=%d, must be larger than 0", p.MaxAttempts)
+	}
+
+	if p.MinDelay < 0 || p.MaxDelay < 0 {
+		return errors.Errorf("retry delays (%s, %s) must not be negative", p.MinDelay, p.MaxDelay)
+	}
+
+	if p.MaxDelay != 0 && p.MinDelay > p.MaxDelay {
+		return errors.Errorf("minimum retry delay (%s) is larger than the maximum (%s)",
+			p.MinDelay, p.MaxDelay)
+	}
+
+	return nil
+}
+
+// backoff returns the backoff for a single operation. Zero delays use
+// the default delays.
+func (p RetryPolicy) backoff() *backoff.Backoff {
+	b := &backoff.Backoff{
+		Min:    p.MinDelay,
+		Max:    p.MaxDelay,
+		Factor: 2,
+		Jitter: p.Jitter,
+	}
+
+	if b.Min == 0 {
+		b.Min = defaultRetryMinDelay
+	}
+
+	if b.Max == 0 {
+		b.Max = defaultRetryMaxDelay
+	}
+
+	return b
+}
+
+// SetRetryPolicy changes how the bucket's operations retry failed
+// requests. Returns an error, and does not change the policy, if the
+// policy is not valid.
+func (b *Bucket) SetRetryPolicy(p RetryPolicy) error {
+	if err := p.Validate(); err != nil {
+		return errors.Wrap(err, "invalid retry policy")
+	}
+
+	b.retry = p
+	return nil
+}
+
+// RetryPolicy returns the bucket's current retry policy.
+func (b *Bucket) RetryPolicy() RetryPolicy {
+	return b.retry
+}
+
+// fatalErrorCodes are the S3 error codes for requests that cannot
+// succeed without a change in configuration, credentials, or input.
+var fatalErrorCodes = map[string]bool{
+	"AccessDenied":          true,
+	"AccountProblem":        true,
+	"AllAccessDisabled":     true,
+	"EntityTooLarge":        true,
+	"ExpiredToken":          true,
+	"InvalidAccessKeyId":    true,
+	"InvalidArgument":       true,
+	"InvalidBucketName":     true,
+	"InvalidObjectState":    true,
+	"MethodNotAllowed":      true,
+	"NoSuchBucket":          true,
+	"NoSuchKey":             true,
+	"NoSuchUpload":          true,
+	"SignatureDoesNotMatch": true,
+}
+
+// retryableErrorCodes are the S3 error codes for transient failures,
+// including codes with 4xx status codes that S3 uses for throttling
+// and timeouts.
+var retryableErrorCodes = map[string]bool{
+	"InternalError":      true,
+	"OperationAborted":   true,
+	"RequestTimeout":     true,
+	"ServiceUnavailable": true,
+	"SlowDown":           true,
+}
+
+// IsRetryable returns false for errors that will occur again if an
+// operation retries the request: S3 errors that report a problem
+// with credentials, permissions, buckets, or the request itself,
+// errors from canceled contexts, and errors for missing local files
+// and permissions. All other errors, including S3 server errors,
+// throttling, and network errors, are retryable.
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	err = errors.Cause(err)
+
+	if err == context.Canceled || err == context.DeadlineExceeded {
+		return false
+	}
+
+	if os.IsNotExist(err) || os.IsPermission(err) {
+		return false
+	}
+
+	s3err, ok := err.(*s3.Error)
+	if !ok {
+		return true
+	}
+
+	switch {
+	case fatalErrorCodes[s3err.Code]:
+		return false
+	case retryableErrorCodes[s3err.Code]:
+		return true
+	case s3err.StatusCode == http.StatusTooManyRequests:
+		return true
+	case s3err.StatusCode >= 400 && s3err.StatusCode < 500:
+		return false
+	default:
+		return true
+	}
+}
+
+// ErrorCode returns the S3 error code (e.g. "SlowDown" or
+// "AccessDenied") of an error, or an empty string for errors that did
+// not come from S3. Responses to HEAD requests do not have error
+// codes, and ErrorCode returns the HTTP status code for these errors.
+func ErrorCode(err error) string {
+	s3err, ok := errors.Cause(err).(*s3.Error)
+	if !ok {
+		return ""
+	}
+
+	if s3err.Code == "" {
+		return http.StatusText(s3err.StatusCode)
+	}
+
+	return s3err.Code
+}
+
+// withRetries runs the operation, which the description names in log
+// messages and errors (e.g. "upload bucket/key"), until it succeeds,
+// or returns an error that is not retryable, or fails as many times
+// as the retry policy allows, and waits between attempts according to
+// the policy. Stops retrying, and returns the context's error, if the
+// context is canceled.
+//
+// Each attempt holds one of the bucket's request slots (see
+// SetMaxRequests) while the operation runs, so operations must call the
+// storage backend directly, and must not call request, which would
+// wait for a second slot and deadlock once all slots are in use.
+func (b *Bucket) withRetries(ctx context.Context, description string, op func() error) error {
+	attempts := b.retry.MaxAttempts
+	backoff := b.retry.backoff()
+	catcher := grip.NewCatcher()
+
+	for i := 1; i <= attempts; i++ {
+		if err := ctx.Err(); err != nil {
+			return errors.Wrapf(err, "%s canceled", description)
+		}
+
+		err := b.request(ctx, op)
+		if err == nil {
+			return nil
+		}
+
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return errors.Wrapf(ctxErr, "%s canceled", description)
+		}
+
+		if !IsRetryable(err) {
+			return errors.Wrapf(err, "could not %s", description)
+		}
+
+		catcher.Add(errors.Wrapf(err, "attempt %d", i))
+
+		if i < attempts {
+			dur := backoff.Duration()
+			code := ErrorCode(err)
+			if code == "" {
+				code = "none"
+			}
+
+			grip.Warningf("retrying %s after attempt %d of %d failed (code=%s), in %s: %s",
+				description, i, attempts, code, dur, err)
+
+			if err = wait(ctx, dur); err != nil {
+				return errors.Wrapf(err, "%s canceled", description)
+			}
+		}
+	}
+
+	return errors.Errorf("could not %s in %d attempts. Errors: %s",
+		description, attempts, catcher.Resolve())
+}
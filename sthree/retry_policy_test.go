@@ -0,0 +1,178 @@
+package sthree
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/goamz/goamz/aws"
+	"github.com/goamz/goamz/s3"
+	"github.com/mongodb/curator/sthree/fakes3"
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+// RetryPolicySuite tests the classification of errors, and the retry
+// behavior of bucket operations, using a fake S3 server that counts
+// requests and injects errors.
+type RetryPolicySuite struct {
+	srv      *fakes3.Server
+	b        *Bucket
+	tempDir  string
+	fileName string
+	requests int
+	require  *require.Assertions
+	suite.Suite
+}
+
+func TestRetryPolicySuite(t *testing.T) {
+	suite.Run(t, new(RetryPolicySuite))
+}
+
+func (s *RetryPolicySuite) SetupSuite() {
+	s.require = s.Require()
+
+	tempDir, err := ioutil.TempDir("", uuid.NewV4().String())
+	s.require.NoError(err)
+	s.tempDir = tempDir
+
+	s.fileName = filepath.Join(s.tempDir, "file.txt")
+	s.require.NoError(ioutil.WriteFile(s.fileName, []byte("retry test"), 0644))
+}
+
+func (s *RetryPolicySuite) TearDownSuite() {
+	s.NoError(os.RemoveAll(s.tempDir))
+}
+
+func (s *RetryPolicySuite) SetupTest() {
+	s.srv = fakes3.NewServer()
+	s.requests = 0
+	auth := aws.Auth{AccessKey: "fake", SecretKey: "fake"}
+
+	s.b = &Bucket{
+		name:    "retries",
+		storage: NewS3Storage(s3.New(auth, s.srv.Region()).Bucket("retries")),
+	}
+	s.require.NoError(s.b.SetRetryPolicy(RetryPolicy{
+		MaxAttempts: 4,
+		MinDelay:    time.Millisecond,
+		MaxDelay:    time.Millisecond,
+	}))
+}
+
+func (s *RetryPolicySuite) TearDownTest() {
+	s.srv.Close()
+}
+
+// count is a request filter for the fake server that counts the
+// requests that it fails.
+func (s *RetryPolicySuite) count(r *http.Request) bool {
+	s.requests++
+	return true
+}
+
+func (s *RetryPolicySuite) TestDefaultPolicyIsValid() {
+	policy := DefaultRetryPolicy()
+	s.NoError(policy.Validate())
+	s.Equal(20, policy.MaxAttempts)
+	s.True(policy.Jitter)
+}
+
+func (s *RetryPolicySuite) TestInvalidPoliciesAreNotSet() {
+	for _, policy := range []RetryPolicy{
+		{},
+		{MaxAttempts: -1},
+		{MaxAttempts: 1, MinDelay: -time.Second},
+		{MaxAttempts: 1, MinDelay: time.Minute, MaxDelay: time.Second},
+	} {
+		s.Error(policy.Validate())
+		s.Error(s.b.SetRetryPolicy(policy))
+		s.Equal(4, s.b.RetryPolicy().MaxAttempts)
+	}
+}
+
+func (s *RetryPolicySuite) TestZeroDelaysUseDefaults() {
+	backoff := RetryPolicy{MaxAttempts: 1}.backoff()
+	s.Equal(100*time.Millisecond, backoff.Min)
+	s.Equal(5*time.Second, backoff.Max)
+}
+
+func (s *RetryPolicySuite) TestErrorClassification() {
+	s.False(IsRetryable(nil))
+	s.False(IsRetryable(context.Canceled))
+	s.False(IsRetryable(errors.Wrap(context.DeadlineExceeded, "wrapped")))
+	s.True(IsRetryable(errors.New("connection reset by peer")))
+
+	_, err := os.Stat(filepath.Join(s.tempDir, "does-not-exist"))
+	s.False(IsRetryable(errors.Wrap(err, "wrapped")))
+
+	for code, status := range map[string]int{
+		"AccessDenied":       http.StatusForbidden,
+		"NoSuchBucket":       http.StatusNotFound,
+		"InvalidAccessKeyId": http.StatusForbidden,
+		"BadDigest":          http.StatusBadRequest,
+	} {
+		err = &s3.Error{StatusCode: status, Code: code}
+		s.False(IsRetryable(err), code)
+		s.False(IsRetryable(errors.Wrap(err, "wrapped")), code)
+		s.Equal(code, ErrorCode(errors.Wrap(err, "wrapped")))
+	}
+
+	for code, status := range map[string]int{
+		"SlowDown":           http.StatusServiceUnavailable,
+		"InternalError":      http.StatusInternalServerError,
+		"RequestTimeout":     http.StatusBadRequest,
+		"":                   http.StatusTooManyRequests,
+		"ServiceUnavailable": http.StatusServiceUnavailable,
+	} {
+		err = &s3.Error{StatusCode: status, Code: code}
+		s.True(IsRetryable(err), code)
+	}
+
+	s.Equal("", ErrorCode(errors.New("not from s3")))
+	s.Equal("Forbidden", ErrorCode(&s3.Error{StatusCode: http.StatusForbidden}))
+}
+
+func (s *RetryPolicySuite) TestFatalErrorsAreNotRetried() {
+	s.srv.FailRequestsWith(100, http.StatusForbidden, "AccessDenied", s.count)
+
+	err := s.b.Put(context.Background(), s.fileName, "file.txt")
+	s.Error(err)
+	s.Equal(1, s.requests)
+	s.Equal("AccessDenied", ErrorCode(err))
+
+	s.requests = 0
+	s.srv.FailRequestsWith(100, http.StatusNotFound, "NoSuchBucket", s.count)
+
+	_, err = s.b.List(context.Background(), "", true)
+	s.Error(err)
+	s.Equal(1, s.requests)
+	s.Equal("NoSuchBucket", ErrorCode(err))
+}
+
+func (s *RetryPolicySuite) TestTransientErrorsAreRetried() {
+	s.srv.FailRequests(3, s.count)
+
+	s.NoError(s.b.Put(context.Background(), s.fileName, "file.txt"))
+	s.Equal(3, s.requests)
+
+	s.requests = 0
+	s.srv.FailRequests(100, s.count)
+
+	err := s.b.Get(context.Background(), "file.txt", filepath.Join(s.tempDir, "out.txt"))
+	s.Error(err)
+	s.Equal(4, s.requests)
+	s.Contains(err.Error(), "in 4 attempts")
+}
+
+func (s *RetryPolicySuite) TestRetryPolicyCarriesToClones() {
+	clone, err := s.b.Clone()
+	s.require.NoError(err)
+	s.Equal(s.b.RetryPolicy(), clone.RetryPolicy())
+}
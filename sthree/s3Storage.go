@@ -0,0 +1,519 @@
+package sthree
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goamz/goamz/aws"
+	"github.com/goamz/goamz/s3"
+	"github.com/pkg/errors"
+)
+
+// s3Storage implements the Storage interface using a goamz S3
+// bucket. Storage with a signer signs requests with version 4
+// signatures, using the credentials of the storage, rather than the
+// credentials of the goamz connection.
+type s3Storage struct {
+	bucket      *s3.Bucket
+	credentials CredentialProvider
+	signer      *signatureV4Transport
+}
+
+// NewS3Storage returns a Storage implementation backed by the
+// specified goamz S3 bucket. The storage makes a single attempt for
+// each request, rather than using the goamz attempt strategy, because
+// the retry policy of the Bucket determines which requests to retry.
+func NewS3Storage(bucket *s3.Bucket) Storage {
+	return newS3Storage(bucket, false)
+}
+
+// newS3Storage returns S3 storage for the bucket, which signs
+// requests with version 4 signatures, rather than the version 2
+// signatures of the goamz client, if signatureV4 is true.
+func newS3Storage(bucket *s3.Bucket, signatureV4 bool) *s3Storage {
+	creds := authCredentials(bucket.S3.Auth)
+	if signatureV4 {
+		return newS3StorageWithCredentials(bucket, creds)
+	}
+
+	conn := *bucket.S3
+	conn.AttemptStrategy = aws.AttemptStrategy{}
+
+	return &s3Storage{
+		bucket:      &s3.Bucket{S3: &conn, Name: bucket.Name},
+		credentials: creds,
+	}
+}
+
+// newS3StorageWithCredentials returns S3 storage for the bucket, which
+// signs requests with version 4 signatures, using the current
+// credentials of the provider for each request, and ignores the
+// credentials of the goamz connection.
+func newS3StorageWithCredentials(bucket *s3.Bucket, creds CredentialProvider) *s3Storage {
+	signer := newSignatureV4Transport(bucket.Name, bucket.S3.Region.Name, creds)
+	conn := s3.New(aws.Auth{}, bucket.S3.Region, &http.Client{Transport: signer})
+	conn.AttemptStrategy = aws.AttemptStrategy{}
+
+	return &s3Storage{
+		bucket:      &s3.Bucket{S3: conn, Name: bucket.Name},
+		credentials: creds,
+		signer:      signer,
+	}
+}
+
+func (s *s3Storage) Put(key string, r io.Reader, size int64, contentType string, perm s3.ACL,
+	opts UploadOptions) error {
+	return s.bucket.PutReaderHeader(key, r, size, opts.headers(contentType), perm)
+}
+
+func (s *s3Storage) Get(key string) (io.ReadCloser, error) {
+	return s.bucket.GetReader(key)
+}
+
+func (s *s3Storage) Exists(key string) (bool, error) {
+	return s.bucket.Exists(key)
+}
+
+func (s *s3Storage) Head(key string) (*ObjectInfo, error) {
+	resp, err := s.bucket.Head(key, nil)
+	if err != nil {
+		if s3err, ok := err.(*s3.Error); ok && s3err.StatusCode == http.StatusNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if resp.Body != nil {
+		resp.Body.Close()
+	}
+
+	info := &ObjectInfo{
+		Key:         key,
+		ETag:        resp.Header.Get("ETag"),
+		ContentType: resp.Header.Get("Content-Type"),
+		Meta:        make(map[string]string),
+
+		CacheControl:       resp.Header.Get("Cache-Control"),
+		ContentEncoding:    resp.Header.Get("Content-Encoding"),
+		ContentDisposition: resp.Header.Get("Content-Disposition"),
+
+		ServerSideEncryption: resp.Header.Get("X-Amz-Server-Side-Encryption"),
+	}
+
+	info.Size, _ = strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	info.LastModified, _ = time.Parse(http.TimeFormat, resp.Header.Get("Last-Modified"))
+
+	for name, values := range resp.Header {
+		if strings.HasPrefix(name, "X-Amz-Meta-") && len(values) > 0 {
+			info.Meta[strings.ToLower(strings.TrimPrefix(name, "X-Amz-Meta-"))] = values[0]
+		}
+	}
+
+	return info, nil
+}
+
+func (s *s3Storage) List(prefix, delim, marker string, max int) (*s3.ListResp, error) {
+	return s.bucket.List(prefix, delim, marker, max)
+}
+
+func (s *s3Storage) Delete(key string) error {
+	return s.bucket.Del(key)
+}
+
+type deleteMultiResult struct {
+	Errors []struct {
+		Key     string
+		Code    string
+		Message string
+	} `xml:"Error"`
+}
+
+// DeleteMulti removes the objects with a multi-object delete request.
+// The goamz client ignores the response, which reports the keys that
+// the request did not remove.
+func (s *s3Storage) DeleteMulti(objects s3.Delete) error {
+	body, err := xml.Marshal(objects)
+	if err != nil {
+		return errors.Wrap(err, "problem encoding multi-object delete")
+	}
+
+	digest := md5.Sum(body)
+	resp, err := s.send("POST", "", url.Values{"delete": {""}}, map[string][]string{
+		"Content-Md5":  {base64.StdEncoding.EncodeToString(digest[:])},
+		"Content-Type": {"text/xml"},
+	}, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	result := deleteMultiResult{}
+	if err = xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return errors.Wrapf(err, "problem decoding multi-object delete response from bucket '%s'",
+			s.bucket.Name)
+	}
+
+	if len(result.Errors) == 0 {
+		return nil
+	}
+
+	multiErr := &DeleteMultiError{Errors: make(map[string]error, len(result.Errors))}
+	for _, keyErr := range result.Errors {
+		multiErr.Errors[keyErr.Key] = &s3.Error{
+			BucketName: s.bucket.Name,
+			Code:       keyErr.Code,
+			Message:    keyErr.Message,
+		}
+	}
+
+	return multiErr
+}
+
+// CanCopyFrom returns true for other S3 buckets on the same endpoint,
+// as S3 can only copy objects within a single service.
+func (s *s3Storage) CanCopyFrom(src Storage) bool {
+	other, ok := src.(*s3Storage)
+	if !ok {
+		return false
+	}
+
+	return other.bucket.S3.Region.S3Endpoint == s.bucket.S3.Region.S3Endpoint
+}
+
+func (s *s3Storage) CopyFrom(src Storage, srcKey, key string, perm s3.ACL, enc Encryption) error {
+	other, ok := src.(*s3Storage)
+	if !ok {
+		return errors.New("s3 storage can only copy objects from other s3 buckets")
+	}
+
+	return s.copyObject(copySource(other.bucket.Name, srcKey), key, perm, enc)
+}
+
+// copySource returns the value of the copy source header for the key:
+// the url-encoded "<bucket>/<key>".
+func copySource(bucket, key string) string {
+	return (&url.URL{Path: bucket + "/" + key}).String()
+}
+
+// copyObject copies the object of the copy source header to the key,
+// with the metadata of the source.
+func (s *s3Storage) copyObject(source, key string, perm s3.ACL, enc Encryption) error {
+	if enc.Mode == EncryptionNone {
+		_, err := s.bucket.PutCopy(key, perm, s3.CopyOptions{MetadataDirective: "COPY"}, source)
+		return err
+	}
+
+	// the goamz copy options do not support SSE-KMS.
+	headers := UploadOptions{Encryption: enc}.headers("")
+	headers["x-amz-copy-source"] = []string{source}
+	headers["x-amz-metadata-directive"] = []string{"COPY"}
+
+	return s.bucket.PutReaderHeader(key, nil, 0, headers, perm)
+}
+
+// SetACL replaces the ACL of the object. The goamz client cannot send
+// requests for the ACL of an object.
+func (s *s3Storage) SetACL(key string, perm s3.ACL) error {
+	resp, err := s.send("PUT", key, url.Values{"acl": {""}},
+		map[string][]string{"x-amz-acl": {string(perm)}}, nil)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+type listVersionsResult struct {
+	IsTruncated         bool
+	NextKeyMarker       string
+	NextVersionIDMarker string        `xml:"NextVersionIdMarker"`
+	Entries             []versionInfo `xml:",any"`
+}
+
+// versionInfo is an element of a version listing, which is a
+// "Version" or a "DeleteMarker" for versions, and another field of the
+// listing otherwise.
+type versionInfo struct {
+	XMLName      xml.Name
+	Key          string
+	VersionID    string `xml:"VersionId"`
+	IsLatest     bool
+	LastModified string
+	ETag         string
+	Size         int64
+}
+
+// ListVersions lists the versions of the bucket. The goamz client
+// does not list delete markers, or return the markers of the next
+// page.
+func (s *s3Storage) ListVersions(prefix, keyMarker, versionMarker string,
+	max int) (*VersionPage, error) {
+	query := url.Values{"versions": {""}, "prefix": {prefix}}
+	if keyMarker != "" {
+		query.Set("key-marker", keyMarker)
+	}
+	if versionMarker != "" {
+		query.Set("version-id-marker", versionMarker)
+	}
+	if max > 0 {
+		query.Set("max-keys", strconv.Itoa(max))
+	}
+
+	resp, err := s.send("GET", "", query, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	// the entries are in the order of the listing only if they
+	// are in a single field.
+	result := listVersionsResult{}
+	if err = xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, errors.Wrapf(err, "problem reading versions of %s/%s", s.bucket.Name, prefix)
+	}
+
+	page := &VersionPage{}
+	if result.IsTruncated {
+		page.NextKeyMarker = result.NextKeyMarker
+		page.NextVersionMarker = result.NextVersionIDMarker
+	}
+
+	for _, entry := range result.Entries {
+		if entry.XMLName.Local != "Version" && entry.XMLName.Local != "DeleteMarker" {
+			continue
+		}
+
+		version := ObjectVersion{
+			Key:          entry.Key,
+			VersionID:    entry.VersionID,
+			IsLatest:     entry.IsLatest,
+			DeleteMarker: entry.XMLName.Local == "DeleteMarker",
+			Size:         entry.Size,
+			ETag:         entry.ETag,
+		}
+		version.LastModified, _ = time.Parse(s3TimeFormat, entry.LastModified)
+
+		page.Versions = append(page.Versions, version)
+	}
+
+	return page, nil
+}
+
+func (s *s3Storage) RestoreVersion(key, versionID string, perm s3.ACL, enc Encryption) error {
+	return s.copyObject(copySource(s.bucket.Name, key)+"?versionId="+url.QueryEscape(versionID), key,
+		perm, enc)
+}
+
+func (s *s3Storage) DeleteVersion(key, versionID string) error {
+	resp, err := s.send("DELETE", key, url.Values{"versionId": {versionID}}, nil, nil)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// SignedURL returns a URL for the key with a version 4 query string
+// signature, signed with the current credentials of the storage. URLs
+// signed with temporary credentials stop working when the credentials
+// expire, even if the duration has not passed.
+func (s *s3Storage) SignedURL(key, method string, ttl time.Duration) (string, error) {
+	req, err := http.NewRequest(method, s.bucket.URL(key), nil)
+	if err != nil {
+		return "", errors.Wrapf(err, "problem building url for '%s'", key)
+	}
+
+	creds, err := s.credentials.Retrieve()
+	if err != nil {
+		return "", errors.Wrapf(err, "problem retrieving credentials for bucket '%s'", s.bucket.Name)
+	}
+	presignV4(req, creds, s.bucket.S3.Region.Name, time.Now().UTC(), ttl)
+
+	return req.URL.String(), nil
+}
+
+// send sends a request for the key, or for the bucket if the key is
+// empty, with the body, if any, and a version 4 signature, which S3
+// accepts in all regions, for operations that the goamz client does
+// not support. Returns an *s3.Error for error responses. Callers must
+// close the body of the response.
+func (s *s3Storage) send(method, key string, query url.Values, headers map[string][]string,
+	body []byte) (*http.Response, error) {
+	u, err := url.Parse(s.bucket.URL(key))
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem building url for '%s'", key)
+	}
+	u.RawQuery = query.Encode()
+
+	var content io.Reader
+	if body != nil {
+		content = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequest(method, u.String(), content)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem building request for '%s'", key)
+	}
+	for name, values := range headers {
+		req.Header[name] = values
+	}
+
+	creds, err := s.credentials.Retrieve()
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem retrieving credentials for bucket '%s'", s.bucket.Name)
+	}
+	signV4(req, creds, "s3", s.bucket.S3.Region.Name, time.Now().UTC())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	s3err := &s3.Error{StatusCode: resp.StatusCode}
+	if data, err := ioutil.ReadAll(resp.Body); err == nil {
+		_ = xml.Unmarshal(data, s3err)
+	}
+	if s3err.Message == "" {
+		s3err.Message = resp.Status
+	}
+
+	return nil, s3err
+}
+
+// InitMultipart starts a multipart upload. The goamz client does not
+// send upload options when starting multipart uploads, so the storage
+// sends the request itself, with the headers of the options, and the
+// object has the encryption, headers, and user metadata of the options
+// from the start of the upload. Bucket policies that require
+// encryption reject uploads that start without it.
+func (s *s3Storage) InitMultipart(key, contentType string, perm s3.ACL,
+	opts UploadOptions) (MultipartUpload, error) {
+	headers := opts.headers(contentType)
+	headers["x-amz-acl"] = []string{string(perm)}
+
+	resp, err := s.send("POST", key, url.Values{"uploads": {""}}, headers, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := initMultipartResult{}
+	if err = xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, errors.Wrapf(err, "problem decoding the response that starts the upload of %s/%s",
+			s.bucket.Name, key)
+	}
+
+	if result.UploadID == "" {
+		return nil, errors.Errorf("starting the upload of %s/%s did not return an upload id",
+			s.bucket.Name, key)
+	}
+
+	multi := &s3.Multi{Bucket: s.bucket, Key: key, UploadId: result.UploadID}
+	return &s3Multipart{multi: multi, initiated: time.Now()}, nil
+}
+
+// initMultipartResult is the response to a request that starts a
+// multipart upload.
+type initMultipartResult struct {
+	UploadID string `xml:"UploadId"`
+}
+
+// ListMultipart lists the incomplete multipart uploads with the
+// prefix. The goamz client does not return the time that each upload
+// started.
+func (s *s3Storage) ListMultipart(prefix string) ([]MultipartUpload, error) {
+	var uploads []MultipartUpload
+	query := url.Values{"uploads": {""}, "prefix": {prefix}}
+
+	for {
+		result, err := s.listMultipartPage(query)
+		if err != nil {
+			return nil, errors.Wrapf(err, "problem listing multipart uploads of %s/%s", s.bucket.Name,
+				prefix)
+		}
+
+		for _, entry := range result.Uploads {
+			upload := &s3Multipart{
+				multi: &s3.Multi{Bucket: s.bucket, Key: entry.Key, UploadId: entry.UploadID},
+			}
+			upload.initiated, _ = time.Parse(s3TimeFormat, entry.Initiated)
+
+			uploads = append(uploads, upload)
+		}
+
+		if !result.IsTruncated {
+			return uploads, nil
+		}
+
+		query.Set("key-marker", result.NextKeyMarker)
+		query.Set("upload-id-marker", result.NextUploadIDMarker)
+	}
+}
+
+func (s *s3Storage) listMultipartPage(query url.Values) (*listMultipartResult, error) {
+	resp, err := s.send("GET", "", query, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	result := &listMultipartResult{}
+	if err = xml.NewDecoder(resp.Body).Decode(result); err != nil {
+		return nil, errors.Wrap(err, "problem decoding response")
+	}
+
+	return result, nil
+}
+
+// listMultipartResult is a page of the response to a request that
+// lists multipart uploads.
+type listMultipartResult struct {
+	IsTruncated        bool
+	NextKeyMarker      string
+	NextUploadIDMarker string `xml:"NextUploadIdMarker"`
+	Uploads            []struct {
+		Key       string
+		UploadID  string `xml:"UploadId"`
+		Initiated string
+	} `xml:"Upload"`
+}
+
+// s3Multipart implements the MultipartUpload interface using a goamz
+// multipart upload.
+type s3Multipart struct {
+	multi     *s3.Multi
+	initiated time.Time
+}
+
+func (m *s3Multipart) Key() string {
+	return m.multi.Key
+}
+
+func (m *s3Multipart) Initiated() time.Time {
+	return m.initiated
+}
+
+func (m *s3Multipart) PutPart(n int, r io.ReadSeeker) (s3.Part, error) {
+	return m.multi.PutPart(n, r)
+}
+
+func (m *s3Multipart) Complete(parts []s3.Part) error {
+	return m.multi.Complete(parts)
+}
+
+func (m *s3Multipart) Abort() error {
+	return m.multi.Abort()
+}
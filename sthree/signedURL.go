@@ -0,0 +1,42 @@
+package sthree
+
+import (
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// MaxSignedURLTTL is the longest duration that S3 accepts for URLs
+// with version 4 signatures.
+const MaxSignedURLTTL = 7 * 24 * time.Hour
+
+// SignedURL returns a pre-signed URL that allows anyone holding it to
+// download (GET) or upload (PUT) the object with the key, without
+// credentials, until the duration passes. Uploads with the URL do not
+// get the permissions, encryption, or metadata of the bucket. Returns
+// an error for other methods, for durations that are not positive or
+// are longer than MaxSignedURLTTL, and if the storage of the bucket
+// does not support signed URLs.
+func (b *Bucket) SignedURL(key, method string, ttl time.Duration) (string, error) {
+	method = strings.ToUpper(method)
+	if method != "GET" && method != "PUT" {
+		return "", errors.Errorf("cannot sign urls for '%s' requests, only GET and PUT", method)
+	}
+
+	if ttl <= 0 || ttl > MaxSignedURLTTL {
+		return "", errors.Errorf("signed urls must expire after more than 0s and at most %s, not %s",
+			MaxSignedURLTTL, ttl)
+	}
+
+	if key == "" {
+		return "", errors.New("cannot sign a url without a key")
+	}
+
+	storage, ok := b.storage.(SignedURLStorage)
+	if !ok {
+		return "", errors.Errorf("the storage of bucket %s does not support signed urls", b.name)
+	}
+
+	return storage.SignedURL(key, method, ttl)
+}
@@ -0,0 +1,118 @@
+package sthree
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/goamz/goamz/aws"
+	"github.com/goamz/goamz/s3"
+	"github.com/mongodb/curator/sthree/fakes3"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// SignedURLSuite tests uploading and downloading objects with
+// pre-signed URLs, using a fake S3 server.
+type SignedURLSuite struct {
+	srv     *fakes3.Server
+	b       *Bucket
+	require *require.Assertions
+	suite.Suite
+}
+
+func TestSignedURLSuite(t *testing.T) {
+	suite.Run(t, new(SignedURLSuite))
+}
+
+func (s *SignedURLSuite) SetupSuite() {
+	s.require = s.Require()
+}
+
+func (s *SignedURLSuite) SetupTest() {
+	s.srv = fakes3.NewServer()
+	auth := aws.Auth{AccessKey: "fake", SecretKey: "fake"}
+
+	s.b = &Bucket{
+		name:    "signed",
+		numJobs: 2,
+		retry:   RetryPolicy{MaxAttempts: 1},
+		storage: NewS3Storage(s3.New(auth, s.srv.Region()).Bucket("signed")),
+	}
+}
+
+func (s *SignedURLSuite) TearDownTest() {
+	s.srv.Close()
+}
+
+func (s *SignedURLSuite) TestUploadAndDownloadWithSignedURLs() {
+	put, err := s.b.SignedURL("dir/a file.txt", "put", time.Hour)
+	s.require.NoError(err)
+
+	req, err := http.NewRequest("PUT", put, bytes.NewBufferString("content"))
+	s.require.NoError(err)
+	resp, err := http.DefaultClient.Do(req)
+	s.require.NoError(err)
+	s.NoError(resp.Body.Close())
+	s.Equal(http.StatusOK, resp.StatusCode)
+	s.Equal([]string{"dir/a file.txt"}, s.srv.Keys("signed"))
+
+	get, err := s.b.SignedURL("dir/a file.txt", "GET", time.Hour)
+	s.require.NoError(err)
+	s.NotEqual(put, get)
+
+	resp, err = http.Get(get)
+	s.require.NoError(err)
+	defer resp.Body.Close()
+	data, err := ioutil.ReadAll(resp.Body)
+	s.NoError(err)
+	s.Equal("content", string(data))
+
+	u, err := url.Parse(get)
+	s.require.NoError(err)
+	s.Equal("3600", u.Query().Get("X-Amz-Expires"))
+	s.Equal("AWS4-HMAC-SHA256", u.Query().Get("X-Amz-Algorithm"))
+	s.NotEmpty(u.Query().Get("X-Amz-Signature"))
+}
+
+func (s *SignedURLSuite) TestSignedURLsHaveSessionTokens() {
+	creds := Credentials{AccessKey: "key", SecretKey: "secret", SessionToken: "token"}
+	auth := aws.Auth{AccessKey: "fake", SecretKey: "fake"}
+	s.b.SetStorage(newS3StorageWithCredentials(s3.New(auth, s.srv.Region()).Bucket("signed"), creds))
+
+	signed, err := s.b.SignedURL("key", "GET", MaxSignedURLTTL)
+	s.require.NoError(err)
+
+	u, err := url.Parse(signed)
+	s.require.NoError(err)
+	s.Equal("token", u.Query().Get("X-Amz-Security-Token"))
+	s.Equal("604800", u.Query().Get("X-Amz-Expires"))
+	s.Contains(u.Query().Get("X-Amz-Credential"), "key/")
+}
+
+func (s *SignedURLSuite) TestInvalidRequestsAreRejected() {
+	for _, method := range []string{"DELETE", "HEAD", ""} {
+		_, err := s.b.SignedURL("key", method, time.Hour)
+		s.Error(err, method)
+	}
+
+	for _, ttl := range []time.Duration{0, -time.Hour, MaxSignedURLTTL + time.Second} {
+		_, err := s.b.SignedURL("key", "GET", ttl)
+		s.Error(err, ttl.String())
+	}
+
+	_, err := s.b.SignedURL("", "GET", time.Hour)
+	s.Error(err)
+
+	dir, err := ioutil.TempDir("", "signed-url-test")
+	s.require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	s.b.SetStorage(NewFileSystemStorage(dir))
+	_, err = s.b.SignedURL("key", "GET", time.Hour)
+	s.Error(err)
+}
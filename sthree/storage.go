@@ -0,0 +1,323 @@
+package sthree
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goamz/goamz/s3"
+)
+
+// mtimeMetadataKey is the name of the user metadata field in which
+// Put stores the modification time of the local file, in seconds
+// since the epoch. In S3 the field is the "x-amz-meta-curator-mtime"
+// header.
+const mtimeMetadataKey = "curator-mtime"
+
+// checksumMetadataKey is the name of the user metadata field in which
+// Put stores the hex encoded MD5 checksum of the file, for objects
+// with ETags that are not MD5 checksums, such as objects encrypted
+// with SSE-KMS.
+const checksumMetadataKey = "curator-md5"
+
+// ObjectInfo describes a single stored object.
+type ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag"`
+	LastModified time.Time `json:"last_modified"`
+	ContentType  string    `json:"content_type,omitempty"`
+
+	// CacheControl, ContentEncoding, and ContentDisposition are
+	// the values of the corresponding headers of the object, if
+	// set when the object was uploaded.
+	CacheControl       string `json:"cache_control,omitempty"`
+	ContentEncoding    string `json:"content_encoding,omitempty"`
+	ContentDisposition string `json:"content_disposition,omitempty"`
+
+	// ServerSideEncryption is the value of the
+	// x-amz-server-side-encryption header of the object: "AES256"
+	// or "aws:kms" for encrypted objects.
+	ServerSideEncryption string `json:"server_side_encryption,omitempty"`
+
+	// Meta holds the user metadata of the object. Keys are lower
+	// case, and do not include the "x-amz-meta-" prefix.
+	Meta map[string]string `json:"meta,omitempty"`
+}
+
+// ModTime returns the modification time of the file that the object
+// was uploaded from, if the object has this metadata, and false
+// otherwise.
+func (o *ObjectInfo) ModTime() (time.Time, bool) {
+	value, ok := o.Meta[mtimeMetadataKey]
+	if !ok {
+		return time.Time{}, false
+	}
+
+	return parseModTime(value)
+}
+
+// checksum returns the MD5 checksum of the content of the object,
+// for comparison with the checksum of a local file: the checksum in
+// the metadata of the object, if set, and otherwise the ETag, which
+// may be a multipart ETag (see parseMultipartETag). Returns an empty
+// string for objects encrypted with SSE-KMS without this metadata,
+// as their ETags are not checksums of the content.
+func (o *ObjectInfo) checksum() string {
+	if value, ok := o.Meta[checksumMetadataKey]; ok {
+		return value
+	}
+
+	if o.ServerSideEncryption == "aws:kms" {
+		return ""
+	}
+
+	return strings.Trim(o.ETag, "\" ")
+}
+
+// formatModTime and parseModTime convert between modification times
+// and the value of the mtime metadata field.
+func formatModTime(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+func parseModTime(value string) (time.Time, bool) {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return time.Unix(seconds, 0), true
+}
+
+// UploadOptions holds the headers that uploads set on objects: the
+// goamz upload options, and the headers that the goamz options do not
+// support.
+type UploadOptions struct {
+	s3.Options
+	ContentDisposition string
+
+	// Encryption overrides the SSE option of the goamz options.
+	Encryption Encryption
+}
+
+// headers returns the request headers of an upload with the options
+// and content type, other than the ACL, which goamz adds.
+func (o UploadOptions) headers(contentType string) map[string][]string {
+	headers := map[string][]string{}
+
+	if contentType != "" {
+		headers["Content-Type"] = []string{contentType}
+	}
+	if value := o.Encryption.headerValue(); value != "" {
+		headers["x-amz-server-side-encryption"] = []string{value}
+		if o.Encryption.KMSKeyID != "" {
+			headers["x-amz-server-side-encryption-aws-kms-key-id"] = []string{o.Encryption.KMSKeyID}
+		}
+	} else if o.SSE {
+		headers["x-amz-server-side-encryption"] = []string{"AES256"}
+	}
+	if o.ContentEncoding != "" {
+		headers["Content-Encoding"] = []string{o.ContentEncoding}
+	}
+	if o.CacheControl != "" {
+		headers["Cache-Control"] = []string{o.CacheControl}
+	}
+	if o.ContentDisposition != "" {
+		headers["Content-Disposition"] = []string{o.ContentDisposition}
+	}
+	if o.ContentMD5 != "" {
+		headers["Content-MD5"] = []string{o.ContentMD5}
+	}
+	if o.RedirectLocation != "" {
+		headers["x-amz-website-redirect-location"] = []string{o.RedirectLocation}
+	}
+	for k, v := range o.Meta {
+		headers["x-amz-meta-"+k] = v
+	}
+
+	return headers
+}
+
+// Storage describes the object-store operations that the Bucket type
+// uses to implement its higher level put, get, delete, and sync
+// operations. The S3 implementation wraps a goamz bucket, and the
+// file system implementation stores objects as files in a local
+// directory tree, which makes it possible to stage or mirror a bucket
+// without access to AWS.
+//
+// Implementations must be safe for concurrent use, as sync operations
+// call these methods from many worker goroutines.
+type Storage interface {
+	// Put writes the content of the reader, which has the
+	// specified size, to the key. Implementations may not support
+	// all upload options.
+	Put(key string, r io.Reader, size int64, contentType string, perm s3.ACL, opts UploadOptions) error
+
+	// Get returns a reader for the content of the key. Callers
+	// must close the reader.
+	Get(key string) (io.ReadCloser, error)
+
+	// Exists returns true if the key exists.
+	Exists(key string) (bool, error)
+
+	// Head returns information about the key, including its user
+	// metadata, or nil if the key does not exist.
+	Head(key string) (*ObjectInfo, error)
+
+	// List returns a page of keys that begin with the prefix and
+	// sort after the marker, with the same semantics as the S3
+	// list bucket operation.
+	List(prefix, delim, marker string, max int) (*s3.ListResp, error)
+
+	// Delete removes a single key. Deleting a key that does not
+	// exist is not an error.
+	Delete(key string) error
+
+	// DeleteMulti removes a group of keys in a single operation.
+	// Returns a *DeleteMultiError if the operation did not remove
+	// some of the keys.
+	DeleteMulti(objects s3.Delete) error
+}
+
+// DeleteMultiError is the error of a multi-object delete that did not
+// remove some of its keys. S3 responds to these requests with success,
+// and reports an error for each key that it did not remove in the
+// response. Errors maps the keys to their errors.
+type DeleteMultiError struct {
+	Errors map[string]error
+}
+
+func (e *DeleteMultiError) Error() string {
+	keys := make([]string, 0, len(e.Errors))
+	for key := range e.Errors {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var more string
+	if len(keys) > 3 {
+		more = fmt.Sprintf(", and %d more", len(keys)-3)
+		keys = keys[:3]
+	}
+
+	details := make([]string, 0, len(keys))
+	for _, key := range keys {
+		details = append(details, fmt.Sprintf("%s (%s)", key, e.Errors[key]))
+	}
+
+	return fmt.Sprintf("problem deleting %d objects: %s%s", len(e.Errors),
+		strings.Join(details, ", "), more)
+}
+
+// MultipartStorage is implemented by Storage implementations that
+// can upload an object in several parts, which is required for
+// objects larger than 5 GB in S3. Bucket uses multipart uploads for
+// large files when its storage implements this interface, and single
+// Put operations otherwise.
+type MultipartStorage interface {
+	Storage
+
+	// InitMultipart starts a new multipart upload for the key.
+	// Implementations may not support all upload options.
+	InitMultipart(key, contentType string, perm s3.ACL, opts UploadOptions) (MultipartUpload, error)
+
+	// ListMultipart returns the incomplete multipart uploads for
+	// keys that begin with the prefix.
+	ListMultipart(prefix string) ([]MultipartUpload, error)
+}
+
+// maxCopySize is the size of the largest object that S3 can copy in a
+// single operation.
+const maxCopySize = 5 * 1024 * 1024 * 1024
+
+// CopyStorage is implemented by Storage implementations that can copy
+// objects, within a bucket or between buckets, without transferring
+// their content through curator. Bucket uses these server-side copies
+// for copy and bucket sync operations when the target storage can
+// copy from the source storage, and otherwise downloads and uploads
+// each object.
+type CopyStorage interface {
+	Storage
+	// CanCopyFrom returns true if the storage can copy objects
+	// from the source storage.
+	CanCopyFrom(src Storage) bool
+	// CopyFrom copies the source key in the source storage to the
+	// key, including the user metadata of the source object, with
+	// the server-side encryption.
+	CopyFrom(src Storage, srcKey, key string, perm s3.ACL, enc Encryption) error
+}
+
+// ACLStorage is implemented by Storage implementations that can change
+// the permissions of existing objects. Local storage has no
+// permissions, and does not implement this interface.
+type ACLStorage interface {
+	Storage
+	// SetACL replaces the permissions of the object with the
+	// canned ACL.
+	SetACL(key string, perm s3.ACL) error
+}
+
+// VersionStorage is implemented by Storage implementations that keep
+// the earlier versions of objects, like S3 buckets with versioning
+// enabled. Local storage does not keep versions, and does not
+// implement this interface.
+type VersionStorage interface {
+	Storage
+	// ListVersions returns a page of the versions and delete
+	// markers of keys that begin with the prefix, sorted by key
+	// and then newest first, that follow the version of the key
+	// marker with the version marker, or with an empty version
+	// marker, all versions of the key marker.
+	ListVersions(prefix, keyMarker, versionMarker string, max int) (*VersionPage, error)
+	// RestoreVersion makes a copy of a version of the key its
+	// current version, with the permissions and server-side
+	// encryption.
+	RestoreVersion(key, versionID string, perm s3.ACL, enc Encryption) error
+	// DeleteVersion permanently removes a version or delete
+	// marker of the key.
+	DeleteVersion(key, versionID string) error
+}
+
+// SignedURLStorage is implemented by Storage implementations that can
+// grant access to objects with pre-signed URLs. Local storage has no
+// URLs, and does not implement this interface.
+type SignedURLStorage interface {
+	Storage
+	// SignedURL returns a URL that allows anyone holding it to
+	// make requests with the method for the key until the
+	// duration passes.
+	SignedURL(key, method string, ttl time.Duration) (string, error)
+}
+
+// VersionPage is a page of a version listing. The markers of the next
+// page are empty for the last page.
+type VersionPage struct {
+	Versions          []ObjectVersion
+	NextKeyMarker     string
+	NextVersionMarker string
+}
+
+// MultipartUpload describes an in-progress multipart upload. Parts
+// may be uploaded concurrently and in any order; the object does not
+// exist until Complete returns.
+type MultipartUpload interface {
+	// Key returns the name of the object that the upload creates.
+	Key() string
+
+	// Initiated returns the time that the upload started.
+	Initiated() time.Time
+
+	// PutPart uploads part number n, replacing any existing part
+	// with the same number. Part numbers start at 1.
+	PutPart(n int, r io.ReadSeeker) (s3.Part, error)
+
+	// Complete assembles the parts into the object.
+	Complete(parts []s3.Part) error
+
+	// Abort discards the upload and all uploaded parts.
+	Abort() error
+}
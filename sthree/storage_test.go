@@ -0,0 +1,289 @@
+package sthree
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goamz/goamz/s3"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+// FileStorageSuite tests the file system implementation of the
+// Storage interface, and the behavior of Bucket operations on top of
+// local storage. None of these tests require access to S3.
+type FileStorageSuite struct {
+	root    string
+	storage Storage
+	require *require.Assertions
+	suite.Suite
+}
+
+func TestFileStorageSuite(t *testing.T) {
+	suite.Run(t, new(FileStorageSuite))
+}
+
+func (s *FileStorageSuite) SetupSuite() {
+	s.require = s.Require()
+}
+
+func (s *FileStorageSuite) SetupTest() {
+	root, err := ioutil.TempDir("", uuid.NewV4().String())
+	s.require.NoError(err)
+	s.root = root
+	s.storage = NewFileSystemStorage(root)
+}
+
+func (s *FileStorageSuite) TearDownTest() {
+	s.NoError(os.RemoveAll(s.root))
+}
+
+func (s *FileStorageSuite) put(key, content string) {
+	s.require.NoError(s.storage.Put(key, strings.NewReader(content), int64(len(content)),
+		"text/plain", s3.Private, UploadOptions{}))
+}
+
+func (s *FileStorageSuite) TestPutWritesFilesThatGetReads() {
+	s.put("a/b/c.txt", "hello")
+
+	info, err := os.Stat(filepath.Join(s.root, "a", "b", "c.txt"))
+	s.require.NoError(err)
+	s.Equal(os.FileMode(0644), info.Mode().Perm())
+
+	reader, err := s.storage.Get("a/b/c.txt")
+	s.require.NoError(err)
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(reader)
+	s.NoError(err)
+	s.Equal("hello", string(data))
+}
+
+func (s *FileStorageSuite) TestPutWithIncorrectSizeErrors() {
+	s.Error(s.storage.Put("foo", strings.NewReader("abc"), 10, "", s3.Private, UploadOptions{}))
+
+	exists, err := s.storage.Exists("foo")
+	s.NoError(err)
+	s.False(exists)
+}
+
+func (s *FileStorageSuite) TestGetMissingKeyErrors() {
+	_, err := s.storage.Get("does-not-exist")
+	s.Error(err)
+}
+
+func (s *FileStorageSuite) TestKeysOutsideOfRootError() {
+	s.put("a/../inside", "x")
+	exists, err := s.storage.Exists("inside")
+	s.NoError(err)
+	s.True(exists)
+
+	sibling := "../" + filepath.Base(s.root) + "x/escape"
+	for _, key := range []string{"..", "../escape", "a/../../escape", sibling} {
+		s.Error(s.storage.Put(key, strings.NewReader("x"), 1, "", s3.Private, UploadOptions{}), key)
+		_, err = s.storage.Get(key)
+		s.Error(err, key)
+		_, err = s.storage.Exists(key)
+		s.Error(err, key)
+		_, err = s.storage.Head(key)
+		s.Error(err, key)
+		s.Error(s.storage.Delete(key), key)
+	}
+
+	_, err = s.storage.List("../", "", "", 1000)
+	s.Error(err)
+
+	_, err = os.Stat(filepath.Join(filepath.Dir(s.root), "escape"))
+	s.True(os.IsNotExist(err))
+}
+
+func (s *FileStorageSuite) TestExistsReportsFilesButNotDirectories() {
+	s.put("dir/file", "x")
+
+	exists, err := s.storage.Exists("dir/file")
+	s.NoError(err)
+	s.True(exists)
+
+	exists, err = s.storage.Exists("dir")
+	s.NoError(err)
+	s.False(exists)
+
+	exists, err = s.storage.Exists("nope")
+	s.NoError(err)
+	s.False(exists)
+}
+
+func (s *FileStorageSuite) TestListReturnsSortedKeysWithChecksums() {
+	s.put("b", "two")
+	s.put("a", "one")
+	s.put("c/d", "three")
+
+	resp, err := s.storage.List("", "", "", 1000)
+	s.require.NoError(err)
+	s.False(resp.IsTruncated)
+	s.require.Len(resp.Contents, 3)
+	s.Equal("a", resp.Contents[0].Key)
+	s.Equal("b", resp.Contents[1].Key)
+	s.Equal("c/d", resp.Contents[2].Key)
+
+	s.Equal(int64(3), resp.Contents[0].Size)
+	s.Equal(`"f97c5d29941bfb1b2fdab0874906ab82"`, resp.Contents[0].ETag)
+	s.NotEqual("", resp.Contents[0].LastModified)
+}
+
+func (s *FileStorageSuite) TestListSupportsPrefixDelimiterAndMarker() {
+	for _, key := range []string{"x/1", "x/2", "x/3", "x/y/4", "xy", "z"} {
+		s.put(key, key)
+	}
+
+	resp, err := s.storage.List("x/", "", "", 1000)
+	s.require.NoError(err)
+	s.Len(resp.Contents, 4)
+
+	resp, err = s.storage.List("x/", "/", "", 1000)
+	s.require.NoError(err)
+	s.Len(resp.Contents, 3)
+	s.Equal([]string{"x/y/"}, resp.CommonPrefixes)
+
+	resp, err = s.storage.List("x/", "", "", 2)
+	s.require.NoError(err)
+	s.True(resp.IsTruncated)
+	s.require.Len(resp.Contents, 2)
+
+	resp, err = s.storage.List("x/", "", resp.Contents[1].Key, 2)
+	s.require.NoError(err)
+	s.False(resp.IsTruncated)
+	s.require.Len(resp.Contents, 2)
+	s.Equal("x/3", resp.Contents[0].Key)
+	s.Equal("x/y/4", resp.Contents[1].Key)
+
+	resp, err = s.storage.List("missing/", "", "", 1000)
+	s.NoError(err)
+	s.Len(resp.Contents, 0)
+}
+
+func (s *FileStorageSuite) TestListPagesThroughNestedDirectories() {
+	keys := []string{"a-b", "a/b/c", "a/b/d", "a/c", "b/a/a", "b/b", "c"}
+	for _, key := range keys {
+		s.put(key, key)
+	}
+
+	var listed []string
+	marker := ""
+	for {
+		resp, err := s.storage.List("", "", marker, 2)
+		s.require.NoError(err)
+		for _, key := range resp.Contents {
+			listed = append(listed, key.Key)
+		}
+
+		if !resp.IsTruncated {
+			break
+		}
+		marker = listed[len(listed)-1]
+	}
+	s.Equal(keys, listed)
+
+	resp, err := s.storage.List("", "/", "a/b/c", 10)
+	s.require.NoError(err)
+	s.Equal([]string{"b/"}, resp.CommonPrefixes)
+	s.require.Len(resp.Contents, 1)
+	s.Equal("c", resp.Contents[0].Key)
+}
+
+func (s *FileStorageSuite) TestPutsReplaceCachedETags() {
+	mtime := time.Date(2016, time.June, 1, 12, 0, 0, 0, time.UTC)
+	meta := map[string][]string{mtimeMetadataKey: {formatModTime(mtime)}}
+	opts := UploadOptions{Options: s3.Options{Meta: meta}}
+
+	s.require.NoError(s.storage.Put("file", strings.NewReader("abc"), 3, "", s3.Private, opts))
+	info, err := s.storage.Head("file")
+	s.require.NoError(err)
+	s.Equal(`"900150983cd24fb0d6963f7d28e17f72"`, info.ETag)
+
+	// the new content has the same size and modification time.
+	s.require.NoError(s.storage.Put("file", strings.NewReader("xyz"), 3, "", s3.Private, opts))
+	resp, err := s.storage.List("", "", "", 1000)
+	s.require.NoError(err)
+	s.require.Len(resp.Contents, 1)
+	s.Equal(`"d16fb36f0911f878998c136191af705e"`, resp.Contents[0].ETag)
+}
+
+func (s *FileStorageSuite) TestDeleteAndDeleteMultiRemoveFiles() {
+	s.put("one", "1")
+	s.put("two", "2")
+	s.put("three", "3")
+
+	s.NoError(s.storage.Delete("one"))
+	s.NoError(s.storage.Delete("one"))
+	s.NoError(s.storage.DeleteMulti(s3.Delete{Objects: []s3.Object{{Key: "two"}, {Key: "three"}}}))
+
+	resp, err := s.storage.List("", "", "", 1000)
+	s.NoError(err)
+	s.Len(resp.Contents, 0)
+}
+
+func (s *FileStorageSuite) TestLocalBucketSyncRoundTrip() {
+	b := GetLocalBucket("local-bucket", s.root)
+	defer b.Close()
+	s.require.NoError(b.Open(context.Background()))
+
+	pwd, err := os.Getwd()
+	s.require.NoError(err)
+	num, err := numFilesInPath(pwd, false)
+	s.require.NoError(err)
+
+	_, err = b.SyncTo(context.Background(), pwd, "prefix", false)
+	s.NoError(err)
+	s.Len(b.contents(context.Background(), "prefix"), num)
+
+	local := filepath.Join(s.root, "download")
+	_, err = b.SyncFrom(context.Background(), local, "prefix", false)
+	s.NoError(err)
+	downloaded, err := numFilesInPath(local, false)
+	s.NoError(err)
+	s.Equal(num, downloaded)
+
+	original, err := ioutil.ReadFile("bucket.go")
+	s.NoError(err)
+	copied, err := ioutil.ReadFile(filepath.Join(local, "bucket.go"))
+	s.NoError(err)
+	s.True(bytes.Equal(original, copied))
+}
+
+func (s *FileStorageSuite) TestLocalBucketsAreCachedByRoot() {
+	one := GetLocalBucket("cached-local", s.root)
+	defer one.Close()
+
+	s.Exactly(one, GetLocalBucket("cached-local", s.root))
+	s.NotEqual(one, GetLocalBucket("cached-local", filepath.Join(s.root, "other")))
+}
+
+func (s *FileStorageSuite) TestHeadReportsModificationTimeMetadata() {
+	mtime := time.Date(2016, time.June, 1, 12, 0, 0, 0, time.UTC)
+	meta := map[string][]string{mtimeMetadataKey: {formatModTime(mtime)}}
+	s.require.NoError(s.storage.Put("file", strings.NewReader("abc"), 3, "text/plain", s3.Private,
+		UploadOptions{Options: s3.Options{Meta: meta}}))
+
+	info, err := s.storage.Head("file")
+	s.require.NoError(err)
+	s.require.NotNil(info)
+	s.Equal(int64(3), info.Size)
+	s.Equal(`"900150983cd24fb0d6963f7d28e17f72"`, info.ETag)
+	s.True(mtime.Equal(info.LastModified))
+
+	stored, ok := info.ModTime()
+	s.True(ok)
+	s.True(mtime.Equal(stored))
+
+	info, err = s.storage.Head("missing")
+	s.NoError(err)
+	s.Nil(info)
+}
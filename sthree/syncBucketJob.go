@@ -0,0 +1,147 @@
+package sthree
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/goamz/goamz/s3"
+	"github.com/mongodb/amboy"
+	"github.com/mongodb/amboy/dependency"
+	"github.com/mongodb/amboy/job"
+	"github.com/pkg/errors"
+	"github.com/tychoish/grip"
+	"golang.org/x/net/context"
+)
+
+// syncBucketJob implements amboy.Job and is used in conjunction with
+// Bucket's SyncToBucket method to copy objects between buckets in
+// parallel. See the documentation of the Run method for information
+// about the behavior of the job.
+type syncBucketJob struct {
+	source     s3.Key
+	targetFile s3.Key
+	b          *Bucket
+	target     *Bucket
+	report     *SyncReport
+	ctx        context.Context
+
+	*job.Base
+}
+
+func newSyncBucketJob(ctx context.Context, b, target *Bucket, source,
+	targetFile s3.Key) *syncBucketJob {
+	j := &syncBucketJob{
+		ctx:        ctx,
+		source:     source,
+		targetFile: targetFile,
+		b:          b,
+		target:     target,
+		Base: &job.Base{
+			JobType: amboy.JobType{
+				Name:    "s3-sync-bucket",
+				Version: 1,
+			},
+		},
+	}
+
+	j.SetID(fmt.Sprintf("%s.%d.sync-bucket", source.Key, job.GetNumber()))
+	j.SetDependency(dependency.NewAlways())
+	return j
+}
+
+// Run executes the copy job. If the target object does not exist, or
+// has different content from the source object, the job copies the
+// source object to the target.
+func (j *syncBucketJob) Run() {
+	defer j.MarkComplete()
+	start := time.Now()
+
+	if j.ctx.Err() != nil {
+		// the operation was canceled before the job started,
+		// and reports the cancellation itself.
+		return
+	}
+
+	different, err := j.isDifferent()
+	if err != nil {
+		j.report.record(j.targetFile.Key, "", SyncFailed, 0, start, err)
+		j.AddError(err)
+		return
+	}
+
+	if !different {
+		j.report.record(j.targetFile.Key, "", SyncSkipIdentical, 0, start, nil)
+		return
+	}
+
+	grip.Debugf("objects aren't the same: [op=copy, source=%s/%s, target=%s/%s]",
+		j.b.name, j.source.Key, j.target.name, j.targetFile.Key)
+
+	err = j.b.CopyTo(j.ctx, j.target, j.source.Key, j.targetFile.Key)
+	if err != nil {
+		err = errors.Wrapf(err, "problem copying %s/%s during sync",
+			j.b.name, j.source.Key)
+		j.AddError(err)
+	}
+	j.report.record(j.targetFile.Key, "", SyncCopy, j.source.Size, start, err)
+}
+
+// isDifferent compares the ETags of the source and target objects,
+// when the target object exists. Server-side copies of objects that
+// were uploaded in parts have single-part ETags, and the ETags of
+// objects encrypted with SSE-KMS are not checksums, so in these cases
+// isDifferent compares the checksum metadata of the objects, when
+// both have it, or the sizes and the modification time metadata of the
+// objects instead, or, for objects without this metadata, treats the
+// target as current unless it is older than the source.
+func (j *syncBucketJob) isDifferent() (bool, error) {
+	if j.targetFile.ETag == "" {
+		return true, nil
+	}
+
+	if j.source.Size != j.targetFile.Size {
+		return true, nil
+	}
+
+	sourceETag := strings.Trim(j.source.ETag, "\" ")
+	targetETag := strings.Trim(j.targetFile.ETag, "\" ")
+	if sourceETag == targetETag {
+		return false, nil
+	}
+
+	_, sourceMulti := parseMultipartETag(sourceETag)
+	_, targetMulti := parseMultipartETag(targetETag)
+	encrypted := j.b.encryption.Mode == EncryptionKMS || j.target.encryption.Mode == EncryptionKMS
+	if !sourceMulti && !targetMulti && !encrypted {
+		return true, nil
+	}
+
+	source, err := j.b.head(j.ctx, j.source.Key)
+	if err != nil {
+		return false, errors.Wrapf(err, "problem checking %s/%s", j.b.name, j.source.Key)
+	}
+	target, err := j.target.head(j.ctx, j.targetFile.Key)
+	if err != nil {
+		return false, errors.Wrapf(err, "problem checking %s/%s", j.target.name, j.targetFile.Key)
+	}
+	if source == nil || target == nil {
+		return true, nil
+	}
+
+	sourceChecksum := source.checksum()
+	targetChecksum := target.checksum()
+	_, sourceMulti = parseMultipartETag(sourceChecksum)
+	_, targetMulti = parseMultipartETag(targetChecksum)
+	if sourceChecksum != "" && targetChecksum != "" && !sourceMulti && !targetMulti {
+		return sourceChecksum != targetChecksum, nil
+	}
+
+	sourceTime, ok := source.ModTime()
+	targetTime, targetOk := target.ModTime()
+	if ok && targetOk {
+		return sourceTime.Unix() != targetTime.Unix(), nil
+	}
+
+	return target.LastModified.Before(source.LastModified), nil
+}
@@ -1,17 +1,17 @@
 package sthree
 
 import (
-	"crypto/md5"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"strings"
+	"path/filepath"
+	"time"
 
 	"github.com/goamz/goamz/s3"
 	"github.com/mongodb/amboy"
 	"github.com/mongodb/amboy/job"
 	"github.com/pkg/errors"
 	"github.com/tychoish/grip"
+	"golang.org/x/net/context"
 )
 
 // Not making this job public or registering it with amboy because it
@@ -28,12 +28,18 @@ type syncFromJob struct {
 	localPath  string
 	remoteFile s3.Key
 	b          *Bucket
+	cache      *checksumCache
+	journal    *syncJournal
+	report     *SyncReport
+	ctx        context.Context
 
 	*job.Base
 }
 
-func newSyncFromJob(b *Bucket, localPath string, remoteFile s3.Key, withDelete bool) *syncFromJob {
+func newSyncFromJob(ctx context.Context, b *Bucket, localPath string, remoteFile s3.Key,
+	withDelete bool) *syncFromJob {
 	j := &syncFromJob{
+		ctx:        ctx,
 		remoteFile: remoteFile,
 		withDelete: withDelete,
 		localPath:  localPath,
@@ -51,38 +57,90 @@ func newSyncFromJob(b *Bucket, localPath string, remoteFile s3.Key, withDelete b
 	return j
 }
 
-func (j *syncFromJob) doGet() error {
-	err := j.b.Get(j.remoteFile.Key, j.localPath)
+func (j *syncFromJob) doGet(remote *ObjectInfo) error {
+	err := j.b.Get(j.ctx, j.remoteFile.Key, j.localPath)
 
 	if err != nil {
-		return errors.Wrap(err, "problem with s3 get during sync")
+		return errors.Wrapf(err, "problem fetching file '%s' during sync", j.remoteFile.Key)
+	}
+
+	mtime, ok := remote.ModTime()
+	if !ok {
+		mtime = remote.LastModified
+	}
+
+	if !mtime.IsZero() {
+		err = os.Chtimes(j.localPath, mtime, mtime)
+		if err != nil {
+			return errors.Wrapf(err, "problem setting modification time of '%s'", j.localPath)
+		}
+	}
+
+	// the content of the file is the content of the object, so
+	// the checksum of single part objects is the checksum of the
+	// file.
+	checksum := remote.checksum()
+	if _, ok := parseMultipartETag(checksum); j.cache != nil && checksum != "" && !ok {
+		info, err := os.Stat(j.localPath)
+		if err == nil {
+			j.cache.set(j.localPath, info, 0, checksum)
+		}
 	}
 
 	return nil
 }
 
 // Run executes the synchronization job. If the local file doesn't
-// exist, pulls down the remote file, otherwise hashes the local file
-// and compares that hash to the remote file's hash. If they differ,
-// pull the remote file.
+// exist, pulls down the remote file, otherwise compares the local
+// file with the remote file, using the bucket's comparison mode. If
+// they differ, pull the remote file. Downloaded files have the
+// modification time of the file that the remote file was uploaded
+// from, when known. Files that the list result of the sync shows to
+// be identical to their objects skip the HEAD request for the object.
 func (j *syncFromJob) Run() {
 	defer j.MarkComplete()
+	start := time.Now()
+
+	if j.ctx.Err() != nil {
+		// the operation was canceled before the job started,
+		// and reports the cancellation itself.
+		return
+	}
 
 	// if the remote file doesn't exist, we should return early here.
 	if j.remoteFile.Key == "" {
 		return
 	}
 
+	if j.cache == nil {
+		// a cache for this job alone keeps the comparisons with
+		// the list entry and with the object from hashing the
+		// file twice.
+		j.cache = newChecksumCache(filepath.Dir(j.localPath))
+	}
+
+	// if the list result shows that the local file has the same
+	// content as the object, there's no need to check the object.
+	if info, err := os.Stat(j.localPath); err == nil &&
+		j.b.isIdenticalToListed(j.localPath, info, j.remoteFile, j.cache) {
+		j.report.record(j.remoteFile.Key, j.localPath, SyncSkipIdentical, 0, start, nil)
+		j.complete(nil)
+		return
+	}
+
 	// if the remote file has disappeared, we should return early here.
-	exists, err := j.b.Exists(j.remoteFile.Key)
+	remote, err := j.b.head(j.ctx, j.remoteFile.Key)
 	if err != nil {
-		j.AddError(errors.Wrapf(err, "problem checking if the file '%s' exists",
-			j.remoteFile.Key))
+		err = errors.Wrapf(err, "problem checking if the file '%s' exists",
+			j.remoteFile.Key)
+		j.report.record(j.remoteFile.Key, j.localPath, SyncFailed, 0, start, err)
+		j.AddError(err)
 		return
 	}
-	if !exists {
+	if remote == nil {
 		if j.withDelete && !j.b.dryRun {
 			err = os.RemoveAll(j.localPath)
+			j.report.record(j.remoteFile.Key, j.localPath, SyncDelete, 0, start, err)
 			if err != nil {
 				j.AddError(errors.Wrapf(err,
 					"problem removing local file %s, during sync from bucket %s with delete",
@@ -94,6 +152,10 @@ func (j *syncFromJob) Run() {
 			return
 		}
 
+		if j.withDelete {
+			j.report.record(j.remoteFile.Key, j.localPath, SyncDelete, 0, start, nil)
+		}
+
 		grip.NoticeWhenf(j.b.dryRun,
 			"dry-run: would remove local file %s from because it doesn't exist in bucket %s",
 			j.remoteFile.Key, j.b.name)
@@ -107,35 +169,50 @@ func (j *syncFromJob) Run() {
 	}
 
 	// if the local file doesn't exist, download the remote file and return.
-	if _, err = os.Stat(j.localPath); os.IsNotExist(err) {
-		err = j.doGet()
-		if err != nil {
-			j.AddError(errors.Wrap(err, "problem downloading file during sync"))
-		}
+	info, err := os.Stat(j.localPath)
+	if os.IsNotExist(err) {
+		err = j.doGet(remote)
+		j.report.record(j.remoteFile.Key, j.localPath, SyncDownload, remote.Size, start, err)
+		j.complete(err)
+		return
+	}
+	if err != nil {
+		err = errors.Wrapf(err, "problem checking local file %s", j.localPath)
+		j.report.record(j.remoteFile.Key, j.localPath, SyncFailed, 0, start, err)
+		j.AddError(err)
 		return
 	}
 
 	// if both the remote and local files exist, then we should
-	// compare md5 checksums between these file and download the
-	// remote file if they differ.
-
-	// Start by reading the file.
-	data, err := ioutil.ReadFile(j.localPath)
+	// compare these files and download the remote file if they
+	// differ.
+	different, err := j.b.isDifferent(j.localPath, info, remote, false, j.cache)
 	if err != nil {
-		j.AddError(errors.Wrap(err, "problem reading file before hashing for sync operation"))
+		// if we can't read the local file, replace it.
+		grip.Warning(err)
+		different = true
 	}
 
-	remoteChecksum := strings.Trim(j.remoteFile.ETag, "\" ")
-	if fmt.Sprintf("%x", md5.Sum(data)) != remoteChecksum {
-		grip.Debugf("hashes aren't the same: [op=pull, file=%s, local=%x, remote=%s]",
-			j.remoteFile.Key, md5.Sum(data), remoteChecksum)
-		err := j.doGet()
-		if err != nil {
-			j.AddError(errors.Wrapf(err, "problem fetching file '%s' during sync",
-				j.remoteFile.Key))
-			return
-		}
+	if !different {
+		j.report.record(j.remoteFile.Key, j.localPath, SyncSkipIdentical, 0, start, nil)
+		j.complete(nil)
+		return
+	}
+
+	grip.Debugf("files aren't the same: [op=pull, file=%s, mode=%s]",
+		j.remoteFile.Key, j.b.compareMode)
+	err = j.doGet(remote)
+	j.report.record(j.remoteFile.Key, j.localPath, SyncDownload, remote.Size, start, err)
+	j.complete(err)
+}
+
+// complete records the error of the job, or, if the job succeeded,
+// records its completion in the journal of the operation.
+func (j *syncFromJob) complete(err error) {
+	if err != nil {
+		j.AddError(err)
+		return
 	}
 
-	return
+	j.journal.complete(j.remoteFile.Key, pullVersion(j.remoteFile))
 }
@@ -0,0 +1,297 @@
+package sthree
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/goamz/goamz/s3"
+	"github.com/pkg/errors"
+	"github.com/tychoish/grip"
+)
+
+// SyncJournalFilePrefix is the prefix of the names of the journal
+// files, in the root of the local directory of a sync operation, that
+// record the progress of sync operations (see SetSyncJournal.) Sync
+// operations never upload these files.
+const SyncJournalFilePrefix = ".curator-sync-journal"
+
+const (
+	journalPending  = "pending"
+	journalComplete = "complete"
+)
+
+// syncJournal records the files or objects that a sync operation has
+// queued and completed, in a file in the local directory of the
+// operation, so that an operation that does not finish can resume
+// where it stopped. The journal is a file of JSON lines: a header that
+// identifies the operation, followed by an entry for each queued and
+// completed item. The journal appends each entry as it happens, so
+// that it survives the process exiting at any point; a partial last
+// line is ignored.
+//
+// Entries for completed items have the version of the source at the
+// time of the transfer (see pushVersion and pullVersion), and resumed
+// operations only skip items whose source has the same version.
+type syncJournal struct {
+	path         string
+	completed    map[string]string
+	file         *os.File
+	unterminated bool
+	failed       bool
+	closed       bool
+	mutex        sync.Mutex
+}
+
+type syncJournalHeader struct {
+	Operation string `json:"operation"`
+	Bucket    string `json:"bucket"`
+	Prefix    string `json:"prefix"`
+}
+
+type syncJournalEntry struct {
+	Key     string `json:"key"`
+	State   string `json:"state"`
+	Version string `json:"version,omitempty"`
+}
+
+// syncJournalFileName returns the name of the journal file of the
+// operation ("push" or "pull"), which are distinct so that the pull
+// and push operations of a sync into and back out of a directory do
+// not replace each other's journals.
+func syncJournalFileName(operation string) string {
+	return fmt.Sprintf("%s-%s.jsonl", SyncJournalFilePrefix, operation)
+}
+
+// isSyncJournal returns true if the path is a journal file in the
+// root of the local directory.
+func isSyncJournal(local, path string) bool {
+	return filepath.Dir(path) == filepath.Clean(local) &&
+		strings.HasPrefix(filepath.Base(path), SyncJournalFilePrefix)
+}
+
+// openSyncJournal opens the journal of the operation in the local
+// directory. If the directory has a journal of an earlier run of the
+// same operation, with the same bucket and prefix, the journal
+// continues with the entries of the earlier run; otherwise it starts
+// empty.
+func openSyncJournal(local string, header syncJournalHeader) (*syncJournal, error) {
+	j := &syncJournal{
+		path:      filepath.Join(local, syncJournalFileName(header.Operation)),
+		completed: make(map[string]string),
+	}
+
+	resumed := j.load(header)
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_APPEND
+	if !resumed {
+		flags |= os.O_TRUNC
+	}
+
+	file, err := os.OpenFile(j.path, flags, 0644)
+	if err != nil {
+		return nil, errors.Wrapf(err, "problem opening sync journal '%s'", j.path)
+	}
+	j.file = file
+
+	if !resumed {
+		err = j.write(header)
+	} else if j.unterminated {
+		_, err = file.Write([]byte("\n"))
+	}
+	if err != nil {
+		grip.CatchWarning(file.Close())
+		return nil, errors.Wrapf(err, "problem writing sync journal '%s'", j.path)
+	}
+
+	return j, nil
+}
+
+// load reads the entries of an existing journal for the operation,
+// and returns false if there is no such journal. Lines that are not
+// valid entries, such as a partial line written as the process
+// exited, are ignored.
+func (j *syncJournal) load(header syncJournalHeader) bool {
+	data, err := ioutil.ReadFile(j.path)
+	if os.IsNotExist(err) {
+		return false
+	}
+	if err != nil {
+		grip.Warning(errors.Wrapf(err, "problem reading sync journal '%s', starting over", j.path))
+		return false
+	}
+
+	lines := bytes.Split(data, []byte("\n"))
+
+	existing := syncJournalHeader{}
+	if err = json.Unmarshal(lines[0], &existing); err != nil || existing != header {
+		grip.Noticef("sync journal '%s' is not for sync %s %s/%s, starting over",
+			j.path, header.Operation, header.Bucket, header.Prefix)
+		return false
+	}
+
+	pending := make(map[string]bool)
+	for _, line := range lines[1:] {
+		entry := syncJournalEntry{}
+		if err = json.Unmarshal(line, &entry); err != nil {
+			grip.DebugWhenf(len(line) > 0, "ignoring invalid entry in sync journal '%s'", j.path)
+			continue
+		}
+
+		switch entry.State {
+		case journalPending:
+			pending[entry.Key] = true
+		case journalComplete:
+			delete(pending, entry.Key)
+			j.completed[entry.Key] = entry.Version
+		}
+	}
+
+	// start a new line after a partial last line.
+	j.unterminated = len(data) > 0 && data[len(data)-1] != '\n'
+
+	grip.Noticef("resuming sync %s %s/%s from journal '%s': %d items completed, %d in progress",
+		header.Operation, header.Bucket, header.Prefix, j.path, len(j.completed), len(pending))
+
+	return true
+}
+
+// write appends a line to the journal.
+func (j *syncJournal) write(record interface{}) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return errors.Wrap(err, "problem encoding sync journal entry")
+	}
+
+	_, err = j.file.Write(append(data, '\n'))
+	return errors.Wrapf(err, "problem writing sync journal '%s'", j.path)
+}
+
+// add appends an entry to the journal. The journal only warns about
+// the first error, as the journal is not necessary for the operation
+// to succeed. Adding entries to a nil journal, or to a journal that
+// is closed, is a noop: jobs of a canceled operation may complete
+// after the operation closes the journal.
+func (j *syncJournal) add(entry syncJournalEntry) {
+	if j == nil {
+		return
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	if j.closed {
+		return
+	}
+
+	if err := j.write(entry); err != nil && !j.failed {
+		j.failed = true
+		grip.Warning(errors.Wrap(err, "the sync will not be able to resume from the journal"))
+	}
+}
+
+// queued records that the operation queued the key.
+func (j *syncJournal) queued(key string) {
+	j.add(syncJournalEntry{Key: key, State: journalPending})
+}
+
+// complete records that the operation completed the key, with the
+// version of its source.
+func (j *syncJournal) complete(key, version string) {
+	j.add(syncJournalEntry{Key: key, State: journalComplete, Version: version})
+}
+
+// isComplete returns true if an earlier run of the operation
+// completed the key, with the same version of its source. A nil
+// journal has no completed keys.
+func (j *syncJournal) isComplete(key, version string) bool {
+	if j == nil {
+		return false
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	completed, ok := j.completed[key]
+	return ok && completed == version
+}
+
+// close closes the journal, and removes it if the operation
+// succeeded, as there is nothing to resume. The journal of an
+// operation that failed or was canceled remains, so that the next run
+// can resume. Closing a nil journal is a noop.
+func (j *syncJournal) close(succeeded bool) {
+	if j == nil {
+		return
+	}
+
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+
+	j.closed = true
+	grip.Warning(errors.Wrapf(j.file.Close(), "problem closing sync journal '%s'", j.path))
+
+	if succeeded {
+		grip.Warning(errors.Wrapf(os.Remove(j.path), "problem removing sync journal '%s'", j.path))
+		return
+	}
+
+	grip.Noticef("keeping sync journal '%s' so that the sync can resume", j.path)
+}
+
+// pushVersion returns the version of a local file for the journal of
+// a push operation.
+func pushVersion(info os.FileInfo) string {
+	return fmt.Sprintf("%d:%d", info.Size(), info.ModTime().UnixNano())
+}
+
+// pullVersion returns the version of an object for the journal of a
+// pull operation.
+func pullVersion(key s3.Key) string {
+	return fmt.Sprintf("%s:%d", key.ETag, key.Size)
+}
+
+// SetSyncJournal enables or disables the sync journal of SyncTo and
+// SyncFrom. With the journal, sync operations record the files or
+// objects that they queue and complete in a journal file in the local
+// directory, and remove the journal when they succeed. When an
+// operation fails, is canceled, or the process exits, the journal
+// remains, and the next sync in the same direction between the same
+// directory, bucket, and prefix resumes: it skips the files and
+// objects that the earlier run completed, unless they changed since,
+// without comparing them with the destination again. Dry-run
+// operations do not use journals.
+func (b *Bucket) SetSyncJournal(enabled bool) {
+	b.useSyncJournal = enabled
+}
+
+// openSyncJournal returns the journal for a sync operation on the
+// local directory, or nil if the bucket does not use a journal.
+func (b *Bucket) openSyncJournal(local, operation, prefix string) *syncJournal {
+	if !b.useSyncJournal || b.dryRun {
+		return nil
+	}
+
+	if info, err := os.Stat(local); err == nil && !info.IsDir() {
+		return nil
+	}
+
+	if err := os.MkdirAll(local, 0755); err != nil {
+		grip.Warning(errors.Wrapf(err, "problem creating directory '%s' for sync journal", local))
+		return nil
+	}
+
+	j, err := openSyncJournal(local,
+		syncJournalHeader{Operation: operation, Bucket: b.name, Prefix: prefix})
+	if err != nil {
+		grip.Warning(errors.Wrap(err, "continuing without a sync journal"))
+		return nil
+	}
+
+	return j
+}
@@ -0,0 +1,232 @@
+package sthree
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SyncProgress describes the state of a sync operation in progress.
+// Considered counts the files or objects that the operation has found
+// so far, Queued the ones that passed the filter, and Completed the
+// ones that the operation has finished with (see SyncReport), which
+// includes Failed. Bytes is the amount of data transferred by
+// completed transfers, out of QueuedBytes, the size of all queued
+// files or objects.
+type SyncProgress struct {
+	Operation   string        `json:"operation"`
+	Bucket      string        `json:"bucket"`
+	Prefix      string        `json:"prefix"`
+	Considered  int           `json:"considered"`
+	Queued      int           `json:"queued"`
+	Completed   int           `json:"completed"`
+	Failed      int           `json:"failed"`
+	Bytes       int64         `json:"bytes"`
+	QueuedBytes int64         `json:"queued_bytes"`
+	Elapsed     time.Duration `json:"elapsed_ns"`
+
+	// Scanned is true once the operation has queued all files or
+	// objects, and Done is true for the last progress update of
+	// the operation.
+	Scanned bool `json:"scanned"`
+	Done    bool `json:"done"`
+}
+
+// ETA estimates the time until the operation completes from the rate
+// at which it has completed files or objects so far. Returns false
+// if there is not enough progress to make an estimate.
+func (p SyncProgress) ETA() (time.Duration, bool) {
+	if p.Done {
+		return 0, true
+	}
+
+	if p.Completed == 0 || !p.Scanned {
+		return 0, false
+	}
+
+	perItem := p.Elapsed / time.Duration(p.Completed)
+	return perItem * time.Duration(p.Queued-p.Completed), true
+}
+
+// String returns a one-line summary of the progress, for log messages
+// and progress displays.
+func (p SyncProgress) String() string {
+	parts := []string{
+		fmt.Sprintf("sync %s %s/%s:", p.Operation, p.Bucket, p.Prefix),
+		fmt.Sprintf("%d/%d done", p.Completed, p.Queued),
+	}
+
+	if p.Failed > 0 {
+		parts = append(parts, fmt.Sprintf("(%d failed)", p.Failed))
+	}
+
+	parts = append(parts, fmt.Sprintf("[%d considered]", p.Considered),
+		fmt.Sprintf("%d bytes transferred,", p.Bytes),
+		fmt.Sprintf("elapsed %s", p.Elapsed-p.Elapsed%time.Second))
+
+	if eta, ok := p.ETA(); ok && !p.Done {
+		parts = append(parts, fmt.Sprintf("eta %s", eta-eta%time.Second))
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// ProgressHandler receives progress updates from sync operations.
+// Sync operations call the handler from a single goroutine at a time.
+type ProgressHandler func(SyncProgress)
+
+// SetProgressHandler sets a function that SyncTo, SyncFrom, and
+// SyncToBucket call with their progress every interval, and once when
+// they finish. An interval of 0 only reports the final progress, and
+// a nil handler disables progress reporting.
+func (b *Bucket) SetProgressHandler(interval time.Duration, handler ProgressHandler) {
+	b.progressInterval = interval
+	b.progressHandler = handler
+}
+
+// progressTracker counts the progress of a sync operation, and
+// delivers updates to the bucket's progress handler. All methods are
+// noops for nil trackers, which sync operations use when the bucket
+// does not have a progress handler.
+type progressTracker struct {
+	progress SyncProgress
+	start    time.Time
+	handler  ProgressHandler
+	stopped  bool
+	done     chan struct{}
+	wg       sync.WaitGroup
+	mutex    sync.Mutex
+}
+
+// trackProgress returns a tracker for the operation of the report,
+// which the report updates as the operation completes items, or nil
+// if the bucket has no progress handler.
+func (b *Bucket) trackProgress(report *SyncReport) *progressTracker {
+	if b.progressHandler == nil {
+		return nil
+	}
+
+	t := &progressTracker{
+		progress: SyncProgress{
+			Operation: report.Operation,
+			Bucket:    report.Bucket,
+			Prefix:    report.Prefix,
+		},
+		start:   time.Now(),
+		handler: b.progressHandler,
+		done:    make(chan struct{}),
+	}
+	report.progress = t
+
+	if b.progressInterval > 0 {
+		t.wg.Add(1)
+		go t.report(b.progressInterval)
+	}
+
+	return t
+}
+
+func (t *progressTracker) report(interval time.Duration) {
+	defer t.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.done:
+			return
+		case <-ticker.C:
+			t.handler(t.snapshot())
+		}
+	}
+}
+
+func (t *progressTracker) snapshot() SyncProgress {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	p := t.progress
+	p.Elapsed = time.Since(t.start)
+	return p
+}
+
+// consider counts a file or object that the operation found.
+func (t *progressTracker) consider() {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.progress.Considered++
+}
+
+// queue counts a file or object, of the specified size, that the
+// operation queued.
+func (t *progressTracker) queue(size int64) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.progress.Queued++
+	t.progress.QueuedBytes += size
+}
+
+// scanned records that the operation has queued all items.
+func (t *progressTracker) scanned() {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	t.progress.Scanned = true
+}
+
+// complete counts an item of the operation's report. Items that the
+// report records after the tracker stops, such as the deletions of
+// SyncToBucket, do not count.
+func (t *progressTracker) complete(item SyncReportItem) {
+	if t == nil {
+		return
+	}
+
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	if t.stopped {
+		return
+	}
+
+	t.progress.Completed++
+	t.progress.Bytes += item.Bytes
+	if item.Action == SyncFailed {
+		t.progress.Failed++
+	}
+}
+
+// stop stops the periodic updates, and delivers the final progress
+// of the operation to the handler.
+func (t *progressTracker) stop() {
+	if t == nil {
+		return
+	}
+
+	close(t.done)
+	t.wg.Wait()
+
+	t.mutex.Lock()
+	t.stopped = true
+	t.progress.Scanned = true
+	t.progress.Done = true
+	t.mutex.Unlock()
+
+	t.handler(t.snapshot())
+}
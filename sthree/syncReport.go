@@ -0,0 +1,218 @@
+package sthree
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// SyncAction describes what a sync operation did, or, in dry-run
+// mode, would do, with a single file or object.
+type SyncAction string
+
+const (
+	// SyncUpload reports files that SyncTo uploaded.
+	SyncUpload SyncAction = "upload"
+
+	// SyncDownload reports objects that SyncFrom downloaded.
+	SyncDownload SyncAction = "download"
+
+	// SyncCopy reports objects that SyncToBucket copied.
+	SyncCopy SyncAction = "copy"
+
+	// SyncSkipIdentical reports files and objects that did not
+	// need a transfer, because the source and destination were
+	// the same.
+	SyncSkipIdentical SyncAction = "skip-identical"
+
+	// SyncSkipCompleted reports files and objects that a resumed
+	// sync operation skipped, because the run that it resumed
+	// completed them (see SetSyncJournal.)
+	SyncSkipCompleted SyncAction = "skip-completed"
+
+	// SyncDelete reports objects or files that a sync operation in
+	// delete mode removed from the destination.
+	SyncDelete SyncAction = "delete"
+
+	// SyncSkipMissing reports keys that DeleteMany skipped,
+	// because no object has the key.
+	SyncSkipMissing SyncAction = "skip-missing"
+
+	// SyncRestore reports objects that RestoreTo restored to an
+	// earlier version.
+	SyncRestore SyncAction = "restore"
+
+	// SyncUndelete reports objects that Undelete restored by
+	// removing their delete markers.
+	SyncUndelete SyncAction = "undelete"
+
+	// SyncKeep reports objects that Expire kept, because the
+	// retention policy did not select them.
+	SyncKeep SyncAction = "keep"
+
+	// SyncFailed reports files and objects that a sync operation
+	// could not process. The Error field of the item describes the
+	// error.
+	SyncFailed SyncAction = "failed"
+)
+
+// SyncReportItem describes the result of a sync operation for a single
+// file or object.
+type SyncReportItem struct {
+	Key      string        `json:"key"`
+	Path     string        `json:"path,omitempty"`
+	Action   SyncAction    `json:"action"`
+	Bytes    int64         `json:"bytes"`
+	Duration time.Duration `json:"duration_ns"`
+	Error    string        `json:"error,omitempty"`
+
+	// Reason is the retention rule that selected the object, for
+	// objects that Expire deleted.
+	Reason string `json:"reason,omitempty"`
+}
+
+// SyncReport describes the result of a sync operation: the action for
+// each file or object that the operation considered, and the number of
+// bytes it transferred. The report of a dry-run operation is the plan
+// of the operation. Reports of canceled operations only include the
+// files and objects that the operation processed before the
+// cancellation: the report drops the items that jobs of the operation
+// record after the operation returns. Reports are safe for concurrent
+// use.
+type SyncReport struct {
+	Operation string           `json:"operation"`
+	Bucket    string           `json:"bucket"`
+	Prefix    string           `json:"prefix"`
+	Local     string           `json:"local,omitempty"`
+	Target    string           `json:"target,omitempty"`
+	DryRun    bool             `json:"dry_run"`
+	Canceled  bool             `json:"canceled,omitempty"`
+	Start     time.Time        `json:"start"`
+	End       time.Time        `json:"end"`
+	Items     []SyncReportItem `json:"items"`
+
+	progress *progressTracker
+	finished bool
+	mutex    sync.Mutex
+}
+
+func newSyncReport(b *Bucket, operation, prefix string) *SyncReport {
+	return &SyncReport{
+		Operation: operation,
+		Bucket:    b.name,
+		Prefix:    prefix,
+		DryRun:    b.dryRun,
+		Start:     time.Now(),
+		Items:     []SyncReportItem{},
+	}
+}
+
+// add records an item, and counts it in the progress of the
+// operation, if tracked. add is a noop for nil reports, so that sync
+// jobs do not require a report, and for finished reports, as jobs of
+// a canceled operation may complete after the operation returns.
+func (r *SyncReport) add(item SyncReportItem) {
+	if r == nil {
+		return
+	}
+
+	r.mutex.Lock()
+	if r.finished {
+		r.mutex.Unlock()
+		return
+	}
+	r.Items = append(r.Items, item)
+	r.mutex.Unlock()
+
+	r.progress.complete(item)
+}
+
+// record adds an item for the key and local path, with the action and
+// bytes transferred, timed from start. If err is not nil, the action
+// is SyncFailed.
+func (r *SyncReport) record(key, path string, action SyncAction, bytes int64, start time.Time,
+	err error) {
+	item := SyncReportItem{
+		Key:      key,
+		Path:     path,
+		Action:   action,
+		Bytes:    bytes,
+		Duration: time.Since(start),
+	}
+
+	if err != nil {
+		item.Action = SyncFailed
+		item.Bytes = 0
+		item.Error = err.Error()
+	}
+
+	r.add(item)
+}
+
+// finish sorts the items of the report by key, sets the end time,
+// and marks the report as canceled if the operation's context was
+// canceled. The report does not change after finish returns.
+func (r *SyncReport) finish(ctx context.Context) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.finished = true
+
+	sort.Stable(reportItemsByKey(r.Items))
+	r.Canceled = ctx.Err() != nil
+	r.End = time.Now()
+}
+
+type reportItemsByKey []SyncReportItem
+
+func (items reportItemsByKey) Len() int           { return len(items) }
+func (items reportItemsByKey) Swap(i, j int)      { items[i], items[j] = items[j], items[i] }
+func (items reportItemsByKey) Less(i, j int) bool { return items[i].Key < items[j].Key }
+
+// Count returns the number of items with the action.
+func (r *SyncReport) Count(action SyncAction) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var count int
+	for _, item := range r.Items {
+		if item.Action == action {
+			count++
+		}
+	}
+
+	return count
+}
+
+// Bytes returns the total number of bytes that the operation
+// transferred, or in dry-run mode, would transfer.
+func (r *SyncReport) Bytes() int64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	var total int64
+	for _, item := range r.Items {
+		total += item.Bytes
+	}
+
+	return total
+}
+
+// WriteJSON writes the report, as indented JSON, to the writer.
+func (r *SyncReport) WriteJSON(w io.Writer) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	data, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "problem encoding sync report")
+	}
+
+	_, err = w.Write(append(data, '\n'))
+	return errors.Wrap(err, "problem writing sync report")
+}
@@ -1,11 +1,10 @@
 package sthree
 
 import (
-	"crypto/md5"
 	"fmt"
-	"io/ioutil"
 	"os"
-	"strings"
+	"path/filepath"
+	"time"
 
 	"github.com/goamz/goamz/s3"
 	"github.com/mongodb/amboy"
@@ -13,6 +12,7 @@ import (
 	"github.com/mongodb/amboy/job"
 	"github.com/pkg/errors"
 	"github.com/tychoish/grip"
+	"golang.org/x/net/context"
 )
 
 // Not making this job public or registering it with amboy because it
@@ -29,12 +29,18 @@ type syncToJob struct {
 	localPath  string
 	remoteFile s3.Key
 	b          *Bucket
+	cache      *checksumCache
+	journal    *syncJournal
+	report     *SyncReport
+	ctx        context.Context
 
 	*job.Base
 }
 
-func newSyncToJob(b *Bucket, localPath string, remoteFile s3.Key, withDelete bool) *syncToJob {
+func newSyncToJob(ctx context.Context, b *Bucket, localPath string, remoteFile s3.Key,
+	withDelete bool) *syncToJob {
 	j := &syncToJob{
+		ctx:        ctx,
 		withDelete: withDelete,
 		remoteFile: remoteFile,
 		localPath:  localPath,
@@ -53,7 +59,7 @@ func newSyncToJob(b *Bucket, localPath string, remoteFile s3.Key, withDelete boo
 }
 
 func (j *syncToJob) doPut() error {
-	err := j.b.Put(j.localPath, j.remoteFile.Key)
+	err := j.b.Put(j.ctx, j.localPath, j.remoteFile.Key)
 
 	if err != nil {
 		return errors.Wrap(err, "s3 error with put during sync")
@@ -65,16 +71,27 @@ func (j *syncToJob) doPut() error {
 // Run executes the synchronization job. If local file doesn't exist
 // this operation becomes a noop. Otherwise, will always upload the
 // local file if a remote file exists, and if both the local and
-// remote file exists, compares the hashes between these files and
-// uploads the local file if it differs from the remote file.
+// remote file exists, compares these files, using the bucket's
+// comparison mode, and uploads the local file if it differs from the
+// remote file. Files that the list result of the sync shows to be
+// identical to their objects skip the HEAD request for the object.
 func (j *syncToJob) Run() {
 	defer j.MarkComplete()
+	start := time.Now()
+
+	if j.ctx.Err() != nil {
+		// the operation was canceled before the job started,
+		// and reports the cancellation itself.
+		return
+	}
 
 	// if the local file doesn't exist or has disappeared since
 	// the job was created, there's nothing to do, we can return early
-	if _, err := os.Stat(j.localPath); os.IsNotExist(err) {
+	info, err := os.Stat(j.localPath)
+	if os.IsNotExist(err) {
 		if j.withDelete && !j.b.dryRun {
-			err := j.b.Delete(j.remoteFile.Key)
+			err := j.b.Delete(j.ctx, j.remoteFile.Key)
+			j.report.record(j.remoteFile.Key, j.localPath, SyncDelete, 0, start, err)
 			if err != nil {
 				j.AddError(errors.Wrapf(err,
 					"problem deleting %s from bucket %s",
@@ -85,6 +102,10 @@ func (j *syncToJob) Run() {
 			return
 		}
 
+		if j.withDelete {
+			j.report.record(j.remoteFile.Key, j.localPath, SyncDelete, 0, start, nil)
+		}
+
 		grip.NoticeWhenf(j.b.dryRun,
 			"dry-run: would delete remote file %s from bucket %s because it doesn't exist locally",
 			j.remoteFile.Key, j.b.name)
@@ -94,61 +115,81 @@ func (j *syncToJob) Run() {
 
 		return
 	}
+	if err != nil {
+		err = errors.Wrapf(err, "problem checking local file %s", j.localPath)
+		j.report.record(j.remoteFile.Key, j.localPath, SyncFailed, 0, start, err)
+		j.AddError(err)
+		return
+	}
+
+	if j.cache == nil {
+		// a cache for this job alone keeps the comparisons with
+		// the list entry and with the object from hashing the
+		// file twice.
+		j.cache = newChecksumCache(filepath.Dir(j.localPath))
+	}
+
+	// if the list result shows that the object has the same
+	// content as the file, there's no need to check the object.
+	if j.b.isIdenticalToListed(j.localPath, info, j.remoteFile, j.cache) {
+		j.journal.complete(j.remoteFile.Key, pushVersion(info))
+		j.report.record(j.remoteFile.Key, j.localPath, SyncSkipIdentical, 0, start, nil)
+		return
+	}
 
 	// first double check that it doesn't exist (s3 is eventually
 	// consistent.) if the file has appeared since we created the
-	// task can safely fall through this case and compare hashes,
-	// otherwise we should put it here.
-	exists, err := j.b.Exists(j.remoteFile.Key)
+	// task can safely fall through this case and compare the
+	// files, otherwise we should put it here.
+	remote, err := j.b.head(j.ctx, j.remoteFile.Key)
 	if err != nil {
-		j.AddError(errors.Wrapf(err,
+		err = errors.Wrapf(err,
 			"problem checking if the file '%s' exists in the bucket %s",
-			j.localPath, j.b.name))
+			j.localPath, j.b.name)
+		j.report.record(j.remoteFile.Key, j.localPath, SyncFailed, 0, start, err)
+		j.AddError(err)
 		return
 	}
-	if !exists {
+	if remote == nil {
 		grip.Debugf("uploading %s because remote file %s/%s does not exist",
 			j.localPath, j.b.name, j.remoteFile.Key)
 		err = j.doPut()
 		if err != nil {
-			j.AddError(errors.Wrapf(err, "problem uploading file %s -> %s",
-				j.localPath, j.remoteFile.Key))
-			return
+			err = errors.Wrapf(err, "problem uploading file %s -> %s",
+				j.localPath, j.remoteFile.Key)
+			j.AddError(err)
+		} else {
+			j.journal.complete(j.remoteFile.Key, pushVersion(info))
 		}
+		j.report.record(j.remoteFile.Key, j.localPath, SyncUpload, info.Size(), start, err)
+		return
 	}
 
-	remoteChecksum := strings.Trim(j.remoteFile.ETag, "\" ")
-
-	// if s3 doesn't know what the hash of the remote file is or
-	// returns it to us, then we don't need to hash it locally,
-	// because we'll always upload it in that situation.
-	if remoteChecksum == "" {
-		grip.Debugf("s3 does not report a hash for %s, uploading file", j.remoteFile.Key)
-		err = j.doPut()
-		if err != nil {
-			j.AddError(errors.Wrapf(err, "problem uploading file '%s' during sync",
-				j.remoteFile.Key))
-		}
+	// if the remote object exists, then we should compare the
+	// local and remote objects and upload the local file if they
+	// differ.
+	different, err := j.b.isDifferent(j.localPath, info, remote, true, j.cache)
+	if err != nil {
+		j.report.record(j.remoteFile.Key, j.localPath, SyncFailed, 0, start, err)
+		j.AddError(err)
 		return
 	}
 
-	// if the remote object exists, then we should compare md5
-	// checksums between the local and remote objects and upload
-	// the local file if they differ.
-	data, err := ioutil.ReadFile(j.localPath)
-	if err != nil {
-		j.AddError(errors.Wrap(err,
-			"problem reading file before hashing for sync operation"))
+	if !different {
+		j.journal.complete(j.remoteFile.Key, pushVersion(info))
+		j.report.record(j.remoteFile.Key, j.localPath, SyncSkipIdentical, 0, start, nil)
 		return
 	}
 
-	if fmt.Sprintf("%x", md5.Sum(data)) != remoteChecksum {
-		grip.Debugf("hashes aren't the same: [op=push, file=%s, local=%x, remote=%s]",
-			j.remoteFile.Key, md5.Sum(data), remoteChecksum)
-		err = j.doPut()
-		if err != nil {
-			j.AddError(errors.Wrapf(err, "problem uploading file '%s' during sync",
-				j.remoteFile.Key))
-		}
+	grip.Debugf("files aren't the same: [op=push, file=%s, mode=%s]",
+		j.remoteFile.Key, j.b.compareMode)
+	err = j.doPut()
+	if err != nil {
+		err = errors.Wrapf(err, "problem uploading file '%s' during sync",
+			j.remoteFile.Key)
+		j.AddError(err)
+	} else {
+		j.journal.complete(j.remoteFile.Key, pushVersion(info))
 	}
+	j.report.record(j.remoteFile.Key, j.localPath, SyncUpload, info.Size(), start, err)
 }
@@ -0,0 +1,248 @@
+package sthree
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/goamz/goamz/aws"
+	"github.com/goamz/goamz/s3"
+	"github.com/mongodb/curator/sthree/fakes3"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+// SyncBucketSuite tests copies and syncs between buckets, using a
+// dedicated fake S3 server with a source and a target bucket.
+type SyncBucketSuite struct {
+	srv     *fakes3.Server
+	source  *Bucket
+	target  *Bucket
+	tempDir string
+	require *require.Assertions
+	suite.Suite
+}
+
+func TestSyncBucketSuite(t *testing.T) {
+	suite.Run(t, new(SyncBucketSuite))
+}
+
+func (s *SyncBucketSuite) SetupSuite() {
+	s.require = s.Require()
+}
+
+func (s *SyncBucketSuite) SetupTest() {
+	tempDir, err := ioutil.TempDir("", uuid.NewV4().String())
+	s.require.NoError(err)
+	s.tempDir = tempDir
+
+	s.srv = fakes3.NewServer()
+	s.source = s.newBucket("source")
+	s.target = s.newBucket("target")
+	s.require.NoError(s.source.Open(context.Background()))
+}
+
+func (s *SyncBucketSuite) TearDownTest() {
+	s.source.Close()
+	s.srv.Close()
+	s.NoError(os.RemoveAll(s.tempDir))
+}
+
+func (s *SyncBucketSuite) newBucket(name string) *Bucket {
+	auth := aws.Auth{AccessKey: "fake", SecretKey: "fake"}
+
+	return &Bucket{
+		name:    name,
+		numJobs: 2,
+		retry:   RetryPolicy{MaxAttempts: 1},
+		storage: NewS3Storage(s3.New(auth, s.srv.Region()).Bucket(name)),
+	}
+}
+
+func (s *SyncBucketSuite) put(b *Bucket, key, content string) {
+	fileName := filepath.Join(s.tempDir, uuid.NewV4().String())
+	s.require.NoError(ioutil.WriteFile(fileName, []byte(content), 0644))
+	s.require.NoError(b.Put(context.Background(), fileName, key))
+}
+
+func (s *SyncBucketSuite) read(b *Bucket, key string) string {
+	reader, err := b.storage.Get(key)
+	s.require.NoError(err)
+	defer reader.Close()
+
+	data, err := ioutil.ReadAll(reader)
+	s.require.NoError(err)
+	return string(data)
+}
+
+func isObjectGet(r *http.Request) bool {
+	return r.Method == "GET" && strings.Count(strings.Trim(r.URL.Path, "/"), "/") > 0
+}
+
+func isCopy(r *http.Request) bool {
+	return r.Header.Get("X-Amz-Copy-Source") != ""
+}
+
+func (s *SyncBucketSuite) TestCopyToCopiesOnTheServer() {
+	s.put(s.source, "dir/a file+1", "content")
+
+	// downloads would fail.
+	s.srv.FailRequests(100, isObjectGet)
+	s.NoError(s.source.CopyTo(context.Background(), s.target, "dir/a file+1", "copy/a file+1"))
+	s.srv.FailRequests(0, nil)
+
+	s.Equal([]string{"copy/a file+1"}, s.srv.Keys("target"))
+	s.Equal("content", s.read(s.target, "copy/a file+1"))
+
+	source, err := s.source.head(context.Background(), "dir/a file+1")
+	s.require.NoError(err)
+	target, err := s.target.head(context.Background(), "copy/a file+1")
+	s.require.NoError(err)
+	s.Equal(source.Meta[mtimeMetadataKey], target.Meta[mtimeMetadataKey])
+	s.Equal(source.ETag, target.ETag)
+}
+
+func (s *SyncBucketSuite) TestCopyToWithinBucket() {
+	s.put(s.source, "a", "content")
+
+	s.NoError(s.source.CopyTo(context.Background(), s.source, "a", "b"))
+	s.Equal([]string{"a", "b"}, s.srv.Keys("source"))
+}
+
+func (s *SyncBucketSuite) TestCopyToMissingObjectIsAnError() {
+	s.Error(s.source.CopyTo(context.Background(), s.target, "missing", "missing"))
+	s.Len(s.srv.Keys("target"), 0)
+}
+
+func (s *SyncBucketSuite) TestCopyToDryRunTargetDoesNotCopy() {
+	s.put(s.source, "a", "content")
+
+	target, err := s.target.DryRunClone()
+	s.require.NoError(err)
+	s.NoError(s.source.CopyTo(context.Background(), target, "a", "a"))
+	s.Len(s.srv.Keys("target"), 0)
+}
+
+func (s *SyncBucketSuite) TestCopyBetweenStorageTypesDownloadsObjects() {
+	local := &Bucket{
+		name:    "local",
+		retry:   RetryPolicy{MaxAttempts: 1},
+		storage: NewFileSystemStorage(filepath.Join(s.tempDir, "local")),
+	}
+	s.put(local, "a", "local content")
+
+	info, err := local.head(context.Background(), "a")
+	s.require.NoError(err)
+
+	s.NoError(local.CopyTo(context.Background(), s.target, "a", "b"))
+	s.Equal("local content", s.read(s.target, "b"))
+
+	target, err := s.target.head(context.Background(), "b")
+	s.require.NoError(err)
+	s.Equal(info.Meta[mtimeMetadataKey], target.Meta[mtimeMetadataKey])
+}
+
+func (s *SyncBucketSuite) TestSyncToBucketOnlyCopiesChanges() {
+	s.put(s.source, "staging/a", "a")
+	s.put(s.source, "staging/b", "b")
+	s.put(s.source, "staging/c", "c")
+	s.put(s.target, "prod/b", "b")
+	s.put(s.target, "prod/c", "old c")
+	s.put(s.target, "prod/d", "d")
+	s.put(s.target, "other", "other")
+
+	// a copy of "b" would fail.
+	s.srv.FailRequests(1, func(r *http.Request) bool {
+		return isCopy(r) && strings.HasSuffix(r.URL.Path, "/b")
+	})
+	_, err := s.source.SyncToBucket(context.Background(), s.target, "staging", "prod", true)
+	s.NoError(err)
+	s.srv.FailRequests(0, nil)
+
+	s.Equal([]string{"other", "prod/a", "prod/b", "prod/c"}, s.srv.Keys("target"))
+	s.Equal("c", s.read(s.target, "prod/c"))
+}
+
+func (s *SyncBucketSuite) TestSyncToBucketWithoutDeleteKeepsExtraObjects() {
+	s.put(s.source, "staging/a", "a")
+	s.put(s.target, "prod/d", "d")
+
+	_, err := s.source.SyncToBucket(context.Background(), s.target, "staging/", "prod/", false)
+	s.NoError(err)
+	s.Equal([]string{"prod/a", "prod/d"}, s.srv.Keys("target"))
+}
+
+func (s *SyncBucketSuite) TestSyncToBucketUsesFilter() {
+	s.put(s.source, "staging/repodata/repomd.xml", "xml")
+	s.put(s.source, "staging/index.html", "html")
+	s.put(s.target, "prod/index.html", "html")
+	s.put(s.target, "prod/extra.html", "html")
+
+	f := NewFilter()
+	s.require.NoError(f.Exclude("*.html"))
+	s.source.SetFilter(f)
+
+	_, err := s.source.SyncToBucket(context.Background(), s.target, "staging", "prod", true)
+	s.NoError(err)
+
+	// excluded objects in the target are not deleted.
+	s.Equal([]string{"prod/extra.html", "prod/index.html", "prod/repodata/repomd.xml"},
+		s.srv.Keys("target"))
+}
+
+func (s *SyncBucketSuite) TestSyncToBucketDoesNotRecopyMultipartObjects() {
+	data := make([]byte, minPartSize+1024)
+	_, err := rand.Read(data)
+	s.require.NoError(err)
+
+	fileName := filepath.Join(s.tempDir, "large")
+	s.require.NoError(ioutil.WriteFile(fileName, data, 0644))
+	s.require.NoError(s.source.SetMultipartThreshold(minPartSize))
+	s.require.NoError(s.source.Put(context.Background(), fileName, "staging/large"))
+
+	_, err = s.source.SyncToBucket(context.Background(), s.target, "staging", "prod", false)
+	s.NoError(err)
+	s.True(bytes.Equal(data, []byte(s.read(s.target, "prod/large"))))
+
+	source, err := s.source.head(context.Background(), "staging/large")
+	s.require.NoError(err)
+	target, err := s.target.head(context.Background(), "prod/large")
+	s.require.NoError(err)
+	s.NotEqual(source.ETag, target.ETag)
+
+	// another copy would fail.
+	s.srv.FailRequests(1, isCopy)
+	_, err = s.source.SyncToBucket(context.Background(), s.target, "staging", "prod", false)
+	s.NoError(err)
+	s.srv.FailRequests(0, nil)
+}
+
+func (s *SyncBucketSuite) TestSyncToBucketWithLocalStorage() {
+	root := filepath.Join(s.tempDir, "buckets")
+	source := GetLocalBucket("local-source", root)
+	target := GetLocalBucket("local-target", root)
+	s.require.NoError(source.Open(context.Background()))
+	defer source.Close()
+
+	s.put(source, "a/one", "1")
+	s.put(source, "a/two", "2")
+
+	_, err := source.SyncToBucket(context.Background(), target, "a", "b", false)
+	s.NoError(err)
+
+	var keys []string
+	for key := range target.contents(context.Background(), "") {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	s.Equal([]string{"b/one", "b/two"}, keys)
+	s.Equal("2", s.read(target, "b/two"))
+}
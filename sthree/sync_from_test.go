@@ -10,6 +10,7 @@ import (
 	"github.com/satori/go.uuid"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
 )
 
 // SyncFromSuite contains tests of some of the more specific behaviors
@@ -40,7 +41,7 @@ func (s *SyncFromSuite) SetupSuite() {
 
 func (s *SyncFromSuite) SetupTest() {
 	s.bucket = GetBucket("build-test-curator")
-	s.job = &syncFromJob{b: s.bucket, Base: &job.Base{}}
+	s.job = &syncFromJob{b: s.bucket, ctx: context.Background(), Base: &job.Base{}}
 }
 
 func (s *SyncFromSuite) TearDownTest() {
@@ -48,7 +49,7 @@ func (s *SyncFromSuite) TearDownTest() {
 }
 
 func (s *SyncFromSuite) TearDownSuite() {
-	s.NoError(s.bucket.DeletePrefix(s.uuid))
+	s.NoError(s.bucket.DeletePrefix(context.Background(), s.uuid))
 	for _, fn := range s.toDelete {
 		if _, err := os.Stat(fn); !os.IsNotExist(err) {
 			s.NoError(os.Remove(fn))
@@ -106,7 +107,7 @@ func (s *SyncFromSuite) TestSyncWithoutDeleteDoesNotRemoveFile() {
 	s.job.localPath = s.writeToTempFile()
 	s.job.remoteFile = s3.Key{Key: "NO-EXISTS"}
 
-	exists, err := s.bucket.Exists(s.job.remoteFile.Key)
+	exists, err := s.bucket.Exists(context.Background(), s.job.remoteFile.Key)
 	s.NoError(err)
 	s.False(exists)
 
@@ -114,7 +115,7 @@ func (s *SyncFromSuite) TestSyncWithoutDeleteDoesNotRemoveFile() {
 	s.job.Run()
 	s.NoError(s.job.Error())
 
-	exists, err = s.bucket.Exists(s.job.remoteFile.Key)
+	exists, err = s.bucket.Exists(context.Background(), s.job.remoteFile.Key)
 	s.NoError(err)
 	s.False(exists)
 	_, err = os.Stat(s.job.localPath)
@@ -0,0 +1,256 @@
+package sthree
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/goamz/goamz/aws"
+	"github.com/goamz/goamz/s3"
+	"github.com/mongodb/curator/sthree/fakes3"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+// SyncJournalSuite tests sync operations that resume from journals,
+// using a fake S3 server.
+type SyncJournalSuite struct {
+	srv     *fakes3.Server
+	b       *Bucket
+	local   string
+	require *require.Assertions
+	suite.Suite
+}
+
+func TestSyncJournalSuite(t *testing.T) {
+	suite.Run(t, new(SyncJournalSuite))
+}
+
+func (s *SyncJournalSuite) SetupSuite() {
+	s.require = s.Require()
+}
+
+func (s *SyncJournalSuite) SetupTest() {
+	s.srv = fakes3.NewServer()
+	auth := aws.Auth{AccessKey: "fake", SecretKey: "fake"}
+
+	s.b = &Bucket{
+		name:    "journal",
+		numJobs: 2,
+		retry:   RetryPolicy{MaxAttempts: 1},
+		storage: NewS3Storage(s3.New(auth, s.srv.Region()).Bucket("journal")),
+	}
+	s.b.SetSyncJournal(true)
+	s.require.NoError(s.b.Open(context.Background()))
+
+	local, err := ioutil.TempDir("", uuid.NewV4().String())
+	s.require.NoError(err)
+	s.local = local
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		s.require.NoError(ioutil.WriteFile(filepath.Join(s.local, name), []byte(name), 0644))
+	}
+}
+
+func (s *SyncJournalSuite) TearDownTest() {
+	s.b.Close()
+	s.srv.Close()
+	s.NoError(os.RemoveAll(s.local))
+}
+
+// reopen replaces the queue of the bucket, as the results of a queue
+// include the errors of the jobs of earlier operations.
+func (s *SyncJournalSuite) reopen() {
+	s.b.Close()
+	s.require.NoError(s.b.Open(context.Background()))
+}
+
+func (s *SyncJournalSuite) journalPath(operation string) string {
+	return filepath.Join(s.local, syncJournalFileName(operation))
+}
+
+// interruptedPush writes the journal of a push of the local directory
+// that completed a.txt, and was uploading b.txt.
+func (s *SyncJournalSuite) interruptedPush(prefix string) {
+	journal, err := openSyncJournal(s.local,
+		syncJournalHeader{Operation: "push", Bucket: "journal", Prefix: prefix})
+	s.require.NoError(err)
+
+	info, err := os.Stat(filepath.Join(s.local, "a.txt"))
+	s.require.NoError(err)
+
+	journal.queued("repo/a.txt")
+	journal.queued("repo/b.txt")
+	journal.complete("repo/a.txt", pushVersion(info))
+	journal.close(false)
+}
+
+func (s *SyncJournalSuite) TestSuccessfulSyncRemovesJournal() {
+	report, err := s.b.SyncTo(context.Background(), s.local, "repo", false)
+	s.require.NoError(err)
+	s.Equal(3, report.Count(SyncUpload))
+
+	_, err = os.Stat(s.journalPath("push"))
+	s.True(os.IsNotExist(err))
+	s.Len(s.srv.Keys("journal"), 3)
+}
+
+func (s *SyncJournalSuite) TestPushResumesFromJournal() {
+	s.interruptedPush("repo")
+
+	report, err := s.b.SyncTo(context.Background(), s.local, "repo", false)
+	s.require.NoError(err)
+	s.Equal(1, report.Count(SyncSkipCompleted))
+	s.Equal(2, report.Count(SyncUpload))
+	s.Equal([]string{"repo/b.txt", "repo/c.txt"}, s.srv.Keys("journal"))
+
+	_, err = os.Stat(s.journalPath("push"))
+	s.True(os.IsNotExist(err))
+}
+
+func (s *SyncJournalSuite) TestPushUploadsFilesChangedSinceTheyCompleted() {
+	s.interruptedPush("repo")
+
+	path := filepath.Join(s.local, "a.txt")
+	s.require.NoError(ioutil.WriteFile(path, []byte("changed"), 0644))
+
+	report, err := s.b.SyncTo(context.Background(), s.local, "repo", false)
+	s.require.NoError(err)
+	s.Equal(0, report.Count(SyncSkipCompleted))
+	s.Equal(3, report.Count(SyncUpload))
+}
+
+func (s *SyncJournalSuite) TestJournalsOfOtherOperationsStartOver() {
+	s.interruptedPush("other")
+
+	report, err := s.b.SyncTo(context.Background(), s.local, "repo", false)
+	s.require.NoError(err)
+	s.Equal(0, report.Count(SyncSkipCompleted))
+	s.Equal(3, report.Count(SyncUpload))
+}
+
+func (s *SyncJournalSuite) TestFailedSyncKeepsJournal() {
+	s.srv.FailRequestsWith(1, http.StatusForbidden, "AccessDenied", func(r *http.Request) bool {
+		return r.Method == "PUT" && strings.HasSuffix(r.URL.Path, "/c.txt")
+	})
+
+	report, err := s.b.SyncTo(context.Background(), s.local, "repo", false)
+	s.Error(err)
+	s.Equal(1, report.Count(SyncFailed))
+
+	data, err := ioutil.ReadFile(s.journalPath("push"))
+	s.require.NoError(err)
+	s.Len(strings.Split(strings.TrimSpace(string(data)), "\n"), 6)
+
+	s.reopen()
+	report, err = s.b.SyncTo(context.Background(), s.local, "repo", false)
+	s.require.NoError(err)
+	s.Equal(2, report.Count(SyncSkipCompleted))
+	s.Equal(1, report.Count(SyncUpload))
+
+	_, err = os.Stat(s.journalPath("push"))
+	s.True(os.IsNotExist(err))
+}
+
+func (s *SyncJournalSuite) TestPartialEntriesAreIgnored() {
+	s.interruptedPush("repo")
+
+	f, err := os.OpenFile(s.journalPath("push"), os.O_WRONLY|os.O_APPEND, 0644)
+	s.require.NoError(err)
+	_, err = f.WriteString(`{"key":"repo/c.txt","sta`)
+	s.require.NoError(err)
+	s.require.NoError(f.Close())
+
+	header := syncJournalHeader{Operation: "push", Bucket: "journal", Prefix: "repo"}
+	journal, err := openSyncJournal(s.local, header)
+	s.require.NoError(err)
+	s.Len(journal.completed, 1)
+	journal.complete("repo/c.txt", "1:2")
+	journal.close(false)
+
+	journal, err = openSyncJournal(s.local, header)
+	s.require.NoError(err)
+	defer journal.close(true)
+	s.Len(journal.completed, 2)
+	s.True(journal.isComplete("repo/c.txt", "1:2"))
+	s.False(journal.isComplete("repo/c.txt", "1:3"))
+}
+
+func (s *SyncJournalSuite) TestPullResumesFromJournal() {
+	_, err := s.b.SyncTo(context.Background(), s.local, "repo", false)
+	s.require.NoError(err)
+
+	dest := filepath.Join(s.local, "pull")
+	s.srv.FailRequestsWith(1, http.StatusForbidden, "AccessDenied", func(r *http.Request) bool {
+		return r.Method == "GET" && strings.HasSuffix(r.URL.Path, "/a.txt")
+	})
+
+	report, err := s.b.SyncFrom(context.Background(), dest, "repo", false)
+	s.Error(err)
+	s.Equal(2, report.Count(SyncDownload))
+	s.Equal(1, report.Count(SyncFailed))
+
+	// the resumed pull skips the objects that the first pull
+	// downloaded, but only if their local files are intact.
+	s.require.NoError(ioutil.WriteFile(filepath.Join(dest, "b.txt"), []byte("truncated"), 0644))
+
+	s.reopen()
+	report, err = s.b.SyncFrom(context.Background(), dest, "repo", false)
+	s.require.NoError(err)
+	s.Equal(1, report.Count(SyncSkipCompleted))
+	s.Equal(2, report.Count(SyncDownload))
+
+	_, err = os.Stat(filepath.Join(dest, syncJournalFileName("pull")))
+	s.True(os.IsNotExist(err))
+
+	data, err := ioutil.ReadFile(filepath.Join(dest, "b.txt"))
+	s.NoError(err)
+	s.Equal("b.txt", string(data))
+}
+
+func (s *SyncJournalSuite) TestJournalsAreNeverUploaded() {
+	s.interruptedPush("other")
+
+	_, err := s.b.SyncTo(context.Background(), s.local, "repo", false)
+	s.require.NoError(err)
+	for _, key := range s.srv.Keys("journal") {
+		s.False(strings.Contains(key, SyncJournalFilePrefix), key)
+	}
+
+	_, err = os.Stat(s.journalPath("push"))
+	s.True(os.IsNotExist(err))
+}
+
+func (s *SyncJournalSuite) TestDryRunsAndDisabledJournalsDoNotWriteJournals() {
+	dryRun, err := s.b.DryRunClone()
+	s.require.NoError(err)
+	defer dryRun.Close()
+
+	s.srv.FailRequests(1, func(r *http.Request) bool { return r.Method == "HEAD" })
+	_, err = dryRun.SyncTo(context.Background(), s.local, "repo", false)
+	s.Error(err)
+	_, err = os.Stat(s.journalPath("push"))
+	s.True(os.IsNotExist(err))
+
+	s.b.SetSyncJournal(false)
+	s.srv.FailRequests(1, func(r *http.Request) bool { return r.Method == "PUT" })
+	_, err = s.b.SyncTo(context.Background(), s.local, "repo", false)
+	s.Error(err)
+	_, err = os.Stat(s.journalPath("push"))
+	s.True(os.IsNotExist(err))
+}
+
+func (s *SyncJournalSuite) TestVersions() {
+	info, err := os.Stat(filepath.Join(s.local, "a.txt"))
+	s.require.NoError(err)
+	s.True(strings.HasPrefix(pushVersion(info), "5:"))
+
+	s.Equal(`"abc":10`,
+		pullVersion(s3.Key{ETag: `"abc"`, Size: 10, LastModified: time.Now().String()}))
+}
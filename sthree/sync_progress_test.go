@@ -0,0 +1,210 @@
+package sthree
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+// SyncProgressSuite tests the progress updates of sync operations
+// with local storage.
+type SyncProgressSuite struct {
+	root    string
+	local   string
+	b       *Bucket
+	updates []SyncProgress
+	mutex   sync.Mutex
+	require *require.Assertions
+	suite.Suite
+}
+
+func TestSyncProgressSuite(t *testing.T) {
+	suite.Run(t, new(SyncProgressSuite))
+}
+
+func (s *SyncProgressSuite) SetupSuite() {
+	s.require = s.Require()
+}
+
+func (s *SyncProgressSuite) SetupTest() {
+	root, err := ioutil.TempDir("", uuid.NewV4().String())
+	s.require.NoError(err)
+	s.root = root
+	s.local = filepath.Join(root, "local")
+	s.updates = nil
+
+	for name, content := range map[string]string{
+		"a.txt":     "one",
+		"dir/b.txt": "second",
+		"c.html":    "html",
+	} {
+		fileName := filepath.Join(s.local, name)
+		s.require.NoError(os.MkdirAll(filepath.Dir(fileName), 0755))
+		s.require.NoError(ioutil.WriteFile(fileName, []byte(content), 0644))
+	}
+
+	s.b = &Bucket{
+		name:    "progress",
+		numJobs: 2,
+		retry:   RetryPolicy{MaxAttempts: 1},
+		storage: NewFileSystemStorage(filepath.Join(root, "bucket")),
+	}
+
+	filter := NewFilter()
+	s.require.NoError(filter.Exclude("*.html"))
+	s.b.SetFilter(filter)
+	s.b.SetProgressHandler(0, s.record)
+	s.require.NoError(s.b.Open(context.Background()))
+}
+
+func (s *SyncProgressSuite) TearDownTest() {
+	s.b.Close()
+	s.NoError(os.RemoveAll(s.root))
+}
+
+func (s *SyncProgressSuite) record(p SyncProgress) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.updates = append(s.updates, p)
+}
+
+func (s *SyncProgressSuite) last() SyncProgress {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.require.NotEmpty(s.updates)
+	return s.updates[len(s.updates)-1]
+}
+
+func (s *SyncProgressSuite) TestPushReportsFinalProgress() {
+	_, err := s.b.SyncTo(context.Background(), s.local, "prefix", false)
+	s.require.NoError(err)
+
+	s.Len(s.updates, 1)
+	p := s.last()
+	s.Equal("push", p.Operation)
+	s.Equal("progress", p.Bucket)
+	s.Equal(3, p.Considered)
+	s.Equal(2, p.Queued)
+	s.Equal(2, p.Completed)
+	s.Equal(0, p.Failed)
+	s.Equal(int64(9), p.Bytes)
+	s.Equal(int64(9), p.QueuedBytes)
+	s.True(p.Scanned)
+	s.True(p.Done)
+
+	eta, ok := p.ETA()
+	s.True(ok)
+	s.Equal(time.Duration(0), eta)
+}
+
+func (s *SyncProgressSuite) TestPullReportsFinalProgress() {
+	_, err := s.b.SyncTo(context.Background(), s.local, "prefix", false)
+	s.require.NoError(err)
+
+	_, err = s.b.SyncFrom(context.Background(), filepath.Join(s.root, "target"), "prefix", false)
+	s.require.NoError(err)
+
+	p := s.last()
+	s.Equal("pull", p.Operation)
+	s.Equal(2, p.Considered)
+	s.Equal(2, p.Queued)
+	s.Equal(2, p.Completed)
+	s.Equal(int64(9), p.Bytes)
+	s.True(p.Done)
+}
+
+func (s *SyncProgressSuite) TestPeriodicUpdates() {
+	s.b.SetProgressHandler(time.Millisecond, s.record)
+	report := newSyncReport(s.b, "push", "prefix")
+	progress := s.b.trackProgress(report)
+	s.require.NotNil(progress)
+
+	progress.consider()
+	progress.queue(3)
+	report.add(SyncReportItem{Key: "prefix/a.txt", Action: SyncUpload, Bytes: 3})
+	time.Sleep(20 * time.Millisecond)
+	progress.stop()
+
+	// items recorded after the operation stops do not count.
+	report.add(SyncReportItem{Key: "prefix/b.txt", Action: SyncDelete})
+
+	s.mutex.Lock()
+	s.True(len(s.updates) > 1)
+	for _, p := range s.updates[:len(s.updates)-1] {
+		s.False(p.Done)
+	}
+	s.mutex.Unlock()
+
+	p := s.last()
+	s.True(p.Done)
+	s.Equal(1, p.Completed)
+	s.Equal(int64(3), p.Bytes)
+}
+
+func (s *SyncProgressSuite) TestCanceledOperationsReportProgress() {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := s.b.SyncTo(ctx, s.local, "prefix", false)
+	s.Error(err)
+
+	p := s.last()
+	s.True(p.Done)
+	s.Equal(0, p.Completed)
+}
+
+func (s *SyncProgressSuite) TestNoHandlerDoesNotTrackProgress() {
+	s.b.SetProgressHandler(time.Millisecond, nil)
+	report := newSyncReport(s.b, "push", "prefix")
+	s.Nil(s.b.trackProgress(report))
+	s.Nil(report.progress)
+
+	report.add(SyncReportItem{Key: "a"})
+	s.Len(s.updates, 0)
+}
+
+func (s *SyncProgressSuite) TestETAEstimatesRemainingTime() {
+	p := SyncProgress{Queued: 10, Completed: 2, Elapsed: 4 * time.Second}
+	_, ok := p.ETA()
+	s.False(ok)
+
+	p.Scanned = true
+	eta, ok := p.ETA()
+	s.True(ok)
+	s.Equal(16*time.Second, eta)
+
+	p.Completed = 0
+	_, ok = p.ETA()
+	s.False(ok)
+}
+
+func (s *SyncProgressSuite) TestStringSummarizesProgress() {
+	p := SyncProgress{
+		Operation:  "pull",
+		Bucket:     "bucket",
+		Prefix:     "repo",
+		Considered: 12,
+		Queued:     10,
+		Completed:  5,
+		Failed:     1,
+		Bytes:      2048,
+		Elapsed:    10*time.Second + time.Millisecond,
+		Scanned:    true,
+	}
+
+	out := p.String()
+	s.True(strings.HasPrefix(out, "sync pull bucket/repo: 5/10 done (1 failed)"), out)
+	s.Contains(out, "elapsed 10s")
+	s.Contains(out, "eta 10s")
+}
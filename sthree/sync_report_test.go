@@ -0,0 +1,146 @@
+package sthree
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+// SyncReportSuite tests the reports of sync operations with local
+// storage.
+type SyncReportSuite struct {
+	root    string
+	local   string
+	b       *Bucket
+	require *require.Assertions
+	suite.Suite
+}
+
+func TestSyncReportSuite(t *testing.T) {
+	suite.Run(t, new(SyncReportSuite))
+}
+
+func (s *SyncReportSuite) SetupSuite() {
+	s.require = s.Require()
+}
+
+func (s *SyncReportSuite) SetupTest() {
+	root, err := ioutil.TempDir("", uuid.NewV4().String())
+	s.require.NoError(err)
+	s.root = root
+	s.local = filepath.Join(root, "local")
+
+	for name, content := range map[string]string{"a.txt": "one", "dir/b.txt": "second"} {
+		fileName := filepath.Join(s.local, name)
+		s.require.NoError(os.MkdirAll(filepath.Dir(fileName), 0755))
+		s.require.NoError(ioutil.WriteFile(fileName, []byte(content), 0644))
+	}
+
+	s.b = &Bucket{
+		name:    "report",
+		numJobs: 2,
+		retry:   RetryPolicy{MaxAttempts: 1},
+		storage: NewFileSystemStorage(filepath.Join(root, "bucket")),
+	}
+	s.require.NoError(s.b.Open(context.Background()))
+}
+
+func (s *SyncReportSuite) TearDownTest() {
+	s.b.Close()
+	s.NoError(os.RemoveAll(s.root))
+}
+
+func (s *SyncReportSuite) TestPushReportsUploadsAndSkippedFiles() {
+	report, err := s.b.SyncTo(context.Background(), s.local, "prefix", false)
+	s.require.NoError(err)
+	s.Equal("push", report.Operation)
+	s.Equal("report", report.Bucket)
+	s.Equal(s.local, report.Local)
+	s.False(report.End.Before(report.Start))
+
+	s.require.Len(report.Items, 2)
+	s.Equal("prefix/a.txt", report.Items[0].Key)
+	s.Equal(SyncUpload, report.Items[0].Action)
+	s.Equal(int64(3), report.Items[0].Bytes)
+	s.Equal("prefix/dir/b.txt", report.Items[1].Key)
+	s.Equal(2, report.Count(SyncUpload))
+	s.Equal(int64(9), report.Bytes())
+
+	report, err = s.b.SyncTo(context.Background(), s.local, "prefix", false)
+	s.require.NoError(err)
+	s.Equal(0, report.Count(SyncUpload))
+	s.Equal(2, report.Count(SyncSkipIdentical))
+	s.Equal(int64(0), report.Bytes())
+}
+
+func (s *SyncReportSuite) TestDryRunReportIsAPlan() {
+	s.b.dryRun = true
+	report, err := s.b.SyncTo(context.Background(), s.local, "prefix", false)
+	s.require.NoError(err)
+	s.True(report.DryRun)
+	s.Equal(2, report.Count(SyncUpload))
+	s.Equal(int64(9), report.Bytes())
+
+	listing, err := s.b.List(context.Background(), "prefix", true)
+	s.require.NoError(err)
+	s.Len(listing.Objects, 0)
+}
+
+func (s *SyncReportSuite) TestPullReportsDownloadsAndDeletes() {
+	_, err := s.b.SyncTo(context.Background(), s.local, "prefix", false)
+	s.require.NoError(err)
+	s.require.NoError(s.b.Delete(context.Background(), "prefix/a.txt"))
+
+	report, err := s.b.SyncFrom(context.Background(), s.local, "prefix", true)
+	s.require.NoError(err)
+	s.Equal("pull", report.Operation)
+	s.Equal(1, report.Count(SyncSkipIdentical))
+
+	target := filepath.Join(s.root, "target")
+	report, err = s.b.SyncFrom(context.Background(), target, "prefix", false)
+	s.require.NoError(err)
+	s.require.Len(report.Items, 1)
+	s.Equal(SyncDownload, report.Items[0].Action)
+	s.Equal(filepath.Join(target, "dir", "b.txt"), report.Items[0].Path)
+	s.Equal(int64(6), report.Items[0].Bytes)
+}
+
+func (s *SyncReportSuite) TestFailedItemsRecordErrors() {
+	report := newSyncReport(s.b, "push", "prefix")
+	report.record("b", "", SyncUpload, 10, time.Now(), errors.New("failure"))
+	report.record("a", "", SyncUpload, 10, time.Now(), nil)
+	report.finish(context.Background())
+
+	s.Equal(1, report.Count(SyncFailed))
+	s.Equal(int64(10), report.Bytes())
+	s.Equal("a", report.Items[0].Key)
+	s.Equal("failure", report.Items[1].Error)
+	s.Equal(int64(0), report.Items[1].Bytes)
+
+	var nilReport *SyncReport
+	nilReport.record("a", "", SyncUpload, 10, time.Now(), nil)
+}
+
+func (s *SyncReportSuite) TestWriteJSON() {
+	report, err := s.b.SyncTo(context.Background(), s.local, "prefix", false)
+	s.require.NoError(err)
+
+	out := &bytes.Buffer{}
+	s.require.NoError(report.WriteJSON(out))
+
+	decoded := &SyncReport{}
+	s.require.NoError(json.Unmarshal(out.Bytes(), decoded))
+	s.Equal(report.Operation, decoded.Operation)
+	s.Equal(report.Items, decoded.Items)
+	s.Contains(out.String(), `"action": "upload"`)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/satori/go.uuid"
 	"github.com/stretchr/testify/require"
 	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
 )
 
 // SyncToSuite contains tests of some of the more specific behaviors
@@ -46,22 +47,22 @@ func (s *SyncToSuite) SetupSuite() {
 
 func (s *SyncToSuite) SetupTest() {
 	s.bucket = GetBucket("build-test-curator")
-	s.job = &syncToJob{b: s.bucket, Base: &job.Base{}}
+	s.job = &syncToJob{b: s.bucket, ctx: context.Background(), Base: &job.Base{}}
 }
 
 func (s *SyncToSuite) TearDownTest() {
-	s.NoError(s.bucket.DeletePrefix(s.uuid))
+	s.NoError(s.bucket.DeletePrefix(context.Background(), s.uuid))
 	s.bucket.Close()
 }
 
 func (s *SyncToSuite) TearDownSuite() {
-	s.NoError(s.bucket.DeletePrefix(s.uuid))
+	s.NoError(s.bucket.DeletePrefix(context.Background(), s.uuid))
 	for _, fn := range s.toDelete {
 		if _, err := os.Stat(fn); !os.IsNotExist(err) {
 			s.NoError(os.Remove(fn))
 		}
 	}
-	s.NoError(s.bucket.DeletePrefix(s.uuid))
+	s.NoError(s.bucket.DeletePrefix(context.Background(), s.uuid))
 }
 
 func (s *SyncToSuite) writeToTempFile() string {
@@ -82,7 +83,7 @@ func (s *SyncToSuite) writeToTempFile() string {
 func (s *SyncToSuite) TestSyncWithoutDeleteLeavesRemoteFile() {
 	file := s.writeToTempFile()
 	key := filepath.Join(s.uuid, file)
-	s.NoError(s.bucket.Put(file, key))
+	s.NoError(s.bucket.Put(context.Background(), file, key))
 
 	s.NoError(s.job.Error())
 	s.job.remoteFile = s3.Key{Key: key}
@@ -93,7 +94,7 @@ func (s *SyncToSuite) TestSyncWithoutDeleteLeavesRemoteFile() {
 	s.job.Run()
 	s.NoError(s.job.Error())
 
-	exists, err := s.bucket.Exists(key)
+	exists, err := s.bucket.Exists(context.Background(), key)
 	s.NoError(err)
 	s.True(exists)
 }
@@ -103,7 +104,7 @@ func (s *SyncToSuite) TestSyncWithDeleteRemovesRemoteFile() {
 	s.bucket.dryRun = false
 	file := s.writeToTempFile()
 	key := filepath.Join(s.uuid, file)
-	s.NoError(s.bucket.Put(file, key))
+	s.NoError(s.bucket.Put(context.Background(), file, key))
 
 	s.NoError(s.job.Error())
 	s.job.remoteFile = s3.Key{Key: key}
@@ -114,7 +115,7 @@ func (s *SyncToSuite) TestSyncWithDeleteRemovesRemoteFile() {
 	s.job.Run()
 	s.NoError(s.job.Error())
 
-	exists, err := s.bucket.Exists(key)
+	exists, err := s.bucket.Exists(context.Background(), key)
 	s.NoError(err)
 	s.False(exists)
 }
@@ -124,7 +125,7 @@ func (s *SyncToSuite) TestSyncWithDeleteAndDryRunDoesNotRemovesRemoteFile() {
 	s.job.b.dryRun = true
 	file := s.writeToTempFile()
 	key := filepath.Join(s.uuid, file)
-	s.NoError(s.bucket.Put(file, key))
+	s.NoError(s.bucket.Put(context.Background(), file, key))
 
 	s.NoError(s.job.Error())
 	s.job.remoteFile = s3.Key{Key: key}
@@ -135,7 +136,7 @@ func (s *SyncToSuite) TestSyncWithDeleteAndDryRunDoesNotRemovesRemoteFile() {
 	s.job.Run()
 	s.NoError(s.job.Error())
 
-	exists, err := s.bucket.Exists(key)
+	exists, err := s.bucket.Exists(context.Background(), key)
 	s.NoError(err)
 	s.False(exists)
 }
@@ -144,7 +145,7 @@ func (s *SyncToSuite) TestSyncWithoutDeleteAndDryRunDoesNotRemovesRemoteFile() {
 	s.job.withDelete = false
 	file := s.writeToTempFile()
 	key := filepath.Join(s.uuid, file)
-	s.NoError(s.bucket.Put(file, key))
+	s.NoError(s.bucket.Put(context.Background(), file, key))
 
 	s.NoError(s.job.Error())
 	s.job.remoteFile = s3.Key{Key: key}
@@ -156,7 +157,7 @@ func (s *SyncToSuite) TestSyncWithoutDeleteAndDryRunDoesNotRemovesRemoteFile() {
 	s.job.Run()
 	s.NoError(s.job.Error())
 
-	exists, err := s.bucket.Exists(key)
+	exists, err := s.bucket.Exists(context.Background(), key)
 	s.NoError(err)
 	s.True(exists)
 }
@@ -176,11 +177,11 @@ func (s *SyncToSuite) TestSyncPutsNewFileIntoBucket() {
 		s.NoError(s.job.Error())
 	}
 
-	exists, err := s.bucket.Exists(key)
+	exists, err := s.bucket.Exists(context.Background(), key)
 	s.NoError(err)
 	s.True(exists)
 
-	s.Len(s.bucket.contents(s.uuid), 1)
+	s.Len(s.bucket.contents(context.Background(), s.uuid), 1)
 }
 
 func (s *SyncToSuite) TestSyncUploadsNewFileOverWrites() {
@@ -207,6 +208,6 @@ func (s *SyncToSuite) TestSyncUploadsNewFileOverWrites() {
 			fmt.Println(err)
 		}
 
-		s.Len(s.bucket.contents(s.uuid), 1)
+		s.Len(s.bucket.contents(context.Background(), s.uuid), 1)
 	}
 }
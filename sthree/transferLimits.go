@@ -0,0 +1,238 @@
+package sthree
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/context"
+)
+
+// maxLimitedRead is the largest read that a bandwidth limited reader
+// makes at once, so that transfers wait in short intervals rather
+// than sending bursts of data.
+const maxLimitedRead = 32 * 1024
+
+// bandwidthLimiter paces the transfers that share it to an aggregate
+// rate. Each read reserves time in a schedule, at the limiter's rate,
+// and waits until its reservation starts, so that concurrent transfers
+// divide the bandwidth between them. A nil limiter does not limit
+// transfers.
+type bandwidthLimiter struct {
+	bytesPerSecond int64
+	next           time.Time
+	mutex          sync.Mutex
+}
+
+func newBandwidthLimiter(bytesPerSecond int64) *bandwidthLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+
+	return &bandwidthLimiter{bytesPerSecond: bytesPerSecond}
+}
+
+// limit returns the rate of the limiter, or 0 for nil limiters.
+func (l *bandwidthLimiter) limit() int64 {
+	if l == nil {
+		return 0
+	}
+
+	return l.bytesPerSecond
+}
+
+// wait blocks until the transfer of n more bytes is within the rate,
+// or until the context is canceled.
+func (l *bandwidthLimiter) wait(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+
+	l.mutex.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.bytesPerSecond))
+	l.mutex.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+
+	return wait(ctx, delay)
+}
+
+// limitedReader paces reads from a reader with a bandwidth limiter.
+type limitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *bandwidthLimiter
+}
+
+func newLimitedReader(ctx context.Context, l *bandwidthLimiter, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+
+	return &limitedReader{ctx: ctx, r: r, limiter: l}
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > maxLimitedRead {
+		p = p[:maxLimitedRead]
+	}
+
+	n, err := r.r.Read(p)
+	if waitErr := r.limiter.wait(r.ctx, n); waitErr != nil {
+		return n, waitErr
+	}
+
+	return n, err
+}
+
+// limitedReadSeeker is a limitedReader for the parts of multipart
+// uploads. The S3 client reads each part twice, first to compute the
+// checksum of the part and then to send it, so the reader only counts
+// bytes beyond the furthest offset that it has read.
+type limitedReadSeeker struct {
+	limitedReader
+	s        io.Seeker
+	offset   int64
+	furthest int64
+}
+
+func newLimitedReadSeeker(ctx context.Context, l *bandwidthLimiter, r io.ReadSeeker) io.ReadSeeker {
+	if l == nil {
+		return r
+	}
+
+	return &limitedReadSeeker{limitedReader: limitedReader{ctx: ctx, r: r, limiter: l}, s: r}
+}
+
+func (r *limitedReadSeeker) Read(p []byte) (int, error) {
+	if len(p) > maxLimitedRead {
+		p = p[:maxLimitedRead]
+	}
+
+	n, err := r.r.Read(p)
+	r.offset += int64(n)
+
+	if r.offset > r.furthest {
+		charge := r.offset - r.furthest
+		r.furthest = r.offset
+
+		if waitErr := r.limiter.wait(r.ctx, int(charge)); waitErr != nil {
+			return n, waitErr
+		}
+	}
+
+	return n, err
+}
+
+func (r *limitedReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.s.Seek(offset, whence)
+	if err == nil {
+		r.offset = pos
+	}
+
+	return pos, err
+}
+
+// requestLimiter is a semaphore that limits the number of concurrent
+// requests. A nil limiter does not limit requests.
+type requestLimiter chan struct{}
+
+func newRequestLimiter(n int) requestLimiter {
+	if n <= 0 {
+		return nil
+	}
+
+	return make(requestLimiter, n)
+}
+
+// acquire blocks until a request may start, or until the context is
+// canceled, and returns a function that releases the request.
+func (l requestLimiter) acquire(ctx context.Context) (func(), error) {
+	if l == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case l <- struct{}{}:
+		return func() { <-l }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// SetBandwidthLimit limits the aggregate rate, in bytes per second,
+// of the uploads and downloads of the bucket, including all of the
+// bucket's sync jobs and clones. A limit of 0 removes the limit.
+// Callers should set the limit before starting operations, as
+// transfers in progress keep the limit that they started with.
+func (b *Bucket) SetBandwidthLimit(bytesPerSecond int64) error {
+	if bytesPerSecond < 0 {
+		return errors.Errorf("bandwidth limit=%d, must not be negative", bytesPerSecond)
+	}
+
+	b.bandwidth = newBandwidthLimiter(bytesPerSecond)
+	return nil
+}
+
+// BandwidthLimit returns the bucket's bandwidth limit, in bytes per
+// second, or 0 if the bucket does not limit its bandwidth.
+func (b *Bucket) BandwidthLimit() int64 {
+	return b.bandwidth.limit()
+}
+
+// SetMaxRequests limits the number of requests that the bucket's
+// operations, including all of the bucket's sync jobs and clones,
+// send to S3 at once, independently of the number of workers (see
+// SetNumJobs.) Uploads and downloads count as requests until the
+// transfer completes. A limit of 0 removes the limit. Callers should
+// set the limit before starting operations.
+func (b *Bucket) SetMaxRequests(n int) error {
+	if n < 0 {
+		return errors.Errorf("maxRequests=%d, must not be negative", n)
+	}
+
+	b.requests = newRequestLimiter(n)
+	return nil
+}
+
+// MaxRequests returns the maximum number of concurrent requests of
+// the bucket, or 0 if the bucket does not limit requests.
+func (b *Bucket) MaxRequests() int {
+	return cap(b.requests)
+}
+
+// request runs an operation that sends a request to the storage
+// backend, once the bucket's request limit allows another request.
+// withRetries already runs each attempt with request, so only
+// operations that do not retry call request directly, and operations
+// must never nest calls to request.
+func (b *Bucket) request(ctx context.Context, op func() error) error {
+	release, err := b.requests.acquire(ctx)
+	if err != nil {
+		return errors.Wrap(err, "canceled while waiting to send request")
+	}
+	defer release()
+
+	return op()
+}
+
+// transferReader wraps the content of an upload or download so that
+// reads stop once the context is canceled, and respect the bucket's
+// bandwidth limit.
+func (b *Bucket) transferReader(ctx context.Context, r io.Reader) io.Reader {
+	return newLimitedReader(ctx, b.bandwidth, newContextReader(ctx, r))
+}
+
+// transferReadSeeker is transferReader for the parts of multipart
+// uploads.
+func (b *Bucket) transferReadSeeker(ctx context.Context, r io.ReadSeeker) io.ReadSeeker {
+	return newLimitedReadSeeker(ctx, b.bandwidth, newContextReadSeeker(ctx, r))
+}
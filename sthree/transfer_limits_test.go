@@ -0,0 +1,160 @@
+package sthree
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/satori/go.uuid"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+// TransferLimitsSuite tests the bandwidth and request limits of
+// buckets, using local storage.
+type TransferLimitsSuite struct {
+	b       *Bucket
+	tempDir string
+	require *require.Assertions
+	suite.Suite
+}
+
+func TestTransferLimitsSuite(t *testing.T) {
+	suite.Run(t, new(TransferLimitsSuite))
+}
+
+func (s *TransferLimitsSuite) SetupSuite() {
+	s.require = s.Require()
+}
+
+func (s *TransferLimitsSuite) SetupTest() {
+	tempDir, err := ioutil.TempDir("", uuid.NewV4().String())
+	s.require.NoError(err)
+	s.tempDir = tempDir
+
+	s.b = &Bucket{
+		name:    "limits",
+		numJobs: 2,
+		retry:   RetryPolicy{MaxAttempts: 1},
+		storage: NewFileSystemStorage(filepath.Join(tempDir, "storage")),
+	}
+}
+
+func (s *TransferLimitsSuite) TearDownTest() {
+	s.NoError(os.RemoveAll(s.tempDir))
+}
+
+func (s *TransferLimitsSuite) TestLimitsRejectNegativeValues() {
+	s.Error(s.b.SetBandwidthLimit(-1))
+	s.Error(s.b.SetMaxRequests(-1))
+	s.Equal(int64(0), s.b.BandwidthLimit())
+	s.Equal(0, s.b.MaxRequests())
+
+	s.NoError(s.b.SetBandwidthLimit(1024))
+	s.NoError(s.b.SetMaxRequests(4))
+	s.Equal(int64(1024), s.b.BandwidthLimit())
+	s.Equal(4, s.b.MaxRequests())
+
+	s.NoError(s.b.SetBandwidthLimit(0))
+	s.NoError(s.b.SetMaxRequests(0))
+	s.Nil(s.b.bandwidth)
+	s.Nil(s.b.requests)
+}
+
+func (s *TransferLimitsSuite) TestClonesShareLimits() {
+	s.require.NoError(s.b.SetBandwidthLimit(1024))
+	s.require.NoError(s.b.SetMaxRequests(4))
+
+	clone, err := s.b.Clone()
+	s.require.NoError(err)
+	s.True(clone.bandwidth == s.b.bandwidth)
+	s.Equal(s.b.requests, clone.requests)
+
+	other := s.b.NewBucket("limits-other")
+	defer buckets.removeBucket(other)
+	s.False(other.bandwidth == s.b.bandwidth)
+	s.Equal(int64(1024), other.BandwidthLimit())
+	s.Equal(4, other.MaxRequests())
+}
+
+func (s *TransferLimitsSuite) TestBandwidthLimiterPacesReads() {
+	data := make([]byte, 4*maxLimitedRead)
+	limiter := newBandwidthLimiter(int64(len(data)))
+
+	start := time.Now()
+	out, err := ioutil.ReadAll(newLimitedReader(context.Background(), limiter, bytes.NewReader(data)))
+	s.NoError(err)
+	s.Len(out, len(data))
+
+	// the first read does not wait, so reading the data takes at
+	// least three quarters of a second.
+	s.True(time.Since(start) >= 700*time.Millisecond)
+}
+
+func (s *TransferLimitsSuite) TestBandwidthLimiterStopsWhenCanceled() {
+	limiter := newBandwidthLimiter(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	s.NoError(limiter.wait(ctx, 1))
+	s.Error(limiter.wait(ctx, 1))
+}
+
+func (s *TransferLimitsSuite) TestRereadingPartsIsNotCharged() {
+	data := make([]byte, 2*maxLimitedRead)
+	limiter := newBandwidthLimiter(1024 * 1024 * 1024)
+	r := newLimitedReadSeeker(context.Background(), limiter, bytes.NewReader(data))
+
+	_, err := ioutil.ReadAll(r)
+	s.NoError(err)
+	next := limiter.next
+
+	_, err = r.Seek(0, 0)
+	s.NoError(err)
+	_, err = ioutil.ReadAll(r)
+	s.NoError(err)
+	s.Equal(next, limiter.next)
+}
+
+func (s *TransferLimitsSuite) TestRequestLimitBlocksRequests() {
+	s.require.NoError(s.b.SetMaxRequests(1))
+
+	started := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		s.NoError(s.b.request(context.Background(), func() error {
+			close(started)
+			<-done
+			return nil
+		}))
+	}()
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	s.Error(s.b.request(ctx, func() error { return nil }))
+
+	close(done)
+	s.NoError(s.b.request(context.Background(), func() error { return nil }))
+}
+
+func (s *TransferLimitsSuite) TestLimitedTransfers() {
+	s.require.NoError(s.b.SetBandwidthLimit(1024 * 1024))
+	s.require.NoError(s.b.SetMaxRequests(1))
+
+	fileName := filepath.Join(s.tempDir, "file.txt")
+	s.require.NoError(ioutil.WriteFile(fileName, []byte("limited"), 0644))
+
+	s.NoError(s.b.Put(context.Background(), fileName, "a/file.txt"))
+	s.NoError(s.b.Get(context.Background(), "a/file.txt", filepath.Join(s.tempDir, "out.txt")))
+
+	data, err := ioutil.ReadFile(filepath.Join(s.tempDir, "out.txt"))
+	s.NoError(err)
+	s.Equal("limited", string(data))
+
+	s.NoError(s.b.Delete(context.Background(), "a/file.txt"))
+}
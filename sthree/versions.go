@@ -0,0 +1,305 @@
+package sthree
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/tychoish/grip"
+	"golang.org/x/net/context"
+)
+
+// ObjectVersion describes a version of an object in a versioned
+// bucket, or a delete marker, which is the version of a key that
+// records that the object was deleted.
+type ObjectVersion struct {
+	Key          string    `json:"key"`
+	VersionID    string    `json:"version_id"`
+	IsLatest     bool      `json:"is_latest"`
+	DeleteMarker bool      `json:"delete_marker,omitempty"`
+	LastModified time.Time `json:"last_modified"`
+	Size         int64     `json:"size"`
+	ETag         string    `json:"etag,omitempty"`
+}
+
+// versionChange is a change that RestoreTo or Undelete makes to a key:
+// restoring a version, deleting the current object, or removing delete
+// markers.
+type versionChange struct {
+	key     string
+	action  SyncAction
+	version ObjectVersion
+	markers []ObjectVersion
+}
+
+// versionStorage returns the storage of the bucket, if it keeps
+// versions of objects.
+func (b *Bucket) versionStorage() (VersionStorage, error) {
+	storage, ok := b.storage.(VersionStorage)
+	if !ok {
+		return nil, errors.Errorf("the storage of bucket %s does not support versions", b.name)
+	}
+
+	return storage, nil
+}
+
+// ListVersions returns the versions and delete markers of the objects
+// with the prefix, sorted by key and then newest first. Buckets without
+// versioning list their objects as the only versions of their keys,
+// with "null" version IDs. Returns an error if the storage of the
+// bucket does not support versions.
+func (b *Bucket) ListVersions(ctx context.Context, prefix string) ([]ObjectVersion, error) {
+	storage, err := b.versionStorage()
+	if err != nil {
+		return nil, err
+	}
+
+	var out []ObjectVersion
+	var keyMarker, versionMarker string
+	for {
+		var page *VersionPage
+		err = b.withRetries(ctx, fmt.Sprintf("list versions %s/%s", b.name, prefix), func() error {
+			var err error
+			page, err = storage.ListVersions(prefix, keyMarker, versionMarker, 1000)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		out = append(out, page.Versions...)
+
+		if page.NextKeyMarker == "" {
+			return out, nil
+		}
+
+		keyMarker, versionMarker = page.NextKeyMarker, page.NextVersionMarker
+	}
+}
+
+// versionHistories returns the versions of each object with the prefix
+// that matches the filter of the bucket, newest first, in key order.
+func (b *Bucket) versionHistories(ctx context.Context, prefix string) ([][]ObjectVersion, error) {
+	versions, err := b.ListVersions(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var histories [][]ObjectVersion
+	for idx, version := range versions {
+		if !b.filter.Match(version.Key[len(prefix):]) {
+			continue
+		}
+
+		if idx == 0 || versions[idx-1].Key != version.Key {
+			histories = append(histories, nil)
+		}
+
+		last := len(histories) - 1
+		histories[last] = append(histories[last], version)
+	}
+
+	return histories, nil
+}
+
+// RestoreTo restores the objects with the prefix that match the filter
+// of the bucket to their state at the time: objects that changed since
+// get a copy of the version that was current at the time, with the
+// permissions that the ACL rules of the bucket, or its
+// NewFilePermission, determine, and objects created since, or deleted
+// at the time, are deleted. Restoring keeps all versions, so that the
+// restore is also reversible with RestoreTo. Returns a report of the
+// change to each object, and an error if the storage of the bucket
+// does not support versions, or if any change fails.
+func (b *Bucket) RestoreTo(ctx context.Context, prefix string, at time.Time) (*SyncReport, error) {
+	grip.Infof("restoring %s/%s to %s", b.name, prefix, at.Format(time.RFC3339))
+
+	storage, err := b.versionStorage()
+	if err != nil {
+		return nil, err
+	}
+
+	report := newSyncReport(b, "restore", prefix)
+	histories, err := b.versionHistories(ctx, prefix)
+	if err != nil {
+		return report, err
+	}
+
+	var changes []versionChange
+	for _, history := range histories {
+		current := history[0]
+		change := versionChange{key: current.Key, action: SyncSkipIdentical}
+
+		var target *ObjectVersion
+		for idx := range history {
+			if !history[idx].LastModified.After(at) {
+				target = &history[idx]
+				break
+			}
+		}
+
+		switch {
+		case target == nil || target.DeleteMarker:
+			if !current.DeleteMarker {
+				change.action = SyncDelete
+			}
+		case current.DeleteMarker || current.ETag != target.ETag || current.Size != target.Size:
+			change.action = SyncRestore
+			change.version = *target
+		}
+
+		changes = append(changes, change)
+	}
+
+	err = b.applyVersionChanges(ctx, storage, report, changes)
+	report.finish(ctx)
+
+	return report, err
+}
+
+// Undelete restores the deleted objects with the prefix that match the
+// filter of the bucket, by removing the delete markers that are the
+// latest versions of their keys, which makes the versions that were
+// current when the objects were deleted current again. Returns a report
+// of the objects that Undelete restored, and an error if the storage of
+// the bucket does not support versions, or if removing any delete
+// marker fails.
+func (b *Bucket) Undelete(ctx context.Context, prefix string) (*SyncReport, error) {
+	grip.Infof("undeleting objects in %s/%s", b.name, prefix)
+
+	storage, err := b.versionStorage()
+	if err != nil {
+		return nil, err
+	}
+
+	report := newSyncReport(b, "undelete", prefix)
+	histories, err := b.versionHistories(ctx, prefix)
+	if err != nil {
+		return report, err
+	}
+
+	var changes []versionChange
+	for _, history := range histories {
+		// deleting a deleted object adds another delete marker,
+		// so remove all of the latest delete markers.
+		var markers []ObjectVersion
+		for _, version := range history {
+			if !version.DeleteMarker {
+				break
+			}
+			markers = append(markers, version)
+		}
+
+		// objects with only delete markers have no version to
+		// restore.
+		if len(markers) == 0 || len(markers) == len(history) {
+			continue
+		}
+
+		changes = append(changes, versionChange{
+			key:     history[0].Key,
+			action:  SyncUndelete,
+			version: history[len(markers)],
+			markers: markers,
+		})
+	}
+
+	err = b.applyVersionChanges(ctx, storage, report, changes)
+	report.finish(ctx)
+
+	return report, err
+}
+
+// applyVersionChanges makes the changes, using as many concurrent
+// requests as the bucket has jobs, and records each change in the
+// report. In dry-run mode, the report is the plan of the changes.
+func (b *Bucket) applyVersionChanges(ctx context.Context, storage VersionStorage,
+	report *SyncReport, changes []versionChange) error {
+	queue := make(chan versionChange)
+	go func() {
+		defer close(queue)
+		for _, change := range changes {
+			select {
+			case queue <- change:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	numWorkers := b.numJobs
+	if numWorkers < 1 {
+		numWorkers = 1
+	}
+
+	catcher := grip.NewCatcher()
+	wg := &sync.WaitGroup{}
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for change := range queue {
+				start := time.Now()
+
+				var size int64
+				if change.action != SyncDelete {
+					size = change.version.Size
+				}
+
+				if change.action == SyncSkipIdentical || b.dryRun {
+					grip.NoticeWhenf(b.dryRun && change.action != SyncSkipIdentical,
+						"dry-run: would %s %s/%s", change.action, b.name, change.key)
+					report.record(change.key, "", change.action, size, start, nil)
+					continue
+				}
+
+				err := b.applyVersionChange(ctx, storage, change)
+				catcher.Add(err)
+				report.record(change.key, "", change.action, size, start, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		catcher.Add(errors.Wrapf(err, "%s of %s/%s canceled", report.Operation, b.name, report.Prefix))
+	}
+
+	return catcher.Resolve()
+}
+
+func (b *Bucket) applyVersionChange(ctx context.Context, storage VersionStorage,
+	change versionChange) error {
+	key := change.key
+	description := fmt.Sprintf("%s %s/%s", change.action, b.name, key)
+
+	var err error
+	switch change.action {
+	case SyncRestore:
+		err = b.withRetries(ctx, description, func() error {
+			return storage.RestoreVersion(key, change.version.VersionID, b.permission(key), b.encryption)
+		})
+	case SyncDelete:
+		err = b.withRetries(ctx, description, func() error {
+			return storage.Delete(key)
+		})
+	case SyncUndelete:
+		for _, marker := range change.markers {
+			id := marker.VersionID
+			err = b.withRetries(ctx, description, func() error {
+				return storage.DeleteVersion(key, id)
+			})
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	grip.Debugf("%s %s/%s (version %s)", change.action, b.name, key, change.version.VersionID)
+	return nil
+}
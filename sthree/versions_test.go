@@ -0,0 +1,254 @@
+package sthree
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/goamz/goamz/aws"
+	"github.com/goamz/goamz/s3"
+	"github.com/mongodb/curator/sthree/fakes3"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/context"
+)
+
+// VersionsSuite tests listing, restoring, and undeleting the versions
+// of objects, using a fake S3 server with a versioned bucket.
+type VersionsSuite struct {
+	srv     *fakes3.Server
+	s3      *s3.Bucket
+	b       *Bucket
+	require *require.Assertions
+	suite.Suite
+}
+
+func TestVersionsSuite(t *testing.T) {
+	suite.Run(t, new(VersionsSuite))
+}
+
+func (s *VersionsSuite) SetupSuite() {
+	s.require = s.Require()
+}
+
+func (s *VersionsSuite) SetupTest() {
+	s.srv = fakes3.NewServer()
+	s.srv.EnableVersioning("versions")
+	auth := aws.Auth{AccessKey: "fake", SecretKey: "fake"}
+	s.s3 = s3.New(auth, s.srv.Region()).Bucket("versions")
+
+	s.b = &Bucket{
+		name:              "versions",
+		numJobs:           2,
+		retry:             RetryPolicy{MaxAttempts: 1},
+		NewFilePermission: s3.PublicRead,
+		storage:           NewS3Storage(s.s3),
+	}
+	s.require.NoError(s.b.Open(context.Background()))
+}
+
+func (s *VersionsSuite) TearDownTest() {
+	s.b.Close()
+	s.srv.Close()
+}
+
+func (s *VersionsSuite) put(key, content string) {
+	s.require.NoError(s.s3.Put(key, []byte(content), "text/plain", s3.Private, s3.Options{}))
+}
+
+func (s *VersionsSuite) get(key string) string {
+	data, err := s.s3.Get(key)
+	s.require.NoError(err)
+	return string(data)
+}
+
+// checkpoint returns a time between the versions of objects written
+// before and after the call, which have modification times with
+// millisecond precision.
+func (s *VersionsSuite) checkpoint() time.Time {
+	time.Sleep(10 * time.Millisecond)
+	at := time.Now()
+	time.Sleep(10 * time.Millisecond)
+
+	return at
+}
+
+func (s *VersionsSuite) TestListVersions() {
+	s.put("repo/a", "one")
+	s.put("repo/a", "two")
+	s.put("repo/b", "one")
+	s.require.NoError(s.s3.Del("repo/b"))
+	s.put("other", "one")
+
+	versions, err := s.b.ListVersions(context.Background(), "repo/")
+	s.require.NoError(err)
+	s.require.Len(versions, 4)
+
+	s.Equal("repo/a", versions[0].Key)
+	s.True(versions[0].IsLatest)
+	s.Equal(int64(3), versions[0].Size)
+	s.Equal("repo/a", versions[1].Key)
+	s.False(versions[1].IsLatest)
+	s.NotEqual(versions[0].VersionID, versions[1].VersionID)
+
+	s.Equal("repo/b", versions[2].Key)
+	s.True(versions[2].DeleteMarker)
+	s.True(versions[2].IsLatest)
+	s.False(versions[2].LastModified.IsZero())
+	s.False(versions[3].DeleteMarker)
+}
+
+func (s *VersionsSuite) TestListVersionsPages() {
+	for i := 0; i < 3; i++ {
+		s.put("a", "content")
+		s.put("b", "content")
+	}
+
+	storage := s.b.storage.(VersionStorage)
+	page, err := storage.ListVersions("", "", "", 4)
+	s.require.NoError(err)
+	s.Len(page.Versions, 4)
+	s.Equal("b", page.NextKeyMarker)
+	s.Equal(page.Versions[3].VersionID, page.NextVersionMarker)
+
+	page, err = storage.ListVersions("", page.NextKeyMarker, page.NextVersionMarker, 4)
+	s.require.NoError(err)
+	s.Len(page.Versions, 2)
+	s.Equal("", page.NextKeyMarker)
+}
+
+func (s *VersionsSuite) TestRestoreToTime() {
+	s.put("repo/changed", "one")
+	s.put("repo/deleted", "one")
+	s.put("repo/unchanged", "one")
+	at := s.checkpoint()
+
+	s.put("repo/changed", "two")
+	s.require.NoError(s.s3.Del("repo/deleted"))
+	s.put("repo/created", "two")
+	s.put("other", "two")
+
+	report, err := s.b.RestoreTo(context.Background(), "repo/", at)
+	s.require.NoError(err)
+	s.Equal(2, report.Count(SyncRestore))
+	s.Equal(1, report.Count(SyncDelete))
+	s.Equal(1, report.Count(SyncSkipIdentical))
+
+	s.Equal([]string{"other", "repo/changed", "repo/deleted", "repo/unchanged"},
+		s.srv.Keys("versions"))
+	s.Equal("one", s.get("repo/changed"))
+	s.Equal("one", s.get("repo/deleted"))
+	s.Equal("public-read", s.srv.ACL("versions", "repo/changed"))
+	s.Len(s.srv.Versions("versions", "repo/unchanged"), 1)
+
+	// restoring keeps the versions of the changes, so the restore
+	// can be undone.
+	report, err = s.b.RestoreTo(context.Background(), "repo/", time.Now())
+	s.require.NoError(err)
+	s.Equal(0, report.Count(SyncRestore))
+
+	report, err = s.b.RestoreTo(context.Background(), "repo/", time.Now().Add(-time.Hour))
+	s.require.NoError(err)
+	s.Equal(3, report.Count(SyncDelete))
+	s.Equal([]string{"other"}, s.srv.Keys("versions"))
+}
+
+func (s *VersionsSuite) TestRestoreHonorsFilterAndDryRun() {
+	s.put("repo/a.txt", "one")
+	s.put("repo/b.rpm", "one")
+	at := s.checkpoint()
+	s.put("repo/a.txt", "two")
+	s.put("repo/b.rpm", "two")
+
+	dryRun, err := s.b.DryRunClone()
+	s.require.NoError(err)
+	defer dryRun.Close()
+
+	report, err := dryRun.RestoreTo(context.Background(), "repo/", at)
+	s.require.NoError(err)
+	s.True(report.DryRun)
+	s.Equal(2, report.Count(SyncRestore))
+	s.Equal("two", s.get("repo/a.txt"))
+
+	filter := NewFilter()
+	s.require.NoError(filter.Include("*.rpm"))
+	s.b.SetFilter(filter)
+
+	report, err = s.b.RestoreTo(context.Background(), "repo/", at)
+	s.require.NoError(err)
+	s.Equal(1, report.Count(SyncRestore))
+	s.Equal("two", s.get("repo/a.txt"))
+	s.Equal("one", s.get("repo/b.rpm"))
+}
+
+func (s *VersionsSuite) TestUndelete() {
+	s.put("repo/a", "one")
+	s.put("repo/a", "two")
+	s.require.NoError(s.s3.Del("repo/a"))
+	s.require.NoError(s.s3.Del("repo/a"))
+	s.require.NoError(s.s3.Del("repo/never-existed"))
+	s.put("repo/current", "one")
+
+	report, err := s.b.Undelete(context.Background(), "repo/")
+	s.require.NoError(err)
+	s.Equal(1, report.Count(SyncUndelete))
+	s.Len(report.Items, 1)
+	s.Equal(int64(3), report.Bytes())
+
+	s.Equal([]string{"repo/a", "repo/current"}, s.srv.Keys("versions"))
+	s.Equal("two", s.get("repo/a"))
+	s.Len(s.srv.Versions("versions", "repo/a"), 2)
+}
+
+func (s *VersionsSuite) TestChangesWithOneRequestAtATime() {
+	s.require.NoError(s.b.SetMaxRequests(1))
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	s.put("repo/a", "one")
+	s.put("repo/b", "one")
+	at := s.checkpoint()
+	s.put("repo/a", "two")
+	s.require.NoError(s.s3.Del("repo/b"))
+
+	report, err := s.b.RestoreTo(ctx, "repo/", at)
+	s.require.NoError(err)
+	s.Equal(2, report.Count(SyncRestore))
+
+	s.require.NoError(s.s3.Del("repo/a"))
+	report, err = s.b.Undelete(ctx, "repo/")
+	s.require.NoError(err)
+	s.Equal(1, report.Count(SyncUndelete))
+	s.Equal([]string{"repo/a", "repo/b"}, s.srv.Keys("versions"))
+}
+
+func (s *VersionsSuite) TestFailedChangesAreReported() {
+	s.put("repo/a", "one")
+	s.require.NoError(s.s3.Del("repo/a"))
+
+	s.srv.FailRequestsWith(1, http.StatusForbidden, "AccessDenied", func(r *http.Request) bool {
+		return r.Method == "DELETE"
+	})
+
+	report, err := s.b.Undelete(context.Background(), "repo/")
+	s.Error(err)
+	s.Equal(1, report.Count(SyncFailed))
+	s.Len(s.srv.Keys("versions"), 0)
+}
+
+func (s *VersionsSuite) TestLocalStorageDoesNotSupportVersions() {
+	dir, err := ioutil.TempDir("", "versions-test")
+	s.require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	s.b.SetStorage(NewFileSystemStorage(dir))
+
+	_, err = s.b.ListVersions(context.Background(), "")
+	s.Error(err)
+	_, err = s.b.RestoreTo(context.Background(), "", time.Now())
+	s.Error(err)
+	_, err = s.b.Undelete(context.Background(), "")
+	s.Error(err)
+}